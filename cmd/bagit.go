@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/bagit"
+	"file-clone-validator/core/checksum"
+	"file-clone-validator/core/utils"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+var (
+	bagitMetaPath       string
+	bagitDir            string
+	bagitAlgorithms     []string
+	bagitSourceDir      string
+	bagitInfo           []string
+	bagitValidatorCount int
+	bagitReportPath     string
+	bagitReportFormat   string
+
+	BagitCmd = &cobra.Command{
+		Use:   "bagit",
+		Short: "Create and validate BagIt bags",
+	}
+
+	BagitCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Write the manifests and tag files of a bag from a metadata file",
+		Long: "Write manifest-<algorithm>.txt, bagit.txt, bag-info.txt and tagmanifest-<algorithm>.txt of a bag from a " +
+			"metadata file generated on its data directory. The files are read from the source directory when the " +
+			"metadata file does not record their hash with an algorithm of the bag",
+		Example: "./binary generate --source /bag/data --output ./output && " +
+			"./binary bagit create --meta ./output/meta.out --bag /bag --algorithm sha256 --info 'Source-Organization: Example'",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if bagitMetaPath == "" || bagitDir == "" {
+				return fmt.Errorf("metadata file path and bag directory must be specified. got metadata file path: %s, "+
+					"bag directory: %s", bagitMetaPath, bagitDir)
+			}
+			for _, algorithm := range bagitAlgorithms {
+				if !checksum.SupportedAlgorithm(algorithm) {
+					return fmt.Errorf("invalid hash algorithm: %s. expect [%s|%s|%s|%s]", algorithm, utils.HashMD5,
+						utils.HashSHA1, utils.HashSHA256, utils.HashSHA512)
+				}
+			}
+			for _, info := range bagitInfo {
+				if _, err := bagit.ParseTag(info); err != nil {
+					return err
+				}
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("MetaFilePath", bagitMetaPath),
+				slog.String("BagDir", bagitDir),
+				slog.Any("Algorithms", bagitAlgorithms),
+				slog.String("SourceDir", bagitSourceDir),
+				slog.Any("Info", bagitInfo),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+
+			opts := bagit.CreateOptions{Algorithms: bagitAlgorithms, SourceDir: bagitSourceDir}
+			for _, info := range bagitInfo {
+				tag, _ := bagit.ParseTag(info)
+				opts.Info = append(opts.Info, tag)
+			}
+			if _, err := bagit.Create(ctx, bagitMetaPath, bagitDir, opts); err != nil {
+				return fmt.Errorf("failed to create bag: %w", err)
+			}
+			return nil
+		},
+	}
+
+	BagitValidateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate a bag against its manifests",
+		Long: "Validate the files listed by the payload and tag manifests of a bag, report the files of the data " +
+			"directory which are not listed by a payload manifest, and check the Payload-Oxum of bag-info.txt",
+		Example: "./binary bagit validate --bag /bag --report ./error_report.txt",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if bagitDir == "" {
+				return fmt.Errorf("bag directory must be specified")
+			}
+			if bagitValidatorCount <= 0 {
+				return fmt.Errorf("validator count must be greater than 0. got %d", bagitValidatorCount)
+			}
+			if bagitReportFormat != validator.ReportFormatText && bagitReportFormat != validator.ReportFormatJSON {
+				return fmt.Errorf("invalid report format: %s. expect [text|json]", bagitReportFormat)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("BagDir", bagitDir),
+				slog.Int("ValidatorCount", bagitValidatorCount),
+				slog.String("ReportPath", bagitReportPath),
+				slog.String("ReportFormat", bagitReportFormat),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+			startMetricsServer(ctx)
+
+			reporter, err := validator.NewReporter(bagitReportPath)
+			if err != nil {
+				return fmt.Errorf("failed to create reporter: %w", err)
+			}
+			defer reporter.Flush()
+			if err = reporter.SetFormat(bagitReportFormat); err != nil {
+				return err
+			}
+
+			result, err := bagit.Validate(ctx, bagitDir, reporter, bagitValidatorCount)
+			if err != nil {
+				return err
+			}
+
+			findings := reporter.Counts()
+			slog.Info("Finish to validate bag:",
+				slog.String("Version", result.Version),
+				slog.Any("Manifests", result.Manifests),
+				slog.Any("Findings", findings),
+				slog.Bool("Passed", len(findings) == 0),
+			)
+			return nil
+		},
+	}
+)
+
+func initBagitCmd() {
+	BagitCreateCmd.PersistentFlags().StringVarP(&bagitMetaPath, "meta", "m", "", "the metadata file generated on the data directory of the bag")
+	BagitCreateCmd.PersistentFlags().StringVarP(&bagitDir, "bag", "b", "", "the root directory of the bag, where the tag files are written")
+	BagitCreateCmd.PersistentFlags().StringSliceVar(&bagitAlgorithms, "algorithm", []string{utils.HashMD5}, fmt.Sprintf("the hash algorithms of the manifests [%s|%s|%s|%s]", utils.HashMD5, utils.HashSHA1, utils.HashSHA256, utils.HashSHA512))
+	BagitCreateCmd.PersistentFlags().StringVarP(&bagitSourceDir, "source", "s", "", "the directory to read the files to rehash from. the source directory of the metadata file if empty")
+	BagitCreateCmd.PersistentFlags().StringArrayVar(&bagitInfo, "info", nil, "a \"Label: Value\" line added to bag-info.txt. can be repeated")
+	addThrottleFlags(BagitCreateCmd)
+	BagitValidateCmd.PersistentFlags().StringVarP(&bagitDir, "bag", "b", "", "the root directory of the bag to validate")
+	BagitValidateCmd.PersistentFlags().IntVarP(&bagitValidatorCount, "validator", "v", 16, "the number of validators to use")
+	BagitValidateCmd.PersistentFlags().StringVar(&bagitReportPath, "report", "./error_report.txt", "the path to write the error report to")
+	BagitValidateCmd.PersistentFlags().StringVar(&bagitReportFormat, "report-format", validator.ReportFormatText, "the format of the error report. the json format is read by repair. [text|json]")
+	addThrottleFlags(BagitValidateCmd)
+	addMetricsFlags(BagitValidateCmd)
+	BagitCmd.AddCommand(BagitCreateCmd, BagitValidateCmd)
+}
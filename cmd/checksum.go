@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/checksum"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+)
+
+var (
+	checksumFormat    string
+	checksumListPath  string
+	checksumRoot      string
+	checksumOutputDir string
+	checksumMetaPath  string
+	checksumAlgorithm string
+	checksumSourceDir string
+	checksumListOut   string
+
+	ChecksumCmd = &cobra.Command{
+		Use:   "checksum",
+		Short: "Convert between metadata files and md5sum, sha256sum or hashdeep checksum lists",
+	}
+
+	ChecksumImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Convert a checksum list to a metadata file",
+		Long: "Convert an md5sum, sha256sum or hashdeep checksum list to a metadata file written to the output " +
+			"directory. The relative paths of the list are joined to the root directory and the absolute paths must be " +
+			"under it. The validation only compares the content and, for hashdeep, the size of the listed files",
+		Example: "./binary checksum import --format md5sum --list ./MD5SUMS --root /data --output ./output\n" +
+			"./binary checksum import --format hashdeep --list ./audit.txt --root /data --output ./output",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if !checksum.ValidFormat(checksumFormat) {
+				return fmt.Errorf("invalid checksum format: %s. expect [%s|%s|%s]", checksumFormat,
+					checksum.FormatMD5Sum, checksum.FormatSHA256Sum, checksum.FormatHashdeep)
+			}
+			if checksumListPath == "" || checksumRoot == "" || checksumOutputDir == "" {
+				return fmt.Errorf("checksum list, root directory and output directory must be specified. got "+
+					"checksum list: %s, root directory: %s, output directory: %s", checksumListPath, checksumRoot,
+					checksumOutputDir)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("Format", checksumFormat),
+				slog.String("ListPath", checksumListPath),
+				slog.String("Root", checksumRoot),
+				slog.String("OutputDir", checksumOutputDir),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			_, err := checksum.Import(ctx, checksumListPath, checksumFormat, checksumRoot, checksumOutputDir)
+			return err
+		},
+	}
+
+	ChecksumExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Convert a metadata file to a checksum list",
+		Long: "Convert the regular files of a metadata file to an md5sum, sha256sum or hashdeep checksum list, with " +
+			"their paths relative to the source directory so that it can be checked from the root of the target. The " +
+			"files are read from the source directory when the metadata file does not record the hash of the list",
+		Example: "./binary checksum export --format md5sum --meta ./output/meta.out --output ./MD5SUMS && cd /target && md5sum -c ./MD5SUMS\n" +
+			"./binary checksum export --format hashdeep --algorithm sha256 --meta ./output/meta.out --output ./audit.txt",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if !checksum.ValidFormat(checksumFormat) {
+				return fmt.Errorf("invalid checksum format: %s. expect [%s|%s|%s]", checksumFormat,
+					checksum.FormatMD5Sum, checksum.FormatSHA256Sum, checksum.FormatHashdeep)
+			}
+			if checksumMetaPath == "" {
+				return fmt.Errorf("metadata file path must be specified")
+			}
+			if checksumAlgorithm != utils.HashMD5 && checksumAlgorithm != utils.HashSHA256 {
+				return fmt.Errorf("invalid hash algorithm: %s. expect [%s|%s]", checksumAlgorithm, utils.HashMD5,
+					utils.HashSHA256)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("Format", checksumFormat),
+				slog.String("MetaFilePath", checksumMetaPath),
+				slog.String("Algorithm", checksumAlgorithm),
+				slog.String("SourceDir", checksumSourceDir),
+				slog.String("OutputPath", checksumListOut),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+
+			var out io.Writer = cmd.OutOrStdout()
+			if checksumListOut != "" {
+				file, err := os.Create(checksumListOut)
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %w", err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			count, err := checksum.Write(ctx, checksumMetaPath, out, checksum.WriteOptions{
+				Format:    checksumFormat,
+				Algorithm: checksumAlgorithm,
+				SourceDir: checksumSourceDir,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to export metadata file: %w", err)
+			}
+
+			slog.Info("Finish to export checksum list:",
+				slog.String("MetaFilePath", checksumMetaPath),
+				slog.String("OutputPath", checksumListOut),
+				slog.Uint64("FileCount", count),
+			)
+			return nil
+		},
+	}
+)
+
+func initChecksumCmd() {
+	ChecksumImportCmd.PersistentFlags().StringVarP(&checksumFormat, "format", "f", checksum.FormatMD5Sum, fmt.Sprintf("the format of the checksum list [%s|%s|%s]", checksum.FormatMD5Sum, checksum.FormatSHA256Sum, checksum.FormatHashdeep))
+	ChecksumImportCmd.PersistentFlags().StringVarP(&checksumListPath, "list", "l", "", "the checksum list to import")
+	ChecksumImportCmd.PersistentFlags().StringVarP(&checksumRoot, "root", "p", "", "the directory the checksum list describes, recorded as the source directory of the metadata file")
+	ChecksumImportCmd.PersistentFlags().StringVarP(&checksumOutputDir, "output", "o", "./output", "the directory to write the metadata file to")
+	ChecksumExportCmd.PersistentFlags().StringVarP(&checksumFormat, "format", "f", checksum.FormatMD5Sum, fmt.Sprintf("the format of the checksum list [%s|%s|%s]", checksum.FormatMD5Sum, checksum.FormatSHA256Sum, checksum.FormatHashdeep))
+	ChecksumExportCmd.PersistentFlags().StringVarP(&checksumMetaPath, "meta", "m", "", "the metadata file to export")
+	ChecksumExportCmd.PersistentFlags().StringVar(&checksumAlgorithm, "algorithm", utils.HashMD5, fmt.Sprintf("the hash algorithm of a hashdeep list [%s|%s]", utils.HashMD5, utils.HashSHA256))
+	ChecksumExportCmd.PersistentFlags().StringVarP(&checksumSourceDir, "source", "s", "", "the directory to read the files to rehash from. the source directory of the metadata file if empty")
+	ChecksumExportCmd.PersistentFlags().StringVarP(&checksumListOut, "output", "o", "", "the output file. stdout if empty")
+	addThrottleFlags(ChecksumExportCmd)
+	ChecksumCmd.AddCommand(ChecksumImportCmd, ChecksumExportCmd)
+}
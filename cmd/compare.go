@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/validator"
+	"file-clone-validator/pkg/clonevalidator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+var (
+	compareSourceDir    string
+	compareTargetDir    string
+	compareScannerCount int
+	compareReaderCount  int
+	compareReportPath   string
+	compareReportFormat string
+	compareContent      string
+
+	CompareCmd = &cobra.Command{
+		Use:   "compare",
+		Short: "Compare two directory trees directly",
+		Long: "Walk the source and the target directories concurrently and compare their metadata in one pass, without " +
+			"writing and reading back a metadata file. Both trees must be mounted on this host. The content of the files is " +
+			"compared by their MD5 hash, or byte for byte with --content bytes",
+		Example: "./binary compare --source /mnt/src --target /mnt/dst --report ./compare_report.txt\n" +
+			"./binary compare --source /mnt/src --target /mnt/dst --content bytes --reader 8",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if compareSourceDir == "" || compareTargetDir == "" {
+				return fmt.Errorf("source and target directory must be specified. got source: %s, target: %s",
+					compareSourceDir, compareTargetDir)
+			}
+			if compareScannerCount <= 0 || compareReaderCount <= 0 {
+				return fmt.Errorf("scanner and reader count must be greater than 0. got scanner: %d, reader: %d",
+					compareScannerCount, compareReaderCount)
+			}
+			if compareReportFormat != validator.ReportFormatText && compareReportFormat != validator.ReportFormatJSON {
+				return fmt.Errorf("invalid report format: %s. expect [text|json]", compareReportFormat)
+			}
+			if compareContent != validator.ContentHash && compareContent != validator.ContentBytes {
+				return fmt.Errorf("invalid content comparison: %s. expect [%s|%s]", compareContent,
+					validator.ContentHash, validator.ContentBytes)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("SourceDir", compareSourceDir),
+				slog.String("TargetDir", compareTargetDir),
+				slog.Int("ScannerCount", compareScannerCount),
+				slog.Int("ReaderCount", compareReaderCount),
+				slog.String("ReportPath", compareReportPath),
+				slog.String("ReportFormat", compareReportFormat),
+				slog.String("Content", compareContent),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+			startMetricsServer(ctx)
+
+			result, err := clonevalidator.Compare(ctx, clonevalidator.CompareOptions{
+				SourceDir:    compareSourceDir,
+				TargetDir:    compareTargetDir,
+				ScannerCount: compareScannerCount,
+				ReaderCount:  compareReaderCount,
+				ReportPath:   compareReportPath,
+				ReportFormat: compareReportFormat,
+				Content:      compareContent,
+			})
+			if err != nil {
+				return err
+			}
+
+			slog.Info("Finish to compare:",
+				slog.Uint64("SourceCount", result.SourceCount),
+				slog.Uint64("TargetCount", result.TargetCount),
+				slog.Uint64("ComparedBytes", result.ComparedBytes),
+				slog.Any("Findings", result.Findings),
+				slog.Bool("Identical", result.Identical()),
+				slog.Duration("Duration", result.Duration),
+			)
+			return nil
+		},
+	}
+)
+
+func initCompareCmd() {
+	CompareCmd.PersistentFlags().StringVarP(&compareSourceDir, "source", "s", "", "the source directory")
+	CompareCmd.PersistentFlags().StringVarP(&compareTargetDir, "target", "t", "", "the target directory")
+	CompareCmd.PersistentFlags().IntVar(&compareScannerCount, "scanner", 4, "number of scanner to list the directories of each tree concurrently")
+	CompareCmd.PersistentFlags().IntVarP(&compareReaderCount, "reader", "r", 1, "number of reader to open and load the file meta of each tree")
+	CompareCmd.PersistentFlags().StringVar(&compareReportPath, "report", "./compare_report.txt", "the path to write the difference report to")
+	CompareCmd.PersistentFlags().StringVar(&compareReportFormat, "report-format", validator.ReportFormatText, "the format of the difference report. the json format is read by repair. [text|json]")
+	CompareCmd.PersistentFlags().StringVar(&compareContent, "content", validator.ContentHash, "how to compare the content of the files. bytes reads both files in parallel chunks instead of hashing them, and reports the offset of the first difference. [hash|bytes]")
+	addThrottleFlags(CompareCmd)
+	addMetricsFlags(CompareCmd)
+}
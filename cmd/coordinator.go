@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"file-clone-validator/core/distributed"
+	"file-clone-validator/core/stream"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+var (
+	coordinatorMetaPath    string
+	coordinatorListenAddr  string
+	coordinatorBatchSize   int
+	coordinatorLeaseTTL    time.Duration
+	coordinatorMaxAttempts int
+	coordinatorReportPath  string
+	coordinatorSummaryPath string
+	clusterToken           string
+	clusterTLSCertPath     string
+	clusterTLSKeyPath      string
+
+	CoordinatorCmd = &cobra.Command{
+		Use:     "coordinator",
+		Short:   "Serve a metadata file to validation workers",
+		Long:    "Serve the entries of a metadata file to connected worker processes and collect their findings",
+		Example: "./binary coordinator --meta ./output/meta.out --listen :7070 --token secret --tls-cert ./cert.pem --tls-key ./key.pem",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if coordinatorMetaPath == "" || coordinatorListenAddr == "" {
+				return fmt.Errorf("metadata file path and listen address must be specified. "+
+					"got metadata file path: %s, listen address: %s", coordinatorMetaPath, coordinatorListenAddr)
+			}
+
+			if coordinatorBatchSize < 1 {
+				return fmt.Errorf("batch size must be greater than 0. got %d", coordinatorBatchSize)
+			}
+
+			if coordinatorLeaseTTL <= 0 {
+				return fmt.Errorf("lease timeout must be greater than 0. got %s", coordinatorLeaseTTL)
+			}
+
+			if coordinatorMaxAttempts < 1 {
+				return fmt.Errorf("max attempts must be greater than 0. got %d", coordinatorMaxAttempts)
+			}
+
+			if (clusterTLSCertPath == "") != (clusterTLSKeyPath == "") {
+				return fmt.Errorf("TLS certificate and key must be specified together. got certificate: %s, key: %s",
+					clusterTLSCertPath, clusterTLSKeyPath)
+			}
+
+			if clusterToken != "" && clusterTLSCertPath == "" {
+				return fmt.Errorf("token requires --tls-cert, it would be received in clear otherwise")
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("MetaFilePath", coordinatorMetaPath),
+				slog.String("ListenAddr", coordinatorListenAddr),
+				slog.Int("BatchSize", coordinatorBatchSize),
+				slog.Duration("LeaseTimeout", coordinatorLeaseTTL),
+				slog.Int("MaxAttempts", coordinatorMaxAttempts),
+				slog.String("TLSCertPath", clusterTLSCertPath),
+				slog.String("ReportPath", coordinatorReportPath),
+				slog.String("SummaryPath", coordinatorSummaryPath),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			startMetricsServer(ctx)
+
+			reporter, err := validator.NewReporter(coordinatorReportPath)
+			if err != nil {
+				return fmt.Errorf("failed to create reporter: %w", err)
+			}
+			defer reporter.Flush()
+
+			coordinator, err := distributed.NewCoordinator(coordinatorMetaPath, reporter, distributed.CoordinatorOptions{
+				BatchSize:    coordinatorBatchSize,
+				LeaseTimeout: coordinatorLeaseTTL,
+				Token:        clusterToken,
+				MaxAttempts:  coordinatorMaxAttempts,
+			})
+			if err != nil {
+				return err
+			}
+
+			ln, err := net.Listen("tcp", coordinatorListenAddr)
+			if err != nil {
+				return err
+			}
+			if clusterTLSCertPath != "" {
+				config, _err := stream.ServerTLSConfig(clusterTLSCertPath, clusterTLSKeyPath)
+				if _err != nil {
+					ln.Close()
+					return _err
+				}
+				ln = tls.NewListener(ln, config)
+			}
+
+			if err = coordinator.Serve(ctx, ln); err != nil {
+				return err
+			}
+
+			findings := reporter.Counts()
+			if coordinatorSummaryPath != "" {
+				header := coordinator.Header()
+				summary := &validator.Summary{
+					SourceDir: header.SourceDir,
+					ItemCount: coordinator.Counted(),
+					Findings:  findings,
+					Passed:    len(findings) == 0,
+				}
+				if summary.MetaFilePath, err = filepath.Abs(coordinatorMetaPath); err != nil {
+					return err
+				}
+				if coordinatorReportPath != "" {
+					if summary.ReportPath, err = filepath.Abs(coordinatorReportPath); err != nil {
+						return err
+					}
+				}
+				if err = validator.WriteSummary(coordinatorSummaryPath, summary); err != nil {
+					return fmt.Errorf("failed to write summary: %w", err)
+				}
+			}
+
+			slog.Info("Finish to validate:",
+				slog.Uint64("ItemCount", coordinator.Counted()),
+				slog.Any("Findings", findings),
+				slog.Bool("Passed", len(findings) == 0),
+			)
+			return nil
+		},
+	}
+)
+
+func initCoordinatorCmd() {
+	CoordinatorCmd.PersistentFlags().StringVarP(&coordinatorMetaPath, "meta", "m", "", "the metadata file path")
+	CoordinatorCmd.PersistentFlags().StringVarP(&coordinatorListenAddr, "listen", "l", ":7070", "the address to accept workers on")
+	CoordinatorCmd.PersistentFlags().IntVar(&coordinatorBatchSize, "batch", 256, "the number of entries in one lease")
+	CoordinatorCmd.PersistentFlags().DurationVar(&coordinatorLeaseTTL, "lease-timeout", 5*time.Minute, "how long a worker may hold a lease before it is reassigned")
+	CoordinatorCmd.PersistentFlags().IntVar(&coordinatorMaxAttempts, "max-attempts", distributed.DefaultMaxAttempts, "the number of times a lease is assigned before the validation fails, e.g. because no worker can validate it")
+	CoordinatorCmd.PersistentFlags().StringVar(&clusterToken, "token", "", "the shared secret the workers must present. any worker is accepted if empty. requires --tls-cert, as it is sent in clear otherwise")
+	CoordinatorCmd.PersistentFlags().StringVar(&clusterTLSCertPath, "tls-cert", "", "the PEM certificate to accept the workers with TLS. plain TCP if empty")
+	CoordinatorCmd.PersistentFlags().StringVar(&clusterTLSKeyPath, "tls-key", "", "the PEM private key of the certificate")
+	CoordinatorCmd.PersistentFlags().StringVar(&coordinatorReportPath, "report", "./error_report.txt", "the path to write the error report to")
+	CoordinatorCmd.PersistentFlags().StringVar(&coordinatorSummaryPath, "summary", "", "the path to write the json summary of the validation to")
+	addMetricsFlags(CoordinatorCmd)
+}
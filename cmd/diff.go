@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/pkg/clonevalidator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+var (
+	diffSourceMetaPath   string
+	diffTargetMetaPath   string
+	diffSourceMerklePath string
+	diffTargetMerklePath string
+	diffReportPath       string
+
+	DiffCmd = &cobra.Command{
+		Use:     "diff",
+		Short:   "Compare two metadata files",
+		Long:    "Compare the metadata files generated from the source and from the target, optionally skipping the identical subtrees of their merkle trees",
+		Example: "./binary diff --source ./src/meta.out --target ./dst/meta.out --source-merkle ./src/merkle.out --target-merkle ./dst/merkle.out",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if diffSourceMetaPath == "" || diffTargetMetaPath == "" {
+				return fmt.Errorf("source and target metadata file path must be specified. "+
+					"got source: %s, target: %s", diffSourceMetaPath, diffTargetMetaPath)
+			}
+
+			if (diffSourceMerklePath == "") != (diffTargetMerklePath == "") {
+				return fmt.Errorf("source and target merkle tree files must be specified together. "+
+					"got source: %s, target: %s", diffSourceMerklePath, diffTargetMerklePath)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("SourceMetaPath", diffSourceMetaPath),
+				slog.String("TargetMetaPath", diffTargetMetaPath),
+				slog.String("SourceMerklePath", diffSourceMerklePath),
+				slog.String("TargetMerklePath", diffTargetMerklePath),
+				slog.String("ReportPath", diffReportPath),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result, err := clonevalidator.Diff(context.Background(), clonevalidator.DiffOptions{
+				SourceMetaPath:   diffSourceMetaPath,
+				TargetMetaPath:   diffTargetMetaPath,
+				SourceMerklePath: diffSourceMerklePath,
+				TargetMerklePath: diffTargetMerklePath,
+				ReportPath:       diffReportPath,
+			})
+			if err != nil {
+				return err
+			}
+
+			slog.Info("Finish to diff:",
+				slog.Uint64("SourceCount", result.SourceCount),
+				slog.Uint64("TargetCount", result.TargetCount),
+				slog.Uint64("Skipped", result.Skipped),
+				slog.Any("Findings", result.Findings),
+				slog.Bool("Identical", result.Identical()),
+				slog.Duration("Duration", result.Duration),
+			)
+			return nil
+		},
+	}
+)
+
+func initDiffCmd() {
+	DiffCmd.PersistentFlags().StringVarP(&diffSourceMetaPath, "source", "s", "", "the metadata file of the source")
+	DiffCmd.PersistentFlags().StringVarP(&diffTargetMetaPath, "target", "t", "", "the metadata file of the target")
+	DiffCmd.PersistentFlags().StringVar(&diffSourceMerklePath, "source-merkle", "", "the merkle tree file of the source")
+	DiffCmd.PersistentFlags().StringVar(&diffTargetMerklePath, "target-merkle", "", "the merkle tree file of the target")
+	DiffCmd.PersistentFlags().StringVar(&diffReportPath, "report", "./diff_report.txt", "the path to write the difference report to")
+}
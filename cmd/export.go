@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"file-clone-validator/core/export"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+)
+
+var (
+	exportMetaFilePath string
+	exportFindingsPath string
+	exportOutput       string
+	exportOutputFormat string
+
+	ExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export a metadata file for analysis with other tools",
+		Long: "Export the items of a metadata file and the findings of an error report. The sqlite format loads them " +
+			"into tables of entries, extended attributes, hard link groups and findings, and can be run several times " +
+			"against the same database. The csv and parquet formats flatten the items into columns, with the extended " +
+			"attributes as a JSON column in csv and as a nested column in parquet",
+		Example: "./binary export --format sqlite --meta ./output/meta.out --report ./error_report.txt --output ./migration.db\n" +
+			"./binary export --format parquet --meta ./output/meta.out --output ./meta.parquet",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if exportOutput == "" {
+				return fmt.Errorf("output path must be specified")
+			}
+
+			switch exportOutputFormat {
+			case export.FormatSQLite:
+				if exportMetaFilePath == "" && exportFindingsPath == "" {
+					return fmt.Errorf("metadata file path or error report must be specified")
+				}
+			case export.FormatCSV, export.FormatParquet:
+				if exportMetaFilePath == "" {
+					return fmt.Errorf("metadata file path must be specified")
+				}
+				if exportFindingsPath != "" {
+					return fmt.Errorf("error report can only be exported in the %s format", export.FormatSQLite)
+				}
+			default:
+				return fmt.Errorf("invalid export format: %s. expect [%s|%s|%s]", exportOutputFormat,
+					export.FormatSQLite, export.FormatCSV, export.FormatParquet)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("MetaFilePath", exportMetaFilePath),
+				slog.String("ReportPath", exportFindingsPath),
+				slog.String("Format", exportOutputFormat),
+				slog.String("OutputPath", exportOutput),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if exportOutputFormat != export.FormatSQLite {
+				return exportFlat(ctx)
+			}
+
+			db, err := export.OpenSQLite(ctx, exportOutput)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if exportMetaFilePath != "" {
+				if _, err = export.LoadManifest(ctx, db, exportMetaFilePath); err != nil {
+					return fmt.Errorf("failed to export metadata file: %w", err)
+				}
+			}
+
+			if exportFindingsPath != "" {
+				findings, _err := validator.ReadFindings(exportFindingsPath)
+				if _err != nil {
+					return fmt.Errorf("failed to read error report: %w", _err)
+				}
+				if _err = export.LoadFindings(ctx, db, exportFindingsPath, findings); _err != nil {
+					return fmt.Errorf("failed to export findings: %w", _err)
+				}
+			}
+			return db.Close()
+		},
+	}
+)
+
+// exportFlat exports the metadata file in the csv or parquet format. The output is written next to the output path and
+// renamed over it once complete.
+func exportFlat(ctx context.Context) error {
+	tmpPath := exportOutput + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	slog.Info("Start to export metadata file:", slog.String("MetaFilePath", exportMetaFilePath),
+		slog.String("Format", exportOutputFormat))
+	bw := bufio.NewWriterSize(file, 1<<20)
+	var count uint64
+	if exportOutputFormat == export.FormatCSV {
+		count, err = export.WriteCSV(ctx, exportMetaFilePath, bw)
+	} else {
+		count, err = export.WriteParquet(ctx, exportMetaFilePath, bw)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export metadata file: %w", err)
+	}
+
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, exportOutput); err != nil {
+		return err
+	}
+
+	slog.Info("Finish to export metadata file:", slog.String("OutputPath", exportOutput), slog.Uint64("ItemCount", count))
+	return nil
+}
+
+func initExportCmd() {
+	ExportCmd.PersistentFlags().StringVarP(&exportMetaFilePath, "meta", "m", "", "the metadata file to export")
+	ExportCmd.PersistentFlags().StringVarP(&exportFindingsPath, "report", "r", "", "the error report to load into the database, in the text or json format. sqlite format only")
+	ExportCmd.PersistentFlags().StringVarP(&exportOutputFormat, "format", "f", export.FormatSQLite, fmt.Sprintf("the export format [%s|%s|%s]", export.FormatSQLite, export.FormatCSV, export.FormatParquet))
+	ExportCmd.PersistentFlags().StringVarP(&exportOutput, "output", "o", "", "the output path. the sqlite database is created if it does not exist, the other outputs are overwritten")
+}
@@ -3,11 +3,10 @@ package cmd
 import (
 	"context"
 	"errors"
-	"file-clone-validator/core/datasource"
-	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/signature"
+	"file-clone-validator/pkg/clonevalidator"
 	"fmt"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/errgroup"
 	"log/slog"
 )
 
@@ -16,26 +15,37 @@ type SourceType string
 const (
 	FS  SourceType = "fs"
 	OSS SourceType = "oss"
+	Tar SourceType = "tar"
+	Zip SourceType = "zip"
 )
 
 var (
 	sourceDir    string
 	outputDir    string
 	generateType SourceType
+	scannerCount int
 	readerCount  int
 	writerCount  int
+	signKeyPath  string
+	withMerkle   bool
 
 	GenerateCmd = &cobra.Command{
-		Use:     "generate",
-		Short:   "Generate metadata file from a data source",
-		Long:    "Generate a metadata file from the specified source directory or storage bucket",
-		Example: "./binary generate --source ./ --output ./output --type fs --reader 16 --writer 16",
+		Use:   "generate",
+		Short: "Generate metadata file from a data source",
+		Long:  "Generate a metadata file from the specified source directory or storage bucket",
+		Example: "./binary generate --source ./ --output ./output --type fs --scanner 4 --reader 16 --writer 16\n" +
+			"./binary generate --source ./ --output ./output --serve-manifest :7071 --stream-token secret " +
+			"--stream-tls-cert cert.pem --stream-tls-key key.pem",
 		PreRunE: func(cmd *cobra.Command, args []string) error { // pre run to validate flags
 			if sourceDir == "" || outputDir == "" {
 				return fmt.Errorf("source and output directory must be specified. "+
 					"got source: %s, output: %s", sourceDir, outputDir)
 			}
 
+			if scannerCount < 1 {
+				return fmt.Errorf("scanner count must be greater than 0. got %d", scannerCount)
+			}
+
 			if readerCount < 1 {
 				return fmt.Errorf("reader count must be greater than 0. got %d", readerCount)
 			}
@@ -44,41 +54,74 @@ var (
 				return fmt.Errorf("writer count must be greater than 0. got %d", writerCount)
 			}
 
-			if generateType != FS && generateType != OSS {
-				return fmt.Errorf("invalid source type: %s. expect [fs|oss]", generateType)
+			if generateType != FS && generateType != OSS && generateType != Tar && generateType != Zip {
+				return fmt.Errorf("invalid source type: %s. expect [fs|oss|tar|zip]", generateType)
+			}
+
+			if err := validateServeManifestFlags(); err != nil {
+				return err
 			}
 
 			slog.Info("Finish to validate flags:",
 				slog.String("SourceDir", sourceDir),
 				slog.String("OutputDir", outputDir),
 				slog.String("SourceType", string(generateType)),
+				slog.Int("ScannerCount", scannerCount),
 				slog.Int("ReaderCount", readerCount),
 				slog.Int("WriterCount", writerCount),
+				slog.String("SignKeyPath", signKeyPath),
+				slog.String("ServeManifestAddr", serveManifestAddr),
 			)
 
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+			startMetricsServer(ctx)
+
+			closeProgress, err := setupProgress()
+			if err != nil {
+				return err
+			}
+			defer closeProgress()
+
 			switch generateType {
-			case FS:
-				ds, err := datasource.NewFileSource(sourceDir)
-				if err != nil {
-					return fmt.Errorf("failed to create file source: %w", err)
+			case FS, Tar, Zip:
+				opts := clonevalidator.GenerateOptions{
+					SourceDir:    sourceDir,
+					SourceKind:   clonevalidator.Kind(generateType),
+					OutputDir:    outputDir,
+					ScannerCount: scannerCount,
+					ReaderCount:  readerCount,
+					WriterCount:  writerCount,
+					Merkle:       withMerkle,
 				}
+				if signKeyPath != "" {
+					if opts.SigningKey, err = signature.LoadPrivateKey(signKeyPath); err != nil {
+						return err
+					}
+				}
+				if opts.ManifestListener, err = listenManifest(); err != nil {
+					return err
+				}
+				opts.StreamToken = streamToken
 
-				writer, err := datasource.NewMetaWriter(sourceDir, outputDir)
+				result, err := clonevalidator.Generate(ctx, opts)
 				if err != nil {
-					return fmt.Errorf("failed to create meta writer: %w", err)
+					return err
 				}
 
-				metaItemC := make(chan *metadata.Meta, 1)
-				g, gCtx := errgroup.WithContext(ctx)
-				g.Go(func() error { return ds.Walk(gCtx, outputDir, metaItemC, readerCount) })
-				g.Go(func() error { return writer.Write(gCtx, metaItemC, writerCount) })
-				if err := g.Wait(); err != nil {
-					return fmt.Errorf("failed to generate metadata: %w", err)
-				}
+				slog.Info("Finish to generate metadata:",
+					slog.String("MetaFilePath", result.MetaFilePath),
+					slog.Uint64("ItemCount", result.Header.ItemCount),
+					slog.String("RootHash", result.RootHash),
+					slog.Duration("Duration", result.Duration),
+				)
 			case OSS:
 			default:
 				return errors.New("not implemented yet")
@@ -90,9 +133,16 @@ var (
 )
 
 func initGenerateCmd() {
-	GenerateCmd.PersistentFlags().StringVarP(&sourceDir, "source", "s", "", "source directory or storage bucket name")
+	GenerateCmd.PersistentFlags().StringVarP(&sourceDir, "source", "s", "", "source directory, storage bucket name or archive path")
 	GenerateCmd.PersistentFlags().StringVarP(&outputDir, "output", "o", "", "output directory path")
+	GenerateCmd.PersistentFlags().IntVar(&scannerCount, "scanner", 4, "number of scanner to list directories concurrently")
 	GenerateCmd.PersistentFlags().IntVarP(&readerCount, "reader", "r", 1, "number of reader to open and load file meta")
 	GenerateCmd.PersistentFlags().IntVarP(&writerCount, "writer", "w", 1, "number of writer to write meta to file")
-	GenerateCmd.PersistentFlags().StringVarP((*string)(&generateType), "type", "t", "fs", "type of data source to use")
+	GenerateCmd.PersistentFlags().StringVarP((*string)(&generateType), "type", "t", "fs", "type of data source to use. [fs|oss|tar|zip]")
+	GenerateCmd.PersistentFlags().StringVar(&signKeyPath, "sign-key", "", "private key to sign the metadata file with. not signed if empty")
+	GenerateCmd.PersistentFlags().BoolVar(&withMerkle, "merkle", false, "write the merkle tree of the directory hierarchy next to the metadata file")
+	addServeManifestFlags(GenerateCmd)
+	addThrottleFlags(GenerateCmd)
+	addMetricsFlags(GenerateCmd)
+	addProgressFlags(GenerateCmd)
 }
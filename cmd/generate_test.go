@@ -13,7 +13,7 @@ import (
 func TestGenerateFileSystem(t *testing.T) {
 	srcDir := "./"
 	outDir := "./"
-	ds, err := datasource.NewFileSource(srcDir)
+	ds, err := datasource.NewFileSource(srcDir, 1)
 	require.NoError(t, err)
 
 	writer, err := datasource.NewMetaWriter(srcDir, outDir)
@@ -3,4 +3,19 @@ package cmd
 func init() {
 	initGenerateCmd()
 	initValidateCmd()
+	initSignatureCmd()
+	initDiffCmd()
+	initShardCmd()
+	initMergeReportsCmd()
+	initCoordinatorCmd()
+	initWorkerCmd()
+	initRepairCmd()
+	initReportCmd()
+	initWatchCmd()
+	initInspectCmd()
+	initExportCmd()
+	initMtreeCmd()
+	initChecksumCmd()
+	initBagitCmd()
+	initCompareCmd()
 }
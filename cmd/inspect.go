@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"file-clone-validator/core/inspect"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+var (
+	inspectMetaPath  string
+	inspectTop       int
+	inspectWhere     string
+	inspectJSON      bool
+	inspectPathsOnly bool
+	inspectCountOnly bool
+
+	InspectCmd = &cobra.Command{
+		Use:   "inspect",
+		Short: "Look inside a metadata file",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if inspectMetaPath == "" {
+				return fmt.Errorf("metadata file path must be specified")
+			}
+			return nil
+		},
+	}
+
+	InspectStatsCmd = &cobra.Command{
+		Use:     "stats",
+		Short:   "Summarise the items of a metadata file",
+		Long:    "Show the counts by file type, the size histogram of the files, the largest files, the deepest paths and the usage of the extended attributes",
+		Example: "./binary inspect stats --meta ./output/meta.out --top 20 --where 'type == \"file\"'",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if inspectTop < 0 {
+				return fmt.Errorf("top must not be negative. got %d", inspectTop)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var filter inspect.Expr
+			if inspectWhere != "" {
+				var err error
+				if filter, err = inspect.Compile(inspectWhere); err != nil {
+					return fmt.Errorf("failed to parse filter expression: %w", err)
+				}
+			}
+
+			stats, err := inspect.CollectStats(inspectMetaPath, inspectTop, filter)
+			if err != nil {
+				return err
+			}
+
+			if inspectJSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(stats)
+			}
+			return stats.WriteText(cmd.OutOrStdout())
+		},
+	}
+
+	InspectShowCmd = &cobra.Command{
+		Use:     "show <path>",
+		Short:   "Print the item of a metadata file at a path",
+		Long:    "Print the item at a path, which is either the recorded source path or a path relative to the source directory",
+		Example: "./binary inspect show --meta ./output/meta.out dir/file.txt",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			item, err := inspect.Find(inspectMetaPath, args[0])
+			if err != nil {
+				return err
+			}
+			if item == nil {
+				return fmt.Errorf("no item at path %s", args[0])
+			}
+
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(item)
+		},
+	}
+
+	InspectQueryCmd = &cobra.Command{
+		Use:   "query <expression>",
+		Short: "Print the items of a metadata file matching an expression",
+		Long: "Print the rows of the items matching a filter expression. The comparisons `<field> <op> <value>` are " +
+			"combined with &&, || and !, and grouped with parentheses. The numbers are compared with ==, !=, <, <=, > " +
+			"and >=, the quoted strings with ==, != and the regular expression matches =~ and !~. The dates without " +
+			"time zone are UTC.\n\nFields:\n" + inspect.FieldsHelp(),
+		Example: "./binary inspect query --meta ./output/meta.out 'type == \"file\" && size > 1G && mtime < 2020-01-01'",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if inspectPathsOnly && inspectCountOnly {
+				return fmt.Errorf("--paths and --count are mutually exclusive")
+			}
+
+			filter, err := inspect.Compile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to parse filter expression: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			var count uint64
+			_, err = inspect.Scan(inspectMetaPath, func(item *metadata.Meta, row []byte) error {
+				if !filter(item) {
+					return nil
+				}
+
+				count++
+				switch {
+				case inspectCountOnly:
+					return nil
+				case inspectPathsOnly:
+					_, _err := fmt.Fprintln(out, item.Common.Path)
+					return _err
+				default:
+					_, _err := out.Write(append(row, '\n'))
+					return _err
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			if inspectCountOnly {
+				fmt.Fprintln(out, count)
+			}
+			slog.Debug("Finish to query metadata file:", slog.String("MetaFilePath", inspectMetaPath), slog.Uint64("Matched", count))
+			return nil
+		},
+	}
+)
+
+func initInspectCmd() {
+	InspectCmd.PersistentFlags().StringVarP(&inspectMetaPath, "meta", "m", "", "the metadata file path")
+	InspectStatsCmd.Flags().IntVar(&inspectTop, "top", 10, "the number of items of the largest files and deepest paths")
+	InspectStatsCmd.Flags().StringVar(&inspectWhere, "where", "", "only summarise the items matching this filter expression, see inspect query")
+	InspectStatsCmd.Flags().BoolVar(&inspectJSON, "json", false, "print the stats as json")
+	InspectQueryCmd.Flags().BoolVar(&inspectPathsOnly, "paths", false, "only print the paths of the matching items")
+	InspectQueryCmd.Flags().BoolVar(&inspectCountOnly, "count", false, "only print the number of matching items")
+	InspectCmd.AddCommand(InspectStatsCmd, InspectShowCmd, InspectQueryCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+var (
+	mergeIndexPath   string
+	mergeReportPath  string
+	mergeSummaryPath string
+
+	MergeReportsCmd = &cobra.Command{
+		Use:     "merge-reports [summary files]",
+		Short:   "Merge the reports of the validation of several shards",
+		Long:    "Merge the summaries and error reports of the validation of several shards into one verdict",
+		Example: "./binary merge-reports --index ./shards/shards.json --report ./error_report.txt ./shard-*/summary.json",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			slog.Info("Finish to validate flags:",
+				slog.String("IndexPath", mergeIndexPath),
+				slog.String("ReportPath", mergeReportPath),
+				slog.String("SummaryPath", mergeSummaryPath),
+				slog.Int("SummaryCount", len(args)),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var index *datasource.ShardIndex
+			if mergeIndexPath != "" {
+				var err error
+				if index, err = datasource.ReadShardIndex(mergeIndexPath); err != nil {
+					return err
+				}
+			}
+
+			merged, err := validator.MergeSummaries(args, index, mergeReportPath)
+			if err != nil {
+				return fmt.Errorf("failed to merge reports: %w", err)
+			}
+
+			for _, problem := range merged.Problems {
+				slog.Warn("Incomplete validation:", slog.String("Problem", problem))
+			}
+
+			if mergeSummaryPath != "" {
+				if err = validator.WriteSummary(mergeSummaryPath, &validator.Summary{
+					ItemCount:  merged.ItemCount,
+					Findings:   merged.Findings,
+					ReportPath: mergeReportPath,
+					Passed:     merged.Passed,
+				}); err != nil {
+					return fmt.Errorf("failed to write merged summary: %w", err)
+				}
+			}
+
+			slog.Info("Finish to merge reports:",
+				slog.Int("Summaries", merged.Summaries),
+				slog.Uint64("ItemCount", merged.ItemCount),
+				slog.Any("Findings", merged.Findings),
+				slog.Int("Problems", len(merged.Problems)),
+				slog.Bool("Passed", merged.Passed),
+			)
+			return nil
+		},
+	}
+)
+
+func initMergeReportsCmd() {
+	MergeReportsCmd.PersistentFlags().StringVarP(&mergeIndexPath, "index", "i", "", "the shard index written by the shard command. checks that every shard is validated")
+	MergeReportsCmd.PersistentFlags().StringVar(&mergeReportPath, "report", "./error_report.txt", "the path to write the merged error report to")
+	MergeReportsCmd.PersistentFlags().StringVar(&mergeSummaryPath, "summary", "", "the path to write the merged json summary to")
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/metrics"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+var metricsAddr string
+
+// addMetricsFlags registers the flags of the Prometheus metrics endpoint shared by the long-running commands.
+func addMetricsFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "address to serve Prometheus metrics on, e.g. :9100. disabled if empty")
+}
+
+// startMetricsServer serves the metrics in the background until the context is done, if the endpoint is enabled.
+func startMetricsServer(ctx context.Context) {
+	if metricsAddr == "" {
+		return
+	}
+
+	go func() {
+		if err := metrics.Serve(ctx, metricsAddr); err != nil {
+			slog.Error("Failed to serve metrics:", slog.String("Addr", metricsAddr), slog.Any("Error", err))
+		}
+	}()
+}
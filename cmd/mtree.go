@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/mtree"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+)
+
+var (
+	mtreeSpecPath  string
+	mtreeRoot      string
+	mtreeOutputDir string
+	mtreeMetaPath  string
+	mtreeSpecOut   string
+
+	MtreeCmd = &cobra.Command{
+		Use:   "mtree",
+		Short: "Convert between metadata files and BSD mtree specifications",
+	}
+
+	MtreeImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Convert an mtree specification to a metadata file",
+		Long: "Convert an mtree specification to a metadata file written to the output directory. The type, mode, uid, " +
+			"gid, nlink, size, time, link, md5digest and sha256digest keywords are imported, and the validation only " +
+			"compares the keywords recorded by the specification",
+		Example: "./binary mtree import --spec ./tree.mtree --root /data --output ./output",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if mtreeSpecPath == "" || mtreeRoot == "" || mtreeOutputDir == "" {
+				return fmt.Errorf("specification, root directory and output directory must be specified. got "+
+					"specification: %s, root directory: %s, output directory: %s", mtreeSpecPath, mtreeRoot, mtreeOutputDir)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("SpecPath", mtreeSpecPath),
+				slog.String("Root", mtreeRoot),
+				slog.String("OutputDir", mtreeOutputDir),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			_, err := mtree.Import(ctx, mtreeSpecPath, mtreeRoot, mtreeOutputDir)
+			return err
+		},
+	}
+
+	MtreeExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Convert a metadata file to an mtree specification",
+		Long: "Convert a metadata file to an mtree specification of full path entries relative to its source directory, " +
+			"which can be checked with mtree -f or imported back. The extended attributes are not exported",
+		Example: "./binary mtree export --meta ./output/meta.out --output ./tree.mtree\n" +
+			"./binary mtree export --meta ./output/meta.out | mtree -p /data",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if mtreeMetaPath == "" {
+				return fmt.Errorf("metadata file path must be specified")
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("MetaFilePath", mtreeMetaPath),
+				slog.String("OutputPath", mtreeSpecOut),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var out io.Writer = cmd.OutOrStdout()
+			if mtreeSpecOut != "" {
+				file, err := os.Create(mtreeSpecOut)
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %w", err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			count, err := mtree.Write(ctx, mtreeMetaPath, out)
+			if err != nil {
+				return fmt.Errorf("failed to export metadata file: %w", err)
+			}
+
+			slog.Info("Finish to export mtree specification:",
+				slog.String("MetaFilePath", mtreeMetaPath),
+				slog.String("OutputPath", mtreeSpecOut),
+				slog.Uint64("EntryCount", count),
+			)
+			return nil
+		},
+	}
+)
+
+func initMtreeCmd() {
+	MtreeImportCmd.PersistentFlags().StringVarP(&mtreeSpecPath, "spec", "f", "", "the mtree specification to import")
+	MtreeImportCmd.PersistentFlags().StringVarP(&mtreeRoot, "root", "p", "", "the directory the specification describes, recorded as the source directory of the metadata file")
+	MtreeImportCmd.PersistentFlags().StringVarP(&mtreeOutputDir, "output", "o", "./output", "the directory to write the metadata file to")
+	MtreeExportCmd.PersistentFlags().StringVarP(&mtreeMetaPath, "meta", "m", "", "the metadata file to export")
+	MtreeExportCmd.PersistentFlags().StringVarP(&mtreeSpecOut, "output", "o", "", "the output file. stdout if empty")
+	MtreeCmd.AddCommand(MtreeImportCmd, MtreeExportCmd)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"file-clone-validator/core/progress"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	progressMode     string
+	progressFilePath string
+	progressInterval time.Duration
+)
+
+// addProgressFlags registers the progress reporting flags shared by the long-running commands.
+func addProgressFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&progressMode, "progress", string(progress.ModeBar), "how to report the progress. [bar|json|none]")
+	cmd.PersistentFlags().StringVar(&progressFilePath, "progress-file", "", "file to append the json progress events to. stderr if empty")
+	cmd.PersistentFlags().DurationVar(&progressInterval, "progress-interval", time.Second, "interval between two json progress events")
+}
+
+// setupProgress configures the progress reporting from the flags. The returned function closes the progress file.
+func setupProgress() (func(), error) {
+	var out io.Writer = os.Stderr
+	closeFn := func() {}
+	if progressFilePath != "" && progress.Mode(progressMode) == progress.ModeJSON {
+		file, err := os.OpenFile(progressFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open progress file: %w", err)
+		}
+		out = file
+		closeFn = func() { file.Close() }
+	}
+
+	if err := progress.Configure(progress.Mode(progressMode), out, progressInterval); err != nil {
+		closeFn()
+		return nil, err
+	}
+	return closeFn, nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/repair"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+var (
+	repairReportPath string
+	repairMetaPath   string
+	repairSourceDir  string
+	repairTargetDir  string
+	repairDryRun     bool
+
+	RepairCmd = &cobra.Command{
+		Use:     "repair",
+		Short:   "Repair the items reported by a validation",
+		Long:    "Restore the missing and mismatching items of an error report from the source directory, reapply their metadata and validate them again",
+		Example: "./binary repair --report ./error_report.txt --meta ./output/meta.out --target ./dst --dry-run",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if repairReportPath == "" || repairMetaPath == "" || repairTargetDir == "" {
+				return fmt.Errorf("error report, metadata file path and target directory must be specified. "+
+					"got error report: %s, metadata file path: %s, target directory: %s",
+					repairReportPath, repairMetaPath, repairTargetDir)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("ReportPath", repairReportPath),
+				slog.String("MetaFilePath", repairMetaPath),
+				slog.String("SourceDir", repairSourceDir),
+				slog.String("TargetDir", repairTargetDir),
+				slog.Bool("DryRun", repairDryRun),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+
+			header, err := datasource.ReadMetaHeader(repairMetaPath)
+			if err != nil {
+				return err
+			}
+
+			findings, err := validator.ReadFindings(repairReportPath)
+			if err != nil {
+				return fmt.Errorf("failed to read error report: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			result, err := repair.Run(ctx, findings, repair.Options{
+				ManifestSourceDir: header.SourceDir,
+				SourceDir:         repairSourceDir,
+				TargetDir:         repairTargetDir,
+				DryRun:            repairDryRun,
+			}, func(item *repair.Item) {
+				switch {
+				case item.Skipped != "":
+					slog.Warn("Skip item:", slog.String("Reason", item.Finding.Reason), slog.String("Skipped", item.Skipped),
+						slog.String("TargetPath", item.TargetPath))
+				case repairDryRun:
+					for _, action := range item.Actions {
+						fmt.Fprintln(out, action.String())
+					}
+				case item.Err != nil:
+				case len(item.Remaining) > 0:
+					slog.Warn("Item still mismatches after repair:", slog.String("TargetPath", item.TargetPath),
+						slog.Any("Remaining", item.Remaining))
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			slog.Info("Finish to repair:",
+				slog.Int("Planned", result.Planned),
+				slog.Int("Repaired", result.Repaired),
+				slog.Int("Failed", result.Failed),
+				slog.Int("Skipped", result.Skipped),
+				slog.Bool("DryRun", repairDryRun),
+			)
+			if result.Failed > 0 {
+				return fmt.Errorf("failed to repair %d items", result.Failed)
+			}
+			return nil
+		},
+	}
+)
+
+func initRepairCmd() {
+	RepairCmd.PersistentFlags().StringVarP(&repairReportPath, "report", "r", "./error_report.txt", "the error report of the validation, in the text or json format")
+	RepairCmd.PersistentFlags().StringVarP(&repairMetaPath, "meta", "m", "", "the metadata file the target has been validated against")
+	RepairCmd.PersistentFlags().StringVarP(&repairSourceDir, "source", "s", "", "the directory to copy from. the source directory of the metadata file if empty")
+	RepairCmd.PersistentFlags().StringVarP(&repairTargetDir, "target", "t", "", "the target directory to repair")
+	RepairCmd.PersistentFlags().BoolVar(&repairDryRun, "dry-run", false, "only print the planned actions")
+	addThrottleFlags(RepairCmd)
+}
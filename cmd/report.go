@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/repair"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+)
+
+var (
+	exportReportPath string
+	exportMetaPath   string
+	exportSourceDir  string
+	exportTargetDir  string
+	exportFormat     string
+	exportOutputPath string
+
+	ReportCmd = &cobra.Command{
+		Use:   "report",
+		Short: "Work with the error report of a validation",
+	}
+
+	ReportExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export the findings of an error report for an external repair",
+		Long: "Export the missing and mismatching items of an error report as an rsync --files-from list of relative paths " +
+			"separated by NUL bytes, to use with rsync --from0, or as a shell script of cp, chmod, chown, setfattr and touch commands to review and run",
+		Example: "./binary report export --report ./error_report.txt --meta ./output/meta.out --format files-from --output ./files.txt\n" +
+			"./binary report export --report ./error_report.txt --meta ./output/meta.out --target ./dst --format script --output ./repair.sh",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if exportReportPath == "" || exportMetaPath == "" {
+				return fmt.Errorf("error report and metadata file path must be specified. got error report: %s, "+
+					"metadata file path: %s", exportReportPath, exportMetaPath)
+			}
+			switch exportFormat {
+			case repair.ExportFilesFrom:
+			case repair.ExportScript:
+				if exportTargetDir == "" {
+					return fmt.Errorf("target directory must be specified for the %s format", repair.ExportScript)
+				}
+			default:
+				return fmt.Errorf("invalid export format: %s. expect [%s|%s]", exportFormat, repair.ExportFilesFrom, repair.ExportScript)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("ReportPath", exportReportPath),
+				slog.String("MetaFilePath", exportMetaPath),
+				slog.String("SourceDir", exportSourceDir),
+				slog.String("TargetDir", exportTargetDir),
+				slog.String("Format", exportFormat),
+				slog.String("OutputPath", exportOutputPath),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			header, err := datasource.ReadMetaHeader(exportMetaPath)
+			if err != nil {
+				return err
+			}
+
+			findings, err := validator.ReadFindings(exportReportPath)
+			if err != nil {
+				return fmt.Errorf("failed to read error report: %w", err)
+			}
+
+			opts := repair.Options{
+				ManifestSourceDir: header.SourceDir,
+				SourceDir:         exportSourceDir,
+				TargetDir:         exportTargetDir,
+			}
+			if opts.TargetDir == "" { // the paths of the list are relative, the target directory does not matter
+				opts.TargetDir = header.SourceDir
+			}
+			items, err := repair.PlanFromReasons(findings, opts)
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = cmd.OutOrStdout()
+			if exportOutputPath != "" {
+				file, _err := os.Create(exportOutputPath)
+				if _err != nil {
+					return fmt.Errorf("failed to create output file: %w", _err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			if exportFormat == repair.ExportFilesFrom {
+				err = repair.WriteFilesFrom(out, items, opts)
+			} else {
+				err = repair.WriteScript(out, items, exportReportPath)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to export findings: %w", err)
+			}
+
+			if exportOutputPath != "" && exportFormat == repair.ExportScript {
+				if err = os.Chmod(exportOutputPath, 0755); err != nil {
+					return err
+				}
+			}
+
+			skipped := 0
+			for _, item := range items {
+				if item.Skipped != "" {
+					skipped++
+				}
+			}
+			slog.Info("Finish to export findings:",
+				slog.Int("Findings", len(findings)),
+				slog.Int("Skipped", skipped),
+				slog.String("Format", exportFormat),
+				slog.String("OutputPath", exportOutputPath),
+			)
+			return nil
+		},
+	}
+)
+
+func initReportCmd() {
+	ReportExportCmd.PersistentFlags().StringVarP(&exportReportPath, "report", "r", "./error_report.txt", "the error report of the validation, in the text or json format")
+	ReportExportCmd.PersistentFlags().StringVarP(&exportMetaPath, "meta", "m", "", "the metadata file the target has been validated against")
+	ReportExportCmd.PersistentFlags().StringVarP(&exportSourceDir, "source", "s", "", "the directory the script copies from. the source directory of the metadata file if empty")
+	ReportExportCmd.PersistentFlags().StringVarP(&exportTargetDir, "target", "t", "", "the target directory the script repairs. required by the script format")
+	ReportExportCmd.PersistentFlags().StringVarP(&exportFormat, "format", "f", repair.ExportFilesFrom, fmt.Sprintf("the export format [%s|%s]", repair.ExportFilesFrom, repair.ExportScript))
+	ReportExportCmd.PersistentFlags().StringVarP(&exportOutputPath, "output", "o", "", "the output file. stdout if empty")
+	ReportCmd.AddCommand(ReportExportCmd)
+}
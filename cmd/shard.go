@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/signature"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"path/filepath"
+)
+
+var (
+	shardMetaPath  string
+	shardOutputDir string
+	shardCount     int
+	shardBy        datasource.ShardBy
+	shardSignKey   string
+
+	ShardCmd = &cobra.Command{
+		Use:   "shard",
+		Short: "Split a metadata file into shards",
+		Long: "Split a metadata file into self-contained shards which can be validated on different hosts. " +
+			"The signature of the metadata file does not cover the shards: sign them with --sign-key, after checking " +
+			"the metadata file with the verify command, to validate them with --public-key",
+		Example: "./binary shard --meta ./output/meta.out --output ./shards --count 8 --by hash",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if shardMetaPath == "" || shardOutputDir == "" {
+				return fmt.Errorf("metadata file path and output directory must be specified. "+
+					"got metadata file path: %s, output directory: %s", shardMetaPath, shardOutputDir)
+			}
+
+			if shardCount < 1 {
+				return fmt.Errorf("shard count must be greater than 0. got %d", shardCount)
+			}
+
+			if shardBy != datasource.ShardByHash && shardBy != datasource.ShardByTop {
+				return fmt.Errorf("invalid shard strategy: %s. expect [hash|top]", shardBy)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("MetaFilePath", shardMetaPath),
+				slog.String("OutputDir", shardOutputDir),
+				slog.Int("ShardCount", shardCount),
+				slog.String("ShardBy", string(shardBy)),
+				slog.String("SignKeyPath", shardSignKey),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			index, err := datasource.ShardMetaFile(shardMetaPath, shardOutputDir, shardCount, shardBy)
+			if err != nil {
+				return fmt.Errorf("failed to shard metadata file: %w", err)
+			}
+
+			if shardSignKey != "" {
+				key, _err := signature.LoadPrivateKey(shardSignKey)
+				if _err != nil {
+					return _err
+				}
+				for _, shard := range index.Shards {
+					if _err = signature.SignFile(filepath.Join(shardOutputDir, shard.Path), key); _err != nil {
+						return fmt.Errorf("failed to sign shard %s: %w", shard.Path, _err)
+					}
+				}
+			}
+
+			for _, shard := range index.Shards {
+				slog.Info("Shard:", slog.String("Path", shard.Path), slog.Uint64("ItemCount", shard.ItemCount))
+			}
+			return nil
+		},
+	}
+)
+
+func initShardCmd() {
+	ShardCmd.PersistentFlags().StringVarP(&shardMetaPath, "meta", "m", "", "the metadata file path")
+	ShardCmd.PersistentFlags().StringVarP(&shardOutputDir, "output", "o", "", "the directory to write the shards to")
+	ShardCmd.PersistentFlags().IntVarP(&shardCount, "count", "n", 2, "the number of shards")
+	ShardCmd.PersistentFlags().StringVar((*string)(&shardBy), "by", string(datasource.ShardByHash), "how to assign the items to the shards. [hash|top]")
+	ShardCmd.PersistentFlags().StringVar(&shardSignKey, "sign-key", "", "private key to sign the shards with. not signed if empty")
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"file-clone-validator/core/signature"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+)
+
+const (
+	signaturePolicyRequire = "require"
+	signaturePolicyWarn    = "warn"
+)
+
+var (
+	publicKeyPath   string
+	privateKeyPath  string
+	signMetaPath    string
+	signaturePolicy string
+
+	KeygenCmd = &cobra.Command{
+		Use:     "keygen",
+		Short:   "Generate a key pair to sign metadata files",
+		Long:    "Generate an ed25519 key pair. The private key signs the metadata files and the public key verifies them",
+		Example: "./binary keygen --public ./meta.pub --private ./meta.key",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if publicKeyPath == "" || privateKeyPath == "" {
+				return fmt.Errorf("public and private key path must be specified. "+
+					"got public: %s, private: %s", publicKeyPath, privateKeyPath)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := signature.GenerateKey(publicKeyPath, privateKeyPath); err != nil {
+				return fmt.Errorf("failed to generate key pair: %w", err)
+			}
+
+			slog.Info("Finish to generate key pair:",
+				slog.String("PublicKeyPath", publicKeyPath),
+				slog.String("PrivateKeyPath", privateKeyPath),
+			)
+			return nil
+		},
+	}
+
+	SignCmd = &cobra.Command{
+		Use:     "sign",
+		Short:   "Sign a metadata file",
+		Long:    "Sign a metadata file with a detached signature written next to it",
+		Example: "./binary sign --meta ./output/meta.out --key ./meta.key",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if signMetaPath == "" || privateKeyPath == "" {
+				return fmt.Errorf("metadata file path and private key path must be specified. "+
+					"got metadata file path: %s, private key path: %s", signMetaPath, privateKeyPath)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := signature.LoadPrivateKey(privateKeyPath)
+			if err != nil {
+				return err
+			}
+
+			if err = signature.SignFile(signMetaPath, key); err != nil {
+				return fmt.Errorf("failed to sign metadata file: %w", err)
+			}
+
+			slog.Info("Finish to sign metadata file:", slog.String("SignaturePath", signMetaPath+signature.Suffix))
+			return nil
+		},
+	}
+
+	VerifyCmd = &cobra.Command{
+		Use:     "verify",
+		Short:   "Verify the signature of a metadata file",
+		Long:    "Verify that a metadata file has not been modified since it was signed",
+		Example: "./binary verify --meta ./output/meta.out --public-key ./meta.pub",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if signMetaPath == "" || publicKeyPath == "" {
+				return fmt.Errorf("metadata file path and public key path must be specified. "+
+					"got metadata file path: %s, public key path: %s", signMetaPath, publicKeyPath)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := signature.LoadPublicKey(publicKeyPath)
+			if err != nil {
+				return err
+			}
+
+			if err = signature.VerifyFile(signMetaPath, key); err != nil {
+				return err
+			}
+
+			slog.Info("Success to verify metadata file signature:", slog.String("MetaFilePath", signMetaPath))
+			return nil
+		},
+	}
+)
+
+// validateSignaturePolicy checks the value of the --signature-policy flag.
+func validateSignaturePolicy() error {
+	if signaturePolicy != signaturePolicyRequire && signaturePolicy != signaturePolicyWarn {
+		return fmt.Errorf("invalid signature policy: %s. expect [%s|%s]",
+			signaturePolicy, signaturePolicyRequire, signaturePolicyWarn)
+	}
+	return nil
+}
+
+func initSignatureCmd() {
+	KeygenCmd.PersistentFlags().StringVar(&publicKeyPath, "public", "", "the path to write the public key to")
+	KeygenCmd.PersistentFlags().StringVar(&privateKeyPath, "private", "", "the path to write the private key to")
+
+	SignCmd.PersistentFlags().StringVarP(&signMetaPath, "meta", "m", "", "the metadata file path")
+	SignCmd.PersistentFlags().StringVarP(&privateKeyPath, "key", "k", "", "the private key path")
+
+	VerifyCmd.PersistentFlags().StringVarP(&signMetaPath, "meta", "m", "", "the metadata file path")
+	VerifyCmd.PersistentFlags().StringVar(&publicKeyPath, "public-key", "", "the public key path")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"file-clone-validator/core/stream"
+	"fmt"
+	"github.com/spf13/cobra"
+	"net"
+)
+
+var (
+	serveManifestAddr string
+	streamToken       string
+	streamTLSCertPath string
+	streamTLSKeyPath  string
+	streamTLS         bool
+	streamTLSCAPath   string
+)
+
+// addServeManifestFlags adds the flags of the generator side of a streamed metadata file.
+func addServeManifestFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&serveManifestAddr, "serve-manifest", "", "address to stream the metadata to a validator on while it is generated, e.g. :7071. the walk waits for the validator. disabled if empty")
+	cmd.PersistentFlags().StringVar(&streamToken, "stream-token", "", "the shared secret the validator of the stream must present. any validator is accepted if empty. requires --stream-tls-cert, as it is sent in clear otherwise")
+	cmd.PersistentFlags().StringVar(&streamTLSCertPath, "stream-tls-cert", "", "the PEM certificate to serve the stream with TLS. plain TCP if empty")
+	cmd.PersistentFlags().StringVar(&streamTLSKeyPath, "stream-tls-key", "", "the PEM private key of the stream certificate")
+}
+
+// addStreamFlags adds the flags of the validator side of a streamed metadata file, see stream.ParseAddress.
+func addStreamFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&streamToken, "stream-token", "", "the shared secret of the generator streaming the metadata. requires --stream-tls or --stream-tls-ca, as it is sent in clear otherwise")
+	cmd.PersistentFlags().BoolVar(&streamTLS, "stream-tls", false, "connect to the generator streaming the metadata with TLS")
+	cmd.PersistentFlags().StringVar(&streamTLSCAPath, "stream-tls-ca", "", "the PEM certificates which sign the certificate of the generator. the system roots if empty. implies --stream-tls")
+}
+
+// validateServeManifestFlags checks the flags of addServeManifestFlags.
+func validateServeManifestFlags() error {
+	if (streamTLSCertPath == "") != (streamTLSKeyPath == "") {
+		return fmt.Errorf("stream TLS certificate and key must be specified together. got certificate: %s, key: %s",
+			streamTLSCertPath, streamTLSKeyPath)
+	}
+	if serveManifestAddr == "" && (streamTLSCertPath != "" || streamToken != "") {
+		return fmt.Errorf("stream TLS and token require --serve-manifest")
+	}
+	if streamToken != "" && streamTLSCertPath == "" {
+		return fmt.Errorf("stream token requires --stream-tls-cert, it would be received in clear otherwise")
+	}
+	return nil
+}
+
+// validateStreamFlags checks the flags of addStreamFlags.
+func validateStreamFlags() error {
+	if streamToken != "" && !streamTLS && streamTLSCAPath == "" {
+		return fmt.Errorf("stream token requires --stream-tls or --stream-tls-ca, it would be sent in clear otherwise")
+	}
+	return nil
+}
+
+// listenManifest returns the listener of --serve-manifest, nil if it is disabled.
+func listenManifest() (net.Listener, error) {
+	if serveManifestAddr == "" {
+		return nil, nil
+	}
+
+	ln, err := net.Listen("tcp", serveManifestAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", serveManifestAddr, err)
+	}
+	if streamTLSCertPath == "" {
+		return ln, nil
+	}
+
+	config, err := stream.ServerTLSConfig(streamTLSCertPath, streamTLSKeyPath)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return tls.NewListener(ln, config), nil
+}
+
+// streamTLSConfig returns the TLS configuration of the flags of addStreamFlags, nil if TLS is disabled.
+func streamTLSConfig() (*tls.Config, error) {
+	if !streamTLS && streamTLSCAPath == "" {
+		return nil, nil
+	}
+	return stream.ClientTLSConfig(streamTLSCAPath)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"time"
+)
+
+// throttleReloadInterval is how often the throttle control file is checked for changes.
+const throttleReloadInterval = 5 * time.Second
+
+var (
+	bandwidthLimit      string
+	filesLimit          uint64
+	throttleControlPath string
+)
+
+// addThrottleFlags registers the I/O throttling flags shared by the commands that read the data source.
+func addThrottleFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&bandwidthLimit, "bwlimit", "0", "maximum bytes read per second across all workers, e.g. 100M. 0 means unlimited")
+	cmd.PersistentFlags().Uint64Var(&filesLimit, "files-limit", 0, "maximum files processed per second across all workers. 0 means unlimited")
+	cmd.PersistentFlags().StringVar(&throttleControlPath, "throttle-file", "", "control file to change the limits at runtime. reloaded on change or SIGHUP")
+}
+
+// setupThrottle applies the throttling flags to utils.DefaultLimiter and starts watching the control file. The control
+// file, if it exists, overrides the limits given by the flags.
+func setupThrottle(ctx context.Context) error {
+	bytesPerSec, err := utils.ParseSize(bandwidthLimit)
+	if err != nil {
+		return fmt.Errorf("invalid bandwidth limit: %w", err)
+	}
+	filesPerSec := filesLimit
+
+	if throttleControlPath != "" {
+		_bytesPerSec, _filesPerSec, _err := utils.LoadThrottleControlFile(throttleControlPath)
+		if _err == nil {
+			bytesPerSec, filesPerSec = _bytesPerSec, _filesPerSec
+		} else {
+			slog.Warn("Failed to load throttle control file, use the flags instead:",
+				slog.String("Path", throttleControlPath), slog.Any("Error", _err))
+		}
+		go utils.WatchLimiter(ctx, utils.DefaultLimiter, throttleControlPath, throttleReloadInterval)
+	}
+
+	utils.DefaultLimiter.SetLimits(bytesPerSec, filesPerSec)
+	return nil
+}
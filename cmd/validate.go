@@ -3,7 +3,10 @@ package cmd
 import (
 	"context"
 	"errors"
+	"file-clone-validator/core/signature"
+	"file-clone-validator/core/stream"
 	"file-clone-validator/core/validator"
+	"file-clone-validator/pkg/clonevalidator"
 	"fmt"
 	"github.com/spf13/cobra"
 	"log/slog"
@@ -12,13 +15,24 @@ import (
 var (
 	targetDir      string
 	metaFilePath   string
+	metaFormat     string
+	metaRoot       string
 	validateType   SourceType
 	validatorCount int
+	reportPath     string
+	reportFormat   string
+	summaryPath    string
+	srcMerklePath  string
+	dstMerklePath  string
+	extraItems     bool
 
 	ValidateCmd = &cobra.Command{
 		Use:   "validate",
 		Short: "Validate the metadata file",
-		Long:  "Validate a metadata file with the specified target directory or storage bucket",
+		Long: "Validate a metadata file with the specified target directory, storage bucket or archive. The metadata " +
+			"can also be received from a generate run with --serve-manifest while it is generated, with --meta " +
+			"tcp://host:port. The symbolic links of a target directory are not followed: they are compared as links, " +
+			"by their link target, like generate records them",
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if targetDir == "" || metaFilePath == "" {
 				return fmt.Errorf("target directory and metadata file path must be specified. "+
@@ -29,35 +43,117 @@ var (
 				return fmt.Errorf("validator count must be greater than 0. got %d", validatorCount)
 			}
 
-			if validateType != FS && validateType != OSS {
-				return fmt.Errorf("invalid source type: %s. expect [fs|oss]", validateType)
+			if (srcMerklePath == "") != (dstMerklePath == "") {
+				return fmt.Errorf("source and target merkle tree files must be specified together. "+
+					"got source: %s, target: %s", srcMerklePath, dstMerklePath)
+			}
+
+			if _, streamed := stream.ParseAddress(metaFilePath); streamed && metaFormat != clonevalidator.MetaFormatJSON {
+				return fmt.Errorf("a streamed metadata file is in the %s format. got %s", clonevalidator.MetaFormatJSON,
+					metaFormat)
+			}
+
+			switch metaFormat {
+			case clonevalidator.MetaFormatJSON:
+				if metaRoot != "" {
+					return fmt.Errorf("metadata root can only be specified for the other metadata formats than %s",
+						clonevalidator.MetaFormatJSON)
+				}
+			case clonevalidator.MetaFormatMtree, clonevalidator.MetaFormatMD5Sum, clonevalidator.MetaFormatSHA256Sum,
+				clonevalidator.MetaFormatHashdeep:
+			default:
+				return fmt.Errorf("invalid metadata format: %s. expect [%s|%s|%s|%s|%s]", metaFormat,
+					clonevalidator.MetaFormatJSON, clonevalidator.MetaFormatMtree, clonevalidator.MetaFormatMD5Sum,
+					clonevalidator.MetaFormatSHA256Sum, clonevalidator.MetaFormatHashdeep)
+			}
+
+			if reportFormat != validator.ReportFormatText && reportFormat != validator.ReportFormatJSON {
+				return fmt.Errorf("invalid report format: %s. expect [text|json]", reportFormat)
+			}
+
+			if err := validateSignaturePolicy(); err != nil {
+				return err
+			}
+
+			if err := validateStreamFlags(); err != nil {
+				return err
+			}
+
+			if validateType != FS && validateType != OSS && validateType != Tar && validateType != Zip {
+				return fmt.Errorf("invalid source type: %s. expect [fs|oss|tar|zip]", validateType)
 			}
 
 			slog.Info("Finish to validate flags:",
 				slog.String("TargetDir", targetDir),
 				slog.String("MetaFilePath", metaFilePath),
+				slog.String("MetaFormat", metaFormat),
+				slog.String("MetaRoot", metaRoot),
 				slog.String("SourceType", string(validateType)),
 				slog.Int("ValidatorCount", validatorCount),
+				slog.String("ReportPath", reportPath),
+				slog.String("ReportFormat", reportFormat),
+				slog.String("SummaryPath", summaryPath),
+				slog.String("PublicKeyPath", publicKeyPath),
+				slog.String("SignaturePolicy", signaturePolicy),
+				slog.Bool("ExtraItems", extraItems),
 			)
 
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			reporter, err := validator.NewReporter("./error_report.txt")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+			startMetricsServer(ctx)
+
+			closeProgress, err := setupProgress()
 			if err != nil {
-				return fmt.Errorf("failed to create reporter: %w", err)
+				return err
 			}
-			defer reporter.Flush()
+			defer closeProgress()
 
-			ctx := context.Background()
 			switch validateType {
-			case FS:
-				v, err := validator.NewFileValidator(targetDir, reporter)
+			case FS, Tar, Zip:
+				opts := clonevalidator.ValidateOptions{
+					TargetDir:        targetDir,
+					TargetKind:       clonevalidator.Kind(validateType),
+					MetaFilePath:     metaFilePath,
+					MetaFormat:       metaFormat,
+					MetaRoot:         metaRoot,
+					ValidatorCount:   validatorCount,
+					ReportPath:       reportPath,
+					ReportFormat:     reportFormat,
+					SummaryPath:      summaryPath,
+					RequireSignature: signaturePolicy == signaturePolicyRequire,
+					SourceMerklePath: srcMerklePath,
+					TargetMerklePath: dstMerklePath,
+					ExtraItems:       extraItems,
+					StreamToken:      streamToken,
+				}
+				if opts.StreamTLS, err = streamTLSConfig(); err != nil {
+					return err
+				}
+				if publicKeyPath != "" {
+					if opts.PublicKey, err = signature.LoadPublicKey(publicKeyPath); err != nil {
+						return err
+					}
+				}
+
+				result, err := clonevalidator.Validate(ctx, opts)
 				if err != nil {
-					return fmt.Errorf("failed to create file validator: %w", err)
+					return err
 				}
 
-				return v.Validate(ctx, metaFilePath, validatorCount)
+				slog.Info("Finish to validate:",
+					slog.Uint64("ItemCount", result.ItemCount),
+					slog.Bool("SignatureVerified", result.SignatureVerified),
+					slog.Any("Findings", result.Findings),
+					slog.Bool("Passed", result.Passed()),
+					slog.Duration("Duration", result.Duration),
+				)
 			case OSS:
 			default:
 				return errors.New("not implemented yet")
@@ -69,8 +165,22 @@ var (
 )
 
 func initValidateCmd() {
-	ValidateCmd.PersistentFlags().StringVarP(&targetDir, "target", "t", "", "the target directory or storage bucket")
-	ValidateCmd.PersistentFlags().StringVarP(&metaFilePath, "meta", "m", "", "the metadata file path")
-	ValidateCmd.PersistentFlags().StringVarP((*string)(&validateType), "type", "y", "fs", "the type of the target. [fs|oss]")
+	ValidateCmd.PersistentFlags().StringVarP(&targetDir, "target", "t", "", "the target directory, storage bucket or archive path. symbolic links in a target directory are not followed")
+	ValidateCmd.PersistentFlags().StringVarP(&metaFilePath, "meta", "m", "", "the metadata file path, or tcp://host:port to receive it from a generate run with --serve-manifest")
+	ValidateCmd.PersistentFlags().StringVar(&metaFormat, "meta-format", clonevalidator.MetaFormatJSON, "the format of the metadata file. an mtree specification or a checksum list is validated on the attributes it records. [json|mtree|md5sum|sha256sum|hashdeep]")
+	ValidateCmd.PersistentFlags().StringVar(&metaRoot, "meta-root", "", "the directory the absolute paths of an mtree specification or a checksum list are under. the target if empty")
+	ValidateCmd.PersistentFlags().StringVarP((*string)(&validateType), "type", "y", "fs", "the type of the target. [fs|oss|tar|zip]")
 	ValidateCmd.PersistentFlags().IntVarP(&validatorCount, "validator", "v", 16, "the number of validators to use")
+	ValidateCmd.PersistentFlags().StringVar(&publicKeyPath, "public-key", "", "public key to verify the metadata file signature with. not verified if empty")
+	ValidateCmd.PersistentFlags().StringVar(&signaturePolicy, "signature-policy", signaturePolicyRequire, "what to do with an unsigned or invalid metadata file when a public key is given. [require|warn]")
+	ValidateCmd.PersistentFlags().StringVar(&srcMerklePath, "source-merkle", "", "the merkle tree file of the source. used with --target-merkle to skip identical subtrees")
+	ValidateCmd.PersistentFlags().StringVar(&dstMerklePath, "target-merkle", "", "the merkle tree file of the target. used with --source-merkle to skip identical subtrees")
+	ValidateCmd.PersistentFlags().BoolVar(&extraItems, "extra", false, "walk a target directory for the items which are not in the metadata file, and report the moved ones. always done for the archives")
+	ValidateCmd.PersistentFlags().StringVar(&reportPath, "report", "./error_report.txt", "the path to write the error report to")
+	ValidateCmd.PersistentFlags().StringVar(&reportFormat, "report-format", validator.ReportFormatText, "the format of the error report. the json format is read by repair. [text|json]")
+	ValidateCmd.PersistentFlags().StringVar(&summaryPath, "summary", "", "the path to write the json summary of the validation to. used by merge-reports")
+	addThrottleFlags(ValidateCmd)
+	addStreamFlags(ValidateCmd)
+	addMetricsFlags(ValidateCmd)
+	addProgressFlags(ValidateCmd)
 }
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"file-clone-validator/core/merkle"
+	"file-clone-validator/core/signature"
+	"file-clone-validator/core/watch"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+var (
+	watchMetaPath   string
+	watchOutputPath string
+	watchDeltaPath  string
+	watchSettle     time.Duration
+	watchCheckpoint time.Duration
+
+	WatchCmd = &cobra.Command{
+		Use:   "watch",
+		Short: "Keep a metadata file up to date while the source changes",
+		Long: "Watch the source directory of a metadata file for changes (inotify on Linux), retrieve the metadata of the " +
+			"touched paths again and record the deletions. Every change is appended to a delta list, and the updated " +
+			"metadata file is written periodically and on exit (SIGINT or SIGTERM). The detached signature of the " +
+			"written metadata file is removed, sign it again if needed, and the merkle tree next to it is rebuilt",
+		Example: "./binary watch --meta ./output/meta.out --delta ./output/delta.jsonl",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if watchMetaPath == "" || watchDeltaPath == "" {
+				return fmt.Errorf("metadata file path and delta list path must be specified. "+
+					"got metadata file path: %s, delta list path: %s", watchMetaPath, watchDeltaPath)
+			}
+			if watchOutputPath == "" {
+				watchOutputPath = watchMetaPath
+			}
+
+			if watchSettle <= 0 || watchCheckpoint <= 0 {
+				return fmt.Errorf("settle and checkpoint intervals must be greater than 0. got settle: %s, checkpoint: %s",
+					watchSettle, watchCheckpoint)
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("MetaFilePath", watchMetaPath),
+				slog.String("OutputPath", watchOutputPath),
+				slog.String("DeltaPath", watchDeltaPath),
+				slog.Duration("Settle", watchSettle),
+				slog.Duration("Checkpoint", watchCheckpoint),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+			startMetricsServer(ctx)
+
+			merklePath := filepath.Join(filepath.Dir(watchOutputPath), merkle.FileName)
+			exclude := []string{watchMetaPath, watchOutputPath, watchOutputPath + ".tmp", watchDeltaPath,
+				watchOutputPath + signature.Suffix, merklePath, merklePath + ".tmp"}
+			w, err := watch.New(watchMetaPath, watch.Options{Settle: watchSettle, Exclude: exclude})
+			if err != nil {
+				return err
+			}
+
+			delta, err := os.OpenFile(watchDeltaPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open delta list: %w", err)
+			}
+			defer delta.Close()
+			encoder := json.NewEncoder(delta)
+
+			metaPath, err := filepath.Abs(watchMetaPath)
+			if err != nil {
+				return err
+			}
+			outputPath, err := filepath.Abs(watchOutputPath)
+			if err != nil {
+				return err
+			}
+			go func() { // checkpoint the metadata file
+				ticker := time.NewTicker(watchCheckpoint)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						if _err := w.WriteMetaFile(outputPath, false); _err != nil {
+							slog.Error("Failed to write metadata file:", slog.String("OutputPath", outputPath), slog.Any("Error", _err))
+						}
+					}
+				}
+			}()
+
+			err = w.Run(ctx, func(change watch.Change) {
+				slog.Debug("Record change:", slog.String("Op", change.Op), slog.String("Path", change.Path))
+				if _err := encoder.Encode(&change); _err != nil {
+					slog.Error("Failed to write delta list:", slog.String("DeltaPath", watchDeltaPath), slog.Any("Error", _err))
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			if err = w.WriteMetaFile(outputPath, outputPath != metaPath); err != nil {
+				return fmt.Errorf("failed to write metadata file: %w", err)
+			}
+			slog.Info("Finish to watch:", slog.String("SourceDir", w.Root()), slog.Uint64("Changes", w.Changes()))
+			return nil
+		},
+	}
+)
+
+func initWatchCmd() {
+	WatchCmd.PersistentFlags().StringVarP(&watchMetaPath, "meta", "m", "", "the metadata file of the source directory to watch")
+	WatchCmd.PersistentFlags().StringVarP(&watchOutputPath, "output", "o", "", "the path to write the updated metadata file to. the metadata file is updated in place if empty")
+	WatchCmd.PersistentFlags().StringVar(&watchDeltaPath, "delta", "./delta.jsonl", "the path to append the json changes to")
+	WatchCmd.PersistentFlags().DurationVar(&watchSettle, "settle", time.Second, "how long the touched paths are collected before their metadata is retrieved again")
+	WatchCmd.PersistentFlags().DurationVar(&watchCheckpoint, "checkpoint", time.Minute, "interval between two writes of the updated metadata file")
+	addThrottleFlags(WatchCmd)
+	addMetricsFlags(WatchCmd)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"file-clone-validator/core/distributed"
+	"file-clone-validator/core/stream"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+)
+
+var (
+	workerCoordinatorAddr string
+	workerTargetDir       string
+	workerName            string
+	workerValidatorCount  int
+	workerTLS             bool
+	workerTLSCAPath       string
+
+	WorkerCmd = &cobra.Command{
+		Use:     "worker",
+		Short:   "Validate entries served by a coordinator",
+		Long:    "Connect to a coordinator and validate the entries it serves against the local target directory",
+		Example: "./binary worker --coordinator 10.0.0.1:7070 --target ./ --validator 16 --token secret --tls-ca ./ca.pem",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if workerCoordinatorAddr == "" || workerTargetDir == "" {
+				return fmt.Errorf("coordinator address and target directory must be specified. "+
+					"got coordinator address: %s, target directory: %s", workerCoordinatorAddr, workerTargetDir)
+			}
+
+			if workerValidatorCount < 1 {
+				return fmt.Errorf("validator count must be greater than 0. got %d", workerValidatorCount)
+			}
+
+			if clusterToken != "" && !workerTLS && workerTLSCAPath == "" {
+				return fmt.Errorf("token requires --tls or --tls-ca, it would be sent in clear otherwise")
+			}
+
+			if workerName == "" {
+				workerName, _ = os.Hostname()
+			}
+
+			slog.Info("Finish to validate flags:",
+				slog.String("CoordinatorAddr", workerCoordinatorAddr),
+				slog.String("TargetDir", workerTargetDir),
+				slog.String("Name", workerName),
+				slog.Int("ValidatorCount", workerValidatorCount),
+				slog.Bool("TLS", workerTLS || workerTLSCAPath != ""),
+			)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := setupThrottle(ctx); err != nil {
+				return err
+			}
+			startMetricsServer(ctx)
+
+			opts := distributed.WorkerOptions{
+				Name:           workerName,
+				TargetDir:      workerTargetDir,
+				ValidatorCount: workerValidatorCount,
+				Token:          clusterToken,
+			}
+			if workerTLS || workerTLSCAPath != "" {
+				var err error
+				if opts.TLS, err = stream.ClientTLSConfig(workerTLSCAPath); err != nil {
+					return err
+				}
+			}
+			return distributed.RunWorker(ctx, workerCoordinatorAddr, opts)
+		},
+	}
+)
+
+func initWorkerCmd() {
+	WorkerCmd.PersistentFlags().StringVarP(&workerCoordinatorAddr, "coordinator", "c", "", "the address of the coordinator")
+	WorkerCmd.PersistentFlags().StringVarP(&workerTargetDir, "target", "t", "", "the local target directory")
+	WorkerCmd.PersistentFlags().StringVar(&workerName, "name", "", "the name of the worker in the coordinator logs. the hostname if empty")
+	WorkerCmd.PersistentFlags().IntVarP(&workerValidatorCount, "validator", "v", 16, "the number of leases to validate concurrently")
+	WorkerCmd.PersistentFlags().StringVar(&clusterToken, "token", "", "the shared secret of the coordinator. requires --tls or --tls-ca, as it is sent in clear otherwise")
+	WorkerCmd.PersistentFlags().BoolVar(&workerTLS, "tls", false, "connect to the coordinator with TLS")
+	WorkerCmd.PersistentFlags().StringVar(&workerTLSCAPath, "tls-ca", "", "the PEM certificates which sign the certificate of the coordinator. the system roots if empty. implies --tls")
+	addThrottleFlags(WorkerCmd)
+	addMetricsFlags(WorkerCmd)
+}
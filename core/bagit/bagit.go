@@ -0,0 +1,150 @@
+// Package bagit creates and validates the BagIt bags of RFC 8493: a payload directory named data, next to the tag
+// files bagit.txt, bag-info.txt, the payload manifests manifest-<algorithm>.txt and the tag manifests
+// tagmanifest-<algorithm>.txt.
+package bagit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Version is the BagIt version of the created bags.
+const Version = "1.0"
+
+// Files and directories of a bag.
+const (
+	bagitTxt          = "bagit.txt"
+	bagInfoTxt        = "bag-info.txt"
+	payloadDir        = "data"
+	manifestPrefix    = "manifest-"
+	tagManifestPrefix = "tagmanifest-"
+	manifestSuffix    = ".txt"
+)
+
+// Labels of the tag files.
+const (
+	labelVersion  = "BagIt-Version"
+	labelEncoding = "Tag-File-Character-Encoding"
+	labelAgent    = "Bag-Software-Agent"
+	labelDate     = "Bagging-Date"
+	labelOxum     = "Payload-Oxum"
+)
+
+// Tag is a "Label: Value" line of a tag file, e.g. of bag-info.txt.
+type Tag struct {
+	Label string
+	Value string
+}
+
+// ParseTag parses a "Label: Value" string, e.g. a flag of the command line.
+func ParseTag(s string) (Tag, error) {
+	label, value, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(label) == "" {
+		return Tag{}, fmt.Errorf("invalid tag %q. expect \"Label: Value\"", s)
+	}
+	return Tag{Label: strings.TrimSpace(label), Value: strings.TrimSpace(value)}, nil
+}
+
+// Oxum is the octet count and the stream count of the payload of a bag, see the Payload-Oxum label.
+type Oxum struct {
+	Octets  uint64
+	Streams uint64
+}
+
+func (o Oxum) String() string {
+	return fmt.Sprintf("%d.%d", o.Octets, o.Streams)
+}
+
+// parseOxum parses the value of a Payload-Oxum label.
+func parseOxum(s string) (Oxum, error) {
+	octets, streams, ok := strings.Cut(s, ".")
+	if !ok {
+		return Oxum{}, fmt.Errorf("invalid %s: %s", labelOxum, s)
+	}
+	var oxum Oxum
+	var err error
+	if oxum.Octets, err = strconv.ParseUint(octets, 10, 64); err != nil {
+		return Oxum{}, fmt.Errorf("invalid %s: %s", labelOxum, s)
+	}
+	if oxum.Streams, err = strconv.ParseUint(streams, 10, 64); err != nil {
+		return Oxum{}, fmt.Errorf("invalid %s: %s", labelOxum, s)
+	}
+	return oxum, nil
+}
+
+// readTagFile reads the tags of a tag file. The lines starting with a space or a tab continue the value of the
+// previous tag.
+func readTagFile(path string) ([]Tag, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tags []Tag
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSuffix(strings.TrimPrefix(scanner.Text(), "\ufeff"), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(tags) > 0 {
+			tags[len(tags)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		tag, _err := ParseTag(line)
+		if _err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filepath.Base(path), lineNo, _err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, scanner.Err()
+}
+
+// tagValue returns the value of the first tag with the label.
+func tagValue(tags []Tag, label string) (string, bool) {
+	for _, tag := range tags {
+		if strings.EqualFold(tag.Label, label) {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// writeTagFile writes the tags to a tag file.
+func writeTagFile(path string, tags []Tag) error {
+	var b strings.Builder
+	for _, tag := range tags {
+		fmt.Fprintf(&b, "%s: %s\n", tag.Label, tag.Value)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// pathEncoder percent-encodes the characters of a manifest path which would break its line, see RFC 8493 2.1.3.
+var pathEncoder = strings.NewReplacer("%", "%25", "\n", "%0A", "\r", "%0D")
+
+// pathDecoder reverses pathEncoder.
+var pathDecoder = strings.NewReplacer("%25", "%", "%0A", "\n", "%0a", "\n", "%0D", "\r", "%0d", "\r")
+
+// manifests returns the paths of the manifests of a bag by algorithm.
+// Input:
+// - bagDir: the root of the bag
+// - prefix: manifestPrefix or tagManifestPrefix
+func manifests(bagDir, prefix string) (map[string]string, error) {
+	paths, err := filepath.Glob(filepath.Join(bagDir, prefix+"*"+manifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	byAlgorithm := make(map[string]string, len(paths))
+	for _, path := range paths {
+		algorithm := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), manifestSuffix)
+		byAlgorithm[algorithm] = path
+	}
+	return byAlgorithm, nil
+}
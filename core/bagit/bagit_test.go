@@ -0,0 +1,116 @@
+package bagit
+
+import (
+	"context"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/utils"
+	"file-clone-validator/core/validator"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	tag, err := ParseTag("Source-Organization:  Example: Org ")
+	require.NoError(t, err)
+	require.Equal(t, Tag{Label: "Source-Organization", Value: "Example: Org"}, tag)
+	_, err = ParseTag("no label")
+	require.Error(t, err)
+
+	oxum, err := parseOxum("10.2")
+	require.NoError(t, err)
+	require.Equal(t, Oxum{Octets: 10, Streams: 2}, oxum)
+	_, err = parseOxum("10")
+	require.Error(t, err)
+}
+
+func TestCreateValidate(t *testing.T) {
+	bagDir, outDir := t.TempDir(), t.TempDir()
+	dataDir := filepath.Join(bagDir, payloadDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "a.txt"), []byte("a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "sub", "b%c.txt"), []byte("bb"), 0600))
+	metaPath := testutil.WriteMetaFile(t, dataDir, outDir)
+
+	oxum, err := Create(context.Background(), metaPath, bagDir, CreateOptions{
+		Algorithms: []string{utils.HashMD5, utils.HashSHA256},
+		Info:       []Tag{{Label: "Source-Organization", Value: "Example"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, Oxum{Octets: 3, Streams: 2}, oxum)
+
+	manifest, err := os.ReadFile(filepath.Join(bagDir, "manifest-sha256.txt"))
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), "  data/sub/b%25c.txt\n")
+	info, err := readTagFile(filepath.Join(bagDir, bagInfoTxt))
+	require.NoError(t, err)
+	value, ok := tagValue(info, labelOxum)
+	require.True(t, ok)
+	require.Equal(t, "3.2", value)
+	for _, name := range []string{bagitTxt, "tagmanifest-md5.txt", "tagmanifest-sha256.txt"} {
+		require.FileExists(t, filepath.Join(bagDir, name))
+	}
+
+	// every listed file is read once for both algorithms
+	var listedSize uint64
+	for _, name := range []string{"data/a.txt", "data/sub/b%c.txt", bagitTxt, bagInfoTxt, "manifest-md5.txt",
+		"manifest-sha256.txt"} {
+		fi, _err := os.Stat(filepath.Join(bagDir, name))
+		require.NoError(t, _err)
+		listedSize += uint64(fi.Size())
+	}
+	hashed := utils.HashedBytes()
+	counts, result := validate(t, bagDir)
+	require.Equal(t, listedSize, utils.HashedBytes()-hashed)
+	require.Empty(t, counts)
+	require.Equal(t, Version, result.Version)
+	require.Equal(t, []string{"manifest-md5.txt", "manifest-sha256.txt", "tagmanifest-md5.txt",
+		"tagmanifest-sha256.txt"}, result.Manifests)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "a.txt"), []byte("z"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "extra.txt"), []byte("e"), 0640))
+	counts, _ = validate(t, bagDir)
+	require.Equal(t, map[string]uint64{
+		validator.ReasonMetaMismatch: 2, // a.txt in both payload manifests
+		validator.ReasonExtraFile:    2, // extra.txt in both payload manifests
+		validator.ReasonInvalidBag:   1, // Payload-Oxum
+	}, counts)
+
+	require.NoError(t, os.Remove(filepath.Join(bagDir, bagitTxt)))
+	_, err = Validate(context.Background(), bagDir, newReporter(t), 2)
+	require.ErrorContains(t, err, "is not a bag")
+}
+
+func TestValidateInvalidManifest(t *testing.T) {
+	bagDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(bagDir, payloadDir), 0755))
+	require.NoError(t, writeTagFile(filepath.Join(bagDir, bagitTxt), []Tag{{Label: labelVersion, Value: Version}}))
+	manifest := strings.Join([]string{
+		"0cc175b9c0f1b6a831c399e269772661 \t data/a.txt",
+		"0cc175b9c0f1b6a831c399e269772661  a.txt",
+		"0cc175b9c0f1b6a831c399e269772661",
+		"",
+	}, "\n")
+	require.NoError(t, os.WriteFile(filepath.Join(bagDir, "manifest-md5.txt"), []byte(manifest), 0644))
+
+	counts, _ := validate(t, bagDir)
+	require.Equal(t, map[string]uint64{
+		validator.ReasonFileNotFound: 1, // data/a.txt
+		validator.ReasonInvalidBag:   2, // a.txt outside of the payload and the line without a path
+	}, counts)
+}
+
+func newReporter(t *testing.T) *validator.Reporter {
+	reporter, err := validator.NewReporter("")
+	require.NoError(t, err)
+	return reporter
+}
+
+func validate(t *testing.T, bagDir string) (map[string]uint64, *Result) {
+	reporter := newReporter(t)
+	result, err := Validate(context.Background(), bagDir, reporter, 2)
+	require.NoError(t, err)
+	return reporter.Counts(), result
+}
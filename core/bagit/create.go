@@ -0,0 +1,161 @@
+package bagit
+
+import (
+	"bufio"
+	"context"
+	"file-clone-validator/core/checksum"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// softwareAgent is the Bag-Software-Agent of the created bags.
+const softwareAgent = "file-clone-validator"
+
+// CreateOptions configures Create.
+type CreateOptions struct {
+	// Algorithms are the algorithms of the manifests, e.g. utils.HashSHA256. utils.HashMD5 if empty.
+	Algorithms []string
+
+	// SourceDir is the directory the files are read from when the metadata file does not record their hash with one
+	// of the algorithms. The source directory of the metadata file if empty, see checksum.Files.
+	SourceDir string
+
+	// Info are the labels added to bag-info.txt, e.g. Source-Organization.
+	Info []Tag
+}
+
+// Create writes the tag files of a bag from a metadata file: the payload is the source directory of the metadata file,
+// which is expected to be the data directory of the bag.
+// Input:
+// - ctx: cancels the creation
+// - metaPath: the metadata file of the payload
+// - bagDir: the root of the bag, where the tag files are written
+// - opts: the algorithms and the labels of the bag
+// Output:
+// - oxum: the Payload-Oxum of the bag
+// Note:
+// - Only the regular files are listed, as BagIt has no notion of the other types. The empty directories are not part
+// of the bag
+func Create(ctx context.Context, metaPath, bagDir string, opts CreateOptions) (oxum Oxum, err error) {
+	algorithms := opts.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{utils.HashMD5}
+	}
+	for _, algorithm := range algorithms {
+		if !checksum.SupportedAlgorithm(algorithm) {
+			return Oxum{}, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+		}
+	}
+
+	if bagDir, err = filepath.Abs(bagDir); err != nil {
+		return Oxum{}, err
+	}
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return Oxum{}, err
+	}
+	if dataDir := filepath.Join(bagDir, payloadDir); header.SourceDir != dataDir && opts.SourceDir != dataDir {
+		slog.Warn("The payload is not in the bag, copy it to the data directory of the bag:",
+			slog.String("SourceDir", header.SourceDir), slog.String("DataDir", dataDir))
+	}
+	if err = os.MkdirAll(bagDir, 0755); err != nil {
+		return Oxum{}, err
+	}
+
+	slog.Info("Start to create bag:", slog.String("MetaFilePath", metaPath), slog.String("BagDir", bagDir),
+		slog.Any("Algorithms", algorithms))
+	manifestNames := make([]string, 0, len(algorithms))
+	files := make([]*os.File, 0, len(algorithms))
+	writers := make([]*bufio.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		name := manifestPrefix + algorithm + manifestSuffix
+		file, _err := os.Create(filepath.Join(bagDir, name))
+		if _err != nil {
+			return Oxum{}, fmt.Errorf("failed to create manifest: %w", _err)
+		}
+		defer file.Close()
+		manifestNames = append(manifestNames, name)
+		files, writers = append(files, file), append(writers, bufio.NewWriter(file))
+	}
+
+	write := func(rel string, item *metadata.Meta, hashes []string) error {
+		for i, hash := range hashes {
+			if _, _err := fmt.Fprintf(writers[i], "%s  %s/%s\n", hash, payloadDir, pathEncoder.Replace(rel)); _err != nil {
+				return _err
+			}
+		}
+		oxum.Octets += item.Common.Size
+		oxum.Streams++
+		return nil
+	}
+	if err = checksum.Files(ctx, metaPath, opts.SourceDir, algorithms, write); err != nil {
+		return Oxum{}, fmt.Errorf("failed to write manifests: %w", err)
+	}
+	for i, w := range writers {
+		if err = w.Flush(); err != nil {
+			return Oxum{}, err
+		}
+		if err = files[i].Close(); err != nil { // the content may only be written on close, e.g. on NFS
+			return Oxum{}, fmt.Errorf("failed to close manifest: %w", err)
+		}
+	}
+
+	err = writeTagFile(filepath.Join(bagDir, bagitTxt), []Tag{
+		{Label: labelVersion, Value: Version},
+		{Label: labelEncoding, Value: "UTF-8"},
+	})
+	if err != nil {
+		return Oxum{}, err
+	}
+	info := append([]Tag{
+		{Label: labelAgent, Value: softwareAgent},
+		{Label: labelDate, Value: time.Now().Format(time.DateOnly)},
+		{Label: labelOxum, Value: oxum.String()},
+	}, opts.Info...)
+	if err = writeTagFile(filepath.Join(bagDir, bagInfoTxt), info); err != nil {
+		return Oxum{}, err
+	}
+
+	tagFiles := append([]string{bagitTxt, bagInfoTxt}, manifestNames...)
+	if err = writeTagManifests(ctx, bagDir, tagFiles, algorithms); err != nil {
+		return Oxum{}, fmt.Errorf("failed to write tag manifests: %w", err)
+	}
+
+	slog.Info("Finish to create bag:", slog.String("BagDir", bagDir), slog.String("PayloadOxum", oxum.String()))
+	return oxum, nil
+}
+
+// writeTagManifests writes the tag manifests of the tag files.
+func writeTagManifests(ctx context.Context, bagDir string, tagFiles, algorithms []string) error {
+	sort.Strings(tagFiles)
+	lines := make([]string, len(algorithms))
+	for _, name := range tagFiles {
+		file, err := os.Open(filepath.Join(bagDir, name))
+		if err != nil {
+			return err
+		}
+		hashes, err := utils.HashesReader(ctx, file, algorithms...)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		for i, hash := range hashes {
+			lines[i] += fmt.Sprintf("%s  %s\n", hash, name)
+		}
+	}
+
+	for i, algorithm := range algorithms {
+		path := filepath.Join(bagDir, tagManifestPrefix+algorithm+manifestSuffix)
+		if err := os.WriteFile(path, []byte(lines[i]), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package bagit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"file-clone-validator/core/checksum"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Result is the result of a Validate run.
+type Result struct {
+	// Version is the BagIt-Version of the bag.
+	Version string
+
+	// Manifests are the names of the validated payload and tag manifests.
+	Manifests []string
+
+	// Oxum is the Payload-Oxum of the data directory.
+	Oxum Oxum
+}
+
+// Validate validates a bag: the files listed by the payload and tag manifests must match their hashes, the data
+// directory must not contain files which are not listed by every payload manifest, and the Payload-Oxum of
+// bag-info.txt must match the data directory. The findings are recorded by the reporter.
+// Input:
+// - ctx: cancels the validation
+// - bagDir: the root of the bag
+// - reporter: records the findings
+// - workerCount: the number of goroutines validating the listed files
+// Output:
+// - result: the description of the bag
+// Note:
+// - The manifests of the algorithms which are not supported, see checksum.SupportedAlgorithm, are skipped with a
+// warning
+// - A file listed by several manifests is read once and hashed with all their algorithms, see validateFiles
+func Validate(ctx context.Context, bagDir string, reporter *validator.Reporter, workerCount int) (*Result, error) {
+	if workerCount < 1 {
+		return nil, fmt.Errorf("worker count must be greater than 0. got %d", workerCount)
+	}
+	bagDir, err := filepath.Abs(bagDir)
+	if err != nil {
+		return nil, err
+	}
+	invalid := func(format string, args ...any) {
+		reporter.Record(validator.ReasonInvalidBag, fmt.Errorf("bag: %s, error: %s", bagDir,
+			fmt.Sprintf(format, args...)))
+	}
+
+	declaration, err := readTagFile(filepath.Join(bagDir, bagitTxt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the bag declaration, %s is not a bag: %w", bagDir, err)
+	}
+	result := &Result{}
+	var ok bool
+	if result.Version, ok = tagValue(declaration, labelVersion); !ok {
+		invalid("%s has no %s", bagitTxt, labelVersion)
+	}
+
+	payloadManifests, err := manifests(bagDir, manifestPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(payloadManifests) == 0 {
+		invalid("no payload manifest")
+	}
+	tagManifests, err := manifests(bagDir, tagManifestPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Start to validate bag:", slog.String("BagDir", bagDir), slog.String("Version", result.Version))
+	expected := make(map[string][]*metadata.Meta) // the items of every manifest listing a path
+	var listed []map[string]*metadata.Meta
+	var listedBy []string
+	for _, m := range []struct {
+		paths   map[string]string
+		payload bool
+	}{{payloadManifests, true}, {tagManifests, false}} {
+		for _, algorithm := range sortedKeys(m.paths) {
+			manifestPath := m.paths[algorithm]
+			if !checksum.SupportedAlgorithm(algorithm) {
+				slog.Warn("Skip manifest of unsupported algorithm:", slog.String("Manifest", manifestPath))
+				continue
+			}
+
+			items, _err := readManifest(bagDir, manifestPath, algorithm, m.payload, reporter)
+			if _err != nil {
+				return nil, _err
+			}
+			for rel, item := range items {
+				expected[rel] = append(expected[rel], item)
+			}
+			result.Manifests = append(result.Manifests, filepath.Base(manifestPath))
+			if m.payload {
+				listed, listedBy = append(listed, items), append(listedBy, filepath.Base(manifestPath))
+			}
+		}
+	}
+
+	if err = validateFiles(ctx, bagDir, expected, reporter, workerCount); err != nil {
+		return nil, err
+	}
+
+	if result.Oxum, err = checkPayload(bagDir, listed, listedBy, reporter); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		invalid("the payload directory %s is missing", payloadDir)
+	}
+
+	info, err := readTagFile(filepath.Join(bagDir, bagInfoTxt))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		invalid("failed to read %s: %s", bagInfoTxt, err)
+	}
+	if value, _ok := tagValue(info, labelOxum); _ok {
+		if oxum, _err := parseOxum(value); _err != nil {
+			invalid("%s", _err)
+		} else if oxum != result.Oxum {
+			invalid("%s: %s != %s", labelOxum, oxum, result.Oxum)
+		}
+	}
+
+	slog.Info("Finish to validate bag:", slog.String("BagDir", bagDir), slog.Any("Manifests", result.Manifests),
+		slog.String("PayloadOxum", result.Oxum.String()))
+	return result, nil
+}
+
+// readManifest reads the lines of a manifest. The invalid lines are recorded by the reporter.
+// Input:
+// - payload: whether the manifest is a payload manifest, whose files must be in the data directory
+// Output:
+// - items: the items of the listed files, by their path relative to the root of the bag with slash separators
+func readManifest(bagDir, manifestPath, algorithm string, payload bool,
+	reporter *validator.Reporter) (items map[string]*metadata.Meta, err error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	name := filepath.Base(manifestPath)
+	items = make(map[string]*metadata.Meta)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		i := strings.IndexAny(line, " \t")
+		if i < 0 || strings.TrimLeft(line[i:], " \t") == "" {
+			reporter.Record(validator.ReasonInvalidBag, fmt.Errorf("bag: %s, error: %s line %d: invalid line %q",
+				bagDir, name, lineNo, line))
+			continue
+		}
+		hash, rel := line[:i], pathDecoder.Replace(strings.TrimLeft(line[i:], " \t"))
+		if payload && !strings.HasPrefix(filepath.ToSlash(filepath.Clean(rel)), payloadDir+"/") {
+			reporter.Record(validator.ReasonInvalidBag, fmt.Errorf("bag: %s, error: %s line %d: %s is not in the "+
+				"payload directory", bagDir, name, lineNo, rel))
+			continue
+		}
+
+		item, _err := checksum.NewMeta(bagDir, rel, algorithm, hash)
+		if _err != nil {
+			reporter.Record(validator.ReasonInvalidBag, fmt.Errorf("bag: %s, error: %s line %d: %s", bagDir, name,
+				lineNo, _err))
+			continue
+		}
+		if rel, _err = filepath.Rel(bagDir, item.Common.Path); _err != nil {
+			return nil, _err
+		}
+		items[filepath.ToSlash(rel)] = item
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", manifestPath, err)
+	}
+	return items, nil
+}
+
+// validateFiles validates the files listed by the manifests with the validator.ValidateRows pipeline of workerCount
+// goroutines. Each file is read once and hashed with the algorithms of all the manifests which list it.
+// Input:
+// - expected: the items of the manifests listing each file, by the path of the file relative to the root of the bag
+func validateFiles(ctx context.Context, bagDir string, expected map[string][]*metadata.Meta,
+	reporter *validator.Reporter, workerCount int) error {
+	rows := &manifestRows{
+		header: datasource.MetaHeader{SourceDir: bagDir, ItemCount: uint64(len(expected))},
+		rels:   make([]string, 0, len(expected)),
+	}
+	for rel := range expected {
+		rows.rels = append(rows.rels, rel)
+	}
+	sort.Strings(rows.rels)
+
+	fv := &fileValidator{fsys: metadata.DirFS(bagDir), expected: expected, reporter: reporter}
+	return validator.ValidateRows(ctx, bagDir, rows, workerCount, fv)
+}
+
+// manifestRows is the validator.RowReader of the files listed by the manifests. Its rows are the paths of the files
+// relative to the root of the bag, rather than serialised items, as a file listed by several manifests has one item
+// per manifest.
+type manifestRows struct {
+	header datasource.MetaHeader
+	rels   []string
+	next   int
+}
+
+func (r *manifestRows) Header() datasource.MetaHeader {
+	return r.header
+}
+
+func (r *manifestRows) Next() ([]byte, error) {
+	if r.next == len(r.rels) {
+		return nil, io.EOF
+	}
+	r.next++
+	return []byte(r.rels[r.next-1]), nil
+}
+
+// fileValidator is the validator.RowValidator of the rows of manifestRows. It is safe for concurrent use.
+type fileValidator struct {
+	fsys     metadata.DirFS
+	expected map[string][]*metadata.Meta // read only
+	reporter *validator.Reporter
+}
+
+func (fv *fileValidator) ValidateRow(ctx context.Context, row []byte, _ *datasource.MetaHeader) (counted bool) {
+	items, ok := fv.expected[string(row)]
+	if !ok {
+		return false
+	}
+	if err := validateFile(ctx, fv.fsys, string(row), items, fv.reporter); err != nil && ctx.Err() == nil {
+		fv.reporter.Record(validator.ReasonRetrieveMetaFail, fmt.Errorf("path: %s, error: %s", string(row), err))
+	}
+	return true
+}
+
+// validateFile validates one file against the items of the manifests listing it and records the findings.
+func validateFile(ctx context.Context, fsys metadata.DirFS, rel string, items []*metadata.Meta,
+	reporter *validator.Reporter) error {
+	record := func(reason, message string) error {
+		for _, item := range items {
+			row, err := metadata.Serialise(item)
+			if err != nil {
+				return err
+			}
+			reporter.Record(reason, fmt.Errorf("source: %s, error: %s", string(row), message))
+		}
+		return nil
+	}
+
+	fi, err := metadata.Lstat(fsys, rel)
+	if err != nil {
+		return record(validator.ReasonFileNotFound, err.Error())
+	}
+	target, err := metadata.RetrieveFSMeta(fsys, rel, items[0].Common.Path, fi, metadata.WithoutHash(),
+		metadata.WithContext(ctx))
+	if err != nil {
+		return record(validator.ReasonRetrieveMetaFail, err.Error())
+	}
+
+	hashes := make([]string, len(items))
+	if target.FileSystem.Type == metadata.FSTypeFile {
+		algorithms := make([]string, len(items))
+		for i, item := range items {
+			algorithms[i] = item.Common.HashAlgorithm
+		}
+
+		file, _err := fsys.Open(rel)
+		if _err != nil {
+			return record(validator.ReasonRetrieveMetaFail, _err.Error())
+		}
+		hashes, _err = utils.HashesReader(ctx, file, algorithms...)
+		file.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if _err != nil {
+			return record(validator.ReasonRetrieveMetaFail, _err.Error())
+		}
+	}
+
+	for i, item := range items {
+		target.Common.Hash, target.Common.HashAlgorithm = hashes[i], item.Common.HashAlgorithm
+		if reasons := item.Equals(target); len(reasons) > 0 {
+			row, _err := metadata.Serialise(item)
+			if _err != nil {
+				return _err
+			}
+			reporter.Record(validator.ReasonMetaMismatch, fmt.Errorf("source: %s, error: %s", string(row),
+				strings.Join(reasons, ",")))
+		}
+	}
+	return nil
+}
+
+// checkPayload walks the data directory of the bag, records the files which are not listed by a payload manifest as
+// extra files, and returns the Payload-Oxum of the directory.
+// Input:
+// - listed: the items listed by every payload manifest, see readManifest
+// - listedBy: the names of the payload manifests
+func checkPayload(bagDir string, listed []map[string]*metadata.Meta, listedBy []string,
+	reporter *validator.Reporter) (oxum Oxum, err error) {
+	fsys := metadata.DirFS(bagDir)
+	err = fs.WalkDir(fsys, payloadDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			oxum.Octets += uint64(fi.Size())
+			oxum.Streams++
+		}
+
+		for i, paths := range listed {
+			if _, ok := paths[name]; ok {
+				continue
+			}
+			item, _err := metadata.RetrieveFSMeta(fsys, name, filepath.Join(bagDir, filepath.FromSlash(name)), fi,
+				metadata.WithoutHash())
+			if _err != nil {
+				return _err
+			}
+			row, _err := metadata.Serialise(item)
+			if _err != nil {
+				return _err
+			}
+			reporter.Record(validator.ReasonExtraFile, fmt.Errorf("target: %s, error: not listed in %s", string(row),
+				listedBy[i]))
+		}
+		return nil
+	})
+	return oxum, err
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
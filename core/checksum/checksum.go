@@ -0,0 +1,127 @@
+// Package checksum converts between the metadata files and the checksum lists of md5sum, sha256sum and hashdeep.
+//
+// A checksum list only records the content of the regular files: the imported items record their name, type, hash
+// and, for hashdeep, their size, see metadata.Meta.Fields, so that the validation only compares those.
+package checksum
+
+import (
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Formats of the checksum lists.
+const (
+	FormatMD5Sum    = "md5sum"    // the output of md5sum, or md5sum --tag
+	FormatSHA256Sum = "sha256sum" // the output of sha256sum, or sha256sum --tag
+	FormatHashdeep  = "hashdeep"  // the output of hashdeep, read by hashdeep -a -k
+)
+
+// ValidFormat reports whether the format is one of the checksum list formats.
+func ValidFormat(format string) bool {
+	return format == FormatMD5Sum || format == FormatSHA256Sum || format == FormatHashdeep
+}
+
+// sumAlgorithm returns the hash algorithm of a sum format.
+func sumAlgorithm(format string) string {
+	if format == FormatSHA256Sum {
+		return utils.HashSHA256
+	}
+	return utils.HashMD5
+}
+
+// hexLen is the length of the hex encoded hashes of the algorithms.
+var hexLen = map[string]int{
+	utils.HashMD5:    32,
+	utils.HashSHA1:   40,
+	utils.HashSHA256: 64,
+	utils.HashSHA512: 128,
+}
+
+// SupportedAlgorithm reports whether the hashes of the algorithm can be imported and exported.
+func SupportedAlgorithm(algorithm string) bool {
+	_, ok := hexLen[algorithm]
+	return ok
+}
+
+// NewMeta returns the metadata of a file of a checksum list.
+// Input:
+// - root: the path the items are recorded under
+// - name: the path of the file in the list, relative to root or absolute under root
+// - algorithm: the algorithm of hash
+// - hash: the hex encoded hash of the file
+func NewMeta(root, name, algorithm, hash string) (*metadata.Meta, error) {
+	if len(hash) != hexLen[algorithm] || strings.Trim(strings.ToLower(hash), "0123456789abcdef") != "" {
+		return nil, fmt.Errorf("invalid %s hash of %s: %s", algorithm, name, hash)
+	}
+
+	var itemPath string
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("file %s is outside of the root %s", name, root)
+		}
+		itemPath = filepath.Join(root, rel)
+	} else {
+		rel := path.Clean(filepath.ToSlash(name))
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			return nil, fmt.Errorf("file %s is outside of the root %s", name, root)
+		}
+		itemPath = filepath.Join(root, filepath.FromSlash(rel))
+	}
+
+	meta := &metadata.Meta{
+		Common: metadata.CommonAttrs{
+			Path: itemPath,
+			Name: filepath.Base(itemPath),
+			Hash: strings.ToLower(hash),
+		},
+		FileSystem: &metadata.FileSystemAttrs{Type: metadata.FSTypeFile},
+		Fields:     []string{metadata.FieldName, metadata.FieldType, metadata.FieldHash},
+	}
+	if algorithm != utils.HashMD5 {
+		meta.Common.HashAlgorithm = algorithm
+	}
+	return meta, nil
+}
+
+// nameEscaper escapes the file names like md5sum, which then prefixes the line with a backslash.
+var nameEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+
+// escapeName escapes a file name of a sum format. escaped is false if the name does not need to be escaped.
+func escapeName(name string) (escapedName string, escaped bool) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return name, false
+	}
+	return nameEscaper.Replace(name), true
+}
+
+// unescapeName reverses escapeName.
+func unescapeName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '\\' {
+			b.WriteByte(name[i])
+			continue
+		}
+		if i+1 >= len(name) {
+			return "", fmt.Errorf("trailing backslash in %q", name)
+		}
+
+		i++
+		switch name[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in %q", name[i], name)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,142 @@
+package checksum
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSums(t *testing.T) {
+	md5A, sha256A := md5Hex("a"), sha256Hex("a")
+	list := strings.Join([]string{
+		md5A + "  ./a.txt",
+		md5A + " *sub/b c.txt",
+		"\\" + md5A + "  new\\nline\\\\.txt",
+		"MD5 (/data/sub/d.txt) = " + strings.ToUpper(md5A),
+		"",
+	}, "\n")
+
+	var items []*metadata.Meta
+	require.NoError(t, Read(strings.NewReader(list), FormatMD5Sum, "/data", func(item *metadata.Meta) error {
+		items = append(items, item)
+		return nil
+	}))
+	require.Len(t, items, 4)
+	require.Equal(t, "/data/a.txt", items[0].Common.Path)
+	require.Equal(t, "/data/sub/b c.txt", items[1].Common.Path)
+	require.Equal(t, "/data/new\nline\\.txt", items[2].Common.Path)
+	require.Equal(t, "/data/sub/d.txt", items[3].Common.Path)
+	require.Equal(t, md5A, items[3].Common.Hash)
+	require.Empty(t, items[3].Common.HashAlgorithm)
+	require.False(t, items[0].Records(metadata.FieldSize))
+
+	err := Read(strings.NewReader(md5A+"  /elsewhere/a.txt\n"), FormatMD5Sum, "/data", func(*metadata.Meta) error { return nil })
+	require.ErrorContains(t, err, "outside of the root")
+	err = Read(strings.NewReader(md5A+"  a.txt\n"), FormatSHA256Sum, "/data", func(*metadata.Meta) error { return nil })
+	require.ErrorContains(t, err, "invalid sha256 hash")
+
+	items = nil
+	require.NoError(t, Read(strings.NewReader(sha256A+"  a.txt\n"), FormatSHA256Sum, "/data", func(item *metadata.Meta) error {
+		items = append(items, item)
+		return nil
+	}))
+	require.Equal(t, utils.HashSHA256, items[0].Common.HashAlgorithm)
+}
+
+func TestReadHashdeep(t *testing.T) {
+	list := strings.Join([]string{
+		"%%%% HASHDEEP-1.0",
+		"%%%% size,md5,sha256,filename",
+		"## Invoked from: /home/user",
+		"## $ hashdeep -r /data",
+		"##",
+		fmt.Sprintf("1,%s,%s,/data/a,b.txt", md5Hex("a"), sha256Hex("a")),
+		"%%%% HASHDEEP-1.0",
+		"%%%% size,sha256,filename",
+		fmt.Sprintf("2,%s,sub/c.txt", sha256Hex("cc")),
+	}, "\n")
+
+	var items []*metadata.Meta
+	require.NoError(t, Read(strings.NewReader(list), FormatHashdeep, "/data", func(item *metadata.Meta) error {
+		items = append(items, item)
+		return nil
+	}))
+	require.Len(t, items, 2)
+	require.Equal(t, "/data/a,b.txt", items[0].Common.Path)
+	require.Equal(t, md5Hex("a"), items[0].Common.Hash, "md5 is preferred")
+	require.Equal(t, uint64(1), items[0].Common.Size)
+	require.True(t, items[0].Records(metadata.FieldSize))
+	require.Equal(t, "/data/sub/c.txt", items[1].Common.Path)
+	require.Equal(t, utils.HashSHA256, items[1].Common.HashAlgorithm)
+
+	err := Read(strings.NewReader("1,abc,a.txt\n"), FormatHashdeep, "/data", func(*metadata.Meta) error { return nil })
+	require.ErrorContains(t, err, "before the header")
+}
+
+func TestWriteImportValidate(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b\\c.txt"), []byte("bb"), 0600))
+	metaPath := testutil.WriteMetaFile(t, srcDir, outDir)
+
+	for _, opts := range []WriteOptions{
+		{Format: FormatMD5Sum},
+		{Format: FormatSHA256Sum},
+		{Format: FormatHashdeep, Algorithm: utils.HashSHA256},
+	} {
+		var list bytes.Buffer
+		count, err := Write(context.Background(), metaPath, &list, opts)
+		require.NoError(t, err, opts.Format)
+		require.Equal(t, uint64(2), count, opts.Format)
+
+		listPath := filepath.Join(t.TempDir(), "list")
+		require.NoError(t, os.WriteFile(listPath, list.Bytes(), 0644))
+		importedPath, err := Import(context.Background(), listPath, opts.Format, srcDir, t.TempDir())
+		require.NoError(t, err, opts.Format)
+
+		header, err := datasource.ReadMetaHeader(importedPath)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), header.ItemCount, opts.Format)
+		require.Empty(t, testutil.Validate(t, srcDir, importedPath), opts.Format)
+	}
+
+	var list bytes.Buffer
+	_, err := Write(context.Background(), metaPath, &list, WriteOptions{Format: FormatMD5Sum})
+	require.NoError(t, err)
+	require.Contains(t, list.String(), fmt.Sprintf("\\%s  sub/b\\\\c.txt\n", md5Hex("bb")))
+
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("z"), 0640))
+	_, err = Write(context.Background(), metaPath, &bytes.Buffer{}, WriteOptions{Format: FormatSHA256Sum})
+	require.ErrorContains(t, err, "has changed since the metadata file was generated")
+
+	listPath := filepath.Join(t.TempDir(), "list")
+	require.NoError(t, os.WriteFile(listPath, list.Bytes(), 0644))
+	importedPath, err := Import(context.Background(), listPath, FormatMD5Sum, srcDir, t.TempDir())
+	require.NoError(t, err)
+	counts := testutil.Validate(t, srcDir, importedPath)
+	require.Equal(t, map[string]uint64{validator.ReasonMetaMismatch: 1}, counts)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
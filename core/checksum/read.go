@@ -0,0 +1,186 @@
+package checksum
+
+import (
+	"bufio"
+	"context"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxLineSize is the longest line of a checksum list Read accepts.
+const maxLineSize = 1 << 20
+
+// tagLine matches the BSD style lines written by md5sum --tag and sha256sum --tag, e.g. "MD5 (a.txt) = 0cc1...".
+var tagLine = regexp.MustCompile(`^(MD5|SHA256) \((.*)\) = ([0-9A-Fa-f]+)$`)
+
+// Read parses a checksum list and calls fn with the metadata of every file.
+// Input:
+// - r: the checksum list
+// - format: FormatMD5Sum, FormatSHA256Sum or FormatHashdeep
+// - root: the path the items are recorded under. The relative paths of the list are joined to it, and the absolute
+// paths must be under it
+// - fn: receives the items in the order of the list
+func Read(r io.Reader, format, root string, fn func(item *metadata.Meta) error) error {
+	var parse func(line string) (*metadata.Meta, error)
+	switch format {
+	case FormatMD5Sum, FormatSHA256Sum:
+		algorithm := sumAlgorithm(format)
+		parse = func(line string) (*metadata.Meta, error) { return parseSumLine(line, algorithm, root) }
+	case FormatHashdeep:
+		parse = (&hashdeepParser{root: root}).parseLine
+	default:
+		return fmt.Errorf("invalid checksum format: %s", format)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		item, err := parse(strings.TrimSuffix(scanner.Text(), "\r"))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if item == nil {
+			continue
+		}
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseSumLine parses a line of md5sum or sha256sum: "<hash>  <name>" in text mode, "<hash> *<name>" in binary mode,
+// or the BSD style of --tag. A line starting with a backslash has its name escaped, see escapeName.
+func parseSumLine(line, algorithm, root string) (*metadata.Meta, error) {
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	var hash, name string
+	if m := tagLine.FindStringSubmatch(line); m != nil {
+		if tagAlgorithm := strings.ToLower(m[1]); tagAlgorithm != algorithm {
+			return nil, fmt.Errorf("unexpected %s hash in a %s list", tagAlgorithm, algorithm)
+		}
+		name, hash = m[2], m[3]
+	} else {
+		var ok bool
+		hash, name, ok = strings.Cut(line, " ")
+		if !ok || name == "" || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("invalid checksum line: %q", line)
+		}
+		name = name[1:]
+	}
+
+	if escaped {
+		var err error
+		if name, err = unescapeName(name); err != nil {
+			return nil, err
+		}
+	}
+	return NewMeta(root, name, algorithm, hash)
+}
+
+// hashdeepParser is the state of Read for a hashdeep list: the columns declared by the last header.
+type hashdeepParser struct {
+	root    string
+	columns []string
+}
+
+// parseLine parses a line of hashdeep. The header declares the columns, e.g. "%%%% size,md5,sha256,filename", and the
+// file name is the last column, which may contain commas.
+func (p *hashdeepParser) parseLine(line string) (*metadata.Meta, error) {
+	switch {
+	case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "##"):
+		return nil, nil
+	case strings.HasPrefix(line, "%%%% HASHDEEP-"):
+		p.columns = nil
+		return nil, nil
+	case strings.HasPrefix(line, "%%%% "):
+		p.columns = strings.Split(strings.TrimPrefix(line, "%%%% "), ",")
+		if p.columns[len(p.columns)-1] != "filename" {
+			return nil, fmt.Errorf("the last hashdeep column is not the filename: %s", line)
+		}
+		return nil, nil
+	}
+	if len(p.columns) == 0 {
+		return nil, fmt.Errorf("hashdeep line before the header: %q", line)
+	}
+
+	values := strings.SplitN(line, ",", len(p.columns))
+	if len(values) != len(p.columns) {
+		return nil, fmt.Errorf("invalid hashdeep line: %q", line)
+	}
+	row := make(map[string]string, len(values))
+	for i, column := range p.columns {
+		row[column] = values[i]
+	}
+
+	var meta *metadata.Meta
+	var err error
+	if hash, ok := row[utils.HashMD5]; ok { // MD5 is preferred, it is the algorithm of the generated metadata files
+		meta, err = NewMeta(p.root, row["filename"], utils.HashMD5, hash)
+	} else if hash, ok = row[utils.HashSHA256]; ok {
+		meta, err = NewMeta(p.root, row["filename"], utils.HashSHA256, hash)
+	} else {
+		return nil, fmt.Errorf("no md5 or sha256 column in hashdeep columns %s", strings.Join(p.columns, ","))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := row["size"]; ok {
+		if meta.Common.Size, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid size of %s: %s", meta.Common.Path, v)
+		}
+		meta.Fields = append(meta.Fields, metadata.FieldSize)
+	}
+	return meta, nil
+}
+
+// Import converts a checksum list to a metadata file, written to the output directory like by the generate command.
+// Input:
+// - listPath: the path to the checksum list
+// - format: FormatMD5Sum, FormatSHA256Sum or FormatHashdeep
+// - root: the source directory recorded in the header of the metadata file, see Read
+// - outDir: the directory to write the metadata file to
+// Output:
+// - metaPath: the path to the metadata file
+func Import(ctx context.Context, listPath, format, root, outDir string) (metaPath string, err error) {
+	if root, err = filepath.Abs(root); err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(listPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open checksum list: %w", err)
+	}
+	defer file.Close()
+
+	slog.Info("Start to import checksum list:", slog.String("ListPath", listPath), slog.String("Format", format),
+		slog.String("SourceDir", root))
+	metaPath, count, err := datasource.Import(ctx, root, outDir, func(emit func(item *metadata.Meta) error) error {
+		if _err := Read(bufio.NewReader(file), format, root, emit); _err != nil {
+			return fmt.Errorf("failed to read checksum list %s: %w", listPath, _err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("Finish to import checksum list:", slog.String("MetaFilePath", metaPath), slog.Uint64("ItemCount", count))
+	return metaPath, nil
+}
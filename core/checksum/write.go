@@ -0,0 +1,197 @@
+package checksum
+
+import (
+	"bufio"
+	"context"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteOptions configures Write.
+type WriteOptions struct {
+	// Format is FormatMD5Sum, FormatSHA256Sum or FormatHashdeep.
+	Format string
+
+	// Algorithm is the hash algorithm of a hashdeep list, utils.HashMD5 if empty. The sum formats have their own.
+	Algorithm string
+
+	// SourceDir is the directory the files are read from when the metadata file does not record their hash with the
+	// algorithm of the list, e.g. for a sha256sum list of a generated metadata file. The source directory of the
+	// metadata file if empty.
+	SourceDir string
+}
+
+// Write converts a metadata file to a checksum list of its regular files, with their paths relative to its source
+// directory, so that the list can be checked from the root of the target, e.g. with md5sum -c or hashdeep -a -k.
+// Input:
+// - ctx: cancels the conversion
+// - metaPath: the metadata file to convert
+// - w: the writer of the checksum list
+// - opts: the format of the list
+// Output:
+// - count: the number of files written
+func Write(ctx context.Context, metaPath string, w io.Writer, opts WriteOptions) (count uint64, err error) {
+	algorithm := opts.Algorithm
+	switch opts.Format {
+	case FormatMD5Sum, FormatSHA256Sum:
+		algorithm = sumAlgorithm(opts.Format)
+	case FormatHashdeep:
+		if algorithm == "" {
+			algorithm = utils.HashMD5
+		}
+		if algorithm != utils.HashMD5 && algorithm != utils.HashSHA256 {
+			return 0, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+		}
+	default:
+		return 0, fmt.Errorf("invalid checksum format: %s", opts.Format)
+	}
+
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	if opts.Format == FormatHashdeep {
+		fmt.Fprintln(bw, "%%%% HASHDEEP-1.0")
+		fmt.Fprintf(bw, "%%%%%%%% size,%s,filename\n", algorithm)
+		fmt.Fprintf(bw, "## Invoked from: %s\n", header.SourceDir)
+		fmt.Fprintln(bw, "##")
+	}
+
+	algorithms := []string{algorithm}
+	err = Files(ctx, metaPath, opts.SourceDir, algorithms, func(rel string, item *metadata.Meta, hashes []string) error {
+		var _err error
+		if opts.Format == FormatHashdeep {
+			if strings.ContainsAny(rel, "\n\r") {
+				slog.Warn("Skip file with a line break in its name:", slog.String("Path", item.Common.Path))
+				return nil
+			}
+			_, _err = fmt.Fprintf(bw, "%d,%s,%s\n", item.Common.Size, hashes[0], rel)
+		} else if escapedName, escaped := escapeName(rel); escaped {
+			_, _err = fmt.Fprintf(bw, "\\%s  %s\n", hashes[0], escapedName)
+		} else {
+			_, _err = fmt.Fprintf(bw, "%s  %s\n", hashes[0], rel)
+		}
+		if _err == nil {
+			count++
+		}
+		return _err
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+// Files calls fn with the regular files of a metadata file which record their hash, in the order of the metadata file.
+// Input:
+// - ctx: cancels the iteration
+// - metaPath: the metadata file
+// - sourceDir: the directory the files are read from when the metadata file does not record their hash with one of
+// the algorithms. The source directory of the metadata file if empty
+// - algorithms: the hash algorithms of the hashes passed to fn
+// - fn: receives the path of the file relative to the source directory with slash separators, its metadata and its
+// hashes in the order of the algorithms
+// Note:
+// - The files which are read from the source directory are checked against their recorded hash in the same read, so
+// that the hashes do not silently describe files which have changed since the metadata file was generated
+func Files(ctx context.Context, metaPath, sourceDir string, algorithms []string,
+	fn func(rel string, item *metadata.Meta, hashes []string) error) error {
+	reader, err := datasource.OpenMetaFile(metaPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if sourceDir == "" {
+		sourceDir = reader.Header.SourceDir
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		row, _err := reader.Next()
+		if _err == io.EOF {
+			return nil
+		}
+		if _err != nil {
+			return fmt.Errorf("failed to read metadata file %s: %w", metaPath, _err)
+		}
+		item, _err := metadata.Deserialise(row)
+		if _err != nil {
+			return fmt.Errorf("failed to parse row of metadata file %s: %w", metaPath, _err)
+		}
+		if item.FileSystem != nil && item.FileSystem.Type != metadata.FSTypeFile {
+			continue
+		}
+		if !item.Records(metadata.FieldHash) || item.Common.Hash == "" {
+			slog.Warn("Skip file without hash:", slog.String("Path", item.Common.Path))
+			continue
+		}
+
+		rel, _err := filepath.Rel(reader.Header.SourceDir, item.Common.Path)
+		if _err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("item %s is outside of the source directory %s", item.Common.Path,
+				reader.Header.SourceDir)
+		}
+
+		hashes, _err := itemHashes(ctx, item, algorithms, filepath.Join(sourceDir, rel))
+		if _err != nil {
+			return _err
+		}
+		if _err = fn(filepath.ToSlash(rel), item, hashes); _err != nil {
+			return _err
+		}
+	}
+}
+
+// itemHashes returns the hashes of an item with the given algorithms. The file is read from sourcePath if the item
+// does not record its hash with one of them, and its recorded hash is checked in the same read.
+func itemHashes(ctx context.Context, item *metadata.Meta, algorithms []string, sourcePath string) ([]string, error) {
+	recorded := item.Common.HashAlgorithm
+	if recorded == "" {
+		recorded = utils.HashMD5
+	}
+
+	hashes := make([]string, len(algorithms))
+	read := false
+	for i, algorithm := range algorithms {
+		if algorithm == recorded {
+			hashes[i] = item.Common.Hash
+		} else {
+			read = true
+		}
+	}
+	if !read {
+		return hashes, nil
+	}
+
+	if err := utils.DefaultLimiter.WaitFile(ctx); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the file to rehash: %w", err)
+	}
+	defer file.Close()
+
+	computed, err := utils.HashesReader(ctx, file, append([]string{recorded}, algorithms...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate the hash of the file %s: %w", sourcePath, err)
+	}
+	if computed[0] != item.Common.Hash {
+		return nil, fmt.Errorf("the file %s has changed since the metadata file was generated: %s: %s != %s",
+			sourcePath, recorded, item.Common.Hash, computed[0])
+	}
+	return computed[1:], nil
+}
@@ -0,0 +1,12 @@
+package datasource
+
+import (
+	"path"
+	"strings"
+)
+
+// ArchiveEntryRelPath normalises the name of an archive entry to a slash separated path relative to the archive root,
+// e.g. "./a/b/" and "/a/b" become "a/b". The root entry becomes ".".
+func ArchiveEntryRelPath(name string) string {
+	return path.Clean(strings.TrimLeft(name, "/"))
+}
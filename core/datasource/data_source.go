@@ -3,14 +3,21 @@ package datasource
 import (
 	"bufio"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/metrics"
+	"file-clone-validator/core/progress"
+	"file-clone-validator/core/signature"
+	"file-clone-validator/core/utils"
+	"fmt"
 	"github.com/cheggaaa/pb/v3"
 	"golang.org/x/sync/errgroup"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,6 +41,16 @@ type MetaHeader struct {
 	ItemCount uint64
 }
 
+// ReadMetaHeader reads the header from the first line of the metadata file at the given path.
+func ReadMetaHeader(filePath string) (*MetaHeader, error) {
+	r, err := OpenMetaFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return &r.Header, nil
+}
+
 // MetaWriter is the interface that writes the metadata to the output file
 type MetaWriter interface {
 	// Write writes the metadata to the output file.
@@ -80,11 +97,25 @@ func NewMetaWriter(srcDir, outDir string) (MetaWriter, error) {
 	return writer, nil
 }
 
+// NewSignedMetaWriter creates a MetaWriter which signs the output file with the given key once it is written. The
+// detached signature is written next to the output file, see signature.SignFile.
+func NewSignedMetaWriter(srcDir, outDir string, key ed25519.PrivateKey) (MetaWriter, error) {
+	writer, err := NewMetaWriter(srcDir, outDir)
+	if err != nil {
+		return nil, err
+	}
+	writer.(*MetaWriterImpl).SigningKey = key
+	return writer, nil
+}
+
 type MetaWriterImpl struct {
 	SourceDir     string
 	OutputDir     string
 	OutputTempDir string
 	ItemCount     uint64
+
+	// SigningKey signs the output file if it is set.
+	SigningKey ed25519.PrivateKey
 }
 
 func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, workerCount int) error {
@@ -96,13 +127,16 @@ func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, wo
 
 	group, groupCtx := errgroup.WithContext(ctx)
 
-	go GenerateProgressWatch(groupCtx, itemCounts)
+	watchDone := make(chan struct{})
+	go func() { GenerateProgressWatch(groupCtx, itemCounts); close(watchDone) }()
 	// monitor the progress of the metadata generation
 	// the lifetime of the progress bar is the same as the lifetime of the metadata generation
 
+	metrics.StartWorkers(metrics.PoolWrite, workerCount)
 	for i := 0; i < workerCount; i++ {
 		_i := i
 		group.Go(func() error {
+			defer metrics.StopWorker(metrics.PoolWrite)
 			defer func() { w.ItemCount += itemCounts[_i] }()
 			tempFile, err := os.CreateTemp(w.OutputTempDir, "temp-*")
 			if err != nil {
@@ -119,6 +153,7 @@ func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, wo
 						return nil
 					}
 
+					done := metrics.Busy(metrics.PoolWrite)
 					data, _err := metadata.Serialise(meta)
 					if _err != nil {
 						return _err
@@ -128,13 +163,16 @@ func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, wo
 					if _err != nil {
 						return _err
 					}
+					done()
 
 					itemCounts[_i]++
+					metrics.ItemsWritten.Inc()
 				}
 			}
 		})
 	}
 	err := group.Wait()
+	<-watchDone
 	if err != nil {
 		return err
 	}
@@ -143,7 +181,7 @@ func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, wo
 
 	slog.Info("Start to merge temp files to final output:", slog.String("OutputDir", w.OutputDir))
 
-	outFile, err := os.Create(filepath.Join(w.OutputDir, "meta.out"))
+	outFile, err := os.Create(filepath.Join(w.OutputDir, utils.GetOutputFileName()))
 	if err != nil {
 		return err
 	}
@@ -165,6 +203,14 @@ func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, wo
 	}
 
 	// merge all temp files to final output
+	var mergedCount atomic.Uint64
+	mergeCtx, mergeCancel := context.WithCancel(ctx)
+	mergeWatchDone := make(chan struct{})
+	go func() {
+		progress.Watch(mergeCtx, progress.PhaseMerge, w.ItemCount, mergedCount.Load, nil)
+		close(mergeWatchDone)
+	}()
+
 	err = filepath.Walk(w.OutputTempDir, func(fp string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -185,6 +231,7 @@ func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, wo
 				if _err != nil {
 					return _err
 				}
+				mergedCount.Add(1)
 			}
 
 			if _err = scanner.Err(); _err != nil {
@@ -196,15 +243,45 @@ func (w *MetaWriterImpl) Write(ctx context.Context, in <-chan *metadata.Meta, wo
 		return nil
 	})
 
+	mergeCancel()
+	<-mergeWatchDone
+
 	slog.Info("Finish to merge temp files to final output:", slog.String("OutputDir", w.OutputDir))
-	return err
+	if err != nil {
+		return err
+	}
+
+	if w.SigningKey == nil {
+		return nil
+	}
+
+	if err = outFile.Close(); err != nil { // flush the output before signing it
+		return err
+	}
+
+	err = signature.SignFile(outFile.Name(), w.SigningKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign metadata file: %w", err)
+	}
+
+	slog.Info("Finish to sign metadata file:", slog.String("SignaturePath", outFile.Name()+signature.Suffix))
+	return nil
 }
 
-// GenerateProgressWatch generates a progress bar to watch the progress of the metadata generation
+// GenerateProgressWatch generates a progress bar to watch the progress of the metadata generation. In the json
+// progress mode, it emits the events of the write phase instead.
 // Input:
 // - itemCounts: the number of items written by each worker. This function will not modify the values of this slice
 // but will read the values to calculate the total number of items written
 func GenerateProgressWatch(ctx context.Context, itemCounts []uint64) {
+	switch progress.CurrentMode() {
+	case progress.ModeJSON:
+		progress.Watch(ctx, progress.PhaseWrite, 0, func() uint64 { return sumCounts(itemCounts) }, utils.HashedBytes)
+		return
+	case progress.ModeNone:
+		return
+	}
+
 	bar := pb.New64(0) // `0` for indefinite mode
 	bar.Start()
 	defer bar.Finish()
@@ -215,18 +292,19 @@ func GenerateProgressWatch(ctx context.Context, itemCounts []uint64) {
 	for {
 		select {
 		case <-ctx.Done():
-			var total uint64
-			for _, itemCount := range itemCounts {
-				total += itemCount
-			}
-			bar.SetCurrent(int64(total))
+			bar.SetCurrent(int64(sumCounts(itemCounts)))
 			return
 		case <-ticker.C:
-			var total uint64
-			for _, itemCount := range itemCounts {
-				total += itemCount
-			}
-			bar.SetCurrent(int64(total))
+			bar.SetCurrent(int64(sumCounts(itemCounts)))
 		}
 	}
 }
+
+// sumCounts returns the total of the item counts of all the workers.
+func sumCounts(itemCounts []uint64) uint64 {
+	var total uint64
+	for _, itemCount := range itemCounts {
+		total += itemCount
+	}
+	return total
+}
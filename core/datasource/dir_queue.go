@@ -0,0 +1,127 @@
+package datasource
+
+import (
+	"sync"
+)
+
+// dirDeque is the double-ended queue of directories owned by one scanner.
+type dirDeque struct {
+	mu    sync.Mutex
+	items []string
+}
+
+// popTail pops the most recently pushed directory. The owner scanner uses it to walk depth-first.
+func (d *dirDeque) popTail() (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == 0 {
+		return "", false
+	}
+	dir := d.items[len(d.items)-1]
+	d.items = d.items[:len(d.items)-1]
+	return dir, true
+}
+
+// popHead pops the oldest directory. Other scanners use it to steal the directories closest to the root, which are
+// likely the largest subtrees.
+func (d *dirDeque) popHead() (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == 0 {
+		return "", false
+	}
+	dir := d.items[0]
+	d.items[0] = ""
+	d.items = d.items[1:]
+	return dir, true
+}
+
+func (d *dirDeque) push(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = append(d.items, dir)
+}
+
+// dirQueue is a work-stealing queue of directories shared by a fixed number of scanners. Every scanner owns a deque,
+// pushes the sub directories it finds to its own deque and steals from the other deques when its own one is empty.
+// The queue is drained when all pushed directories have been marked as done.
+type dirQueue struct {
+	deques []*dirDeque
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending int    // number of directories pushed but not done yet
+	seq     uint64 // incremented on every push to wake up idle scanners
+	closed  bool
+}
+
+func newDirQueue(scannerCount int) *dirQueue {
+	q := &dirQueue{deques: make([]*dirDeque, scannerCount)}
+	for i := range q.deques {
+		q.deques[i] = &dirDeque{}
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a directory to the deque of the given scanner.
+func (q *dirQueue) push(scanner int, dir string) {
+	q.mu.Lock()
+	q.pending++ // count the directory before it can be stolen and marked as done
+	q.mu.Unlock()
+
+	q.deques[scanner].push(dir)
+
+	q.mu.Lock()
+	q.seq++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop returns the next directory for the given scanner. It blocks until a directory is available, and returns false
+// when the queue is drained or closed.
+func (q *dirQueue) pop(scanner int) (string, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed || q.pending == 0 {
+			q.mu.Unlock()
+			return "", false
+		}
+		seq := q.seq
+		q.mu.Unlock()
+
+		if dir, ok := q.deques[scanner].popTail(); ok {
+			return dir, true
+		}
+		for i := 1; i < len(q.deques); i++ {
+			if dir, ok := q.deques[(scanner+i)%len(q.deques)].popHead(); ok {
+				return dir, true
+			}
+		}
+
+		// nothing to steal, wait for a new push or for the queue to be drained
+		q.mu.Lock()
+		for !q.closed && q.pending > 0 && q.seq == seq {
+			q.cond.Wait()
+		}
+		q.mu.Unlock()
+	}
+}
+
+// done marks a popped directory as fully listed.
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending--
+	if q.pending == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+// close wakes up all scanners and makes pop return false.
+func (q *dirQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
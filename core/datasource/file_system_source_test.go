@@ -0,0 +1,59 @@
+package datasource
+
+import (
+	"context"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFileSourceWalkMatchesFilepathWalk(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			dir := filepath.Join(root, fmt.Sprintf("d%d", i), fmt.Sprintf("s%d", j))
+			require.NoError(t, os.MkdirAll(dir, 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "f"), []byte(dir), 0644))
+		}
+	}
+	require.NoError(t, os.Symlink("d0", filepath.Join(root, "link")))
+	outDir := filepath.Join(root, "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(outDir, "temp_dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "temp_dir", "temp-1"), nil, 0644))
+
+	var expected []string
+	require.NoError(t, filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if path == root || path == filepath.Join(outDir, "temp_dir") {
+			return nil
+		}
+		if filepath.Dir(path) == filepath.Join(outDir, "temp_dir") {
+			return nil
+		}
+		expected = append(expected, path)
+		return err
+	}))
+
+	ds, err := NewFileSource(root, 4)
+	require.NoError(t, err)
+
+	out := make(chan *metadata.Meta, 1)
+	var actual []string
+	g, gCtx := errgroup.WithContext(context.Background())
+	g.Go(func() error { return ds.Walk(gCtx, outDir, out, 4) })
+	g.Go(func() error {
+		for meta := range out {
+			actual = append(actual, meta.Common.Path)
+		}
+		return nil
+	})
+	require.NoError(t, g.Wait())
+
+	sort.Strings(expected)
+	sort.Strings(actual)
+	require.Equal(t, expected, actual)
+}
@@ -0,0 +1,248 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/metrics"
+	"file-clone-validator/core/progress"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+)
+
+// readDirBatchSize is the number of directory entries read by one getdents round trip of a scanner.
+const readDirBatchSize = 1024
+
+// FSSource is a DataSource implementation that reads files from any fs.FS. The link targets and the extended
+// attributes are read if the file system implements metadata.ReadLinkFS and metadata.XAttrFS, and the symbolic links
+// are not followed if it implements metadata.LstatFS.
+type FSSource struct {
+	fsys         fs.FS
+	root         string
+	scannerCount int
+	opts         []metadata.RetrieveOption
+}
+
+type FileItem struct {
+	Path  string      // the path recorded in the metadata
+	Name  string      // the name of the file in the fs.FS
+	Entry fs.DirEntry // the directory entry listed by the scanner
+}
+
+// NewFSSource creates a new FSSource.
+// Input:
+// - fsys: the file system to read files from
+// - root: the path the metadata records for the root of fsys, e.g. the directory fsys is opened on. The paths of the
+// files are made by joining it with their names
+// - scannerCount: the number of scanners to list the directories concurrently
+// - opts: the options of metadata.RetrieveFSMeta, e.g. metadata.WithoutHash() when the content is compared otherwise
+func NewFSSource(fsys fs.FS, root string, scannerCount int, opts ...metadata.RetrieveOption) (DataSource, error) {
+	return newFSSource(fsys, root, scannerCount, opts...)
+}
+
+func newFSSource(fsys fs.FS, root string, scannerCount int, opts ...metadata.RetrieveOption) (*FSSource, error) {
+	if scannerCount < 1 {
+		return nil, fmt.Errorf("scanner count must be greater than 0. got %d", scannerCount)
+	}
+	return &FSSource{fsys: fsys, root: root, scannerCount: scannerCount, opts: opts}, nil
+}
+
+// Walk walks the file system and sends the metadata of each file to the given channel. M scanner goroutines will list
+// the directories and send the file paths to the N worker goroutines. The N worker goroutines will retrieve the
+// metadata of the file and send it to the output channel.
+// Input:
+// - outDir: the directory to save the metadata files to. This directory should be empty and needs to be filtered out
+// - out: the channel to send the metadata to
+// - workerCount: the number of workers to use to retrieve the metadata
+// Note:
+// - There are two types of goroutine in this function:
+// --- Scanner: lists the directories and sends the file paths to the worker goroutines
+// --- Worker: retrieves the metadata of the file and sends it to the output channel
+// The concurrency of Scanner is scannerCount. Scanners share a work-stealing queue of directories: each scanner lists
+// the directories of its own deque depth-first and steals from the other deques when it runs out of work, so a single
+// huge subtree does not leave the other scanners idle. Scanners only read the directory entries (getdents) and never
+// stat them, the stat is deferred to the workers. The concurrency of Worker is workerCount. Workers deal with the
+// metadata and IO operations which are more expensive than the directory listing of the Scanner.
+func (fss *FSSource) Walk(ctx context.Context, outDir string, out chan<- *metadata.Meta, workerCount int) error {
+	slog.Info("Start walking the file system:",
+		slog.Int("ScannerCount", fss.scannerCount),
+		slog.Int("WorkerCount", workerCount),
+	)
+	defer close(out) // close the output channel when done
+
+	outputTempPath, err := utils.GetTempPath(outDir)
+	if err != nil {
+		return err
+	}
+
+	rootInfo, err := metadata.Lstat(fss.fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	itemC := make(chan *FileItem, 1)
+	defer metrics.TrackQueue("walk_items", func() int { return len(itemC) })()
+
+	queue := newDirQueue(fss.scannerCount)
+	if rootInfo.IsDir() { // the root itself is skipped, and it is not followed if it is a symlink
+		queue.push(0, ".")
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	var walkedCount atomic.Uint64 // the number of items sent to the workers
+	watchDone := make(chan struct{})
+	go func() {
+		progress.Watch(groupCtx, progress.PhaseWalk, 0, walkedCount.Load, utils.HashedBytes)
+		close(watchDone)
+	}()
+	defer func() { <-watchDone }()
+
+	scanners, scannersCtx := errgroup.WithContext(groupCtx)
+	go func() { // unblock the idle scanners when the walk is canceled
+		<-scannersCtx.Done()
+		queue.close()
+	}()
+
+	for i := 0; i < fss.scannerCount; i++ {
+		_i := i
+		scanners.Go(func() error { // scanner goroutines
+			for {
+				dir, ok := queue.pop(_i)
+				if !ok {
+					return scannersCtx.Err()
+				}
+
+				err := fss.scan(scannersCtx, dir, outputTempPath, itemC, &walkedCount,
+					func(name string) { queue.push(_i, name) })
+				queue.done()
+				if err != nil {
+					return err
+				}
+			}
+		})
+	}
+
+	group.Go(func() error {
+		defer close(itemC) // to notify the workers that there are no more items to process
+		return scanners.Wait()
+	})
+
+	// built once, as appending to fss.opts in every worker would share its backing array between the workers
+	opts := append(slices.Clip(fss.opts), metadata.WithContext(groupCtx))
+	metrics.StartWorkers(metrics.PoolWalk, workerCount)
+	for i := 0; i < workerCount; i++ {
+		group.Go(func() error { // worker goroutines
+			defer metrics.StopWorker(metrics.PoolWalk)
+			for {
+				select {
+				case <-groupCtx.Done():
+					return groupCtx.Err()
+				case item, ok := <-itemC:
+					if !ok {
+						return nil
+					}
+
+					done := metrics.Busy(metrics.PoolWalk)
+					info, err := item.Entry.Info()
+					if err != nil {
+						return err
+					}
+
+					// retrieve the metadata of the file
+					meta, err := metadata.RetrieveFSMeta(fss.fsys, item.Name, item.Path, info, opts...)
+					if err != nil { // to make sure that the fbs is retrieved, we will handle the error the first time
+						return err
+					}
+					done()
+
+					select {
+					case <-groupCtx.Done():
+						return groupCtx.Err()
+					case out <- meta:
+					}
+				}
+			}
+		})
+	}
+
+	return group.Wait()
+}
+
+// scan lists the entries of one directory in batches and sends them to the workers.
+// Input:
+// - dir: the name of the directory to list
+// - outputTempPath: the temp directory of the meta writer which needs to be filtered out
+// - itemC: the channel to send the entries to
+// - walkedCount: the counter of the entries sent to the workers
+// - pushDir: the callback to queue a sub directory
+func (fss *FSSource) scan(ctx context.Context, dir, outputTempPath string, itemC chan<- *FileItem,
+	walkedCount *atomic.Uint64, pushDir func(name string)) error {
+	f, err := fss.fsys.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	readDir := func() ([]fs.DirEntry, error) { // fall back to one full listing if the file can not list in batches
+		entries, _err := fs.ReadDir(fss.fsys, dir)
+		if _err == nil {
+			_err = io.EOF
+		}
+		return entries, _err
+	}
+	if rdf, ok := f.(fs.ReadDirFile); ok {
+		readDir = func() ([]fs.DirEntry, error) { return rdf.ReadDir(readDirBatchSize) }
+	}
+
+	for {
+		entries, err := readDir()
+		for _, entry := range entries {
+			name := path.Join(dir, entry.Name())
+			itemPath := fss.Path(name)
+
+			// filter paths
+			isTemp, _err := utils.IsSubPath(outputTempPath, itemPath)
+			if _err != nil {
+				return _err
+			}
+
+			if isTemp { // skip the temp directory
+				continue
+			}
+			// end of filter paths
+
+			if entry.IsDir() {
+				pushDir(name)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case itemC <- &FileItem{Path: itemPath, Name: name, Entry: entry}:
+				walkedCount.Add(1)
+				metrics.ItemsWalked.Inc()
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Path returns the path recorded in the metadata for the named file of the file system.
+func (fss *FSSource) Path(name string) string {
+	return filepath.Join(fss.root, filepath.FromSlash(name))
+}
@@ -0,0 +1,51 @@
+package datasource
+
+import (
+	"context"
+	"file-clone-validator/core/metadata"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFSSourceWalkMapFS(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	fsys := fstest.MapFS{
+		"a":       {Mode: fs.ModeDir | 0755, ModTime: mtime},
+		"a/f":     {Data: []byte("hello\n"), Mode: 0644, ModTime: mtime},
+		"a/b/g":   {Data: []byte{}, Mode: 0600, ModTime: mtime},
+		"h":       {Data: []byte("h"), Mode: 0640, ModTime: mtime},
+		"a/b/c/i": {Data: []byte("i"), Mode: 0644, ModTime: mtime},
+	}
+
+	ds, err := NewFSSource(fsys, "/virtual", 2)
+	require.NoError(t, err)
+
+	out := make(chan *metadata.Meta, 1)
+	metas := make(map[string]*metadata.Meta)
+	g, gCtx := errgroup.WithContext(context.Background())
+	g.Go(func() error { return ds.Walk(gCtx, t.TempDir(), out, 2) })
+	g.Go(func() error {
+		for meta := range out {
+			metas[meta.Common.Path] = meta
+		}
+		return nil
+	})
+	require.NoError(t, g.Wait())
+
+	// the parent directories missing from the map are synthesised by fstest.MapFS
+	require.Len(t, metas, 7)
+	require.Equal(t, metadata.FSTypeDir, metas["/virtual/a/b"].FileSystem.Type)
+
+	f := metas["/virtual/a/f"]
+	require.Equal(t, metadata.FSTypeFile, f.FileSystem.Type)
+	require.Equal(t, "f", f.Common.Name)
+	require.Equal(t, uint64(6), f.Common.Size)
+	require.Equal(t, "b1946ac92492d2347c6235b4d2611184", f.Common.Hash)
+	require.Equal(t, fs.FileMode(0644), f.FileSystem.Mode)
+	require.Equal(t, uint64(1700000000), f.FileSystem.ModTime)
+	require.Nil(t, f.ExtendedAttributes) // fstest.MapFS does not implement metadata.XAttrFS
+}
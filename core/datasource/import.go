@@ -0,0 +1,50 @@
+package datasource
+
+import (
+	"context"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"golang.org/x/sync/errgroup"
+	"path/filepath"
+)
+
+// ImportFunc reads the items of a manifest of another format, e.g. an mtree specification, and calls emit with every
+// one of them.
+type ImportFunc func(emit func(item *metadata.Meta) error) error
+
+// Import writes the items read by an ImportFunc to a metadata file in the output directory, like the generate command.
+// Input:
+// - srcDir: the source directory recorded in the header of the metadata file
+// - outDir: the directory to write the metadata file to
+// - read: reads the items of the manifest
+// Output:
+// - metaPath: the path to the metadata file
+// - count: the number of items written
+func Import(ctx context.Context, srcDir, outDir string, read ImportFunc) (metaPath string, count uint64, err error) {
+	writer, err := NewMetaWriter(srcDir, outDir)
+	if err != nil {
+		return "", 0, err
+	}
+
+	itemC := make(chan *metadata.Meta, 64)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(itemC)
+		return read(func(item *metadata.Meta) error {
+			select {
+			case itemC <- item:
+				return nil
+			case <-gCtx.Done():
+				return gCtx.Err()
+			}
+		})
+	})
+	g.Go(func() error {
+		return writer.Write(gCtx, itemC, 1)
+	})
+	if err = g.Wait(); err != nil {
+		return "", 0, err
+	}
+
+	return filepath.Join(outDir, utils.GetOutputFileName()), writer.(*MetaWriterImpl).ItemCount, nil
+}
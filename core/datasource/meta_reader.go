@@ -0,0 +1,67 @@
+package datasource
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxRowSize is the largest row of a metadata file a MetaReader accepts. Rows are usually small, but the extended
+// attributes of an item may be large.
+const maxRowSize = 64 << 20
+
+// MetaReader reads a metadata file row by row.
+type MetaReader struct {
+	// Header is the header of the metadata file.
+	Header MetaHeader
+
+	file    *os.File
+	scanner *bufio.Scanner
+}
+
+// OpenMetaFile opens a metadata file and reads its header.
+func OpenMetaFile(filePath string) (*MetaReader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &MetaReader{file: file, scanner: bufio.NewScanner(file)}
+	r.scanner.Buffer(make([]byte, 0, 64<<10), maxRowSize)
+
+	if !r.scanner.Scan() {
+		file.Close()
+		if err = r.scanner.Err(); err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to read the header of metadata file %s: %w", filePath, err)
+	}
+
+	if err = json.Unmarshal(r.scanner.Bytes(), &r.Header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to parse the header of metadata file %s: %w", filePath, err)
+	}
+	return r, nil
+}
+
+// Next returns the next row of the metadata file, or io.EOF when there are no more rows. The row is a serialised
+// metadata.Meta which can be parsed by metadata.Deserialise.
+func (r *MetaReader) Next() ([]byte, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	row := make([]byte, len(r.scanner.Bytes()))
+	copy(row, r.scanner.Bytes())
+	return row, nil
+}
+
+// Close closes the metadata file.
+func (r *MetaReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,272 @@
+package datasource
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ShardBy is the strategy to assign the items of a metadata file to the shards.
+type ShardBy string
+
+const (
+	// ShardByHash assigns every item by the hash of its relative path. The shards are balanced by item count, but
+	// the items of one directory are spread across all shards.
+	ShardByHash ShardBy = "hash"
+
+	// ShardByTop assigns all the items under the same top-level directory to the same shard. The top-level
+	// directories are packed greedily from the largest one to balance the item counts.
+	ShardByTop ShardBy = "top"
+)
+
+// ShardIndexFileName is the name of the index file written next to the shards.
+const ShardIndexFileName = "shards.json"
+
+// ShardIndex describes how a metadata file has been split into shards.
+type ShardIndex struct {
+	// SourceDir is the root directory of the source.
+	SourceDir string
+
+	// ItemCount is the number of items in the original metadata file, the sum of the item counts of the shards.
+	ItemCount uint64
+
+	// By is the sharding strategy.
+	By ShardBy
+
+	// Shards are the shards, in order.
+	Shards []ShardInfo
+}
+
+// ShardInfo describes one shard.
+type ShardInfo struct {
+	// Path is the file name of the shard, relative to the directory of the index.
+	Path string
+
+	// ItemCount is the number of items in the shard.
+	ItemCount uint64
+}
+
+// ShardMetaFile splits a metadata file into self-contained shards. Every shard is a metadata file with its own
+// MetaHeader, so that it can be validated on its own. The index of the shards is written to ShardIndexFileName. The
+// signature of the metadata file does not cover the shards, the caller signs them if needed, see signature.SignFile.
+// Input:
+// - metaPath: the metadata file to split
+// - outDir: the directory to write the shards and the index to
+// - count: the number of shards
+// - by: the sharding strategy
+func ShardMetaFile(metaPath, outDir string, count int, by ShardBy) (*ShardIndex, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("shard count must be greater than 0. got %d", count)
+	}
+	if by != ShardByHash && by != ShardByTop {
+		return nil, fmt.Errorf("invalid shard strategy: %s. expect [%s|%s]", by, ShardByHash, ShardByTop)
+	}
+
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return nil, err
+	}
+
+	assign := func(rel string) int { return int(hashString(rel) % uint64(count)) }
+	if by == ShardByTop {
+		topShards, err := packTopDirs(metaPath, count)
+		if err != nil {
+			return nil, err
+		}
+		assign = func(rel string) int { return topShards[topDir(rel)] }
+	}
+
+	// write the rows to temp files first, the headers need the item counts of the shards
+	temps := make([]*os.File, count)
+	writers := make([]*bufio.Writer, count)
+	defer func() {
+		for _, temp := range temps {
+			if temp != nil {
+				temp.Close()
+				os.Remove(temp.Name())
+			}
+		}
+	}()
+	for i := range temps {
+		temp, err := os.CreateTemp(outDir, "shard-temp-*")
+		if err != nil {
+			return nil, err
+		}
+		temps[i], writers[i] = temp, bufio.NewWriter(temp)
+	}
+
+	index := &ShardIndex{By: by, Shards: make([]ShardInfo, count)}
+	header, err := scanRelPaths(metaPath, func(rel string, row []byte) error {
+		i := assign(rel)
+		index.Shards[i].ItemCount++
+		index.ItemCount++
+		_, err := writers[i].Write(append(row, '\n'))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if index.ItemCount != header.ItemCount { // the shards would each pass their own count check of a truncated file
+		return nil, fmt.Errorf("item count mismatch in %s. expect %d, got %d", metaPath, header.ItemCount,
+			index.ItemCount)
+	}
+	index.SourceDir = header.SourceDir
+
+	for i := range temps {
+		index.Shards[i].Path = fmt.Sprintf("meta-%05d-of-%05d.out", i, count)
+		if err = writers[i].Flush(); err != nil {
+			return nil, err
+		}
+		if err = writeShard(filepath.Join(outDir, index.Shards[i].Path), temps[i], &MetaHeader{
+			SourceDir: header.SourceDir,
+			ItemCount: index.Shards[i].ItemCount,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(outDir, ShardIndexFileName), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Finish to shard metadata file:",
+		slog.String("MetaFilePath", metaPath),
+		slog.String("OutputDir", outDir),
+		slog.Int("ShardCount", count),
+		slog.Uint64("ItemCount", index.ItemCount),
+	)
+	return index, nil
+}
+
+// ReadShardIndex reads the index written by ShardMetaFile.
+func ReadShardIndex(path string) (*ShardIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &ShardIndex{}
+	if err = json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse shard index %s: %w", path, err)
+	}
+	return index, nil
+}
+
+// writeShard writes the header and then the rows of the temp file to the shard file.
+func writeShard(path string, temp *os.File, header *MetaHeader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	if _, err = out.Write(append(headerData, '\n')); err != nil {
+		return err
+	}
+
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, temp); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// packTopDirs assigns the top-level directories to the shards, largest first, each to the shard with the fewest items.
+func packTopDirs(metaPath string, count int) (map[string]int, error) {
+	sizes := make(map[string]uint64)
+	_, err := scanRelPaths(metaPath, func(rel string, row []byte) error {
+		sizes[topDir(rel)]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tops := make([]string, 0, len(sizes))
+	for top := range sizes {
+		tops = append(tops, top)
+	}
+	sort.Slice(tops, func(i, j int) bool {
+		if sizes[tops[i]] != sizes[tops[j]] {
+			return sizes[tops[i]] > sizes[tops[j]]
+		}
+		return tops[i] < tops[j]
+	})
+
+	loads := make([]uint64, count)
+	shards := make(map[string]int, len(tops))
+	for _, top := range tops {
+		lightest := 0
+		for i := range loads {
+			if loads[i] < loads[lightest] {
+				lightest = i
+			}
+		}
+		shards[top] = lightest
+		loads[lightest] += sizes[top]
+	}
+	return shards, nil
+}
+
+// scanRelPaths calls fn with the slash-separated relative path and the raw row of every item of the metadata file.
+func scanRelPaths(metaPath string, fn func(rel string, row []byte) error) (*MetaHeader, error) {
+	r, err := OpenMetaFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for {
+		row, _err := r.Next()
+		if errors.Is(_err, io.EOF) {
+			return &r.Header, nil
+		}
+		if _err != nil {
+			return nil, _err
+		}
+
+		meta, _err := metadata.Deserialise(row)
+		if _err != nil {
+			return nil, fmt.Errorf("invalid row in metadata file %s: %s: %w", metaPath, string(row), _err)
+		}
+
+		rel, _err := filepath.Rel(r.Header.SourceDir, meta.Common.Path)
+		if _err != nil {
+			return nil, _err
+		}
+
+		if _err = fn(filepath.ToSlash(rel), row); _err != nil {
+			return nil, _err
+		}
+	}
+}
+
+// topDir returns the first element of a relative path. A top-level file is its own top-level directory.
+func topDir(rel string) string {
+	top, _, _ := strings.Cut(rel, "/")
+	return top
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
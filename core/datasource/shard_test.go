@@ -0,0 +1,60 @@
+package datasource
+
+import (
+	"file-clone-validator/core/metadata"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShardMetaFile(t *testing.T) {
+	dir := t.TempDir()
+	rows := []string{`{"SourceDir":"/src","ItemCount":5}`}
+	for _, rel := range []string{"a", "a/1", "a/2", "b", "b/1"} {
+		data, err := metadata.Serialise(&metadata.Meta{Common: metadata.CommonAttrs{Path: "/src/" + rel}})
+		require.NoError(t, err)
+		rows = append(rows, string(data))
+	}
+	metaPath := filepath.Join(dir, "meta.out")
+	require.NoError(t, os.WriteFile(metaPath, []byte(strings.Join(rows, "\n")+"\n"), 0644))
+
+	for _, by := range []ShardBy{ShardByHash, ShardByTop} {
+		outDir := filepath.Join(dir, string(by))
+		index, err := ShardMetaFile(metaPath, outDir, 2, by)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), index.ItemCount)
+
+		var total uint64
+		for _, shard := range index.Shards {
+			header, _err := ReadMetaHeader(filepath.Join(outDir, shard.Path))
+			require.NoError(t, _err)
+			require.Equal(t, "/src", header.SourceDir)
+			require.Equal(t, shard.ItemCount, header.ItemCount)
+			total += header.ItemCount
+		}
+		require.Equal(t, uint64(5), total)
+
+		if by == ShardByTop { // a goes to one shard and b to the other
+			require.ElementsMatch(t, []uint64{3, 2}, []uint64{index.Shards[0].ItemCount, index.Shards[1].ItemCount})
+		}
+	}
+}
+
+func TestShardTruncatedMetaFile(t *testing.T) {
+	dir := t.TempDir()
+	rows := []string{`{"SourceDir":"/src","ItemCount":3}`}
+	for _, rel := range []string{"a", "b"} {
+		data, err := metadata.Serialise(&metadata.Meta{Common: metadata.CommonAttrs{Path: "/src/" + rel}})
+		require.NoError(t, err)
+		rows = append(rows, string(data))
+	}
+	metaPath := filepath.Join(dir, "meta.out")
+	require.NoError(t, os.WriteFile(metaPath, []byte(strings.Join(rows, "\n")+"\n"), 0644))
+
+	for _, by := range []ShardBy{ShardByHash, ShardByTop} {
+		_, err := ShardMetaFile(metaPath, filepath.Join(dir, string(by)), 2, by)
+		require.ErrorContains(t, err, "item count mismatch")
+	}
+}
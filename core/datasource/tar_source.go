@@ -0,0 +1,192 @@
+package datasource
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/metrics"
+	"file-clone-validator/core/progress"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// TarSource is a DataSource implementation that reads the entries of a tar archive. The archive may be compressed
+// with gzip or zstd, the compression is detected from the content.
+type TarSource struct {
+	archivePath string
+}
+
+// NewTarSource creates a new TarSource.
+// Input:
+// - archivePath: the path to the tar archive. The paths of the entries are made absolute by joining it with the entry
+// names, so it plays the role of the source directory in the metadata file
+func NewTarSource(archivePath string) (DataSource, error) {
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(archivePath); err != nil {
+		return nil, fmt.Errorf("failed to stat tar archive: %w", err)
+	}
+	return &TarSource{archivePath: archivePath}, nil
+}
+
+// Walk reads the archive from the beginning to the end and sends the metadata of each entry to the given channel.
+// Input:
+// - outDir: unused, the output directory can not be inside an archive
+// - out: the channel to send the metadata to
+// - workerCount: unused, the entries of a tar archive can only be read one after another
+func (ts *TarSource) Walk(ctx context.Context, outDir string, out chan<- *metadata.Meta, workerCount int) error {
+	slog.Info("Start walking the tar archive:", slog.String("ArchivePath", ts.archivePath))
+	defer close(out)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	var walkedCount atomic.Uint64
+	watchDone := make(chan struct{})
+	go func() {
+		progress.Watch(watchCtx, progress.PhaseWalk, 0, walkedCount.Load, utils.HashedBytes)
+		close(watchDone)
+	}()
+	defer func() { cancel(); <-watchDone }()
+
+	return WalkTar(ctx, ts.archivePath, func(rel string, meta *metadata.Meta) error {
+		walkedCount.Add(1)
+		metrics.ItemsWalked.Inc()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- meta:
+		}
+		return nil
+	})
+}
+
+// WalkTar reads the entries of a tar archive in order and calls fn with the metadata of each entry, see
+// metadata.RetrieveTarMeta. The root entry of the archive, e.g. "./", is skipped like the root of a directory, and so
+// are the PAX global headers, e.g. the pax_global_header written by git archive, which are not entries.
+// Input:
+// - archivePath: the absolute path to the tar archive
+// - fn: receives the slash separated path of the entry relative to the archive root and its metadata
+// Note:
+// - A hard link entry gets the size and the hash of the regular file it links to, which must come first
+func WalkTar(ctx context.Context, archivePath string, fn func(rel string, meta *metadata.Meta) error) error {
+	tr, closer, err := OpenTar(archivePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	type content struct {
+		size uint64
+		hash string
+	}
+	files := make(map[string]content) // the regular files which hard links may refer to
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive %s: %w", archivePath, err)
+		}
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		rel := ArchiveEntryRelPath(hdr.Name)
+		if rel == "." {
+			continue
+		}
+
+		meta, err := metadata.RetrieveTarMeta(ctx, filepath.Join(archivePath, filepath.FromSlash(rel)), hdr, tr)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			linked, ok := files[ArchiveEntryRelPath(hdr.Linkname)]
+			if !ok {
+				return fmt.Errorf("failed to resolve hard link %s: %s is not a preceding regular file",
+					hdr.Name, hdr.Linkname)
+			}
+			meta.Common.Size, meta.Common.Hash = linked.size, linked.hash
+			files[rel] = linked
+		default:
+			if meta.FileSystem.Type == metadata.FSTypeFile {
+				files[rel] = content{size: meta.Common.Size, hash: meta.Common.Hash}
+			}
+		}
+
+		if err = fn(rel, meta); err != nil {
+			return err
+		}
+	}
+}
+
+// OpenTar opens a tar archive which may be compressed with gzip or zstd.
+// Input:
+// - archivePath: the path to the tar archive
+// Output:
+// - tr: the reader of the entries
+// - closer: closes the archive and the decompressor
+func OpenTar(archivePath string) (tr *tar.Reader, closer io.Closer, err error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(file)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to read tar archive %s: %w", archivePath, err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, _err := gzip.NewReader(br)
+		if _err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to open gzip stream of %s: %w", archivePath, _err)
+		}
+		return tar.NewReader(gr), closerFunc(func() error { gr.Close(); return file.Close() }), nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, _err := zstd.NewReader(br)
+		if _err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to open zstd stream of %s: %w", archivePath, _err)
+		}
+		return tar.NewReader(zr), closerFunc(func() error { zr.Close(); return file.Close() }), nil
+	default:
+		return tar.NewReader(br), file, nil
+	}
+}
+
+// closerFunc adapts a function to io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -0,0 +1,119 @@
+package datasource
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"file-clone-validator/core/metadata"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestTar writes a tar archive with a directory, a file with an extended attribute, a hard link and a symlink.
+func writeTestTar(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	mtime := time.Unix(1700000000, 0)
+	content := []byte("hello\n")
+
+	headers := []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime},
+		{Name: "./d/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: mtime, Uid: 1000, Gid: 1000},
+		{Name: "./d/f", Typeflag: tar.TypeReg, Mode: 0644, ModTime: mtime, Size: int64(len(content)),
+			PAXRecords: map[string]string{"SCHILY.xattr.user.b": "2", "SCHILY.xattr.user.a": "1"}},
+		{Name: "./hl", Typeflag: tar.TypeLink, Linkname: "./d/f", Mode: 0644, ModTime: mtime},
+		{Name: "./sl", Typeflag: tar.TypeSymlink, Linkname: "d/f", Mode: 0777, ModTime: mtime},
+	}
+	for _, hdr := range headers {
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write(content)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestWalkTar(t *testing.T) {
+	raw := writeTestTar(t)
+
+	gzipped := &bytes.Buffer{}
+	gw := gzip.NewWriter(gzipped)
+	_, err := gw.Write(raw)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	zstded := &bytes.Buffer{}
+	zw, err := zstd.NewWriter(zstded)
+	require.NoError(t, err)
+	_, err = io.Copy(zw, bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"a.tar": raw, "a.tar.gz": gzipped.Bytes(), "a.tar.zst": zstded.Bytes()} {
+		archivePath := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(archivePath, data, 0644))
+
+		metas := make(map[string]*metadata.Meta)
+		err = WalkTar(context.Background(), archivePath, func(rel string, meta *metadata.Meta) error {
+			metas[rel] = meta
+			return nil
+		})
+		require.NoError(t, err, name)
+		require.Len(t, metas, 4, name)
+
+		require.Equal(t, metadata.FSTypeDir, metas["d"].FileSystem.Type)
+		require.Equal(t, os.ModeDir|0750, metas["d"].FileSystem.Mode)
+		require.Equal(t, uint32(1000), metas["d"].FileSystem.UID)
+
+		f := metas["d/f"]
+		require.Equal(t, filepath.Join(archivePath, "d", "f"), f.Common.Path)
+		require.Equal(t, uint64(6), f.Common.Size)
+		require.Equal(t, "b1946ac92492d2347c6235b4d2611184", f.Common.Hash)
+		require.Equal(t, uint64(1700000000), f.FileSystem.ModTime)
+		require.Equal(t, metadata.ExtendedAttributes{{Key: "user.a", Value: []byte("1")}, {Key: "user.b", Value: []byte("2")}},
+			f.ExtendedAttributes)
+
+		require.Equal(t, metadata.FSTypeFile, metas["hl"].FileSystem.Type)
+		require.Equal(t, f.Common.Hash, metas["hl"].Common.Hash)
+		require.Equal(t, f.Common.Size, metas["hl"].Common.Size)
+
+		require.Equal(t, metadata.FSTypeSymlink, metas["sl"].FileSystem.Type)
+		require.Equal(t, "d/f", metas["sl"].FileSystem.LinkTarget)
+	}
+}
+
+func TestWalkTarSkipsGlobalHeader(t *testing.T) {
+	// git archive writes a pax global header with the commit id before the entries
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	mtime := time.Unix(1700000000, 0)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader,
+		PAXRecords: map[string]string{"comment": "9a0364b9e99bb480dd25e1f0284c8555a1b2c3d4"}}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "repo/", Typeflag: tar.TypeDir, Mode: 0775, ModTime: mtime}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "repo/README", Typeflag: tar.TypeReg, Mode: 0664,
+		ModTime: mtime, Size: 6}))
+	_, err := tw.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	archivePath := filepath.Join(t.TempDir(), "repo.tar")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0644))
+
+	var rels []string
+	err = WalkTar(context.Background(), archivePath, func(rel string, meta *metadata.Meta) error {
+		require.NotEqual(t, metadata.FSTypeUnknown, meta.FileSystem.Type, rel)
+		rels = append(rels, rel)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"repo", "repo/README"}, rels)
+}
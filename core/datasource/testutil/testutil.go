@@ -0,0 +1,64 @@
+// Package testutil provides the fixtures shared by the tests of the packages which read metadata files.
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/validator"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// WriteMetaFile walks the source directory with a FileSource and writes its metadata file to the output directory,
+// like the generate command.
+// Output:
+// - metaPath: the path of the metadata file
+func WriteMetaFile(t testing.TB, srcDir, outDir string) string {
+	t.Helper()
+	ds, err := datasource.NewFileSource(srcDir, 1)
+	require.NoError(t, err)
+	writer, err := datasource.NewMetaWriter(srcDir, outDir)
+	require.NoError(t, err)
+
+	metaC := make(chan *metadata.Meta, 1)
+	errC := make(chan error, 1)
+	go func() { errC <- ds.Walk(context.Background(), outDir, metaC, 1) }()
+	require.NoError(t, writer.Write(context.Background(), metaC, 1))
+	require.NoError(t, <-errC)
+	return filepath.Join(outDir, "meta.out")
+}
+
+// WriteItems writes a metadata file of the items to a temp directory of the test.
+// Output:
+// - metaPath: the path of the metadata file
+func WriteItems(t testing.TB, sourceDir string, items []*metadata.Meta) string {
+	t.Helper()
+	header, err := json.Marshal(&datasource.MetaHeader{SourceDir: sourceDir, ItemCount: uint64(len(items))})
+	require.NoError(t, err)
+	data := append(header, '\n')
+	for _, item := range items {
+		row, _err := metadata.Serialise(item)
+		require.NoError(t, _err)
+		data = append(append(data, row...), '\n')
+	}
+
+	metaPath := filepath.Join(t.TempDir(), "meta.out")
+	require.NoError(t, os.WriteFile(metaPath, data, 0644))
+	return metaPath
+}
+
+// Validate validates the target directory against the metadata file with an FSValidator and returns the findings by
+// reason.
+func Validate(t testing.TB, targetDir, metaPath string) map[string]uint64 {
+	t.Helper()
+	reporter, err := validator.NewReporter("")
+	require.NoError(t, err)
+	v, err := validator.NewFSValidator(metadata.DirFS(targetDir), targetDir, reporter)
+	require.NoError(t, err)
+	require.NoError(t, v.Validate(context.Background(), metaPath, 2))
+	return reporter.Counts()
+}
@@ -0,0 +1,117 @@
+package datasource
+
+import (
+	"archive/zip"
+	"context"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/metrics"
+	"file-clone-validator/core/progress"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"log/slog"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// ZipSource is a DataSource implementation that reads the entries of a zip archive.
+type ZipSource struct {
+	archivePath string
+}
+
+// NewZipSource creates a new ZipSource.
+// Input:
+// - archivePath: the path to the zip archive. The paths of the entries are made absolute by joining it with the entry
+// names, so it plays the role of the source directory in the metadata file
+func NewZipSource(archivePath string) (DataSource, error) {
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	r.Close()
+	return &ZipSource{archivePath: archivePath}, nil
+}
+
+// Walk sends the metadata of each entry of the archive to the given channel. The entries are listed from the central
+// directory, and workerCount workers read their content concurrently, see metadata.RetrieveZipMeta.
+// Input:
+// - outDir: unused, the output directory can not be inside an archive
+// - out: the channel to send the metadata to
+// - workerCount: the number of workers to use to retrieve the metadata
+func (zs *ZipSource) Walk(ctx context.Context, outDir string, out chan<- *metadata.Meta, workerCount int) error {
+	slog.Info("Start walking the zip archive:",
+		slog.String("ArchivePath", zs.archivePath),
+		slog.Int("WorkerCount", workerCount),
+	)
+	defer close(out)
+
+	r, err := zip.OpenReader(zs.archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	defer r.Close()
+
+	fileC := make(chan *zip.File, 1)
+	defer metrics.TrackQueue("walk_items", func() int { return len(fileC) })()
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	var walkedCount atomic.Uint64
+	watchDone := make(chan struct{})
+	go func() {
+		progress.Watch(groupCtx, progress.PhaseWalk, uint64(len(r.File)), walkedCount.Load, utils.HashedBytes)
+		close(watchDone)
+	}()
+	defer func() { <-watchDone }()
+
+	group.Go(func() error {
+		defer close(fileC)
+		for _, f := range r.File {
+			if ArchiveEntryRelPath(f.Name) == "." {
+				continue
+			}
+
+			select {
+			case <-groupCtx.Done():
+				return groupCtx.Err()
+			case fileC <- f:
+			}
+		}
+		return nil
+	})
+
+	metrics.StartWorkers(metrics.PoolWalk, workerCount)
+	for i := 0; i < workerCount; i++ {
+		group.Go(func() error {
+			defer metrics.StopWorker(metrics.PoolWalk)
+			for f := range fileC {
+				done := metrics.Busy(metrics.PoolWalk)
+				meta, err := metadata.RetrieveZipMeta(groupCtx, ZipEntryPath(zs.archivePath, f.Name), f)
+				if err != nil {
+					return err
+				}
+				done()
+				walkedCount.Add(1)
+				metrics.ItemsWalked.Inc()
+
+				select {
+				case <-groupCtx.Done():
+					return groupCtx.Err()
+				case out <- meta:
+				}
+			}
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// ZipEntryPath returns the absolute path of a zip entry, made by joining the archive path and the entry name.
+func ZipEntryPath(archivePath, name string) string {
+	return filepath.Join(archivePath, filepath.FromSlash(ArchiveEntryRelPath(name)))
+}
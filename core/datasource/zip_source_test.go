@@ -0,0 +1,86 @@
+package datasource
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"file-clone-validator/core/metadata"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestZipSourceWalk(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	mtime := time.Unix(1700000000, 0)
+	owner := []byte{0x75, 0x78, 11, 0, 1, 4, 0xe8, 0x03, 0, 0, 4, 0xe9, 0x03, 0, 0} // uid 1000, gid 1001
+
+	entries := []struct {
+		hdr     *zip.FileHeader
+		mode    os.FileMode
+		content string
+	}{
+		{hdr: &zip.FileHeader{Name: "d/", Modified: mtime}, mode: os.ModeDir | 0750},
+		{hdr: &zip.FileHeader{Name: "d/f", Modified: mtime, Method: zip.Store, Extra: owner}, mode: 0644,
+			content: "hello\n"},
+		{hdr: &zip.FileHeader{Name: "sl", Modified: mtime}, mode: os.ModeSymlink | 0777, content: "d/f"},
+	}
+	for _, entry := range entries {
+		entry.hdr.SetMode(entry.mode)
+		w, err := zw.CreateHeader(entry.hdr)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	archivePath := filepath.Join(t.TempDir(), "a.zip")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0644))
+
+	walk := func() (map[string]*metadata.Meta, error) {
+		ds, err := NewZipSource(archivePath)
+		require.NoError(t, err)
+
+		out := make(chan *metadata.Meta)
+		metas := make(map[string]*metadata.Meta)
+		done := make(chan struct{})
+		go func() {
+			for meta := range out {
+				rel, _ := filepath.Rel(archivePath, meta.Common.Path)
+				metas[filepath.ToSlash(rel)] = meta
+			}
+			close(done)
+		}()
+		err = ds.Walk(context.Background(), t.TempDir(), out, 2)
+		<-done
+		return metas, err
+	}
+
+	metas, err := walk()
+	require.NoError(t, err)
+	require.Len(t, metas, 3)
+
+	require.Equal(t, metadata.FSTypeDir, metas["d"].FileSystem.Type)
+	require.Equal(t, os.ModeDir|0750, metas["d"].FileSystem.Mode)
+
+	f := metas["d/f"]
+	require.Equal(t, "f", f.Common.Name)
+	require.Equal(t, "b1946ac92492d2347c6235b4d2611184", f.Common.Hash)
+	require.Equal(t, os.FileMode(0644), f.FileSystem.Mode)
+	require.Equal(t, uint64(1700000000), f.FileSystem.ModTime)
+	require.Equal(t, uint32(1000), f.FileSystem.UID)
+	require.Equal(t, uint32(1001), f.FileSystem.GID)
+
+	require.Equal(t, metadata.FSTypeSymlink, metas["sl"].FileSystem.Type)
+	require.Equal(t, "d/f", metas["sl"].FileSystem.LinkTarget)
+
+	// corrupt the stored content, which no longer matches its CRC32
+	data := bytes.Replace(buf.Bytes(), []byte("hello\n"), []byte("jello\n"), 1)
+	require.NoError(t, os.WriteFile(archivePath, data, 0644))
+	_, err = walk()
+	require.True(t, errors.Is(err, zip.ErrChecksum), err)
+}
@@ -0,0 +1,436 @@
+package distributed
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// CoordinatorOptions configures a Coordinator.
+type CoordinatorOptions struct {
+	// BatchSize is the number of rows in one lease.
+	BatchSize int
+
+	// LeaseTimeout is how long a worker may hold a lease before it is reassigned to another worker.
+	LeaseTimeout time.Duration
+
+	// Token is the shared secret the workers must present. Any worker is accepted if it is empty.
+	Token string
+
+	// MaxAttempts is the number of times a lease is assigned before the validation fails, e.g. because every worker
+	// fails to validate it or holds it past the lease timeout. DefaultMaxAttempts if 0.
+	MaxAttempts int
+}
+
+// DefaultMaxAttempts is the default number of times a lease is assigned before the validation fails.
+const DefaultMaxAttempts = 3
+
+// lease is a batch of rows assigned to a worker.
+type lease struct {
+	id       uint64
+	rows     []string
+	holder   *conn
+	deadline time.Time
+	attempts int // the number of times the lease has been assigned
+}
+
+// Coordinator serves the rows of a metadata file to the connected workers and collects their findings. Rows are
+// assigned in batches with leases: the leases of a worker which disconnects, or which holds a lease for longer than
+// the lease timeout, are reassigned to the other workers. A late result of a reassigned lease is ignored, so every
+// row is counted exactly once.
+type Coordinator struct {
+	opts     CoordinatorOptions
+	reporter *validator.Reporter
+
+	mu        sync.Mutex
+	reader    *datasource.MetaReader
+	eof       bool
+	nextID    uint64
+	retry     []*lease
+	active    map[uint64]*lease
+	counted   uint64
+	readErr   error
+	failErr   error         // set when a lease failed MaxAttempts times
+	changed   chan struct{} // closed and replaced whenever the state changes
+	finishedC chan struct{} // closed when every row has been validated
+}
+
+// NewCoordinator creates a new Coordinator.
+// Input:
+// - metaFilePath: the metadata file to validate
+// - reporter: the reporter to record the findings of the workers to
+func NewCoordinator(metaFilePath string, reporter *validator.Reporter, opts CoordinatorOptions) (*Coordinator, error) {
+	if opts.BatchSize < 1 {
+		return nil, fmt.Errorf("batch size must be greater than 0. got %d", opts.BatchSize)
+	}
+	if opts.LeaseTimeout <= 0 {
+		return nil, fmt.Errorf("lease timeout must be greater than 0. got %s", opts.LeaseTimeout)
+	}
+	if opts.MaxAttempts < 0 {
+		return nil, fmt.Errorf("max attempts must not be negative. got %d", opts.MaxAttempts)
+	}
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	reader, err := datasource.OpenMetaFile(metaFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Coordinator{
+		opts:      opts,
+		reporter:  reporter,
+		reader:    reader,
+		active:    make(map[uint64]*lease),
+		changed:   make(chan struct{}),
+		finishedC: make(chan struct{}),
+	}, nil
+}
+
+// Header returns the header of the metadata file.
+func (c *Coordinator) Header() datasource.MetaHeader {
+	return c.reader.Header
+}
+
+// Counted returns the number of rows validated so far.
+func (c *Coordinator) Counted() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counted
+}
+
+// Serve accepts workers on the listener until every row of the metadata file has been validated, then tells the
+// workers to stop and returns. It fails once a lease has been assigned MaxAttempts times without a result. The
+// listener is closed when Serve returns. Wrap it with tls.NewListener for TLS, the token is sent in clear otherwise.
+func (c *Coordinator) Serve(ctx context.Context, ln net.Listener) error {
+	defer c.reader.Close()
+	defer ln.Close()
+
+	slog.Info("Start to coordinate validation:",
+		slog.String("Addr", ln.Addr().String()),
+		slog.Uint64("ItemCount", c.reader.Header.ItemCount),
+	)
+
+	// read the first batch ahead, so that an empty metadata file finishes without any worker
+	c.mu.Lock()
+	if l := c.readLease(); l != nil {
+		c.retry = append(c.retry, l)
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); c.expireLeases(ctx) }()
+
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return // closed by Serve
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.handle(ctx, newConn(nc, maxHelloSize))
+			}()
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		ln.Close()
+		wg.Wait()
+		return ctx.Err()
+	case <-c.finishedC:
+	}
+
+	ln.Close()
+	cancel()
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failErr != nil {
+		return c.failErr
+	}
+	if c.readErr != nil {
+		return c.readErr
+	}
+	if c.counted != c.reader.Header.ItemCount {
+		return fmt.Errorf("item count mismatch. expect %d, got %d", c.reader.Header.ItemCount, c.counted)
+	}
+
+	slog.Info("Finish to coordinate validation:", slog.Uint64("ItemCount", c.counted))
+	return nil
+}
+
+// handle serves one worker until it disconnects or every row has been validated. The connection only accepts a small
+// hello, within helloTimeout, until the worker is authenticated.
+func (c *Coordinator) handle(ctx context.Context, wc *conn) {
+	defer wc.Close()
+	stop := context.AfterFunc(ctx, func() { wc.Close() }) // unblock the hello when Serve returns
+	defer stop()
+
+	wc.SetReadDeadline(time.Now().Add(helloTimeout))
+	hello, err := wc.receive()
+	if err != nil || hello.Type != msgHello {
+		slog.Warn("Reject worker without hello:", slog.String("Addr", wc.RemoteAddr().String()), slog.Any("Error", err))
+		return
+	}
+	if c.opts.Token != "" && subtle.ConstantTimeCompare([]byte(hello.Token), []byte(c.opts.Token)) != 1 {
+		slog.Warn("Reject worker with invalid token:", slog.String("Worker", hello.Worker))
+		wc.send(&message{Type: msgError, Error: "invalid token"})
+		return
+	}
+	if !stop() { // Serve returned and the connection is closed, otherwise the loop below stops on ctx
+		return
+	}
+	wc.SetReadDeadline(time.Time{})
+	wc.setMaxSize(maxMessageSize)
+	capacity := max(hello.Capacity, 1)
+
+	header := c.reader.Header
+	if err = wc.send(&message{Type: msgHeader, Header: &header}); err != nil {
+		return
+	}
+	slog.Info("Worker connected:", slog.String("Worker", hello.Worker), slog.Int("Capacity", capacity))
+
+	// read the results in the background, the connection is only written by this goroutine and the senders
+	resultC := make(chan *message)
+	readErrC := make(chan error, 1)
+	go func() {
+		for {
+			msg, _err := wc.receive()
+			if _err != nil {
+				readErrC <- _err
+				return
+			}
+			select {
+			case resultC <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	outstanding := 0
+	for {
+		changed := c.changedC()
+		for outstanding < capacity {
+			l := c.acquire(wc)
+			if l == nil {
+				break
+			}
+			if err = wc.send(&message{Type: msgLease, LeaseID: l.id, Rows: l.rows}); err != nil {
+				c.release(wc)
+				return
+			}
+			outstanding++
+		}
+
+		select {
+		case <-ctx.Done():
+			wc.send(c.doneMessage())
+			return
+		case _err := <-readErrC:
+			if !errors.Is(_err, net.ErrClosed) && !errors.Is(_err, io.EOF) {
+				slog.Warn("Worker connection failed:", slog.String("Worker", hello.Worker), slog.Any("Error", _err))
+			}
+			slog.Warn("Worker disconnected, reassign its leases:", slog.String("Worker", hello.Worker))
+			c.release(wc)
+			return
+		case msg := <-resultC:
+			if msg.Type == msgResult {
+				outstanding--
+				c.complete(msg)
+			}
+			if msg.Error != "" { // the worker stops after a lease it can not validate, do not assign it another one
+				c.release(wc)
+				return
+			}
+		case <-changed:
+		}
+	}
+}
+
+// acquire assigns the next lease to the worker, a reassigned one first. It returns nil if no row is available now.
+func (c *Coordinator) acquire(wc *conn) *lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var l *lease
+	if len(c.retry) > 0 {
+		l, c.retry = c.retry[0], c.retry[1:]
+	} else if l = c.readLease(); l == nil {
+		return nil
+	}
+
+	l.holder = wc
+	l.deadline = time.Now().Add(c.opts.LeaseTimeout)
+	l.attempts++
+	c.active[l.id] = l
+	return l
+}
+
+// readLease reads the next batch of rows from the metadata file. It returns nil at the end of the file. It must be
+// called with the lock held.
+func (c *Coordinator) readLease() *lease {
+	if c.eof {
+		return nil
+	}
+
+	rows := make([]string, 0, c.opts.BatchSize)
+	for len(rows) < c.opts.BatchSize {
+		row, err := c.reader.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.readErr = err
+			}
+			c.eof = true
+			break
+		}
+		rows = append(rows, string(row))
+	}
+
+	if len(rows) == 0 {
+		c.checkFinished()
+		return nil
+	}
+	c.nextID++
+	return &lease{id: c.nextID, rows: rows}
+}
+
+// complete records the result of a lease. Results of leases which are not active anymore are ignored. A lease the
+// worker failed to validate is reassigned.
+func (c *Coordinator) complete(msg *message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok := c.active[msg.LeaseID]
+	if !ok {
+		slog.Warn("Ignore result of reassigned lease:", slog.Uint64("LeaseID", msg.LeaseID))
+		return
+	}
+	delete(c.active, msg.LeaseID)
+
+	if msg.Error != "" {
+		slog.Warn("Worker failed to validate lease, reassign it:", slog.Uint64("LeaseID", msg.LeaseID),
+			slog.String("Error", msg.Error))
+		c.requeue(l, msg.Error)
+		c.notify()
+		return
+	}
+
+	c.counted += min(msg.Count, uint64(len(l.rows))) // a worker can not count more rows than it has been leased
+	for _, finding := range msg.Findings {
+		c.reporter.Record(finding.Reason, errors.New(finding.Detail))
+	}
+	c.checkFinished()
+	c.notify()
+}
+
+// release requeues all the leases held by a worker.
+func (c *Coordinator) release(wc *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, l := range c.active {
+		if l.holder == wc {
+			delete(c.active, id)
+			c.requeue(l, "worker disconnected")
+		}
+	}
+	c.notify()
+}
+
+// expireLeases periodically requeues the leases held for longer than the lease timeout.
+func (c *Coordinator) expireLeases(ctx context.Context) {
+	ticker := time.NewTicker(max(c.opts.LeaseTimeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for id, l := range c.active {
+				if now.After(l.deadline) {
+					slog.Warn("Lease expired, reassign it:", slog.Uint64("LeaseID", id))
+					delete(c.active, id)
+					c.requeue(l, "lease expired")
+				}
+			}
+			c.notify()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// requeue makes a lease available to the other workers, or fails the validation if the lease has already been
+// assigned MaxAttempts times. It must be called with the lock held.
+// Input:
+// - reason: why the lease is not completed, e.g. the error of the worker
+func (c *Coordinator) requeue(l *lease, reason string) {
+	if l.attempts < c.opts.MaxAttempts {
+		c.retry = append(c.retry, l)
+		return
+	}
+
+	if c.failErr == nil {
+		c.failErr = fmt.Errorf("lease %d failed %d times, last error: %s", l.id, l.attempts, reason)
+		slog.Error("Abort validation:", slog.Any("Error", c.failErr))
+	}
+	select {
+	case <-c.finishedC:
+	default:
+		close(c.finishedC)
+	}
+}
+
+// doneMessage returns the message which tells the workers to stop.
+func (c *Coordinator) doneMessage() *message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failErr != nil {
+		return &message{Type: msgError, Error: c.failErr.Error()}
+	}
+	return &message{Type: msgDone}
+}
+
+// changedC returns a channel closed on the next state change.
+func (c *Coordinator) changedC() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+// notify wakes up the connection handlers. It must be called with the lock held.
+func (c *Coordinator) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// checkFinished closes finishedC once every row has been read and validated. It must be called with the lock held.
+func (c *Coordinator) checkFinished() {
+	if !c.eof || len(c.retry) > 0 || len(c.active) > 0 {
+		return
+	}
+	select {
+	case <-c.finishedC:
+	default:
+		close(c.finishedC)
+	}
+}
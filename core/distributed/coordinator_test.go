@@ -0,0 +1,169 @@
+package distributed_test
+
+import (
+	"bufio"
+	"context"
+	"file-clone-validator/core/distributed"
+	"file-clone-validator/core/validator"
+	"file-clone-validator/pkg/clonevalidator"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCoordinatorReassignsLeasesOfLostWorkers(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	for i := 0; i < 40; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("f%02d", i)), []byte{byte(i)}, 0644))
+	}
+	generated, err := clonevalidator.Generate(context.Background(), clonevalidator.GenerateOptions{
+		SourceDir: srcDir,
+		OutputDir: outDir,
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "f07")))
+
+	reporter, err := validator.NewReporter("")
+	require.NoError(t, err)
+	coordinator, err := distributed.NewCoordinator(generated.MetaFilePath, reporter, distributed.CoordinatorOptions{
+		BatchSize:    4,
+		LeaseTimeout: time.Minute,
+		Token:        "secret",
+	})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+
+	g, gCtx := errgroup.WithContext(context.Background())
+	g.Go(func() error { return coordinator.Serve(gCtx, ln) })
+
+	// a worker which takes a lease and disconnects without a result
+	lost, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = lost.Write([]byte(`{"Type":"hello","Token":"secret","Worker":"lost","Capacity":2}` + "\n"))
+	require.NoError(t, err)
+	s := bufio.NewScanner(lost)
+	require.True(t, s.Scan()) // header
+	require.True(t, s.Scan()) // first lease
+	require.NoError(t, lost.Close())
+
+	// a worker with a wrong token is rejected
+	err = distributed.RunWorker(context.Background(), addr, distributed.WorkerOptions{
+		Name: "intruder", TargetDir: srcDir, ValidatorCount: 1, Token: "wrong",
+	})
+	require.ErrorContains(t, err, "invalid token")
+
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("worker-%d", i)
+		g.Go(func() error {
+			return distributed.RunWorker(gCtx, addr, distributed.WorkerOptions{
+				Name: name, TargetDir: srcDir, ValidatorCount: 2, Token: "secret",
+			})
+		})
+	}
+	require.NoError(t, g.Wait())
+
+	require.Equal(t, generated.Header.ItemCount, coordinator.Counted())
+	require.Equal(t, map[string]uint64{validator.ReasonFileNotFound: 1}, reporter.Counts())
+}
+
+func TestCoordinatorFailsLeasesNoWorkerCanValidate(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "f"), []byte("f"), 0644))
+	generated, err := clonevalidator.Generate(context.Background(), clonevalidator.GenerateOptions{
+		SourceDir: srcDir,
+		OutputDir: outDir,
+	})
+	require.NoError(t, err)
+
+	reporter, err := validator.NewReporter("")
+	require.NoError(t, err)
+	coordinator, err := distributed.NewCoordinator(generated.MetaFilePath, reporter, distributed.CoordinatorOptions{
+		BatchSize:    16,
+		LeaseTimeout: time.Minute,
+		MaxAttempts:  2,
+	})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- coordinator.Serve(ctx, ln) }()
+
+	// the workers report the lease they can not validate and stop, until the lease has been attempted twice
+	missingDir := filepath.Join(t.TempDir(), "missing")
+	for i := 0; i < 2; i++ {
+		err = distributed.RunWorker(ctx, addr, distributed.WorkerOptions{
+			Name: fmt.Sprintf("worker-%d", i), TargetDir: missingDir, ValidatorCount: 1,
+		})
+		require.ErrorContains(t, err, "failed to validate lease 1")
+	}
+	require.ErrorContains(t, <-served, "lease 1 failed 2 times")
+}
+
+func TestCoordinatorLimitsUnauthenticatedWorkers(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "f"), []byte("f"), 0644))
+	generated, err := clonevalidator.Generate(context.Background(), clonevalidator.GenerateOptions{
+		SourceDir: srcDir,
+		OutputDir: outDir,
+	})
+	require.NoError(t, err)
+
+	reporter, err := validator.NewReporter("")
+	require.NoError(t, err)
+	coordinator, err := distributed.NewCoordinator(generated.MetaFilePath, reporter, distributed.CoordinatorOptions{
+		BatchSize:    16,
+		LeaseTimeout: time.Minute,
+	})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- coordinator.Serve(ctx, ln) }()
+
+	// a connection which never sends its hello does not hold back the end of the validation
+	silent, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer silent.Close()
+
+	// a hello larger than the limit is rejected before it is buffered
+	oversized, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer oversized.Close()
+	_, err = oversized.Write(make([]byte, 64<<10))
+	require.NoError(t, err)
+	_, err = bufio.NewReader(oversized).ReadByte()
+	require.Error(t, err)
+
+	// a worker which reports more rows than its lease holds only counts the rows of the lease
+	liar, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer liar.Close()
+	_, err = liar.Write([]byte(`{"Type":"hello","Worker":"liar","Capacity":1}` + "\n"))
+	require.NoError(t, err)
+	s := bufio.NewScanner(liar)
+	require.True(t, s.Scan()) // header
+	require.True(t, s.Scan()) // lease
+	_, err = liar.Write([]byte(`{"Type":"result","LeaseID":1,"Count":1000}` + "\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, <-served)
+	require.Equal(t, generated.Header.ItemCount, coordinator.Counted())
+}
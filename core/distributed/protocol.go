@@ -0,0 +1,120 @@
+package distributed
+
+import (
+	"bufio"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message types of the protocol. The messages are json objects, one per line, over a TCP connection:
+// - worker -> coordinator: hello, then one result per lease
+// - coordinator -> worker: header, then leases, then done when every row has been validated
+const (
+	msgHello  = "hello"
+	msgHeader = "header"
+	msgLease  = "lease"
+	msgResult = "result"
+	msgDone   = "done"
+	msgError  = "error"
+)
+
+// maxMessageSize is the largest message accepted on a connection.
+const maxMessageSize = 256 << 20
+
+// maxHelloSize is the largest hello accepted by the coordinator, which only receives the hello before the worker is
+// authenticated.
+const maxHelloSize = 4 << 10
+
+// helloTimeout is the time a worker has to present its token.
+const helloTimeout = 10 * time.Second
+
+// Finding is one finding of a worker, sent back to the coordinator.
+type Finding struct {
+	Reason string
+	Detail string
+}
+
+// message is the envelope of all the messages of the protocol. Only the fields of its type are set.
+type message struct {
+	Type string
+
+	// hello
+	Token    string `json:",omitempty"`
+	Worker   string `json:",omitempty"`
+	Capacity int    `json:",omitempty"`
+
+	// header
+	Header *datasource.MetaHeader `json:",omitempty"`
+
+	// lease and result
+	LeaseID  uint64    `json:",omitempty"`
+	Rows     []string  `json:",omitempty"`
+	Count    uint64    `json:",omitempty"`
+	Findings []Finding `json:",omitempty"`
+
+	// error, and result of a lease the worker failed to validate
+	Error string `json:",omitempty"`
+}
+
+// conn reads and writes messages on a connection. Writes are safe for concurrent use, reads are not.
+type conn struct {
+	net.Conn
+	scanner *bufio.Scanner
+	maxSize int // the largest message accepted by the next reads, see setMaxSize
+	mu      sync.Mutex
+}
+
+// newConn returns the conn of a connection which accepts the messages up to maxSize bytes.
+func newConn(c net.Conn, maxSize int) *conn {
+	sc := &conn{Conn: c, maxSize: maxSize}
+	sc.scanner = bufio.NewScanner(c)
+	sc.scanner.Buffer(make([]byte, 0, min(64<<10, maxSize)), maxMessageSize)
+	sc.scanner.Split(sc.scanLines)
+	return sc
+}
+
+// setMaxSize changes the largest message accepted by the next reads, up to maxMessageSize. It must not be called
+// concurrently with receive.
+func (c *conn) setMaxSize(maxSize int) {
+	c.maxSize = maxSize
+}
+
+// scanLines splits the messages like bufio.ScanLines, and fails as soon as a message is larger than the max size
+// instead of buffering it.
+func (c *conn) scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = bufio.ScanLines(data, atEOF)
+	if len(token) > c.maxSize || (token == nil && len(data) > c.maxSize) {
+		return 0, nil, bufio.ErrTooLong
+	}
+	return advance, token, err
+}
+
+func (c *conn) send(msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.Write(append(data, '\n'))
+	return err
+}
+
+func (c *conn) receive() (*message, error) {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, net.ErrClosed
+	}
+
+	msg := &message{}
+	if err := json.Unmarshal(c.scanner.Bytes(), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,166 @@
+package distributed
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// WorkerOptions configures a worker.
+type WorkerOptions struct {
+	// Name identifies the worker in the logs of the coordinator.
+	Name string
+
+	// TargetDir is the local mount of the target to validate.
+	TargetDir string
+
+	// ValidatorCount is the number of leases validated concurrently.
+	ValidatorCount int
+
+	// Token is the shared secret of the coordinator.
+	Token string
+
+	// TLS connects to the coordinator with TLS if it is set. Optional.
+	TLS *tls.Config
+}
+
+// RunWorker connects to a coordinator and validates the leased rows against the local target directory with the
+// FileValidator logic, until the coordinator tells it that every row has been validated. A lease which can not be
+// validated at all, e.g. because the target directory is missing, is reported to the coordinator and stops the
+// worker.
+// Input:
+// - addr: the address of the coordinator, e.g. "10.0.0.1:7070"
+func RunWorker(ctx context.Context, addr string, opts WorkerOptions) error {
+	if opts.ValidatorCount < 1 {
+		return fmt.Errorf("validator count must be greater than 0. got %d", opts.ValidatorCount)
+	}
+
+	var nc net.Conn
+	var err error
+	if opts.TLS != nil {
+		dialer := &tls.Dialer{Config: opts.TLS}
+		nc, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		nc, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to coordinator: %w", err)
+	}
+	wc := newConn(nc, maxMessageSize)
+	defer wc.Close()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() { // unblock the reads when the context is done
+		<-ctx.Done()
+		wc.Close()
+	}()
+
+	err = wc.send(&message{Type: msgHello, Token: opts.Token, Worker: opts.Name, Capacity: opts.ValidatorCount})
+	if err != nil {
+		return err
+	}
+
+	msg, err := wc.receive()
+	if err != nil {
+		return fmt.Errorf("failed to receive header: %w", err)
+	}
+	if msg.Type == msgError {
+		return fmt.Errorf("rejected by coordinator: %s", msg.Error)
+	}
+	if msg.Type != msgHeader || msg.Header == nil {
+		return fmt.Errorf("unexpected message from coordinator: %s", msg.Type)
+	}
+	header := *msg.Header
+
+	slog.Info("Connected to coordinator:",
+		slog.String("Addr", addr),
+		slog.String("SourceDir", header.SourceDir),
+		slog.String("TargetDir", opts.TargetDir),
+	)
+
+	leaseC := make(chan *message, opts.ValidatorCount)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.ValidatorCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range leaseC {
+				if ctx.Err() != nil {
+					continue // drain the leases, the worker is stopping
+				}
+				result, _err := validateLease(ctx, opts.TargetDir, &header, l)
+				if _err != nil {
+					slog.Error("Failed to validate lease:", slog.Uint64("LeaseID", l.LeaseID), slog.Any("Error", _err))
+					// the coordinator reassigns the lease to another worker, this one fails the same way
+					wc.send(&message{Type: msgResult, LeaseID: l.LeaseID, Error: _err.Error()})
+					cancel(fmt.Errorf("failed to validate lease %d: %w", l.LeaseID, _err))
+					continue
+				}
+				if _err = wc.send(result); _err != nil {
+					return
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(leaseC)
+
+	var validated uint64
+	for {
+		msg, err = wc.receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			return fmt.Errorf("lost connection to coordinator: %w", err)
+		}
+
+		switch msg.Type {
+		case msgLease:
+			validated += uint64(len(msg.Rows))
+			leaseC <- msg
+		case msgDone:
+			slog.Info("Finish to validate leases:", slog.Uint64("RowCount", validated))
+			return nil
+		case msgError:
+			return errors.New(msg.Error)
+		}
+	}
+}
+
+// validateLease validates the rows of one lease and returns the result to send back.
+func validateLease(ctx context.Context, targetDir string, header *datasource.MetaHeader, l *message) (*message, error) {
+	result := &message{Type: msgResult, LeaseID: l.LeaseID}
+
+	reporter, err := validator.NewReporter("")
+	if err != nil {
+		return nil, err
+	}
+	reporter.SetHook(func(entry validator.LogEntry) { // called synchronously by ValidateRow
+		result.Findings = append(result.Findings, Finding{Reason: entry.Reason, Detail: entry.ErrorDetail.Error()})
+	})
+
+	v, err := validator.NewFileValidator(targetDir, reporter)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, ok := v.(validator.RowValidator)
+	if !ok {
+		return nil, errors.New("validator does not support row validation")
+	}
+	for _, row := range l.Rows {
+		if rv.ValidateRow(ctx, []byte(row), header) {
+			result.Count++
+		}
+	}
+	return result, nil
+}
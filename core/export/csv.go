@@ -0,0 +1,50 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/inspect"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"io"
+)
+
+// WriteCSV writes the items of a metadata file as CSV, one Row per line after a header line. The items are streamed,
+// so the memory does not grow with the size of the metadata file.
+// Output:
+// - count: the number of items written
+func WriteCSV(ctx context.Context, metaPath string, w io.Writer) (count uint64, err error) {
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return 0, err
+	}
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(csvHeader); err != nil {
+		return 0, err
+	}
+
+	_, err = inspect.Scan(metaPath, func(item *metadata.Meta, row []byte) error {
+		if _err := ctx.Err(); _err != nil {
+			return _err
+		}
+
+		flat := NewRow(header.SourceDir, item)
+		record, _err := flat.csvRecord()
+		if _err != nil {
+			return fmt.Errorf("failed to flatten item %s: %w", item.Common.Path, _err)
+		}
+		if _err = cw.Write(record); _err != nil {
+			return _err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	cw.Flush()
+	return count, cw.Error()
+}
@@ -0,0 +1,9 @@
+// Package export converts a metadata file and the findings of its validation to formats other tools can analyse.
+package export
+
+// Formats of an export.
+const (
+	FormatSQLite  = "sqlite"  // a SQLite database with the entries, extended attributes, hard link groups and findings
+	FormatCSV     = "csv"     // one Row per line, with the extended attributes as a JSON column
+	FormatParquet = "parquet" // one Row per item, with the extended attributes as a nested list column
+)
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"file-clone-validator/core/checksum"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestFlatExports(t *testing.T) {
+	items := []*metadata.Meta{
+		{
+			Common:             metadata.CommonAttrs{Path: "/src/a/f", Name: "f", Size: 5, Hash: "5d41402abc4b2a76b9719d911017c592"},
+			FileSystem:         &metadata.FileSystemAttrs{Type: metadata.FSTypeFile, Mode: 0640, ModTime: 1600000000, UID: 1000, GID: 100, Links: 1},
+			ExtendedAttributes: metadata.ExtendedAttributes{{Key: "user.tag", Value: []byte{0, 1}}},
+		},
+		{
+			Common:        metadata.CommonAttrs{Path: "/src/b", Name: "b"},
+			ObjectStorage: &metadata.ObjectStorageAttrs{StorageClass: "STANDARD", LastModified: 1700000000},
+		},
+	}
+	metaPath := testutil.WriteItems(t, "/src", items)
+	ctx := context.Background()
+
+	// csv
+	buf := &bytes.Buffer{}
+	count, err := WriteCSV(ctx, metaPath, buf)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), count)
+	records, err := csv.NewReader(buf).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		csvHeader,
+		{"/src/a/f", "a/f", "f", "5", "5d41402abc4b2a76b9719d911017c592", "file", "0640", "-rw-r-----", "1600000000",
+			"1000", "100", "1", "", "", "", `[{"Key":"user.tag","Value":"AAE="}]`},
+		{"/src/b", "b", "b", "0", "", "", "", "", "", "", "", "", "", "STANDARD", "1700000000", ""},
+	}, records)
+
+	// parquet
+	buf.Reset()
+	count, err = WriteParquet(ctx, metaPath, buf)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), count)
+
+	r := parquet.NewGenericReader[Row](bytes.NewReader(buf.Bytes()))
+	defer r.Close()
+	rows := make([]Row, 3)
+	n, err := r.Read(rows)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 2, n)
+	require.Equal(t, NewRow("/src", items[0]), rows[0])
+	require.Equal(t, "a/f", rows[0].RelPath)
+	require.Equal(t, []XAttr{{Key: "user.tag", Value: []byte{0, 1}}}, rows[0].XAttrs)
+	require.Nil(t, rows[1].Type)
+	require.Equal(t, "STANDARD", *rows[1].StorageClass)
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	source, ok := file.Lookup("source_dir")
+	require.True(t, ok)
+	require.Equal(t, "/src", source)
+}
+
+func TestFlatExportsImportedManifest(t *testing.T) {
+	item, err := checksum.NewMeta("/src", "a/f", utils.HashMD5, "5d41402abc4b2a76b9719d911017c592")
+	require.NoError(t, err)
+	metaPath := testutil.WriteItems(t, "/src", []*metadata.Meta{item})
+
+	// the attributes which a checksum list does not record are null, not zero
+	buf := &bytes.Buffer{}
+	_, err = WriteCSV(context.Background(), metaPath, buf)
+	require.NoError(t, err)
+	records, err := csv.NewReader(buf).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		csvHeader,
+		{"/src/a/f", "a/f", "f", "0", "5d41402abc4b2a76b9719d911017c592", "file", "", "", "", "", "", "0", "", "", "", ""},
+	}, records)
+
+	row := NewRow("/src", item)
+	require.Nil(t, row.Mode)
+	require.Nil(t, row.ModTime)
+	require.Nil(t, row.UID)
+	require.Nil(t, row.GID)
+}
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"context"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/inspect"
+	"file-clone-validator/core/metadata"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+	"io"
+)
+
+// parquetRowGroupSize is the number of rows of a row group of a Parquet export. The writer buffers one row group, so
+// it bounds the memory of the export.
+const parquetRowGroupSize = 64 << 10
+
+// WriteParquet writes the items of a metadata file as Parquet, one Row per item, compressed with zstd. The items are
+// streamed and the rows are flushed every parquetRowGroupSize rows, so the memory does not grow with the size of the
+// metadata file.
+// Output:
+// - count: the number of items written
+func WriteParquet(ctx context.Context, metaPath string, w io.Writer) (count uint64, err error) {
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return 0, err
+	}
+
+	pw := parquet.NewGenericWriter[Row](w,
+		parquet.Compression(&zstd.Codec{}),
+		parquet.KeyValueMetadata("source_dir", header.SourceDir),
+	)
+
+	rows := make([]Row, 0, 1024)
+	buffered := 0 // the rows of the current row group
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		if _, _err := pw.Write(rows); _err != nil {
+			return _err
+		}
+		buffered += len(rows)
+		rows = rows[:0]
+		if buffered >= parquetRowGroupSize {
+			buffered = 0
+			return pw.Flush()
+		}
+		return nil
+	}
+
+	_, err = inspect.Scan(metaPath, func(item *metadata.Meta, row []byte) error {
+		if _err := ctx.Err(); _err != nil {
+			return _err
+		}
+
+		rows = append(rows, NewRow(header.SourceDir, item))
+		count++
+		if len(rows) == cap(rows) {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return count, err
+	}
+	return count, pw.Close()
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"encoding/json"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"strconv"
+)
+
+// Row is an item of a metadata file flattened into columns. The file system and object storage columns are null when
+// the item has no such attributes, and the mode, modification time and owner columns when the item does not record
+// them, e.g. an item imported from a checksum list, see metadata.Meta.Fields.
+type Row struct {
+	Path    string `parquet:"path"`
+	RelPath string `parquet:"rel_path"`
+	Name    string `parquet:"name"`
+	Size    int64  `parquet:"size"`
+	Hash    string `parquet:"hash"`
+
+	Type       *string `parquet:"fs_type,optional"`
+	Mode       *int32  `parquet:"fs_mode,optional"` // the Unix permission and special bits
+	ModeString *string `parquet:"fs_mode_string,optional"`
+	ModTime    *int64  `parquet:"fs_mtime,optional"` // seconds since the Unix epoch
+	UID        *int64  `parquet:"fs_uid,optional"`
+	GID        *int64  `parquet:"fs_gid,optional"`
+	Links      *int64  `parquet:"fs_links,optional"`
+	LinkTarget *string `parquet:"fs_link_target,optional"`
+
+	StorageClass *string `parquet:"os_storage_class,optional"`
+	LastModified *int64  `parquet:"os_last_modified,optional"` // seconds since the Unix epoch
+
+	XAttrs []XAttr `parquet:"xattrs,list"`
+}
+
+// XAttr is an extended attribute of a Row.
+type XAttr struct {
+	Key   string `parquet:"key"`
+	Value []byte `parquet:"value"`
+}
+
+// NewRow flattens an item.
+// Input:
+// - sourceDir: the source directory of the metadata file, RelPath is relative to it
+// - item: the item to flatten
+func NewRow(sourceDir string, item *metadata.Meta) Row {
+	row := Row{
+		Path:    item.Common.Path,
+		RelPath: relPath(sourceDir, item.Common.Path),
+		Name:    item.Common.Name,
+		Size:    int64(item.Common.Size),
+		Hash:    item.Common.Hash,
+		XAttrs:  make([]XAttr, 0, len(item.ExtendedAttributes)),
+	}
+
+	if fsAttrs := item.FileSystem; fsAttrs != nil {
+		links := int64(fsAttrs.Links)
+		row.Type, row.Links, row.LinkTarget = &fsAttrs.Type, &links, &fsAttrs.LinkTarget
+		if item.Records(metadata.FieldMode) {
+			mode, modeString := int32(metadata.UnixMode(fsAttrs.Mode)), fsAttrs.Mode.String()
+			row.Mode, row.ModeString = &mode, &modeString
+		}
+		if item.Records(metadata.FieldModTime) {
+			modTime := int64(fsAttrs.ModTime)
+			row.ModTime = &modTime
+		}
+		if item.Records(metadata.FieldUID) {
+			uid := int64(fsAttrs.UID)
+			row.UID = &uid
+		}
+		if item.Records(metadata.FieldGID) {
+			gid := int64(fsAttrs.GID)
+			row.GID = &gid
+		}
+	}
+
+	if osAttrs := item.ObjectStorage; osAttrs != nil {
+		lastModified := int64(osAttrs.LastModified)
+		row.StorageClass, row.LastModified = &osAttrs.StorageClass, &lastModified
+	}
+
+	for _, xattr := range item.ExtendedAttributes {
+		row.XAttrs = append(row.XAttrs, XAttr{Key: xattr.Key, Value: xattr.Value})
+	}
+	return row
+}
+
+// csvHeader are the columns of a CSV export, in the order of Row.
+var csvHeader = []string{
+	"path", "rel_path", "name", "size", "hash",
+	"fs_type", "fs_mode", "fs_mode_string", "fs_mtime", "fs_uid", "fs_gid", "fs_links", "fs_link_target",
+	"os_storage_class", "os_last_modified",
+	"xattrs",
+}
+
+// csvRecord returns the columns of the row for a CSV export. The null columns are empty, and the extended attributes
+// are a JSON array of {"Key", "Value"} objects with the values in base64, or empty if there are none.
+func (r *Row) csvRecord() ([]string, error) {
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	num := func(i *int64) string {
+		if i == nil {
+			return ""
+		}
+		return strconv.FormatInt(*i, 10)
+	}
+
+	mode := ""
+	if r.Mode != nil {
+		mode = fmt.Sprintf("%04o", *r.Mode)
+	}
+
+	xattrs := ""
+	if len(r.XAttrs) > 0 {
+		data, err := json.Marshal(r.XAttrs)
+		if err != nil {
+			return nil, err
+		}
+		xattrs = string(data)
+	}
+
+	return []string{
+		r.Path, r.RelPath, r.Name, strconv.FormatInt(r.Size, 10), r.Hash,
+		str(r.Type), mode, str(r.ModeString), num(r.ModTime), num(r.UID), num(r.GID), num(r.Links), str(r.LinkTarget),
+		str(r.StorageClass), num(r.LastModified),
+		xattrs,
+	}, nil
+}
@@ -0,0 +1,269 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/inspect"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"log/slog"
+	_ "modernc.org/sqlite" // the pure-Go driver registered as "sqlite"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sqliteSchema creates the tables of a SQLite export. The statements are idempotent, so several metadata files and
+// error reports can be loaded into the same database.
+// Note:
+// - The hard link groups are the files of a manifest with the same device and inode numbers. The metadata files
+// generated before the inode numbers were recorded, see metadata.FileSystemAttrs.Inode, have no hard link groups
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS manifests (
+	id          INTEGER PRIMARY KEY,
+	meta_path   TEXT    NOT NULL,
+	source_dir  TEXT    NOT NULL,
+	item_count  INTEGER NOT NULL,
+	loaded_at   TEXT    NOT NULL
+);
+CREATE TABLE IF NOT EXISTS hardlink_groups (
+	id          INTEGER PRIMARY KEY,
+	manifest_id INTEGER NOT NULL REFERENCES manifests(id),
+	dev         INTEGER NOT NULL,
+	inode       INTEGER NOT NULL,
+	links       INTEGER NOT NULL,
+	members     INTEGER NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS hardlink_groups_inode ON hardlink_groups(manifest_id, dev, inode);
+CREATE TABLE IF NOT EXISTS entries (
+	id             INTEGER PRIMARY KEY,
+	manifest_id    INTEGER NOT NULL REFERENCES manifests(id),
+	path           TEXT    NOT NULL,
+	rel_path       TEXT    NOT NULL,
+	name           TEXT    NOT NULL,
+	type           TEXT    NOT NULL,
+	size           INTEGER NOT NULL,
+	hash           TEXT    NOT NULL,
+	mode           INTEGER NOT NULL,
+	mode_string    TEXT    NOT NULL,
+	mtime          INTEGER NOT NULL,
+	uid            INTEGER NOT NULL,
+	gid            INTEGER NOT NULL,
+	links          INTEGER NOT NULL,
+	link_target    TEXT    NOT NULL,
+	dev            INTEGER,
+	inode          INTEGER,
+	hardlink_group INTEGER REFERENCES hardlink_groups(id)
+);
+CREATE INDEX IF NOT EXISTS entries_path ON entries(path);
+CREATE INDEX IF NOT EXISTS entries_rel_path ON entries(manifest_id, rel_path);
+CREATE INDEX IF NOT EXISTS entries_hash ON entries(hash);
+CREATE TABLE IF NOT EXISTS xattrs (
+	entry_id INTEGER NOT NULL REFERENCES entries(id),
+	key      TEXT    NOT NULL,
+	value    BLOB    NOT NULL,
+	PRIMARY KEY (entry_id, key)
+);
+CREATE TABLE IF NOT EXISTS findings (
+	id          INTEGER PRIMARY KEY,
+	report_path TEXT    NOT NULL,
+	reason      TEXT    NOT NULL,
+	side        TEXT    NOT NULL,
+	path        TEXT,
+	error       TEXT    NOT NULL,
+	item        TEXT,
+	loaded_at   TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS findings_path ON findings(path);
+CREATE INDEX IF NOT EXISTS findings_reason ON findings(reason);
+`
+
+// sqliteHardlinkGroups group the hard linked files of a manifest, see sqliteSchema.
+var sqliteHardlinkGroups = []string{`
+INSERT INTO hardlink_groups (manifest_id, dev, inode, links, members)
+SELECT manifest_id, dev, inode, MAX(links), COUNT(*)
+FROM entries
+WHERE manifest_id = ?1 AND type = 'file' AND links > 1 AND inode IS NOT NULL
+GROUP BY dev, inode`, `
+UPDATE entries SET hardlink_group = (
+	SELECT g.id FROM hardlink_groups g
+	WHERE g.manifest_id = entries.manifest_id AND g.dev = entries.dev AND g.inode = entries.inode
+)
+WHERE manifest_id = ?1 AND type = 'file' AND links > 1 AND inode IS NOT NULL`,
+}
+
+// OpenSQLite opens the SQLite database at the given path, creates it if it does not exist and creates the tables of
+// the export.
+func OpenSQLite(ctx context.Context, dbPath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", dbPath, err)
+	}
+	db.SetMaxOpenConns(1) // one writer, and the pragmas apply to the only connection
+
+	for _, statement := range []string{"PRAGMA journal_mode = WAL", "PRAGMA synchronous = NORMAL", sqliteSchema} {
+		if _, err = db.ExecContext(ctx, statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create the tables of database %s: %w", dbPath, err)
+		}
+	}
+	return db, nil
+}
+
+// LoadManifest loads the items of a metadata file into the database in one transaction, and groups the hard linked
+// files.
+// Output:
+// - manifestID: the id of the row of the metadata file in the manifests table
+func LoadManifest(ctx context.Context, db *sql.DB, metaPath string) (manifestID int64, err error) {
+	metaPath, err = filepath.Abs(metaPath)
+	if err != nil {
+		return 0, err
+	}
+
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("Start to load metadata file into database:", slog.String("MetaFilePath", metaPath))
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO manifests (meta_path, source_dir, item_count, loaded_at) VALUES (?, ?, 0, ?)",
+		metaPath, header.SourceDir, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	if manifestID, err = result.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	insertEntry, err := tx.PrepareContext(ctx, `INSERT INTO entries (manifest_id, path, rel_path, name, type, size, hash,
+		mode, mode_string, mtime, uid, gid, links, link_target, dev, inode)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertEntry.Close()
+	insertXAttr, err := tx.PrepareContext(ctx, "INSERT OR REPLACE INTO xattrs (entry_id, key, value) VALUES (?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer insertXAttr.Close()
+
+	var count uint64
+	_, err = inspect.Scan(metaPath, func(item *metadata.Meta, row []byte) error {
+		if _err := ctx.Err(); _err != nil {
+			return _err
+		}
+
+		fsAttrs := item.FileSystem
+		if fsAttrs == nil {
+			fsAttrs = &metadata.FileSystemAttrs{Type: metadata.FSTypeUnknown}
+		}
+		result, _err := insertEntry.ExecContext(ctx, manifestID, item.Common.Path, relPath(header.SourceDir, item.Common.Path),
+			item.Common.Name, fsAttrs.Type, int64(item.Common.Size), item.Common.Hash, metadata.UnixMode(fsAttrs.Mode), fsAttrs.Mode.String(),
+			int64(fsAttrs.ModTime), fsAttrs.UID, fsAttrs.GID, int64(fsAttrs.Links), fsAttrs.LinkTarget,
+			nullInt64(fsAttrs.Dev, fsAttrs.Inode != 0), nullInt64(fsAttrs.Inode, fsAttrs.Inode != 0))
+		if _err != nil {
+			return fmt.Errorf("failed to insert entry %s: %w", item.Common.Path, _err)
+		}
+		entryID, _err := result.LastInsertId()
+		if _err != nil {
+			return _err
+		}
+
+		for _, xattr := range item.ExtendedAttributes {
+			if _, _err = insertXAttr.ExecContext(ctx, entryID, xattr.Key, xattr.Value); _err != nil {
+				return fmt.Errorf("failed to insert extended attribute %s of %s: %w", xattr.Key, item.Common.Path, _err)
+			}
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE manifests SET item_count = ? WHERE id = ?", count, manifestID); err != nil {
+		return 0, err
+	}
+	for _, statement := range sqliteHardlinkGroups {
+		if _, err = tx.ExecContext(ctx, statement, manifestID); err != nil {
+			return 0, fmt.Errorf("failed to group hard links: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	slog.Info("Finish to load metadata file into database:", slog.String("MetaFilePath", metaPath),
+		slog.Int64("ManifestID", manifestID), slog.Uint64("ItemCount", count))
+	return manifestID, nil
+}
+
+// LoadFindings loads the findings of an error report into the database in one transaction. The findings are joined
+// with the entries on the path column.
+func LoadFindings(ctx context.Context, db *sql.DB, reportPath string, findings []validator.Finding) error {
+	reportPath, err := filepath.Abs(reportPath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO findings (report_path, reason, side, path, error, item, loaded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	loadedAt := time.Now().UTC().Format(time.RFC3339)
+	for _, finding := range findings {
+		var path, item sql.NullString
+		if finding.Item != nil {
+			data, _err := json.Marshal(finding.Item)
+			if _err != nil {
+				return _err
+			}
+			path = sql.NullString{String: finding.Item.Common.Path, Valid: true}
+			item = sql.NullString{String: string(data), Valid: true}
+		}
+
+		if _, err = insert.ExecContext(ctx, reportPath, finding.Reason, finding.Side, path, finding.Error, item,
+			loadedAt); err != nil {
+			return fmt.Errorf("failed to insert finding: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	slog.Info("Finish to load findings into database:", slog.String("ReportPath", reportPath),
+		slog.Int("FindingCount", len(findings)))
+	return nil
+}
+
+// nullInt64 returns the value as an INTEGER if it is valid, and NULL otherwise.
+func nullInt64(value uint64, valid bool) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(value), Valid: valid}
+}
+
+// relPath returns the path of an item relative to the source directory, or the path itself if it is outside of it.
+func relPath(sourceDir, path string) string {
+	if rel, ok := strings.CutPrefix(path, sourceDir+string(filepath.Separator)); ok {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"context"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/validator"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteExport(t *testing.T) {
+	root := t.TempDir()
+	srcDir := filepath.Join(root, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("hello"), 0644))
+	require.NoError(t, os.Link(filepath.Join(srcDir, "a", "f"), filepath.Join(srcDir, "g")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "h"), []byte("hello"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "i"), []byte("hello"), 0644))
+	require.NoError(t, os.Link(filepath.Join(srcDir, "i"), filepath.Join(srcDir, "a", "j")))
+	for _, name := range []string{"g", "h", "i"} { // the same content and attributes as the other files
+		require.NoError(t, os.Chtimes(filepath.Join(srcDir, name), time.Unix(1600000000, 0), time.Unix(1600000000, 0)))
+	}
+	metaPath := testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "out"))
+
+	ctx := context.Background()
+	dbPath := filepath.Join(root, "export.db")
+	db, err := OpenSQLite(ctx, dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	manifestID, err := LoadManifest(ctx, db, metaPath)
+	require.NoError(t, err)
+	require.NoError(t, LoadFindings(ctx, db, filepath.Join(root, "report.txt"), []validator.Finding{
+		{Reason: validator.ReasonFileNotFound, Side: validator.SideSource, Error: "missing",
+			Item: &metadata.Meta{Common: metadata.CommonAttrs{Path: filepath.Join(srcDir, "h")}}},
+		{Reason: validator.ReasonInvalidJSON, Error: "bad row"},
+	}))
+
+	var count, groups, members int
+	require.NoError(t, db.QueryRow("SELECT item_count FROM manifests WHERE id = ?", manifestID).Scan(&count))
+	require.Equal(t, 6, count)
+	require.NoError(t, db.QueryRow("SELECT COUNT(*), SUM(members) FROM hardlink_groups").Scan(&groups, &members))
+	require.Equal(t, []int{2, 4}, []int{groups, members})
+
+	// the links to the same file share a group, the links to another file and the copy with the same content do not
+	rows, err := db.Query(`SELECT group_concat(rel_path, ' ') FROM (SELECT hardlink_group, rel_path FROM entries
+		WHERE type = 'file' ORDER BY rel_path) GROUP BY hardlink_group ORDER BY 1`)
+	require.NoError(t, err)
+	groupPaths := make([]string, 0)
+	for rows.Next() {
+		var paths string
+		require.NoError(t, rows.Scan(&paths))
+		groupPaths = append(groupPaths, paths)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []string{"a/f g", "a/j i", "h"}, groupPaths)
+
+	// the findings join the entries on the path
+	var relPath, mode string
+	require.NoError(t, db.QueryRow(`SELECT e.rel_path, e.mode_string FROM findings f JOIN entries e ON e.path = f.path
+		WHERE f.reason = ?`, validator.ReasonFileNotFound).Scan(&relPath, &mode))
+	require.Equal(t, []string{"h", "-rw-r--r--"}, []string{relPath, mode})
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM findings WHERE path IS NULL").Scan(&count))
+	require.Equal(t, 1, count)
+
+	// a second load adds a manifest to the same database
+	_, err = LoadManifest(ctx, db, metaPath)
+	require.NoError(t, err)
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM entries").Scan(&count))
+	require.Equal(t, 12, count)
+}
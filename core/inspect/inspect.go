@@ -0,0 +1,68 @@
+// Package inspect looks inside a metadata file: it summarises the items, finds a single item and filters the items
+// with an expression.
+package inspect
+
+import (
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// Scan reads the items of a metadata file and calls fn with each of them and its row.
+func Scan(metaPath string, fn func(item *metadata.Meta, row []byte) error) (*datasource.MetaHeader, error) {
+	r, err := datasource.OpenMetaFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for {
+		row, _err := r.Next()
+		if errors.Is(_err, io.EOF) {
+			return &r.Header, nil
+		}
+		if _err != nil {
+			return nil, fmt.Errorf("failed to read metadata file: %w", _err)
+		}
+
+		item, _err := metadata.Deserialise(row)
+		if _err != nil {
+			return nil, fmt.Errorf("failed to parse metadata row %q: %w", row, _err)
+		}
+		if _err = fn(item, row); _err != nil {
+			return nil, _err
+		}
+	}
+}
+
+// errFound stops the scan of Find.
+var errFound = errors.New("found")
+
+// Find returns the item of a metadata file at the given path, which is either the recorded source path or a path
+// relative to the source directory of the metadata file. Nil if there is no such item.
+func Find(metaPath, path string) (*metadata.Meta, error) {
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(header.SourceDir, path)
+	}
+	path = filepath.Clean(path)
+
+	var found *metadata.Meta
+	_, err = Scan(metaPath, func(item *metadata.Meta, row []byte) error {
+		if item.Common.Path == path {
+			found = item
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return nil, err
+	}
+	return found, nil
+}
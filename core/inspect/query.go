@@ -0,0 +1,402 @@
+package inspect
+
+import (
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expr is a compiled filter expression, see Compile.
+type Expr func(item *metadata.Meta) bool
+
+// kinds of the fields of an expression, which decide the operators and the syntax of the literals.
+const (
+	kindString = iota // compared with ==, !=, =~ and !~ to a quoted string
+	kindNumber        // compared with any comparison operator to an integer
+	kindSize          // a number which accepts the size suffixes, e.g. 1G
+	kindTime          // a number of seconds which accepts a date, e.g. 2020-01-01, or an RFC 3339 time
+	kindMode          // a number which is written in octal, e.g. 0644
+)
+
+// field is a field of an item an expression can refer to.
+type field struct {
+	kind    int
+	str     func(item *metadata.Meta) []string // the values of a string field, the comparison matches any of them
+	num     func(item *metadata.Meta) uint64
+	summary string
+}
+
+// fsAttrs returns the file system attributes of an item, or empty ones.
+func fsAttrs(item *metadata.Meta) *metadata.FileSystemAttrs {
+	if item.FileSystem == nil {
+		return &metadata.FileSystemAttrs{}
+	}
+	return item.FileSystem
+}
+
+// fields are the fields of the expressions by name.
+var fields = map[string]field{
+	"path": {kind: kindString, summary: "the source path",
+		str: func(item *metadata.Meta) []string { return []string{item.Common.Path} }},
+	"name": {kind: kindString, summary: "the file name",
+		str: func(item *metadata.Meta) []string { return []string{item.Common.Name} }},
+	"hash": {kind: kindString, summary: "the content hash",
+		str: func(item *metadata.Meta) []string { return []string{item.Common.Hash} }},
+	"type": {kind: kindString, summary: "the file type, e.g. file, dir or symlink",
+		str: func(item *metadata.Meta) []string { return []string{fsAttrs(item).Type} }},
+	"target": {kind: kindString, summary: "the target of a symbolic link",
+		str: func(item *metadata.Meta) []string { return []string{fsAttrs(item).LinkTarget} }},
+	"xattr": {kind: kindString, summary: "the keys of the extended attributes, matches if any key matches",
+		str: func(item *metadata.Meta) []string {
+			keys := make([]string, 0, len(item.ExtendedAttributes))
+			for _, xattr := range item.ExtendedAttributes {
+				keys = append(keys, xattr.Key)
+			}
+			return keys
+		}},
+	"size": {kind: kindSize, summary: "the size in bytes, e.g. 1G",
+		num: func(item *metadata.Meta) uint64 { return item.Common.Size }},
+	"mtime": {kind: kindTime, summary: "the modification time, e.g. 2020-01-01 or 2020-01-01T12:00:00Z",
+		num: func(item *metadata.Meta) uint64 { return fsAttrs(item).ModTime }},
+	"mode": {kind: kindMode, summary: "the permission and special bits in octal, e.g. 0644",
+		num: func(item *metadata.Meta) uint64 { return uint64(metadata.UnixMode(fsAttrs(item).Mode)) }},
+	"uid": {kind: kindNumber, summary: "the user id of the owner",
+		num: func(item *metadata.Meta) uint64 { return uint64(fsAttrs(item).UID) }},
+	"gid": {kind: kindNumber, summary: "the group id of the owner",
+		num: func(item *metadata.Meta) uint64 { return uint64(fsAttrs(item).GID) }},
+	"links": {kind: kindNumber, summary: "the number of hard links",
+		num: func(item *metadata.Meta) uint64 { return fsAttrs(item).Links }},
+	"xattrs": {kind: kindNumber, summary: "the number of extended attributes",
+		num: func(item *metadata.Meta) uint64 { return uint64(len(item.ExtendedAttributes)) }},
+}
+
+// FieldsHelp describes the fields of the expressions, one per line.
+func FieldsHelp() string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sb := strings.Builder{}
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("  %-7s %s\n", name, fields[name].summary))
+	}
+	return sb.String()
+}
+
+// Compile compiles a filter expression over the fields of the items, e.g.
+// `type == "file" && size > 1G && mtime < 2020-01-01`.
+// Note:
+// - The comparisons are `<field> <op> <literal>`, with the operators ==, !=, <, <=, > and >= for the numbers, and
+// ==, != and the regular expression matches =~ and !~ for the strings
+// - The comparisons are combined with &&, || and !, and grouped with parentheses. && binds tighter than ||
+// - The strings are quoted with double or single quotes and unescaped like the Go strings, e.g. "a\"b" or 'a\'b', the
+// other literals are bare words
+func Compile(expression string) (Expr, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	return expr, nil
+}
+
+// token is a token of an expression.
+type token struct {
+	text     string
+	quoted   bool // the token is a quoted string, text is unquoted
+	operator bool // the token is one of the operators, never a quoted string
+	offset   int
+}
+
+// operators are the operators of the expressions, the longest first.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+// tokenize splits an expression into tokens.
+func tokenize(expression string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(expression) && expression[end] != byte(c) {
+				if expression[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+
+			text, err := unquote(expression[i+1:end], byte(c))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %w", i, err)
+			}
+			tokens = append(tokens, token{text: text, quoted: true, offset: i})
+			i = end + 1
+			continue
+		}
+
+		operator := ""
+		for _, op := range operators {
+			if strings.HasPrefix(expression[i:], op) {
+				operator = op
+				break
+			}
+		}
+		if operator != "" {
+			tokens = append(tokens, token{text: operator, operator: true, offset: i})
+			i += len(operator)
+			continue
+		}
+
+		end := i
+		for end < len(expression) && !unicode.IsSpace(rune(expression[end])) && !strings.ContainsRune(`"'()!=<>&|~`, rune(expression[end])) {
+			end++
+		}
+		if end == i { // a character which starts an operator but is not one, e.g. a single =
+			return nil, fmt.Errorf("unexpected %q at offset %d", expression[i], i)
+		}
+		tokens = append(tokens, token{text: expression[i:end], offset: i})
+		i = end
+	}
+	return tokens, nil
+}
+
+// unquote unescapes the body of a string quoted with the quote, the escape sequences are the ones of the Go strings
+// for both quotes.
+func unquote(body string, quote byte) (string, error) {
+	var sb strings.Builder
+	for body != "" {
+		r, multibyte, tail, err := strconv.UnquoteChar(body, quote)
+		if err != nil {
+			return "", err
+		}
+		if multibyte {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte(byte(r))
+		}
+		body = tail
+	}
+	return sb.String(), nil
+}
+
+// parser parses the tokens of an expression by recursive descent.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// peek returns the text of the next token if it is an operator, so that a quoted "&&" is not taken for one.
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) || !p.tokens[p.pos].operator {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+// next returns the next token.
+func (p *parser) next(expected string) (token, error) {
+	if p.pos >= len(p.tokens) {
+		return token{}, fmt.Errorf("unexpected end of expression, expect %s", expected)
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, _err := p.parseAnd()
+		if _err != nil {
+			return nil, _err
+		}
+		l := left
+		left = func(item *metadata.Meta) bool { return l(item) || right(item) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, _err := p.parseUnary()
+		if _err != nil {
+			return nil, _err
+		}
+		l := left
+		left = func(item *metadata.Meta) bool { return l(item) && right(item) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	switch p.peek() {
+	case "!":
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(item *metadata.Meta) bool { return !expr(item) }, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, err := p.next(`")"`)
+		if err != nil {
+			return nil, err
+		}
+		if !closing.operator || closing.text != ")" {
+			return nil, fmt.Errorf(`unexpected %q at offset %d, expect ")"`, closing.text, closing.offset)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	name, err := p.next("a field")
+	if err != nil {
+		return nil, err
+	}
+	f, ok := fields[name.text]
+	if name.quoted || !ok {
+		return nil, fmt.Errorf("unknown field %q at offset %d", name.text, name.offset)
+	}
+
+	op, err := p.next("an operator")
+	if err != nil {
+		return nil, err
+	}
+	if !op.operator {
+		return nil, fmt.Errorf("invalid operator %q at offset %d", op.text, op.offset)
+	}
+	literal, err := p.next("a value")
+	if err != nil {
+		return nil, err
+	}
+
+	if f.kind == kindString {
+		return compileString(f, op, literal)
+	}
+	return compileNumber(f, op, literal)
+}
+
+// compileString compiles the comparison of a string field.
+func compileString(f field, op, literal token) (Expr, error) {
+	if !literal.quoted {
+		return nil, fmt.Errorf("invalid value %q at offset %d: strings must be quoted", literal.text, literal.offset)
+	}
+
+	var match func(value string) bool
+	switch op.text {
+	case "==", "!=":
+		match = func(value string) bool { return value == literal.text }
+	case "=~", "!~":
+		re, err := regexp.Compile(literal.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression at offset %d: %w", literal.offset, err)
+		}
+		match = re.MatchString
+	default:
+		return nil, fmt.Errorf("invalid operator %q at offset %d for a string field", op.text, op.offset)
+	}
+
+	negate := op.text == "!=" || op.text == "!~"
+	return func(item *metadata.Meta) bool {
+		for _, value := range f.str(item) {
+			if match(value) {
+				return !negate
+			}
+		}
+		return negate
+	}, nil
+}
+
+// compileNumber compiles the comparison of a numeric field.
+func compileNumber(f field, op, literal token) (Expr, error) {
+	if literal.quoted && f.kind != kindTime {
+		return nil, fmt.Errorf("invalid value %q at offset %d: numbers must not be quoted", literal.text, literal.offset)
+	}
+	value, err := parseNumber(f.kind, literal.text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q at offset %d: %w", literal.text, literal.offset, err)
+	}
+
+	var compare func(a uint64) bool
+	switch op.text {
+	case "==":
+		compare = func(a uint64) bool { return a == value }
+	case "!=":
+		compare = func(a uint64) bool { return a != value }
+	case "<":
+		compare = func(a uint64) bool { return a < value }
+	case "<=":
+		compare = func(a uint64) bool { return a <= value }
+	case ">":
+		compare = func(a uint64) bool { return a > value }
+	case ">=":
+		compare = func(a uint64) bool { return a >= value }
+	default:
+		return nil, fmt.Errorf("invalid operator %q at offset %d for a numeric field", op.text, op.offset)
+	}
+	return func(item *metadata.Meta) bool { return compare(f.num(item)) }, nil
+}
+
+// parseNumber parses the literal of a numeric field.
+func parseNumber(kind int, s string) (uint64, error) {
+	switch kind {
+	case kindSize:
+		return utils.ParseSize(s)
+	case kindMode:
+		return strconv.ParseUint(s, 8, 32)
+	case kindTime:
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				if t.Unix() < 0 {
+					return 0, nil
+				}
+				return uint64(t.Unix()), nil
+			}
+		}
+		value, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expect a date, an RFC 3339 time or seconds since the Unix epoch")
+		}
+		return value, nil
+	default:
+		return strconv.ParseUint(s, 10, 64)
+	}
+}
@@ -0,0 +1,67 @@
+package inspect
+
+import (
+	"file-clone-validator/core/metadata"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	old := uint64(time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC).Unix())
+	big := &metadata.Meta{
+		Common:             metadata.CommonAttrs{Path: "/src/data/big.iso", Name: "big.iso", Size: 2 << 30},
+		FileSystem:         &metadata.FileSystemAttrs{Type: metadata.FSTypeFile, Mode: 0644 | os.ModeSetuid, ModTime: old, Links: 2},
+		ExtendedAttributes: metadata.ExtendedAttributes{{Key: "user.tag", Value: []byte("x")}},
+	}
+	dir := &metadata.Meta{
+		Common:     metadata.CommonAttrs{Path: "/src/data", Name: "data"},
+		FileSystem: &metadata.FileSystemAttrs{Type: metadata.FSTypeDir, Mode: os.ModeDir | 0755, ModTime: old + 1<<25},
+	}
+
+	for expression, expected := range map[string][2]bool{
+		`type == "file" && size > 1G && mtime < 2020-01-01`:   {true, false},
+		`type == 'dir' || size >= 2GiB`:                       {true, true},
+		`!(type == "file")`:                                   {false, true},
+		`name =~ "\\.iso$" && links > 1`:                      {true, false},
+		`path !~ "^/src/data/"`:                               {false, true},
+		`mode == 4644 || mode == 0755`:                        {true, true},
+		`xattr == "user.tag" && xattrs == 1`:                  {true, false},
+		`mtime >= 2019-06-01T00:00:00Z && mtime < 1580000000`: {true, false},
+		`type == "dir" && size == 0 || name == "&&"`:          {false, true},
+		`name == 'big\x2eiso' || name == 'a\'b'`:              {true, false},
+	} {
+		expr, err := Compile(expression)
+		require.NoError(t, err, expression)
+		require.Equal(t, expected, [2]bool{expr(big), expr(dir)}, expression)
+	}
+
+	// the single quoted strings are unescaped like the double quoted ones
+	expr, err := Compile(`name == 'a\'b'`)
+	require.NoError(t, err)
+	require.True(t, expr(&metadata.Meta{Common: metadata.CommonAttrs{Name: "a'b"}}))
+	require.False(t, expr(&metadata.Meta{Common: metadata.CommonAttrs{Name: `a\'b`}}))
+
+	for _, expression := range []string{
+		``,
+		`type == file`,
+		`size > "1G"`,
+		`size =~ 1`,
+		`type < "file"`,
+		`owner == 1`,
+		`(type == "file"`,
+		`type == "file" extra`,
+		`name =~ "("`,
+		`mtime < yesterday`,
+		`name == "unterminated`,
+		`name = "a"`,
+		`size > 1 & size < 2`,
+		`size "==" 1`,
+		`name '=~' "iso"`,
+		`name == 'a\d'`,
+	} {
+		_, err := Compile(expression)
+		require.Error(t, err, expression)
+	}
+}
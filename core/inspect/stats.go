@@ -0,0 +1,240 @@
+package inspect
+
+import (
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// sizeBuckets are the upper bounds of the buckets of the size histogram. The last bucket has no upper bound.
+var sizeBuckets = []uint64{1, 4 << 10, 64 << 10, 1 << 20, 16 << 20, 256 << 20, 1 << 30, 16 << 30}
+
+// Bucket is a bucket of the size histogram of the files.
+type Bucket struct {
+	// Min and Max are the bounds of the sizes of the bucket, Min included and Max excluded. Max is 0 for the last
+	// bucket.
+	Min uint64
+	Max uint64
+
+	// Count and Size are the number and the total size of the files of the bucket.
+	Count uint64
+	Size  uint64
+}
+
+// Label describes the bounds of the bucket, e.g. "[4K, 64K)".
+func (b Bucket) Label() string {
+	if b.Max == 0 {
+		return fmt.Sprintf("[%s, inf)", utils.FormatSize(b.Min))
+	}
+	return fmt.Sprintf("[%s, %s)", utils.FormatSize(b.Min), utils.FormatSize(b.Max))
+}
+
+// Entry is an item of the rankings of Stats.
+type Entry struct {
+	Path  string
+	Value uint64
+}
+
+// Stats summarises the items of a metadata file.
+type Stats struct {
+	SourceDir string
+	ItemCount uint64
+	TotalSize uint64
+
+	// Types and TypeSizes are the number and the total size of the items by file system type.
+	Types     map[string]uint64
+	TypeSizes map[string]uint64
+
+	// Sizes is the size histogram of the regular files.
+	Sizes []Bucket
+
+	// Largest are the largest files, and Deepest the items with the most path elements below the source directory.
+	Largest []Entry
+	Deepest []Entry
+
+	// Hardlinked is the number of files with more than one hard link.
+	Hardlinked uint64
+
+	// XAttrItems is the number of items with extended attributes, XAttrKeys the number of items by key and XAttrBytes
+	// the total size of the values.
+	XAttrItems uint64
+	XAttrKeys  map[string]uint64
+	XAttrBytes uint64
+}
+
+// StatsCollector accumulates the Stats of the items one by one.
+type StatsCollector struct {
+	stats *Stats
+	top   int
+}
+
+// NewStatsCollector creates a StatsCollector.
+// Input:
+// - sourceDir: the source directory of the metadata file, the depth of the items is relative to it
+// - top: the number of items of the rankings, 0 for no rankings
+func NewStatsCollector(sourceDir string, top int) (*StatsCollector, error) {
+	if top < 0 {
+		return nil, fmt.Errorf("top must not be negative. got %d", top)
+	}
+
+	stats := &Stats{
+		SourceDir: sourceDir,
+		Types:     make(map[string]uint64),
+		TypeSizes: make(map[string]uint64),
+		Sizes:     make([]Bucket, len(sizeBuckets)+1),
+		Largest:   make([]Entry, 0, top+1),
+		Deepest:   make([]Entry, 0, top+1),
+		XAttrKeys: make(map[string]uint64),
+	}
+	for i := range stats.Sizes {
+		if i > 0 {
+			stats.Sizes[i].Min = sizeBuckets[i-1]
+		}
+		if i < len(sizeBuckets) {
+			stats.Sizes[i].Max = sizeBuckets[i]
+		}
+	}
+	return &StatsCollector{stats: stats, top: top}, nil
+}
+
+// Add accounts an item.
+func (c *StatsCollector) Add(item *metadata.Meta) {
+	s := c.stats
+	fsType := fsAttrs(item).Type
+	if fsType == "" {
+		fsType = metadata.FSTypeUnknown
+	}
+
+	s.ItemCount++
+	s.TotalSize += item.Common.Size
+	s.Types[fsType]++
+	s.TypeSizes[fsType] += item.Common.Size
+
+	if fsType == metadata.FSTypeFile {
+		i := sort.Search(len(sizeBuckets), func(i int) bool { return item.Common.Size < sizeBuckets[i] })
+		s.Sizes[i].Count++
+		s.Sizes[i].Size += item.Common.Size
+		s.Largest = c.rank(s.Largest, Entry{Path: item.Common.Path, Value: item.Common.Size})
+		if fsAttrs(item).Links > 1 {
+			s.Hardlinked++
+		}
+	}
+
+	if rel, err := filepath.Rel(s.SourceDir, item.Common.Path); err == nil {
+		depth := uint64(strings.Count(rel, string(filepath.Separator)) + 1)
+		s.Deepest = c.rank(s.Deepest, Entry{Path: item.Common.Path, Value: depth})
+	}
+
+	if len(item.ExtendedAttributes) > 0 {
+		s.XAttrItems++
+		for _, xattr := range item.ExtendedAttributes {
+			s.XAttrKeys[xattr.Key]++
+			s.XAttrBytes += uint64(len(xattr.Value))
+		}
+	}
+}
+
+// rank inserts the entry into the ranking, sorted by value descending and then by path, and keeps the top entries.
+func (c *StatsCollector) rank(ranking []Entry, entry Entry) []Entry {
+	i := sort.Search(len(ranking), func(i int) bool {
+		return ranking[i].Value < entry.Value || (ranking[i].Value == entry.Value && ranking[i].Path > entry.Path)
+	})
+	if i >= c.top {
+		return ranking
+	}
+
+	ranking = append(ranking, Entry{})
+	copy(ranking[i+1:], ranking[i:])
+	ranking[i] = entry
+	if len(ranking) > c.top {
+		ranking = ranking[:c.top]
+	}
+	return ranking
+}
+
+// Stats returns the accumulated Stats.
+func (c *StatsCollector) Stats() *Stats {
+	return c.stats
+}
+
+// CollectStats summarises the items of a metadata file.
+// Input:
+// - metaPath: the metadata file
+// - top: the number of items of the rankings, 0 for no rankings
+// - filter: only the items it matches are summarised. All the items if nil
+func CollectStats(metaPath string, top int, filter Expr) (*Stats, error) {
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewStatsCollector(header.SourceDir, top)
+	if err != nil {
+		return nil, err
+	}
+	_, err = Scan(metaPath, func(item *metadata.Meta, row []byte) error {
+		if filter == nil || filter(item) {
+			c.Add(item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Stats(), nil
+}
+
+// WriteText writes the Stats as human-readable tables.
+func (s *Stats) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Source directory:\t%s\n", s.SourceDir)
+	fmt.Fprintf(tw, "Items:\t%d\n", s.ItemCount)
+	fmt.Fprintf(tw, "Total size:\t%s\t(%d bytes)\n", utils.FormatSize(s.TotalSize), s.TotalSize)
+	fmt.Fprintf(tw, "Hard linked files:\t%d\n", s.Hardlinked)
+
+	fmt.Fprintln(tw, "\nTYPE\tCOUNT\tSIZE")
+	for _, fsType := range sortedKeys(s.Types) {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", fsType, s.Types[fsType], utils.FormatSize(s.TypeSizes[fsType]))
+	}
+
+	fmt.Fprintln(tw, "\nFILE SIZE\tCOUNT\tSIZE")
+	for _, bucket := range s.Sizes {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", bucket.Label(), bucket.Count, utils.FormatSize(bucket.Size))
+	}
+
+	fmt.Fprintln(tw, "\nLARGEST FILE\tSIZE")
+	for _, entry := range s.Largest {
+		fmt.Fprintf(tw, "%s\t%s\n", entry.Path, utils.FormatSize(entry.Value))
+	}
+
+	fmt.Fprintln(tw, "\nDEEPEST PATH\tDEPTH")
+	for _, entry := range s.Deepest {
+		fmt.Fprintf(tw, "%s\t%d\n", entry.Path, entry.Value)
+	}
+
+	fmt.Fprintf(tw, "\nItems with extended attributes:\t%d\n", s.XAttrItems)
+	fmt.Fprintf(tw, "Extended attribute values:\t%s\n", utils.FormatSize(s.XAttrBytes))
+	if len(s.XAttrKeys) > 0 {
+		fmt.Fprintln(tw, "\nXATTR KEY\tITEMS")
+		for _, key := range sortedKeys(s.XAttrKeys) {
+			fmt.Fprintf(tw, "%s\t%d\n", key, s.XAttrKeys[key])
+		}
+	}
+	return tw.Flush()
+}
+
+// sortedKeys returns the keys of the map sorted.
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package inspect
+
+import (
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/metadata"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectStats(t *testing.T) {
+	metaPath := testutil.WriteItems(t, "/src", []*metadata.Meta{
+		statsItem("/src/a", metadata.FSTypeDir, 0, 1),
+		statsItem("/src/a/b", metadata.FSTypeDir, 0, 1),
+		statsItem("/src/a/b/small", metadata.FSTypeFile, 10, 1),
+		statsItem("/src/a/big", metadata.FSTypeFile, 2<<20, 2),
+		statsItem("/src/empty", metadata.FSTypeFile, 0, 1),
+		statsItem("/src/link", metadata.FSTypeSymlink, 0, 1),
+	})
+
+	for _, c := range []struct {
+		name       string
+		top        int
+		where      string
+		items      uint64
+		size       uint64
+		types      map[string]uint64
+		largest    []Entry
+		deepest    []Entry
+		hardlinked uint64
+		xattrItems uint64
+	}{{
+		name:       "all",
+		top:        2,
+		items:      6,
+		size:       2<<20 + 10,
+		types:      map[string]uint64{metadata.FSTypeDir: 2, metadata.FSTypeFile: 3, metadata.FSTypeSymlink: 1},
+		largest:    []Entry{{Path: "/src/a/big", Value: 2 << 20}, {Path: "/src/a/b/small", Value: 10}},
+		deepest:    []Entry{{Path: "/src/a/b/small", Value: 3}, {Path: "/src/a/b", Value: 2}},
+		hardlinked: 1,
+		xattrItems: 1,
+	}, {
+		name:    "filtered",
+		top:     10,
+		where:   `type == "file" && size < 1K`,
+		items:   2,
+		size:    10,
+		types:   map[string]uint64{metadata.FSTypeFile: 2},
+		largest: []Entry{{Path: "/src/a/b/small", Value: 10}, {Path: "/src/empty", Value: 0}},
+		deepest: []Entry{{Path: "/src/a/b/small", Value: 3}, {Path: "/src/empty", Value: 1}},
+	}, {
+		name:       "no rankings",
+		items:      6,
+		size:       2<<20 + 10,
+		types:      map[string]uint64{metadata.FSTypeDir: 2, metadata.FSTypeFile: 3, metadata.FSTypeSymlink: 1},
+		largest:    []Entry{},
+		deepest:    []Entry{},
+		hardlinked: 1,
+		xattrItems: 1,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			var filter Expr
+			if c.where != "" {
+				var err error
+				filter, err = Compile(c.where)
+				require.NoError(t, err)
+			}
+
+			stats, err := CollectStats(metaPath, c.top, filter)
+			require.NoError(t, err)
+			require.Equal(t, "/src", stats.SourceDir)
+			require.Equal(t, c.items, stats.ItemCount)
+			require.Equal(t, c.size, stats.TotalSize)
+			require.Equal(t, c.types, stats.Types)
+			require.Equal(t, c.largest, stats.Largest)
+			require.Equal(t, c.deepest, stats.Deepest)
+			require.Equal(t, c.hardlinked, stats.Hardlinked)
+			require.Equal(t, c.xattrItems, stats.XAttrItems)
+			require.Equal(t, c.xattrItems, stats.XAttrKeys["user.tag"])
+		})
+	}
+
+	_, err := CollectStats(metaPath, -2, nil)
+	require.Error(t, err)
+}
+
+func TestFind(t *testing.T) {
+	metaPath := testutil.WriteItems(t, "/src", []*metadata.Meta{
+		statsItem("/src/a", metadata.FSTypeDir, 0, 1),
+		statsItem("/src/a/f", metadata.FSTypeFile, 1, 1),
+	})
+
+	for path, expected := range map[string]string{
+		"/src/a/f":  "/src/a/f",
+		"a/f":       "/src/a/f",
+		"./a/../a":  "/src/a",
+		"/src/a/f/": "/src/a/f",
+		"a/g":       "",
+		"/other/a":  "",
+	} {
+		item, err := Find(metaPath, path)
+		require.NoError(t, err, path)
+		if expected == "" {
+			require.Nil(t, item, path)
+			continue
+		}
+		require.NotNil(t, item, path)
+		require.Equal(t, expected, item.Common.Path, path)
+	}
+}
+
+// statsItem creates an item of the given type. The files larger than 1 MiB carry an extended attribute.
+func statsItem(path, fsType string, size, links uint64) *metadata.Meta {
+	item := &metadata.Meta{
+		Common:             metadata.CommonAttrs{Path: path, Name: filepath.Base(path), Size: size},
+		FileSystem:         &metadata.FileSystemAttrs{Type: fsType, Links: links},
+		ExtendedAttributes: make(metadata.ExtendedAttributes, 0),
+	}
+	if fsType == metadata.FSTypeFile && size > 1<<20 {
+		item.ExtendedAttributes = append(item.ExtendedAttributes, metadata.ExtendedAttribute{Key: "user.tag",
+			Value: []byte("xy")})
+	}
+	return item
+}
@@ -0,0 +1,314 @@
+package merkle
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileName is the name of the Merkle tree file written next to the metadata file.
+const FileName = "merkle.out"
+
+// RootPath is the relative path of the root directory in a Tree.
+const RootPath = "."
+
+// Header is the header of the Merkle tree file.
+type Header struct {
+	// SourceDir is the root directory of the source, the same as the one of the metadata file.
+	SourceDir string
+
+	// RootHash is the digest of the root directory.
+	RootHash string
+
+	// DirCount is the number of directories in the tree file, including the root.
+	DirCount uint64
+}
+
+// DirDigest is one line of the Merkle tree file after the header.
+type DirDigest struct {
+	// Path is the path of the directory relative to the source directory.
+	Path string
+
+	// Digest is the hex-encoded digest of the directory.
+	Digest string
+}
+
+// Tree is the Merkle tree of a directory hierarchy. Only the digests of the directories are kept: the digest of a
+// directory is derived from its own metadata and from the names and digests of its children, so two directories with
+// the same digest have identical subtrees.
+type Tree struct {
+	Header
+
+	// Dirs maps the relative path of every directory to its digest.
+	Dirs map[string]string
+}
+
+// LeafDigest returns the digest of one item. It covers the fields compared by metadata.Meta.Equals, apart from the
+// path, so two items have the same digest if and only if Meta.Equals finds no difference between them.
+func LeafDigest(meta *metadata.Meta) []byte {
+	h := sha256.New()
+	writeString(h, meta.Common.Name)
+	writeUint(h, meta.Common.Size)
+	writeString(h, meta.Common.Hash)
+
+	if fa := meta.FileSystem; fa != nil {
+		writeString(h, fa.Type)
+		if fa.Type != metadata.FSTypeSocket { // sockets are ignored by Meta.Equals apart from their type
+			writeUint(h, uint64(fa.Mode))
+			writeUint(h, fa.ModTime)
+			writeUint(h, uint64(fa.UID))
+			writeUint(h, uint64(fa.GID))
+			writeUint(h, fa.Links)
+			writeString(h, fa.LinkTarget)
+		}
+	}
+
+	if oa := meta.ObjectStorage; oa != nil {
+		writeString(h, oa.StorageClass)
+		writeUint(h, oa.LastModified)
+	}
+
+	writeUint(h, uint64(len(meta.ExtendedAttributes)))
+	for _, xattr := range meta.ExtendedAttributes {
+		writeString(h, xattr.Key)
+		writeString(h, string(xattr.Value))
+	}
+	return h.Sum(nil)
+}
+
+// Builder builds the Tree of a directory hierarchy from the metadata of its items, in any order. It is safe for
+// concurrent use.
+type Builder struct {
+	sourceDir string
+
+	mu       sync.Mutex
+	leaves   map[string][]byte            // relative path -> leaf digest, of the directories only
+	children map[string]map[string][]byte // relative directory path -> child name -> leaf digest of the child
+}
+
+// NewBuilder creates a new Builder.
+// Input:
+// - sourceDir: the absolute root directory the paths of the items are relative to
+func NewBuilder(sourceDir string) *Builder {
+	return &Builder{
+		sourceDir: sourceDir,
+		leaves:    make(map[string][]byte),
+		children:  map[string]map[string][]byte{RootPath: {}},
+	}
+}
+
+// Add adds one item to the tree.
+func (b *Builder) Add(meta *metadata.Meta) error {
+	rel, err := filepath.Rel(b.sourceDir, meta.Common.Path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	parent := pathDir(rel)
+	digest := LeafDigest(meta)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.children[parent] == nil {
+		b.children[parent] = make(map[string][]byte)
+	}
+	b.children[parent][pathBase(rel)] = digest
+
+	if meta.FileSystem != nil && meta.FileSystem.Type == metadata.FSTypeDir {
+		b.leaves[rel] = digest
+		if b.children[rel] == nil {
+			b.children[rel] = make(map[string][]byte)
+		}
+	}
+	return nil
+}
+
+// Build computes the digests of all the directories, from the deepest ones up to the root.
+func (b *Builder) Build() *Tree {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dirs := make([]string, 0, len(b.children))
+	for dir := range b.children {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return depth(dirs[i]) > depth(dirs[j]) })
+
+	tree := &Tree{Header: Header{SourceDir: b.sourceDir}, Dirs: make(map[string]string, len(dirs))}
+	for _, dir := range dirs {
+		names := make([]string, 0, len(b.children[dir]))
+		for name := range b.children[dir] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		h := sha256.New()
+		h.Write(b.leaves[dir]) // the own metadata of the directory, empty for the root
+		for _, name := range names {
+			writeString(h, name)
+			h.Write(b.children[dir][name])
+		}
+		digest := h.Sum(nil)
+		tree.Dirs[dir] = hex.EncodeToString(digest)
+
+		if dir != RootPath { // the digest of a directory replaces its leaf digest in its parent
+			b.children[pathDir(dir)][pathBase(dir)] = digest
+		}
+	}
+
+	tree.RootHash = tree.Dirs[RootPath]
+	tree.DirCount = uint64(len(tree.Dirs))
+	return tree
+}
+
+// WriteFile writes the tree to a file: the header on the first line, then one DirDigest per line sorted by path.
+func (t *Tree) WriteFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(&t.Header); err != nil {
+		return err
+	}
+
+	dirs := make([]string, 0, len(t.Dirs))
+	for dir := range t.Dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err = enc.Encode(&DirDigest{Path: dir, Digest: t.Dirs[dir]}); err != nil {
+			return err
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// ReadFile reads a tree written by Tree.WriteFile.
+func ReadFile(path string) (*Tree, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	tree := &Tree{Dirs: make(map[string]string)}
+	if err = dec.Decode(&tree.Header); err != nil {
+		return nil, fmt.Errorf("failed to parse the header of merkle tree file %s: %w", path, err)
+	}
+
+	for dec.More() {
+		dir := DirDigest{}
+		if err = dec.Decode(&dir); err != nil {
+			return nil, fmt.Errorf("failed to parse merkle tree file %s: %w", path, err)
+		}
+		tree.Dirs[dir.Path] = dir.Digest
+	}
+
+	if uint64(len(tree.Dirs)) != tree.DirCount {
+		return nil, fmt.Errorf("directory count mismatch in merkle tree file %s. expect %d, got %d",
+			path, tree.DirCount, len(tree.Dirs))
+	}
+	return tree, nil
+}
+
+// IdenticalSubtrees compares two trees and returns the directories whose subtrees are identical in both trees. Only
+// the topmost identical directories are returned: the sub directories of an identical directory are not visited.
+func IdenticalSubtrees(src, dst *Tree) *Subtrees {
+	identical := &Subtrees{dirs: make(map[string]bool)}
+	for dir, digest := range src.Dirs {
+		if dst.Dirs[dir] != digest {
+			continue
+		}
+
+		covered := false
+		for parent := dir; parent != RootPath; {
+			parent = pathDir(parent)
+			if src.Dirs[parent] == dst.Dirs[parent] {
+				covered = true // an ancestor is identical already
+				break
+			}
+		}
+		if !covered {
+			identical.dirs[dir] = true
+		}
+	}
+	return identical
+}
+
+// Subtrees is a set of directories whose subtrees are identical on both sides.
+type Subtrees struct {
+	dirs map[string]bool
+}
+
+// Len returns the number of topmost identical directories.
+func (s *Subtrees) Len() int {
+	return len(s.dirs)
+}
+
+// Contains reports whether the item at the relative path is inside, or is, one of the identical directories.
+func (s *Subtrees) Contains(rel string) bool {
+	if len(s.dirs) == 0 {
+		return false
+	}
+
+	rel = filepath.ToSlash(rel)
+	for {
+		if s.dirs[rel] {
+			return true
+		}
+		if rel == RootPath {
+			return false
+		}
+		rel = pathDir(rel)
+	}
+}
+
+func pathDir(rel string) string {
+	i := strings.LastIndexByte(rel, '/')
+	if i < 0 {
+		return RootPath
+	}
+	return rel[:i]
+}
+
+func pathBase(rel string) string {
+	return rel[strings.LastIndexByte(rel, '/')+1:]
+}
+
+func depth(rel string) int {
+	if rel == RootPath {
+		return 0
+	}
+	return strings.Count(rel, "/") + 1
+}
+
+func writeString(h hash.Hash, s string) {
+	writeUint(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+func writeUint(h hash.Hash, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	h.Write(buf[:])
+}
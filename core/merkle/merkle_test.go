@@ -0,0 +1,44 @@
+package merkle
+
+import (
+	"file-clone-validator/core/metadata"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func buildTree(t *testing.T, root string, hashes map[string]string) *Tree {
+	builder := NewBuilder(root)
+	for rel, hash := range hashes {
+		meta := &metadata.Meta{
+			Common:     metadata.CommonAttrs{Path: filepath.Join(root, rel), Name: filepath.Base(rel), Hash: hash},
+			FileSystem: &metadata.FileSystemAttrs{Type: metadata.FSTypeFile},
+		}
+		if hash == "" {
+			meta.FileSystem.Type = metadata.FSTypeDir
+		}
+		require.NoError(t, builder.Add(meta))
+	}
+	return builder.Build()
+}
+
+func TestIdenticalSubtrees(t *testing.T) {
+	items := map[string]string{"a": "", "a/f": "1", "b": "", "b/g": "2", "b/c": "", "b/c/h": "3"}
+	src := buildTree(t, "/src", items)
+	dst := buildTree(t, "/dst", items)
+	require.Equal(t, src.RootHash, dst.RootHash)
+	require.True(t, IdenticalSubtrees(src, dst).Contains("b/c/h"))
+
+	items["b/g"] = "changed"
+	dst = buildTree(t, "/dst", items)
+	require.NotEqual(t, src.RootHash, dst.RootHash)
+	require.Equal(t, src.Dirs["a"], dst.Dirs["a"])
+	require.NotEqual(t, src.Dirs["b"], dst.Dirs["b"])
+
+	identical := IdenticalSubtrees(src, dst)
+	require.Equal(t, 2, identical.Len()) // a and b/c
+	require.True(t, identical.Contains("a/f"))
+	require.True(t, identical.Contains("b/c/h"))
+	require.False(t, identical.Contains("b/g"))
+	require.False(t, identical.Contains("b"))
+}
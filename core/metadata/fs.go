@@ -0,0 +1,270 @@
+package metadata
+
+import (
+	"context"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// LstatFS is an fs.FS which can describe a symbolic link itself instead of the file it refers to.
+type LstatFS interface {
+	fs.FS
+
+	// Lstat returns the fs.FileInfo of the named file without following a final symbolic link.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// ReadLinkFS is an fs.FS which can read the target of a symbolic link.
+type ReadLinkFS interface {
+	fs.FS
+
+	// ReadLink returns the target of the named symbolic link.
+	ReadLink(name string) (string, error)
+}
+
+// XAttrFS is an fs.FS which can read the extended attributes of its files.
+type XAttrFS interface {
+	fs.FS
+
+	// ListXAttr returns the names of the extended attributes of the named file.
+	ListXAttr(name string) ([]string, error)
+
+	// GetXAttr returns the value of an extended attribute of the named file.
+	GetXAttr(name, attr string) ([]byte, error)
+}
+
+// Lstat returns the fs.FileInfo of the named file without following a final symbolic link if fsys implements LstatFS,
+// and fs.Stat otherwise.
+func Lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if lfs, ok := fsys.(LstatFS); ok {
+		return lfs.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// DirFS is the fs.FS of a directory of the OS file system, like os.DirFS. It implements LstatFS, ReadLinkFS and
+// XAttrFS, and never follows the symbolic links.
+type DirFS string
+
+func (dir DirFS) Open(name string) (fs.File, error) {
+	path, err := dir.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (dir DirFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := dir.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+func (dir DirFS) Lstat(name string) (fs.FileInfo, error) {
+	path, err := dir.join("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(path)
+}
+
+func (dir DirFS) ReadLink(name string) (string, error) {
+	path, err := dir.join("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
+
+func (dir DirFS) ListXAttr(name string) ([]string, error) {
+	path, err := dir.join("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	return ListXAttr(path)
+}
+
+func (dir DirFS) GetXAttr(name, attr string) ([]byte, error) {
+	path, err := dir.join("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	return GetXAttr(path, attr)
+}
+
+// join returns the OS path of the named file.
+func (dir DirFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(dir), filepath.FromSlash(name)), nil
+}
+
+// RetrieveOption configures optional behaviours of RetrieveFSMeta.
+type RetrieveOption func(ro *retrieveOptions)
+
+type retrieveOptions struct {
+	ctx           context.Context
+	hashAlgorithm string
+	noHash        bool
+}
+
+// WithContext makes RetrieveFSMeta cancel its waits for utils.DefaultLimiter when the context is done. The waits can
+// not be cancelled without it.
+func WithContext(ctx context.Context) RetrieveOption {
+	return func(ro *retrieveOptions) { ro.ctx = ctx }
+}
+
+// WithHashAlgorithm makes RetrieveFSMeta hash the content of the files with the given algorithm instead of MD5, see
+// utils.HashReader.
+func WithHashAlgorithm(algorithm string) RetrieveOption {
+	return func(ro *retrieveOptions) { ro.hashAlgorithm = algorithm }
+}
+
+// WithoutHash makes RetrieveFSMeta skip reading the content of the files, so the hash is left empty.
+func WithoutHash() RetrieveOption {
+	return func(ro *retrieveOptions) { ro.noHash = true }
+}
+
+// RetrieveOptionsFor returns the options to retrieve the metadata of an item compared with the given item: its hash
+// algorithm, and no hash at all if it does not record one, see Meta.Fields.
+func RetrieveOptionsFor(item *Meta) []RetrieveOption {
+	if !item.Records(FieldHash) {
+		return []RetrieveOption{WithoutHash()}
+	}
+	if item.Common.HashAlgorithm != "" {
+		return []RetrieveOption{WithHashAlgorithm(item.Common.HashAlgorithm)}
+	}
+	return nil
+}
+
+// RetrieveFSMeta retrieves the file system metadata of a file of an fs.FS. The link target and the extended attributes
+// are only retrieved if fsys implements ReadLinkFS and XAttrFS.
+// Input:
+// - fsys: the file system the file belongs to
+// - name: the name of the file in fsys
+// - path: the path recorded in the metadata, usually the root of fsys joined with name
+// - fi: the fs.FileInfo of the file, which should not follow a final symbolic link, see Lstat
+// Output:
+// - meta: the metadata of the file
+// Note:
+// - Every call counts as one file against the files limit of utils.DefaultLimiter
+func RetrieveFSMeta(fsys fs.FS, name, path string, fi fs.FileInfo, opts ...RetrieveOption) (*Meta, error) {
+	ro := &retrieveOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(ro)
+	}
+
+	if err := utils.DefaultLimiter.WaitFile(ro.ctx); err != nil {
+		return nil, err
+	}
+
+	// fill the basic fbs attributes
+	mask := os.ModePerm | os.ModeType | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	meta := &Meta{
+		Common: CommonAttrs{
+			Path: path,      // absolute path in the source file system
+			Name: fi.Name(), // file name without the directory path
+		},
+		FileSystem: &FileSystemAttrs{
+			Mode:    fi.Mode() & mask, // file mode bits
+			ModTime: uint64(fi.ModTime().Unix()),
+		},
+		ObjectStorage: nil, // file system fbs does not include object storage attributes
+	}
+
+	// fill the file type
+	switch fi.Mode() & (os.ModeType | os.ModeCharDevice) {
+	case 0:
+		meta.FileSystem.Type = FSTypeFile
+	case os.ModeDir:
+		meta.FileSystem.Type = FSTypeDir
+	case os.ModeSymlink:
+		meta.FileSystem.Type = FSTypeSymlink
+	case os.ModeDevice | os.ModeCharDevice:
+		meta.FileSystem.Type = FSTypeCharDevice
+	case os.ModeDevice:
+		meta.FileSystem.Type = FSTypeDevice
+	case os.ModeNamedPipe:
+		meta.FileSystem.Type = FSTypeNamedPipe
+	case os.ModeSocket:
+		meta.FileSystem.Type = FSTypeSocket
+	default:
+		meta.FileSystem.Type = FSTypeUnknown
+		slog.Warn("Unknown file type", "path", path, "mode", fi.Mode())
+	}
+
+	if meta.FileSystem.Type == FSTypeFile { // file-specific attributes
+		meta.Common.Size = uint64(fi.Size()) // file size in bytes
+	}
+
+	if meta.FileSystem.Type == FSTypeFile && !ro.noHash {
+		file, err := fsys.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the file %s: %w", path, err)
+		}
+		meta.Common.Hash, err = utils.HashReader(ro.ctx, ro.hashAlgorithm, file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate the hash of the file %s: %w", path, err)
+		}
+		if ro.hashAlgorithm != utils.HashMD5 {
+			meta.Common.HashAlgorithm = ro.hashAlgorithm
+		}
+	}
+
+	// fill the extra underlying file system attributes
+	underSys, ok := toSys(fi.Sys())
+	if !ok {
+		meta.FileSystem.UID = uint32(os.Getuid()) // user id of the owner
+		meta.FileSystem.GID = uint32(os.Getgid()) // group id of the owner
+	} else {
+		switch meta.FileSystem.Type {
+		case FSTypeFile:
+			meta.Common.Size = uint64(underSys.size()) // file size in bytes
+			meta.FileSystem.Links = underSys.nlink()   // number of hard links
+		case FSTypeSymlink, FSTypeDevice, FSTypeCharDevice:
+			meta.FileSystem.Links = underSys.nlink() // number of hard links
+		}
+		if meta.FileSystem.Links > 1 { // to group the hard links of the same file
+			meta.FileSystem.Dev, meta.FileSystem.Inode = underSys.dev(), underSys.ino()
+		}
+	}
+
+	if rfs, _ok := fsys.(ReadLinkFS); _ok && meta.FileSystem.Type == FSTypeSymlink {
+		target, err := rfs.ReadLink(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the link target of the symlink %s: %w", path, err)
+		}
+		meta.FileSystem.LinkTarget = target
+	}
+
+	// retrieve the extended attributes
+	if xfs, _ok := fsys.(XAttrFS); _ok {
+		xattrs, err := xfs.ListXAttr(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the extended attributes of the file %s: %w", path, err)
+		}
+
+		meta.ExtendedAttributes = make([]ExtendedAttribute, 0, len(xattrs))
+		for _, xattr := range xattrs {
+			value, _err := xfs.GetXAttr(name, xattr)
+			if _err != nil {
+				slog.Warn("Failed to get the extended attribute", "path", path, "xattr", xattr, "err", _err)
+				continue
+			}
+			meta.ExtendedAttributes = append(meta.ExtendedAttributes, ExtendedAttribute{
+				Key:   xattr,
+				Value: value,
+			})
+		}
+	}
+
+	return meta, nil
+}
@@ -1,11 +1,10 @@
 package metadata
 
 import (
-	"file-clone-validator/core/utils"
 	"fmt"
-	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // FSType is the type of the file system.
@@ -26,100 +25,66 @@ const (
 // - fi: the os.FileInfo of the file
 // Output:
 // - fbs: the file system fbs of the file
-func RetrieveFileSystemMeta(path string, fi os.FileInfo) (*Meta, error) {
+// Note:
+// - Every call counts as one file against the files limit of utils.DefaultLimiter
+// - It is RetrieveFSMeta over the DirFS of the parent directory, or of the root itself for a root directory, see
+// RetrieveFSMeta
+func RetrieveFileSystemMeta(path string, fi os.FileInfo, opts ...RetrieveOption) (*Meta, error) {
 	path, err := filepath.Abs(path) // replace the relative path with the absolute path
 	if err != nil {
 		return nil, err
 	}
-
-	// fill the basic fbs attributes
-	mask := os.ModePerm | os.ModeType | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
-	meta := &Meta{
-		Common: CommonAttrs{
-			Path: path,      // absolute path in the source file system
-			Name: fi.Name(), // file name without the directory path
-		},
-		FileSystem: &FileSystemAttrs{
-			Mode:    fi.Mode() & mask, // file mode bits
-			ModTime: uint64(fi.ModTime().Unix()),
-		},
-		ObjectStorage: nil, // file system fbs does not include object storage attributes
-	}
-
-	// fill the file type
-	switch fi.Mode() & (os.ModeType | os.ModeCharDevice) {
-	case 0:
-		meta.FileSystem.Type = FSTypeFile
-	case os.ModeDir:
-		meta.FileSystem.Type = FSTypeDir
-	case os.ModeSymlink:
-		meta.FileSystem.Type = FSTypeSymlink
-	case os.ModeDevice | os.ModeCharDevice:
-		meta.FileSystem.Type = FSTypeCharDevice
-	case os.ModeDevice:
-		meta.FileSystem.Type = FSTypeDevice
-	case os.ModeNamedPipe:
-		meta.FileSystem.Type = FSTypeNamedPipe
-	case os.ModeSocket:
-		meta.FileSystem.Type = FSTypeSocket
-	default:
-		meta.FileSystem.Type = FSTypeUnknown
-		slog.Warn("Unknown file type", "path", path, "mode", fi.Mode())
-	}
-
-	if meta.FileSystem.Type == FSTypeFile { // file-specific attributes
-		meta.Common.Size = uint64(fi.Size()) // file size in bytes
-		meta.Common.Hash, err = utils.MD5Hash(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to calculate the md5 hash of the file %s: %w", path, err)
-		}
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	if dir == path { // a root such as / has no parent, and its base name is not a valid fs.FS name
+		name = "."
 	}
+	return RetrieveFSMeta(DirFS(dir), name, path, fi, opts...)
+}
 
-	// fill the extra underlying file system attributes
-	underSys, ok := toSys(fi.Sys())
-	if !ok {
-		meta.FileSystem.UID = uint32(os.Getuid()) // user id of the owner
-		meta.FileSystem.GID = uint32(os.Getgid()) // group id of the owner
-	} else {
-		switch meta.FileSystem.Type {
-		case FSTypeFile:
-			meta.Common.Size = uint64(underSys.size()) // file size in bytes
-			meta.FileSystem.Links = underSys.nlink()   // number of hard links
-		case FSTypeDir:
-		case FSTypeSymlink:
-			meta.FileSystem.Links = underSys.nlink() // number of hard links
-			meta.FileSystem.LinkTarget, err = os.Readlink(path)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read the link target of the symlink %s: %w", path, err)
-			}
-		case FSTypeDevice, FSTypeCharDevice:
-			meta.FileSystem.Links = underSys.nlink() // number of hard links
-		case FSTypeNamedPipe, FSTypeSocket, FSTypeUnknown:
-		default:
-			return meta, nil // return the fbs without the file system attributes
-		}
-
-		// retrieve the extended attributes
-		xattrs, _err := ListXAttr(path)
-		if _err != nil {
-			return nil, fmt.Errorf("failed to list the extended attributes of the file %s: %w", path, _err)
-		}
+// UnixMode returns the Unix permission and special bits of a file mode, e.g. 04755 for a setuid executable.
+func UnixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
 
-		meta.ExtendedAttributes = make([]ExtendedAttribute, 0, len(xattrs))
-		for _, xattr := range xattrs {
-			value, __err := GetXAttr(path, xattr)
-			if __err != nil {
-				slog.Warn("Failed to get the extended attribute", "path", path, "xattr", xattr, "err", __err)
-				continue
-			}
-			meta.ExtendedAttributes = append(meta.ExtendedAttributes, ExtendedAttribute{
-				Key:   xattr,
-				Value: value,
-			})
-		}
+// FileMode returns the file mode of an item of the given type with the given Unix permission and special bits. It is
+// the reverse of UnixMode, for the sources which record the mode as a number, e.g. an mtree specification.
+func FileMode(fsType string, unixMode uint32) os.FileMode {
+	mode := os.FileMode(unixMode) & os.ModePerm
+	if unixMode&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if unixMode&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if unixMode&01000 != 0 {
+		mode |= os.ModeSticky
 	}
 
-	return meta, nil
+	switch fsType {
+	case FSTypeDir:
+		mode |= os.ModeDir
+	case FSTypeSymlink:
+		mode |= os.ModeSymlink
+	case FSTypeCharDevice:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case FSTypeDevice:
+		mode |= os.ModeDevice
+	case FSTypeNamedPipe:
+		mode |= os.ModeNamedPipe
+	case FSTypeSocket:
+		mode |= os.ModeSocket
+	}
+	return mode
 }
 
 // RetrieveObjectStorageMeta TODO: implement this function
@@ -127,6 +92,25 @@ func RetrieveObjectStorageMeta(object string) (*Meta, error) {
 	return nil, nil
 }
 
+// Fields of the metadata, as named by the mismatch reasons of Meta.Equals. See Meta.Fields.
+const (
+	FieldName       = "name"
+	FieldSize       = "size"
+	FieldHash       = "hash"
+	FieldType       = "type"
+	FieldMode       = "mode"
+	FieldModTime    = "modTime"
+	FieldUID        = "uid"
+	FieldGID        = "gid"
+	FieldLinks      = "links"
+	FieldLinkTarget = "linkTarget"
+	FieldXAttrs     = "xattrs"
+)
+
+// allFields lists every field of the metadata.
+var allFields = []string{FieldName, FieldSize, FieldHash, FieldType, FieldMode, FieldModTime, FieldUID, FieldGID,
+	FieldLinks, FieldLinkTarget, FieldXAttrs}
+
 // Meta is the main structure that combines common and source-specific attributes.
 type Meta struct {
 	Common        CommonAttrs
@@ -134,9 +118,84 @@ type Meta struct {
 	ObjectStorage *ObjectStorageAttrs
 
 	ExtendedAttributes ExtendedAttributes
+
+	// Fields lists the fields recorded for the item when it comes from a source which only records some of them,
+	// e.g. an mtree specification or a checksum list. Equals ignores the other fields. Every field is recorded if it
+	// is empty, which is the case of the generated metadata files.
+	Fields []string `json:",omitempty"`
 }
 
+// Records reports whether the field is recorded for the item, see Fields.
+func (m *Meta) Records(field string) bool {
+	if len(m.Fields) == 0 {
+		return true
+	}
+	for _, f := range m.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Equals compares the item with the other item and returns the reasons of the mismatches, e.g. "size: 1 != 2". Only
+// the fields recorded for the item are compared, see Fields.
 func (m *Meta) Equals(other *Meta) (reasons []string) {
+	reasons = m.equals(other)
+	if len(m.Fields) == 0 {
+		return reasons
+	}
+
+	recorded := reasons[:0]
+	for _, reason := range reasons {
+		if m.Records(reasonField(reason)) {
+			recorded = append(recorded, reason)
+		}
+	}
+	return recorded
+}
+
+// ReasonNames splits the comma joined mismatch reasons of Equals and returns the name each reason starts with, e.g.
+// "size" for "size: 1 != 2". The free-form values are quoted by Equals, so a comma inside them is not a boundary.
+func ReasonNames(reasons string) (names []string) {
+	quoted, escaped, start := false, false, 0
+	for i, c := range reasons {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ',':
+			names = append(names, reasonName(reasons[start:i]))
+			start = i + 1
+		}
+	}
+	if reasons != "" {
+		names = append(names, reasonName(reasons[start:]))
+	}
+	return names
+}
+
+func reasonName(reason string) string {
+	name, _, _ := strings.Cut(reason, ":")
+	return name
+}
+
+// reasonField returns the field a mismatch reason of Equals is about.
+func reasonField(reason string) string {
+	field, _, _ := strings.Cut(reason, ":")
+	switch field {
+	case "length", "key", "value":
+		return FieldXAttrs
+	case "ignore type":
+		return FieldType
+	}
+	return field
+}
+
+func (m *Meta) equals(other *Meta) (reasons []string) {
 	reasons = append(reasons, m.Common.Equals(&other.Common)...)
 	if m.FileSystem != nil && other.FileSystem != nil {
 		reasons = append(reasons, m.FileSystem.Equals(other.FileSystem)...)
@@ -175,24 +234,36 @@ type CommonAttrs struct {
 	// in any security-sensitive applications. It's vulnerable to hash collisions. However, it's still useful for
 	// detecting accidental data corruption in current use cases.
 	Hash string
+
+	// HashAlgorithm is the algorithm of Hash when it is not MD5, e.g. utils.HashSHA256 for the imported manifests
+	// which only record a SHA-256 digest. MD5 if empty.
+	HashAlgorithm string `json:",omitempty"`
 }
 
 func (ca *CommonAttrs) Equals(other *CommonAttrs) (reasons []string) {
 	if ca.Name != other.Name {
-		reasons = append(reasons, fmt.Sprintf("name: %s != %s", ca.Name, other.Name))
+		reasons = append(reasons, fmt.Sprintf("name: %q != %q", ca.Name, other.Name))
 	}
 
 	if ca.Size != other.Size {
 		reasons = append(reasons, fmt.Sprintf("size: %d != %d", ca.Size, other.Size))
 	}
 
-	if ca.Hash != other.Hash {
-		reasons = append(reasons, fmt.Sprintf("hash: %s != %s", ca.Hash, other.Hash))
+	if ca.Hash != other.Hash || ca.HashAlgorithm != other.HashAlgorithm {
+		reasons = append(reasons, fmt.Sprintf("hash: %s != %s", ca.hash(), other.hash()))
 	}
 
 	return reasons
 }
 
+// hash returns the hash prefixed with its algorithm when it is not MD5.
+func (ca *CommonAttrs) hash() string {
+	if ca.HashAlgorithm == "" {
+		return ca.Hash
+	}
+	return ca.HashAlgorithm + ":" + ca.Hash
+}
+
 // FileSystemAttrs captures file-system-specific attributes.
 type FileSystemAttrs struct {
 	// Type is the type of the file. It can be one of the following values:
@@ -222,6 +293,12 @@ type FileSystemAttrs struct {
 
 	// LinkTarget is the path to the target of the symbolic link.
 	LinkTarget string
+
+	// Dev and Inode identify the file on its file system. They are only recorded for the items with more than one
+	// hard link, to tell which paths are links to the same file, and they are not compared by Equals as a copy has
+	// other inode numbers.
+	Dev   uint64 `json:",omitempty"`
+	Inode uint64 `json:",omitempty"`
 }
 
 func (fa *FileSystemAttrs) Equals(other *FileSystemAttrs) (reasons []string) {
@@ -253,7 +330,7 @@ func (fa *FileSystemAttrs) Equals(other *FileSystemAttrs) (reasons []string) {
 	}
 
 	if fa.LinkTarget != other.LinkTarget {
-		reasons = append(reasons, fmt.Sprintf("linkTarget: %s != %s", fa.LinkTarget, other.LinkTarget))
+		reasons = append(reasons, fmt.Sprintf("linkTarget: %q != %q", fa.LinkTarget, other.LinkTarget))
 	}
 
 	return reasons
@@ -270,7 +347,7 @@ type ObjectStorageAttrs struct {
 
 func (oa *ObjectStorageAttrs) Equals(other *ObjectStorageAttrs) (reasons []string) {
 	if oa.StorageClass != other.StorageClass {
-		reasons = append(reasons, fmt.Sprintf("storageClass: %s != %s", oa.StorageClass, other.StorageClass))
+		reasons = append(reasons, fmt.Sprintf("storageClass: %q != %q", oa.StorageClass, other.StorageClass))
 	}
 
 	if oa.LastModified != other.LastModified {
@@ -296,11 +373,11 @@ func (eas ExtendedAttributes) Equals(other ExtendedAttributes) (reasons []string
 
 	for i := range eas {
 		if eas[i].Key != other[i].Key {
-			reasons = append(reasons, fmt.Sprintf("key: %s != %s", eas[i].Key, other[i].Key))
+			reasons = append(reasons, fmt.Sprintf("key: %q != %q", eas[i].Key, other[i].Key))
 		}
 
 		if string(eas[i].Value) != string(other[i].Value) {
-			reasons = append(reasons, fmt.Sprintf("value: %s != %s", eas[i].Value, other[i].Value))
+			reasons = append(reasons, fmt.Sprintf("value: %q != %q", eas[i].Value, other[i].Value))
 		}
 	}
 
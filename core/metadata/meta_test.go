@@ -0,0 +1,19 @@
+package metadata
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetrieveFileSystemMetaRoot(t *testing.T) {
+	root := filepath.VolumeName(os.TempDir()) + string(filepath.Separator)
+	fi, err := os.Lstat(root)
+	require.NoError(t, err)
+
+	meta, err := RetrieveFileSystemMeta(root, fi)
+	require.NoError(t, err)
+	require.Equal(t, root, meta.Common.Path)
+	require.Equal(t, FSTypeDir, meta.FileSystem.Type)
+}
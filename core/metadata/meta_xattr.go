@@ -21,6 +21,16 @@ func ListXAttr(path string) ([]string, error) {
 	return l, handleXAttrErr(err)
 }
 
+// SetXAttr sets the extended attribute of path without following a final symbolic link.
+func SetXAttr(path, name string, value []byte) error {
+	return xattr.LSet(path, name, value)
+}
+
+// RemoveXAttr removes the extended attribute of path without following a final symbolic link.
+func RemoveXAttr(path, name string) error {
+	return xattr.LRemove(path, name)
+}
+
 // handleXAttrErr handles the error returned by the xattr package.
 // Input:
 // - err: the error returned by the xattr package
@@ -0,0 +1,99 @@
+package metadata
+
+import (
+	"archive/tar"
+	"context"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// paxXAttrPrefix is the prefix of the PAX records which carry the extended attributes, as written by GNU tar and
+// archive/tar.
+const paxXAttrPrefix = "SCHILY.xattr."
+
+// RetrieveTarMeta retrieves the file system metadata of an entry of a tar archive.
+// Input:
+// - ctx: cancels the waits for utils.DefaultLimiter while the content is hashed
+// - path: the path of the entry, made absolute by joining the archive path and the entry name
+// - hdr: the header of the entry
+// - content: the content of the entry, only read for regular files
+// Output:
+// - meta: the metadata of the entry
+// Note:
+// - Tar does not record the number of hard links, so Links is always 0. A hard link entry is a regular file without
+// content, the caller fills its size and hash from the entry it links to
+// - The extended attributes are sorted by key, because the order of the PAX records is not preserved
+// - A PAX global header, e.g. the pax_global_header of git archive, is not an entry and must be skipped by the caller
+func RetrieveTarMeta(ctx context.Context, path string, hdr *tar.Header, content io.Reader) (*Meta, error) {
+	if hdr.Typeflag == tar.TypeXGlobalHeader {
+		return nil, fmt.Errorf("the pax global header %s is not an entry of the tar archive", hdr.Name)
+	}
+
+	fi := hdr.FileInfo()
+	mask := os.ModePerm | os.ModeType | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	meta := &Meta{
+		Common: CommonAttrs{
+			Path: path,
+			Name: fi.Name(),
+		},
+		FileSystem: &FileSystemAttrs{
+			Mode:    fi.Mode() & mask,
+			ModTime: uint64(hdr.ModTime.Unix()),
+			UID:     uint32(hdr.Uid),
+			GID:     uint32(hdr.Gid),
+		},
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse, tar.TypeCont:
+		meta.FileSystem.Type = FSTypeFile
+		meta.Common.Size = uint64(hdr.Size)
+
+		var err error
+		meta.Common.Hash, err = utils.MD5HashReader(ctx, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate the md5 hash of the tar entry %s: %w", hdr.Name, err)
+		}
+	case tar.TypeLink:
+		meta.FileSystem.Type = FSTypeFile
+	case tar.TypeDir:
+		meta.FileSystem.Type = FSTypeDir
+	case tar.TypeSymlink:
+		meta.FileSystem.Type = FSTypeSymlink
+		meta.FileSystem.LinkTarget = hdr.Linkname
+	case tar.TypeChar:
+		meta.FileSystem.Type = FSTypeCharDevice
+	case tar.TypeBlock:
+		meta.FileSystem.Type = FSTypeDevice
+	case tar.TypeFifo:
+		meta.FileSystem.Type = FSTypeNamedPipe
+	default:
+		meta.FileSystem.Type = FSTypeUnknown
+	}
+	if fi.Mode()&os.ModeSocket != 0 {
+		meta.FileSystem.Type = FSTypeSocket
+	}
+
+	meta.ExtendedAttributes = make([]ExtendedAttribute, 0)
+	for key, value := range hdr.PAXRecords {
+		if strings.HasPrefix(key, paxXAttrPrefix) {
+			meta.ExtendedAttributes = append(meta.ExtendedAttributes, ExtendedAttribute{
+				Key:   strings.TrimPrefix(key, paxXAttrPrefix),
+				Value: []byte(value),
+			})
+		}
+	}
+	meta.ExtendedAttributes.Sort()
+
+	return meta, nil
+}
+
+// Sort sorts the extended attributes by key in place. Sources which do not preserve the order of the extended
+// attributes, e.g. archives, are compared to the file system after both sides are sorted.
+func (eas ExtendedAttributes) Sort() {
+	sort.Slice(eas, func(i, j int) bool { return eas[i].Key < eas[j].Key })
+}
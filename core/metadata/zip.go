@@ -0,0 +1,200 @@
+package metadata
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// zipUnixOwnerExtraID is the id of the Info-ZIP "new Unix" extra field which carries the owner of an entry.
+const zipUnixOwnerExtraID = 0x7875
+
+// zipTimeExtraIDs are the ids of the extra fields archive/zip reads an accurate modification time from: NTFS, Unix,
+// extended timestamp and Info-ZIP Unix. Without them, the time is the local MS-DOS time with a 2 seconds resolution.
+var zipTimeExtraIDs = []uint16{0x000a, 0x000d, 0x5455, 0x5855}
+
+// Host systems of the zip entries whose external attributes carry a Unix mode, see zip.FileHeader.CreatorVersion.
+const (
+	zipCreatorUnix  = 3
+	zipCreatorMacOS = 19
+)
+
+// maxZipLinkTargetSize bounds the content read as the target of a symlink entry.
+const maxZipLinkTargetSize = 64 * 1024
+
+// RetrieveZipMeta retrieves the file system metadata of an entry of a zip archive. The Unix mode comes from the
+// external attributes, the mtime from the extended timestamp and the owner from the Info-ZIP Unix extra field.
+// Input:
+// - ctx: cancels the waits for utils.DefaultLimiter while the content is hashed
+// - path: the path of the entry, made absolute by joining the archive path and the entry name
+// - f: the entry
+// Output:
+// - meta: the metadata of the entry
+// Note:
+// - The content is read to compute the hash, so a corrupted entry fails with the error of archive/zip, e.g.
+// zip.ErrChecksum if the content does not match the CRC32 stored in the archive
+// - Zip does not record hard links nor extended attributes. The mode, the mtime and the owner are only recorded, see
+// Meta.Fields, if the entry has a Unix mode, an accurate timestamp and a Unix owner extra field respectively. They
+// are derived from the MS-DOS attributes and time or 0 otherwise, which would mismatch any file system
+func RetrieveZipMeta(ctx context.Context, path string, f *zip.File) (*Meta, error) {
+	mask := os.ModePerm | os.ModeType | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	mode := f.Mode()
+	meta := &Meta{
+		Common: CommonAttrs{
+			Path: path,
+			Name: zipEntryName(f.Name),
+		},
+		FileSystem: &FileSystemAttrs{
+			Mode:    mode & mask,
+			ModTime: uint64(f.Modified.Unix()),
+		},
+		ExtendedAttributes: make([]ExtendedAttribute, 0),
+	}
+	var missing []string
+	if host := f.CreatorVersion >> 8; host != zipCreatorUnix && host != zipCreatorMacOS {
+		missing = append(missing, FieldMode)
+	}
+	if !hasZipExtra(f, zipTimeExtraIDs...) {
+		missing = append(missing, FieldModTime)
+	}
+	var hasOwner bool
+	if meta.FileSystem.UID, meta.FileSystem.GID, hasOwner = ZipOwner(f); !hasOwner {
+		missing = append(missing, FieldUID, FieldGID)
+	}
+	if len(missing) > 0 {
+		meta.Fields = recordedFields(missing)
+	}
+
+	switch mode & (os.ModeType | os.ModeCharDevice) {
+	case 0:
+		meta.FileSystem.Type = FSTypeFile
+		meta.Common.Size = f.UncompressedSize64
+
+		content, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the zip entry %s: %w", f.Name, err)
+		}
+		defer content.Close()
+
+		meta.Common.Hash, err = utils.MD5HashReader(ctx, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate the md5 hash of the zip entry %s: %w", f.Name, err)
+		}
+	case os.ModeDir:
+		meta.FileSystem.Type = FSTypeDir
+	case os.ModeSymlink:
+		meta.FileSystem.Type = FSTypeSymlink
+
+		content, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the zip entry %s: %w", f.Name, err)
+		}
+		defer content.Close()
+
+		target, err := io.ReadAll(io.LimitReader(content, maxZipLinkTargetSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the link target of the zip entry %s: %w", f.Name, err)
+		}
+		meta.FileSystem.LinkTarget = string(target)
+	case os.ModeDevice | os.ModeCharDevice:
+		meta.FileSystem.Type = FSTypeCharDevice
+	case os.ModeDevice:
+		meta.FileSystem.Type = FSTypeDevice
+	case os.ModeNamedPipe:
+		meta.FileSystem.Type = FSTypeNamedPipe
+	case os.ModeSocket:
+		meta.FileSystem.Type = FSTypeSocket
+	default:
+		meta.FileSystem.Type = FSTypeUnknown
+	}
+
+	return meta, nil
+}
+
+// ZipOwner returns the owner recorded in the Info-ZIP Unix extra field of a zip entry.
+// Input:
+// - f: the entry
+// Output:
+// - uid, gid: the owner of the entry
+// - ok: whether the entry records its owner
+func ZipOwner(f *zip.File) (uid, gid uint32, ok bool) {
+	extra := f.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			return 0, 0, false
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != zipUnixOwnerExtraID {
+			continue
+		}
+
+		// version (1), uid size (1), uid (n), gid size (1), gid (n)
+		if len(field) < 2 || field[0] != 1 {
+			return 0, 0, false
+		}
+		uid, field, ok = readZipOwnerID(field[1:])
+		if !ok || len(field) < 1 {
+			return 0, 0, false
+		}
+		gid, _, ok = readZipOwnerID(field)
+		return uid, gid, ok
+	}
+	return 0, 0, false
+}
+
+// hasZipExtra reports whether the entry has an extra field with one of the ids.
+func hasZipExtra(f *zip.File, ids ...uint16) bool {
+	extra := f.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			return false
+		}
+		for _, want := range ids {
+			if id == want {
+				return true
+			}
+		}
+		extra = extra[4+size:]
+	}
+	return false
+}
+
+// recordedFields returns every field but the missing ones, see Meta.Fields.
+func recordedFields(missing []string) []string {
+	fields := make([]string, 0, len(allFields))
+	for _, field := range allFields {
+		if !slices.Contains(missing, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// readZipOwnerID reads one size-prefixed little-endian id of the Unix extra field and returns the rest of the field.
+func readZipOwnerID(field []byte) (id uint32, rest []byte, ok bool) {
+	size := int(field[0])
+	if size > 4 || len(field) < 1+size {
+		return 0, nil, false
+	}
+	for i := size; i >= 1; i-- {
+		id = id<<8 | uint32(field[i])
+	}
+	return id, field[1+size:], true
+}
+
+// zipEntryName returns the base name of a zip entry, ignoring the trailing slash of the directories.
+func zipEntryName(name string) string {
+	return path.Base(strings.TrimSuffix(name, "/"))
+}
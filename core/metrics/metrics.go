@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const namespace = "file_clone_validator"
+
+// Worker pools reported by the worker metrics.
+const (
+	PoolWalk     = "walk"
+	PoolWrite    = "write"
+	PoolValidate = "validate"
+)
+
+var (
+	// Registry is the registry of all the metrics exposed by Serve.
+	Registry = prometheus.NewRegistry()
+
+	// ItemsWalked is the number of items found by walking the data source.
+	ItemsWalked = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "items_walked_total",
+		Help:      "Number of items found by walking the data source.",
+	})
+
+	// ItemsHashed is the number of files whose content has been hashed.
+	ItemsHashed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "items_hashed_total",
+		Help:      "Number of files whose content has been hashed.",
+	})
+
+	// BytesRead is the number of content bytes read to hash files.
+	BytesRead = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_read_total",
+		Help:      "Number of content bytes read to hash files.",
+	})
+
+	// ItemsWritten is the number of items written to the metadata file.
+	ItemsWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "items_written_total",
+		Help:      "Number of items written to the metadata file.",
+	})
+
+	// ItemsValidated is the number of metadata items validated against the target.
+	ItemsValidated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "items_validated_total",
+		Help:      "Number of metadata items validated against the target.",
+	})
+
+	// Findings is the number of validation findings by reason, e.g. FileNotFound or MetaMismatch.
+	Findings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "findings_total",
+		Help:      "Number of validation findings by reason.",
+	}, []string{"reason"})
+
+	// Workers is the number of workers by pool.
+	Workers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers",
+		Help:      "Number of workers by pool.",
+	}, []string{"pool"})
+
+	// WorkerBusySeconds is the time spent by the workers on items rather than waiting for them, by pool. The worker
+	// utilization of a pool is rate(worker_busy_seconds_total) / workers.
+	WorkerBusySeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_busy_seconds_total",
+		Help:      "Time spent by the workers processing items, by pool.",
+	}, []string{"pool"})
+
+	queues = &queueCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_depth"),
+			"Number of items buffered in a queue between two stages.", []string{"queue"}, nil),
+		lens: make(map[string]func() int),
+	}
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ItemsWalked, ItemsHashed, BytesRead, ItemsWritten, ItemsValidated, Findings,
+		Workers, WorkerBusySeconds, queues,
+	)
+}
+
+// TrackQueue exposes the depth of a queue, typically the length of a channel, under the given name until the
+// returned function is called.
+func TrackQueue(name string, lenFn func() int) (untrack func()) {
+	queues.mu.Lock()
+	defer queues.mu.Unlock()
+	queues.lens[name] = lenFn
+	return func() {
+		queues.mu.Lock()
+		defer queues.mu.Unlock()
+		delete(queues.lens, name)
+	}
+}
+
+// StartWorkers records that n workers of the pool have started.
+func StartWorkers(pool string, n int) {
+	Workers.WithLabelValues(pool).Add(float64(n))
+}
+
+// StopWorker records that one worker of the pool has stopped.
+func StopWorker(pool string) {
+	Workers.WithLabelValues(pool).Dec()
+}
+
+// Busy starts measuring the time a worker of the pool spends on one item. Call the returned function when the item is
+// done.
+func Busy(pool string) (done func()) {
+	start := time.Now()
+	return func() {
+		WorkerBusySeconds.WithLabelValues(pool).Add(time.Since(start).Seconds())
+	}
+}
+
+// queueCollector collects the depth of the tracked queues when the metrics are scraped.
+type queueCollector struct {
+	desc *prometheus.Desc
+	mu   sync.Mutex
+	lens map[string]func() int
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, lenFn := range c.lens {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(lenFn()), name)
+	}
+}
+
+// Serve serves the metrics of Registry over HTTP at /metrics until the context is done.
+// Input:
+// - addr: the address to listen on, e.g. ":9100"
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Start serving metrics:", slog.String("Addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
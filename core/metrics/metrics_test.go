@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"context"
+	"file-clone-validator/core/metrics"
+	"file-clone-validator/pkg/clonevalidator"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetricsOfGenerateAndValidate(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("aaaa"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("bbbbbb"), 0644))
+
+	counters := func() map[string]float64 {
+		return map[string]float64{
+			"walked":       testutil.ToFloat64(metrics.ItemsWalked),
+			"hashed":       testutil.ToFloat64(metrics.ItemsHashed),
+			"bytes":        testutil.ToFloat64(metrics.BytesRead),
+			"written":      testutil.ToFloat64(metrics.ItemsWritten),
+			"validated":    testutil.ToFloat64(metrics.ItemsValidated),
+			"fileNotFound": testutil.ToFloat64(metrics.Findings.WithLabelValues("FileNotFound")),
+		}
+	}
+	delta := func(before map[string]float64) map[string]float64 {
+		after := counters()
+		for name := range after {
+			after[name] -= before[name]
+		}
+		return after
+	}
+
+	before := counters()
+	generated, err := clonevalidator.Generate(context.Background(), clonevalidator.GenerateOptions{
+		SourceDir: srcDir,
+		OutputDir: outDir,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{
+		"walked":       3, // a.txt, sub and sub/b.txt
+		"hashed":       2,
+		"bytes":        10,
+		"written":      3,
+		"validated":    0,
+		"fileNotFound": 0,
+	}, delta(before))
+
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "a.txt")))
+	before = counters()
+	_, err = clonevalidator.Validate(context.Background(), clonevalidator.ValidateOptions{
+		TargetDir:    srcDir,
+		MetaFilePath: generated.MetaFilePath,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{
+		"walked":       0,
+		"hashed":       1, // sub/b.txt, a.txt is not found
+		"bytes":        6,
+		"written":      0,
+		"validated":    3,
+		"fileNotFound": 1,
+	}, delta(before))
+
+	// the workers of every pool have stopped
+	for _, pool := range []string{metrics.PoolWalk, metrics.PoolWrite, metrics.PoolValidate} {
+		require.Zero(t, testutil.ToFloat64(metrics.Workers.WithLabelValues(pool)), pool)
+	}
+}
+
+func TestTrackQueue(t *testing.T) {
+	depth := 7
+	untrack := metrics.TrackQueue("test", func() int { return depth })
+	require.Equal(t, 1, testutil.CollectAndCount(metrics.Registry, "file_clone_validator_queue_depth"))
+
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	var value float64
+	for _, family := range families {
+		if family.GetName() == "file_clone_validator_queue_depth" {
+			value = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, float64(7), value)
+
+	untrack()
+	require.Zero(t, testutil.CollectAndCount(metrics.Registry, "file_clone_validator_queue_depth"))
+}
@@ -0,0 +1,126 @@
+// Package mtree converts between the metadata files and the BSD mtree specifications, see mtree(5). The type, mode,
+// uid, gid, nlink, size, time, link, md5digest and sha256digest keywords are converted, the others are ignored on
+// import and never written on export.
+//
+// An mtree specification only records some of the metadata of an item: the imported items list the fields they record,
+// see metadata.Meta.Fields, so that the validation only compares those.
+package mtree
+
+import (
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"strings"
+)
+
+// Keywords of an mtree specification converted to and from the metadata.
+const (
+	keywordType         = "type"
+	keywordMode         = "mode"
+	keywordUID          = "uid"
+	keywordGID          = "gid"
+	keywordNLink        = "nlink"
+	keywordSize         = "size"
+	keywordTime         = "time"
+	keywordLink         = "link"
+	keywordMD5          = "md5"
+	keywordMD5Digest    = "md5digest"
+	keywordSHA256       = "sha256"
+	keywordSHA256Digest = "sha256digest"
+)
+
+// types maps the values of the type keyword to the file system types of the metadata.
+var types = map[string]string{
+	"file":   metadata.FSTypeFile,
+	"dir":    metadata.FSTypeDir,
+	"link":   metadata.FSTypeSymlink,
+	"char":   metadata.FSTypeCharDevice,
+	"block":  metadata.FSTypeDevice,
+	"fifo":   metadata.FSTypeNamedPipe,
+	"socket": metadata.FSTypeSocket,
+}
+
+// mtreeType returns the value of the type keyword of a file system type of the metadata.
+func mtreeType(fsType string) (string, bool) {
+	for mType, t := range types {
+		if t == fsType {
+			return mType, true
+		}
+	}
+	return "", false
+}
+
+// hasLinks reports whether the metadata records the number of hard links of the items of a file system type, see
+// metadata.RetrieveFSMeta.
+func hasLinks(fsType string) bool {
+	switch fsType {
+	case metadata.FSTypeFile, metadata.FSTypeSymlink, metadata.FSTypeDevice, metadata.FSTypeCharDevice:
+		return true
+	}
+	return false
+}
+
+// vis encodes a path or a link target like vis(3) with the VIS_OCTAL and VIS_WHITE flags, so that it is a single
+// field of a line of the specification.
+func vis(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '\\' || c == '#' || c == '=' {
+			fmt.Fprintf(&b, "\\%03o", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// unvis decodes a field encoded by vis(3): the octal escapes, the C escapes and \s for a space.
+func unvis(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("trailing backslash in %q", s)
+		}
+
+		i++
+		switch c := s[i]; c {
+		case '0', '1', '2', '3':
+			if i+2 >= len(s) || !isOctal(s[i+1]) || !isOctal(s[i+2]) {
+				return "", fmt.Errorf("invalid octal escape in %q", s)
+			}
+			b.WriteByte((c-'0')<<6 | (s[i+1]-'0')<<3 | (s[i+2] - '0'))
+			i += 2
+		case 's':
+			b.WriteByte(' ')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
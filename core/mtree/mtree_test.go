@@ -0,0 +1,124 @@
+package mtree
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	spec := strings.Join([]string{
+		"#mtree",
+		"# comment",
+		"/set type=file uid=0 gid=0 mode=0644",
+		". type=dir mode=0755",
+		"a\\040b size=3 time=1600000000.500000000 \\",
+		"    md5digest=0CC175B9C0F1B6A831C399E269772661",
+		"sub type=dir mode=02775 nlink=4",
+		"    f sha256digest=abc nlink=2",
+		"..",
+		"./sub/l type=link link=../a\\040b",
+		"/unset all",
+		"top",
+	}, "\n")
+
+	var items []*metadata.Meta
+	require.NoError(t, Read(strings.NewReader(spec), "/root", func(item *metadata.Meta) error {
+		items = append(items, item)
+		return nil
+	}))
+	require.Len(t, items, 5)
+
+	ab := items[0]
+	require.Equal(t, "/root/a b", ab.Common.Path)
+	require.Equal(t, "a b", ab.Common.Name)
+	require.Equal(t, uint64(3), ab.Common.Size)
+	require.Equal(t, "0cc175b9c0f1b6a831c399e269772661", ab.Common.Hash)
+	require.Empty(t, ab.Common.HashAlgorithm)
+	require.Equal(t, os.FileMode(0644), ab.FileSystem.Mode)
+	require.Equal(t, uint64(1600000000), ab.FileSystem.ModTime)
+	require.ElementsMatch(t, []string{metadata.FieldName, metadata.FieldType, metadata.FieldMode, metadata.FieldUID,
+		metadata.FieldGID, metadata.FieldSize, metadata.FieldModTime, metadata.FieldHash}, ab.Fields)
+
+	sub := items[1]
+	require.Equal(t, "/root/sub", sub.Common.Path)
+	require.Equal(t, os.ModeDir|os.ModeSetgid|0775, sub.FileSystem.Mode)
+	require.False(t, sub.Records(metadata.FieldLinks), "the links of a directory are not recorded")
+
+	f := items[2]
+	require.Equal(t, "/root/sub/f", f.Common.Path)
+	require.Equal(t, "abc", f.Common.Hash)
+	require.Equal(t, utils.HashSHA256, f.Common.HashAlgorithm)
+	require.Equal(t, uint64(2), f.FileSystem.Links)
+	require.False(t, f.Records(metadata.FieldSize))
+
+	l := items[3]
+	require.Equal(t, "/root/sub/l", l.Common.Path)
+	require.Equal(t, metadata.FSTypeSymlink, l.FileSystem.Type)
+	require.Equal(t, "../a b", l.FileSystem.LinkTarget)
+
+	top := items[4]
+	require.Equal(t, "/root/top", top.Common.Path, "the full path entry does not change the current directory")
+	require.Equal(t, []string{metadata.FieldName}, top.Fields)
+
+	err := Read(strings.NewReader("a type=door\n"), "/root", func(item *metadata.Meta) error { return nil })
+	require.ErrorContains(t, err, "line 1")
+}
+
+func TestWriteImportValidate(t *testing.T) {
+	srcDir, outDir, importDir := t.TempDir(), t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a#1.txt"), []byte("a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub dir", "b.txt"), []byte("b"), 0644))
+	require.NoError(t, os.Symlink("../a#1.txt", filepath.Join(srcDir, "sub dir", "link")))
+
+	metaPath := testutil.WriteMetaFile(t, srcDir, outDir)
+	var spec bytes.Buffer
+	count, err := Write(context.Background(), metaPath, &spec)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), count)
+	require.Contains(t, spec.String(), "./sub\\040dir/link type=link ")
+	require.Contains(t, spec.String(), "link=../a\\0431.txt")
+
+	specPath := filepath.Join(t.TempDir(), "tree.mtree")
+	require.NoError(t, os.WriteFile(specPath, spec.Bytes(), 0644))
+	importedPath, err := Import(context.Background(), specPath, srcDir, importDir)
+	require.NoError(t, err)
+
+	header, err := datasource.ReadMetaHeader(importedPath)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), header.ItemCount)
+	require.Empty(t, testutil.Validate(t, srcDir, importedPath))
+
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub dir", "b.txt"), []byte("c"), 0644))
+	counts := testutil.Validate(t, srcDir, importedPath)
+	require.Equal(t, uint64(1), counts[validator.ReasonMetaMismatch])
+}
+
+func TestValidateSHA256Only(t *testing.T) {
+	srcDir, importDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0600))
+
+	sum := sha256.Sum256([]byte("a"))
+	spec := fmt.Sprintf("./a.txt type=file sha256digest=%s\n./missing size=1\n", hex.EncodeToString(sum[:]))
+	specPath := filepath.Join(t.TempDir(), "tree.mtree")
+	require.NoError(t, os.WriteFile(specPath, []byte(spec), 0644))
+
+	importedPath, err := Import(context.Background(), specPath, srcDir, importDir)
+	require.NoError(t, err)
+	counts := testutil.Validate(t, srcDir, importedPath)
+	require.Equal(t, map[string]uint64{validator.ReasonFileNotFound: 1}, counts,
+		"only the recorded keywords are validated")
+}
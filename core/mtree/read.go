@@ -0,0 +1,293 @@
+package mtree
+
+import (
+	"bufio"
+	"context"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxLineSize is the longest line of a specification Read accepts.
+const maxLineSize = 1 << 20
+
+// Read parses an mtree specification and calls fn with the metadata of every entry but the root directory. Both the
+// relative entries, which change the current directory, and the full path entries are supported.
+// Input:
+// - r: the specification
+// - root: the path the items are recorded under, the entries are joined to it
+// - fn: receives the items in the order of the specification
+func Read(r io.Reader, root string, fn func(item *metadata.Meta) error) error {
+	p := &parser{root: root, defaults: map[string]string{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	var continued string
+	for scanner.Scan() {
+		p.line++
+		line := continued + scanner.Text()
+		if strings.HasSuffix(line, "\\") && !strings.HasSuffix(line, "\\\\") {
+			continued = strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		continued = ""
+
+		item, err := p.parseLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", p.line, err)
+		}
+		if item == nil {
+			continue
+		}
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if continued != "" {
+		return fmt.Errorf("line %d: unterminated line continuation", p.line)
+	}
+	return nil
+}
+
+// parser is the state of Read: the keywords set by /set and the current directory of the relative entries.
+type parser struct {
+	root     string
+	defaults map[string]string
+	cwd      []string
+	line     int
+}
+
+// parseLine parses one line of the specification. It returns nil for the lines which are not entries.
+func (p *parser) parseLine(line string) (*metadata.Meta, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return nil, nil
+	}
+
+	switch fields[0] {
+	case "/set":
+		for k, v := range parseKeywords(fields[1:]) {
+			p.defaults[k] = v
+		}
+		return nil, nil
+	case "/unset":
+		for _, k := range fields[1:] {
+			if k == "all" {
+				p.defaults = map[string]string{}
+			}
+			delete(p.defaults, k)
+		}
+		return nil, nil
+	case "..":
+		if len(p.cwd) > 0 {
+			p.cwd = p.cwd[:len(p.cwd)-1]
+		}
+		return nil, nil
+	}
+	if strings.HasPrefix(fields[0], "/") {
+		return nil, fmt.Errorf("unknown special command %s", fields[0])
+	}
+
+	name, err := unvis(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	keywords := make(map[string]string, len(p.defaults)+len(fields)-1)
+	for k, v := range p.defaults {
+		keywords[k] = v
+	}
+	for k, v := range parseKeywords(fields[1:]) {
+		keywords[k] = v
+	}
+
+	var rel string
+	if strings.Contains(fields[0], "/") { // a full path entry does not change the current directory
+		rel = path.Clean(name)
+	} else {
+		rel = path.Join(append(append([]string{}, p.cwd...), name)...)
+		if keywords[keywordType] == "dir" && name != "." {
+			p.cwd = append(p.cwd, name)
+		}
+	}
+	if rel == "." {
+		return nil, nil
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return nil, fmt.Errorf("entry %s is outside of the root", name)
+	}
+
+	return newMeta(filepath.Join(p.root, filepath.FromSlash(rel)), keywords)
+}
+
+// parseKeywords parses the keyword=value fields of a line. The keywords without a value, e.g. optional, are mapped to
+// an empty value.
+func parseKeywords(fields []string) map[string]string {
+	keywords := make(map[string]string, len(fields))
+	for _, field := range fields {
+		k, v, _ := strings.Cut(field, "=")
+		keywords[k] = v
+	}
+	return keywords
+}
+
+// newMeta builds the metadata of an entry from its keywords. The fields which are not recorded by the keywords are
+// left out of Fields.
+func newMeta(itemPath string, keywords map[string]string) (*metadata.Meta, error) {
+	meta := &metadata.Meta{
+		Common:     metadata.CommonAttrs{Path: itemPath, Name: filepath.Base(itemPath)},
+		FileSystem: &metadata.FileSystemAttrs{Type: metadata.FSTypeFile},
+		Fields:     []string{metadata.FieldName},
+	}
+	fsAttrs := meta.FileSystem
+
+	if v, ok := keywords[keywordType]; ok {
+		fsType, _ok := types[v]
+		if !_ok {
+			return nil, fmt.Errorf("invalid type of %s: %s", itemPath, v)
+		}
+		fsAttrs.Type = fsType
+		meta.Fields = append(meta.Fields, metadata.FieldType)
+	}
+
+	number := func(keyword string, base, bitSize int) (uint64, bool, error) {
+		v, ok := keywords[keyword]
+		if !ok {
+			return 0, false, nil
+		}
+		n, err := strconv.ParseUint(v, base, bitSize)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s of %s: %s", keyword, itemPath, v)
+		}
+		return n, true, nil
+	}
+
+	mode, ok, err := number(keywordMode, 8, 32)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		fsAttrs.Mode = metadata.FileMode(fsAttrs.Type, uint32(mode))
+		meta.Fields = append(meta.Fields, metadata.FieldMode)
+	} else {
+		fsAttrs.Mode = metadata.FileMode(fsAttrs.Type, 0)
+	}
+
+	uid, ok, err := number(keywordUID, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		fsAttrs.UID = uint32(uid)
+		meta.Fields = append(meta.Fields, metadata.FieldUID)
+	}
+
+	gid, ok, err := number(keywordGID, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		fsAttrs.GID = uint32(gid)
+		meta.Fields = append(meta.Fields, metadata.FieldGID)
+	}
+
+	links, ok, err := number(keywordNLink, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if ok && hasLinks(fsAttrs.Type) {
+		fsAttrs.Links = links
+		meta.Fields = append(meta.Fields, metadata.FieldLinks)
+	}
+
+	size, ok, err := number(keywordSize, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if ok && fsAttrs.Type == metadata.FSTypeFile { // the size of the other types depends on the file system
+		meta.Common.Size = size
+		meta.Fields = append(meta.Fields, metadata.FieldSize)
+	}
+
+	if v, _ok := keywords[keywordTime]; _ok {
+		sec, _, _ := strings.Cut(v, ".")
+		modTime, _err := strconv.ParseUint(sec, 10, 64)
+		if _err != nil {
+			return nil, fmt.Errorf("invalid time of %s: %s", itemPath, v)
+		}
+		fsAttrs.ModTime = modTime
+		meta.Fields = append(meta.Fields, metadata.FieldModTime)
+	}
+
+	if v, _ok := keywords[keywordLink]; _ok && fsAttrs.Type == metadata.FSTypeSymlink {
+		if fsAttrs.LinkTarget, err = unvis(v); err != nil {
+			return nil, fmt.Errorf("invalid link of %s: %w", itemPath, err)
+		}
+		meta.Fields = append(meta.Fields, metadata.FieldLinkTarget)
+	}
+
+	if fsAttrs.Type == metadata.FSTypeFile { // MD5 is preferred, it is the algorithm of the generated metadata files
+		if v, _ok := firstKeyword(keywords, keywordMD5Digest, keywordMD5); _ok {
+			meta.Common.Hash = strings.ToLower(v)
+			meta.Fields = append(meta.Fields, metadata.FieldHash)
+		} else if v, _ok = firstKeyword(keywords, keywordSHA256Digest, keywordSHA256); _ok {
+			meta.Common.Hash, meta.Common.HashAlgorithm = strings.ToLower(v), utils.HashSHA256
+			meta.Fields = append(meta.Fields, metadata.FieldHash)
+		}
+	}
+	return meta, nil
+}
+
+// firstKeyword returns the value of the first of the keywords which is set.
+func firstKeyword(keywords map[string]string, names ...string) (string, bool) {
+	for _, name := range names {
+		if v, ok := keywords[name]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Import converts an mtree specification to a metadata file, written to the output directory like by the generate
+// command.
+// Input:
+// - specPath: the path to the specification
+// - root: the source directory recorded in the header of the metadata file, the entries are joined to it
+// - outDir: the directory to write the metadata file to
+// Output:
+// - metaPath: the path to the metadata file
+func Import(ctx context.Context, specPath, root, outDir string) (metaPath string, err error) {
+	if root, err = filepath.Abs(root); err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(specPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open mtree specification: %w", err)
+	}
+	defer file.Close()
+
+	slog.Info("Start to import mtree specification:", slog.String("SpecPath", specPath), slog.String("SourceDir", root))
+	metaPath, count, err := datasource.Import(ctx, root, outDir, func(emit func(item *metadata.Meta) error) error {
+		if _err := Read(bufio.NewReader(file), root, emit); _err != nil {
+			return fmt.Errorf("failed to read mtree specification %s: %w", specPath, _err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("Finish to import mtree specification:", slog.String("MetaFilePath", metaPath), slog.Uint64("ItemCount", count))
+	return metaPath, nil
+}
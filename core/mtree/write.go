@@ -0,0 +1,122 @@
+package mtree
+
+import (
+	"bufio"
+	"context"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// Write converts a metadata file to an mtree specification of full path entries relative to its source directory, in
+// the order of the metadata file.
+// Input:
+// - ctx: cancels the conversion
+// - metaPath: the metadata file to convert
+// - w: the writer of the specification
+// Output:
+// - count: the number of entries written
+// Note:
+// - Only the fields recorded for the items are written, see metadata.Meta.Fields. mtree has no keyword for the
+// extended attributes, they are not written
+func Write(ctx context.Context, metaPath string, w io.Writer) (count uint64, err error) {
+	reader, err := datasource.OpenMetaFile(metaPath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#mtree")
+	fmt.Fprintf(bw, "# source: %s\n", oneLine(reader.Header.SourceDir))
+	for {
+		if err = ctx.Err(); err != nil {
+			return count, err
+		}
+
+		row, _err := reader.Next()
+		if _err == io.EOF {
+			break
+		}
+		if _err != nil {
+			return count, fmt.Errorf("failed to read metadata file %s: %w", metaPath, _err)
+		}
+		item, _err := metadata.Deserialise(row)
+		if _err != nil {
+			return count, fmt.Errorf("failed to parse row of metadata file %s: %w", metaPath, _err)
+		}
+
+		rel, _err := filepath.Rel(reader.Header.SourceDir, item.Common.Path)
+		if _err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return count, fmt.Errorf("item %s is outside of the source directory %s", item.Common.Path,
+				reader.Header.SourceDir)
+		}
+
+		line, ok := entry(filepath.ToSlash(rel), item)
+		if !ok {
+			slog.Warn("Skip item of unknown type:", slog.String("Path", item.Common.Path))
+			continue
+		}
+		if _, _err = fmt.Fprintln(bw, line); _err != nil {
+			return count, _err
+		}
+		count++
+	}
+	return count, bw.Flush()
+}
+
+// entry returns the line of the specification of an item. ok is false if the type of the item has no mtree type.
+func entry(rel string, item *metadata.Meta) (line string, ok bool) {
+	fsAttrs := item.FileSystem
+	if fsAttrs == nil {
+		fsAttrs = &metadata.FileSystemAttrs{Type: metadata.FSTypeFile}
+	}
+	mType, ok := mtreeType(fsAttrs.Type)
+	if !ok {
+		return "", false
+	}
+
+	keywords := []string{"./" + vis(rel), keywordType + "=" + mType}
+	add := func(field, keyword string, format string, value any) {
+		if item.Records(field) {
+			keywords = append(keywords, keyword+"="+fmt.Sprintf(format, value))
+		}
+	}
+
+	if item.FileSystem != nil {
+		add(metadata.FieldMode, keywordMode, "%04o", metadata.UnixMode(fsAttrs.Mode))
+		add(metadata.FieldUID, keywordUID, "%d", fsAttrs.UID)
+		add(metadata.FieldGID, keywordGID, "%d", fsAttrs.GID)
+		if hasLinks(fsAttrs.Type) {
+			add(metadata.FieldLinks, keywordNLink, "%d", fsAttrs.Links)
+		}
+	}
+	if fsAttrs.Type == metadata.FSTypeFile {
+		add(metadata.FieldSize, keywordSize, "%d", item.Common.Size)
+	}
+	if item.FileSystem != nil {
+		add(metadata.FieldModTime, keywordTime, "%d.000000000", fsAttrs.ModTime)
+		if fsAttrs.Type == metadata.FSTypeSymlink {
+			add(metadata.FieldLinkTarget, keywordLink, "%s", vis(fsAttrs.LinkTarget))
+		}
+	}
+	if fsAttrs.Type == metadata.FSTypeFile && item.Common.Hash != "" {
+		switch item.Common.HashAlgorithm {
+		case "", utils.HashMD5:
+			add(metadata.FieldHash, keywordMD5Digest, "%s", item.Common.Hash)
+		case utils.HashSHA256:
+			add(metadata.FieldHash, keywordSHA256Digest, "%s", item.Common.Hash)
+		}
+	}
+	return strings.Join(keywords, " "), true
+}
+
+// oneLine replaces the line breaks of s, so that it fits in a comment.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,176 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Mode is the way the progress is reported.
+type Mode string
+
+const (
+	ModeBar  Mode = "bar"  // interactive progress bars on the terminal
+	ModeJSON Mode = "json" // periodic NDJSON events, see Event
+	ModeNone Mode = "none" // no progress at all
+)
+
+// Phase is the stage of a pipeline the progress refers to.
+const (
+	PhaseWalk     = "walk"
+	PhaseWrite    = "write"
+	PhaseMerge    = "merge"
+	PhaseValidate = "validate"
+)
+
+// Event is one progress event emitted in the json mode. Events of the same phase are emitted periodically, and the
+// last event of a phase has Done set.
+type Event struct {
+	// Time is the time the event is emitted at, in RFC 3339 format.
+	Time string
+
+	// Phase is the phase of the pipeline, one of walk, write, merge or validate.
+	Phase string
+
+	// Processed is the number of items processed so far in the phase.
+	Processed uint64
+
+	// Total is the number of items expected in the phase. 0 means unknown.
+	Total uint64
+
+	// Bytes is the number of content bytes read so far by the process.
+	Bytes uint64
+
+	// Rate is the average number of items processed per second since the phase started.
+	Rate float64
+
+	// BytesRate is the average number of bytes read per second since the phase started.
+	BytesRate float64
+
+	// ETASeconds is the estimated number of seconds until the phase is done. -1 means unknown.
+	ETASeconds float64
+
+	// Done is set on the last event of the phase.
+	Done bool
+}
+
+var (
+	mu       sync.Mutex
+	mode               = ModeBar
+	out      io.Writer = os.Stderr
+	interval           = time.Second
+)
+
+// Configure sets how the progress is reported by the whole process.
+// Input:
+// - m: the progress mode
+// - w: the writer of the json events. It is not used by the other modes
+// - every: the interval between two events of the same phase
+func Configure(m Mode, w io.Writer, every time.Duration) error {
+	if m != ModeBar && m != ModeJSON && m != ModeNone {
+		return fmt.Errorf("invalid progress mode: %s. expect [bar|json|none]", m)
+	}
+	if every <= 0 {
+		return fmt.Errorf("progress interval must be greater than 0. got %s", every)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	mode, out, interval = m, w, every
+	return nil
+}
+
+// CurrentMode returns the configured progress mode.
+func CurrentMode() Mode {
+	mu.Lock()
+	defer mu.Unlock()
+	return mode
+}
+
+// Interval returns the configured interval between two progress updates.
+func Interval() time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+	return interval
+}
+
+// Watch emits the json events of a phase until the context is done. It does nothing in the other modes, the bars are
+// drawn by the callers which own them.
+// Input:
+// - phase: the phase of the pipeline
+// - total: the number of items expected in the phase. 0 means unknown
+// - processed: returns the number of items processed so far
+// - bytes: returns the number of content bytes read so far. It may be nil
+func Watch(ctx context.Context, phase string, total uint64, processed, bytes func() uint64) {
+	if CurrentMode() != ModeJSON {
+		return
+	}
+
+	start := time.Now()
+	startBytes := uint64(0)
+	if bytes != nil {
+		startBytes = bytes()
+	}
+
+	ticker := time.NewTicker(Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			emit(newEvent(phase, total, processed, bytes, start, startBytes, true))
+			return
+		case <-ticker.C:
+			emit(newEvent(phase, total, processed, bytes, start, startBytes, false))
+		}
+	}
+}
+
+func newEvent(phase string, total uint64, processed, bytes func() uint64, start time.Time, startBytes uint64,
+	done bool) *Event {
+	now := time.Now()
+	elapsed := now.Sub(start).Seconds()
+
+	event := &Event{
+		Time:       now.Format(time.RFC3339),
+		Phase:      phase,
+		Processed:  processed(),
+		Total:      total,
+		ETASeconds: -1,
+		Done:       done,
+	}
+	if bytes != nil {
+		event.Bytes = bytes()
+	}
+
+	if elapsed > 0 {
+		event.Rate = float64(event.Processed) / elapsed
+		event.BytesRate = float64(event.Bytes-startBytes) / elapsed
+	}
+
+	switch {
+	case done:
+		event.ETASeconds = 0
+	case total > 0 && event.Processed >= total:
+		event.ETASeconds = 0
+	case total > 0 && event.Rate > 0:
+		event.ETASeconds = float64(total-event.Processed) / event.Rate
+	}
+	return event
+}
+
+// emit writes one event as a line of json. Events of concurrent phases are serialised.
+func emit(event *Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	out.Write(append(data, '\n'))
+}
@@ -0,0 +1,79 @@
+package progress_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"file-clone-validator/core/progress"
+	"file-clone-validator/pkg/clonevalidator"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer the events of concurrent phases can be written to.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestConfigure(t *testing.T) {
+	require.Error(t, progress.Configure("verbose", os.Stderr, time.Second))
+	require.Error(t, progress.Configure(progress.ModeJSON, os.Stderr, 0))
+}
+
+func TestJSONEventsOfGenerateAndValidate(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644))
+	}
+
+	out := &syncBuffer{}
+	require.NoError(t, progress.Configure(progress.ModeJSON, out, 10*time.Millisecond))
+	defer progress.Configure(progress.ModeBar, os.Stderr, time.Second)
+
+	generated, err := clonevalidator.Generate(context.Background(), clonevalidator.GenerateOptions{
+		SourceDir: srcDir,
+		OutputDir: outDir,
+	})
+	require.NoError(t, err)
+	_, err = clonevalidator.Validate(context.Background(), clonevalidator.ValidateOptions{
+		TargetDir:    srcDir,
+		MetaFilePath: generated.MetaFilePath,
+	})
+	require.NoError(t, err)
+
+	// every phase ends with one done event
+	done := make(map[string]progress.Event)
+	s := bufio.NewScanner(&out.buf)
+	for s.Scan() {
+		var event progress.Event
+		require.NoError(t, json.Unmarshal(s.Bytes(), &event), s.Text())
+		_, err = time.Parse(time.RFC3339, event.Time)
+		require.NoError(t, err)
+		if event.Done {
+			require.NotContains(t, done, event.Phase)
+			require.Zero(t, event.ETASeconds, event.Phase)
+			done[event.Phase] = event
+		} else {
+			require.NotContains(t, done, event.Phase, "event after the done event of the phase")
+		}
+	}
+
+	for _, phase := range []string{progress.PhaseWalk, progress.PhaseWrite, progress.PhaseMerge, progress.PhaseValidate} {
+		require.Contains(t, done, phase)
+		require.Equal(t, uint64(3), done[phase].Processed, phase)
+	}
+	require.Equal(t, uint64(3), done[progress.PhaseMerge].Total)
+	require.Equal(t, uint64(3), done[progress.PhaseValidate].Total)
+}
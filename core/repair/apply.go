@@ -0,0 +1,144 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd
+// +build darwin freebsd linux netbsd openbsd
+
+package repair
+
+import (
+	"context"
+	"errors"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// applyAction applies one action of an item. The actions which create an entry preserve the modification time of its
+// parent directory, which is repaired separately if it mismatches too.
+func applyAction(ctx context.Context, item *Item, action Action) error {
+	meta := item.Finding.Item
+	switch action.Kind {
+	case ActionMkdir:
+		return preserveParentTime(action.Path, func() error {
+			err := os.Mkdir(action.Path, 0700)
+			if errors.Is(err, fs.ErrExist) { // created as the parent of a repaired child
+				return nil
+			}
+			return err
+		})
+	case ActionCopy:
+		return preserveParentTime(action.Path, func() error { return copyFile(ctx, item.SourcePath, action.Path) })
+	case ActionSymlink:
+		return preserveParentTime(action.Path, func() error {
+			return replaceWith(action.Path, func(tmpPath string) error {
+				return os.Symlink(meta.FileSystem.LinkTarget, tmpPath)
+			})
+		})
+	case ActionChown:
+		uid, gid := owner(meta)
+		return os.Lchown(action.Path, uid, gid)
+	case ActionChmod:
+		return os.Chmod(action.Path, meta.FileSystem.Mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	case ActionXAttrs:
+		return setXAttrs(action.Path, meta.ExtendedAttributes)
+	case ActionTouch:
+		return setModTime(action.Path, time.Unix(int64(meta.FileSystem.ModTime), 0))
+	default:
+		return fmt.Errorf("unknown action: %s", action.Kind)
+	}
+}
+
+// copyFile copies the content of the source file to the target path through utils.DefaultLimiter. The content is
+// written to a temp file next to the target, which replaces the target once it is complete.
+func copyFile(ctx context.Context, srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return replaceWith(dstPath, func(tmpPath string) error {
+		dst, _err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if _err != nil {
+			return _err
+		}
+
+		if _, _err = io.Copy(dst, utils.DefaultLimiter.Reader(ctx, src)); _err != nil {
+			dst.Close()
+			return _err
+		}
+		return dst.Close()
+	})
+}
+
+// replaceWith creates a new entry with create at a temp path next to path, and renames it over path. The missing
+// parent directories are created.
+func replaceWith(path string, create func(tmpPath string) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(dir, fmt.Sprintf(".%s.repair-%d", filepath.Base(path), time.Now().UnixNano()))
+	if err := create(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// preserveParentTime runs fn and restores the modification time the parent directory had before, if it existed.
+func preserveParentTime(path string, fn func() error) error {
+	parent := filepath.Dir(path)
+	fi, err := os.Lstat(parent)
+	if err != nil {
+		return fn()
+	}
+
+	if err = fn(); err != nil {
+		return err
+	}
+	return setModTime(parent, fi.ModTime())
+}
+
+// setModTime sets the modification time of path without following a final symbolic link. The access time is set to
+// now.
+func setModTime(path string, mtime time.Time) error {
+	tv := []unix.Timeval{unix.NsecToTimeval(time.Now().UnixNano()), unix.NsecToTimeval(mtime.UnixNano())}
+	if err := unix.Lutimes(path, tv); err != nil {
+		return &fs.PathError{Op: "lutimes", Path: path, Err: err}
+	}
+	return nil
+}
+
+// setXAttrs sets the extended attributes of path and removes the ones which are not in xattrs.
+func setXAttrs(path string, xattrs metadata.ExtendedAttributes) error {
+	keep := make(map[string]bool, len(xattrs))
+	for _, xattr := range xattrs {
+		if err := metadata.SetXAttr(path, xattr.Key, xattr.Value); err != nil {
+			return err
+		}
+		keep[xattr.Key] = true
+	}
+
+	names, err := metadata.ListXAttr(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !keep[name] {
+			if err = metadata.RemoveXAttr(path, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
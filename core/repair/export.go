@@ -0,0 +1,219 @@
+package repair
+
+import (
+	"bufio"
+	"encoding/hex"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Formats of the exported findings.
+const (
+	ExportFilesFrom = "files-from" // the relative paths to fix, for rsync --files-from --from0
+	ExportScript    = "script"     // a shell script of cp, chmod, chown, setfattr and touch commands
+)
+
+// PlanFromReasons plans the repair of the items of the findings like Plan, but without looking at the target: the
+// actions only derive from the recorded metadata of the items and the mismatch reasons of metadata.Meta.Equals. The
+// attributes which can not be fixed by the actions, e.g. the number of hard links, are left to the operator.
+func PlanFromReasons(findings []validator.Finding, opts Options) ([]*Item, error) {
+	opts, err := absOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(findings))
+	for _, finding := range findings {
+		item := &Item{Finding: finding}
+		items = append(items, item)
+
+		if !repairable(finding.Reason) {
+			item.Skipped = fmt.Sprintf("%s findings are not repairable", finding.Reason)
+			continue
+		}
+		if finding.Side != validator.SideSource || finding.Item == nil || finding.Item.FileSystem == nil {
+			item.Skipped = "the finding has no source file system metadata"
+			continue
+		}
+
+		rel, _err := filepath.Rel(opts.ManifestSourceDir, finding.Item.Common.Path)
+		if _err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			item.Skipped = fmt.Sprintf("the item is outside of the source directory %s", opts.ManifestSourceDir)
+			continue
+		}
+		item.SourcePath = filepath.Join(opts.SourceDir, rel)
+		item.TargetPath = filepath.Join(opts.TargetDir, rel)
+		planFromReasons(item)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].TargetPath > items[j].TargetPath })
+	return items, nil
+}
+
+// planFromReasons fills the actions of an item from its finding.
+func planFromReasons(item *Item) {
+	meta := item.Finding.Item
+	expected := meta.FileSystem
+	mismatch := func(attr string) bool {
+		return missing(item.Finding.Reason) || hasReason(item.Finding.Error, attr)
+	}
+
+	recreated := mismatch("type") || mismatch("size") || mismatch("hash") || mismatch("linkTarget")
+	if recreated {
+		switch expected.Type {
+		case metadata.FSTypeDir:
+			item.Actions = append(item.Actions, Action{Kind: ActionMkdir, Path: item.TargetPath})
+		case metadata.FSTypeFile:
+			item.Actions = append(item.Actions, Action{Kind: ActionCopy, Path: item.TargetPath, Arg: item.SourcePath})
+		case metadata.FSTypeSymlink:
+			item.Actions = append(item.Actions, Action{Kind: ActionSymlink, Path: item.TargetPath, Arg: expected.LinkTarget})
+		default:
+			item.Skipped = fmt.Sprintf("%s items are not repairable", expected.Type)
+			return
+		}
+	}
+
+	planAttributes(item, recreated, func(field string) bool {
+		if field == metadata.FieldXAttrs {
+			return mismatch("length") || mismatch("key") || mismatch("value")
+		}
+		return mismatch(field)
+	})
+}
+
+// hasReason reports whether the mismatch reasons of metadata.Meta.Equals include the attribute.
+func hasReason(reasons, attr string) bool {
+	return slices.Contains(metadata.ReasonNames(reasons), attr)
+}
+
+// WriteFilesFrom writes the paths of the items which have actions relative to the source directory for rsync
+// --files-from --from0. The paths are sorted, the directories end with a slash and every path ends with a NUL byte,
+// so that the names with line breaks are not split.
+func WriteFilesFrom(w io.Writer, items []*Item, opts Options) error {
+	opts, err := absOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.Skipped != "" || len(item.Actions) == 0 {
+			continue
+		}
+
+		rel, _err := filepath.Rel(opts.TargetDir, item.TargetPath)
+		if _err != nil {
+			return _err
+		}
+		rel = filepath.ToSlash(rel)
+		if item.Finding.Item.FileSystem.Type == metadata.FSTypeDir {
+			rel += "/"
+		}
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	bw := bufio.NewWriter(w)
+	for _, path := range paths {
+		if _, err = fmt.Fprintf(bw, "%s\x00", path); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteScript writes a POSIX shell script applying the actions of the items, for the operators to review and run.
+// The items which can not be repaired and the reasons left to the operator are written as comments, with their line
+// breaks replaced so that no value of the report or of the metadata can end a comment.
+// Input:
+// - w: the writer of the script
+// - items: the items planned by PlanFromReasons
+// - reportPath: the error report the items come from, recorded in the header of the script
+func WriteScript(w io.Writer, items []*Item, reportPath string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#!/bin/sh")
+	fmt.Fprintf(bw, "# Generated from the error report %s. Review the commands before running them.\n",
+		oneLine(reportPath))
+	fmt.Fprintln(bw, "set -eu")
+
+	for _, item := range items {
+		fmt.Fprintln(bw)
+		if item.Finding.Item != nil {
+			fmt.Fprintf(bw, "# [%s] %s: %s\n", oneLine(item.Finding.Reason),
+				oneLine(item.Finding.Item.Common.Path), oneLine(item.Finding.Error))
+		} else {
+			fmt.Fprintf(bw, "# [%s] %s\n", oneLine(item.Finding.Reason), oneLine(item.Finding.Error))
+		}
+		if item.Skipped != "" {
+			fmt.Fprintf(bw, "# skipped: %s\n", oneLine(item.Skipped))
+			continue
+		}
+		if hasReason(item.Finding.Error, "links") {
+			fmt.Fprintln(bw, "# the hard links are not restored")
+		}
+
+		for _, action := range item.Actions {
+			for _, command := range scriptCommands(item, action) {
+				fmt.Fprintln(bw, command)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// scriptCommands renders an action as shell commands.
+func scriptCommands(item *Item, action Action) []string {
+	meta := item.Finding.Item
+	path := shellQuote(action.Path)
+	replace := item.Finding.Reason == validator.ReasonMetaMismatch && hasReason(item.Finding.Error, "type")
+
+	switch action.Kind {
+	case ActionMkdir:
+		return []string{"mkdir -p -- " + path}
+	case ActionCopy:
+		commands := []string{"mkdir -p -- " + shellQuote(filepath.Dir(action.Path))}
+		if replace {
+			commands = append(commands, "rm -f -- "+path)
+		}
+		return append(commands, fmt.Sprintf("cp -- %s %s", shellQuote(action.Arg), path))
+	case ActionSymlink:
+		commands := []string{"mkdir -p -- " + shellQuote(filepath.Dir(action.Path))}
+		if replace {
+			commands = append(commands, "rm -f -- "+path)
+		}
+		return append(commands, fmt.Sprintf("ln -sfn -- %s %s", shellQuote(action.Arg), path))
+	case ActionChown:
+		return []string{fmt.Sprintf("chown -h %s -- %s", action.Arg, path)}
+	case ActionChmod:
+		return []string{fmt.Sprintf("chmod %s -- %s", action.Arg, path)}
+	case ActionXAttrs:
+		commands := make([]string, 0, len(meta.ExtendedAttributes)+1)
+		if !hasReason(item.Finding.Error, "length") && item.Finding.Reason == validator.ReasonMetaMismatch {
+			commands = append(commands, "# the extended attributes which are not listed below are left as they are")
+		}
+		for _, xattr := range meta.ExtendedAttributes {
+			commands = append(commands, fmt.Sprintf("setfattr -h -n %s -v 0x%s -- %s",
+				shellQuote(xattr.Key), hex.EncodeToString(xattr.Value), path))
+		}
+		return commands
+	case ActionTouch:
+		return []string{fmt.Sprintf("touch -h -m -d %s -- %s", action.Arg, path)}
+	default:
+		return []string{fmt.Sprintf("# unknown action %s", oneLine(fmt.Sprint(action)))}
+	}
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// oneLine replaces the line breaks of s, so that it fits in a comment.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,131 @@
+package repair
+
+import (
+	"bytes"
+	"encoding/json"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportFromReasons(t *testing.T) {
+	root := t.TempDir()
+	srcDir, dstDir := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("hello\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "it's"), []byte("g"), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dstDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "a", "f"), []byte("hello\n"), 0600))
+	for _, dir := range []string{srcDir, dstDir} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "a", "f"), time.Unix(1600000000, 0), time.Unix(1600000000, 0)))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "a"), time.Unix(1600000000, 0), time.Unix(1600000000, 0)))
+	}
+
+	metaPath := testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "out"))
+	reportPath := filepath.Join(root, "report.txt")
+	validate(t, dstDir, metaPath, reportPath)
+	findings, err := validator.ReadFindings(reportPath)
+	require.NoError(t, err)
+
+	opts := Options{ManifestSourceDir: srcDir, TargetDir: dstDir}
+	items, err := PlanFromReasons(findings, opts)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteFilesFrom(buf, items, opts))
+	require.Equal(t, "a/f\x00a/it's\x00", buf.String())
+
+	// the mode mismatch only needs a chmod, the missing file is copied with all its attributes
+	buf.Reset()
+	require.NoError(t, WriteScript(buf, items, reportPath))
+	script := buf.String()
+	f := filepath.Join(dstDir, "a", "f")
+	require.Contains(t, script, "chmod 0644 -- '"+f+"'\n")
+	require.NotContains(t, script, "cp -- '"+filepath.Join(srcDir, "a", "f")+"'")
+	require.NotContains(t, script, "touch -h -m -d 2020-09-13T12:26:40Z -- '"+f+"'")
+	quoted := "'" + filepath.Join(dstDir, "a", "it") + `'\''s'`
+	require.Contains(t, script, "cp -- '"+filepath.Join(srcDir, "a", "it")+`'\''s' `+quoted+"\n")
+	require.Contains(t, script, "chmod 0600 -- "+quoted+"\n")
+}
+
+func TestExportLineBreaks(t *testing.T) {
+	root := t.TempDir()
+	srcDir, dstDir := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, os.MkdirAll(dstDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a\nrm -rf b"), []byte("hello\n"), 0644))
+
+	metaPath := testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "out"))
+	reportPath := filepath.Join(root, "report\nexit 1")
+	validate(t, dstDir, metaPath, reportPath)
+	findings, err := validator.ReadFindings(reportPath)
+	require.NoError(t, err)
+
+	opts := Options{ManifestSourceDir: srcDir, TargetDir: dstDir}
+	items, err := PlanFromReasons(findings, opts)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteFilesFrom(buf, items, opts))
+	require.Equal(t, "a\nrm -rf b\x00", buf.String())
+
+	// the line breaks of the names only appear in the quoted arguments, never in the comments
+	buf.Reset()
+	require.NoError(t, WriteScript(buf, items, reportPath))
+	for _, line := range strings.Split(buf.String(), "\n") {
+		require.NotEqual(t, "exit 1. Review the commands before running them.", line)
+		require.False(t, strings.HasPrefix(line, "rm -rf b:"), line)
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+	scriptPath := filepath.Join(root, "repair.sh")
+	require.NoError(t, os.WriteFile(scriptPath, buf.Bytes(), 0755))
+	output, err := exec.Command(sh, scriptPath).CombinedOutput()
+	require.NoError(t, err, string(output))
+	content, err := os.ReadFile(filepath.Join(dstDir, "a\nrm -rf b"))
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", string(content))
+}
+
+func TestExportFromReasonsQuotedValues(t *testing.T) {
+	root := t.TempDir()
+	source := &metadata.Meta{
+		Common:             metadata.CommonAttrs{Path: filepath.Join(root, "src", "f"), Name: "f", Size: 1},
+		FileSystem:         &metadata.FileSystemAttrs{Type: metadata.FSTypeFile, Mode: 0644, ModTime: 1600000000},
+		ExtendedAttributes: metadata.ExtendedAttributes{{Key: "user.a", Value: []byte("v")}},
+	}
+	target := *source
+	// a target value which looks like other reasons must not plan their actions
+	target.ExtendedAttributes = metadata.ExtendedAttributes{
+		{Key: "user.a", Value: []byte(`v",size: 1 != 2,mode: -rw-r--r-- != -rwxr-xr-x,length: 1 != 2`)}}
+
+	row, err := json.Marshal(source)
+	require.NoError(t, err)
+	detail := fmt.Sprintf("source: %s, error: %s", row, strings.Join(source.Equals(&target), ","))
+	finding := validator.ParseFinding(validator.ReasonMetaMismatch, detail)
+	require.Equal(t, []string{"value"}, metadata.ReasonNames(finding.Error))
+
+	opts := Options{ManifestSourceDir: filepath.Join(root, "src"), TargetDir: filepath.Join(root, "dst")}
+	items, err := PlanFromReasons([]validator.Finding{finding}, opts)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, []Action{{Kind: ActionXAttrs, Path: filepath.Join(root, "dst", "f"), Arg: "user.a"}},
+		items[0].Actions)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteScript(buf, items, filepath.Join(root, "report.txt")))
+	require.Contains(t, buf.String(), "# the extended attributes which are not listed below are left as they are\n")
+}
@@ -0,0 +1,381 @@
+// Package repair restores the items reported by a validation from the source directory. It plans the actions needed
+// to make each target item match its metadata, applies them, and validates the item again.
+package repair
+
+import (
+	"context"
+	"errors"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of the actions of a repair.
+const (
+	ActionMkdir   = "mkdir"   // create the missing directory
+	ActionCopy    = "copy"    // copy the content from the source
+	ActionSymlink = "symlink" // create the symbolic link
+	ActionChown   = "chown"   // set the owner
+	ActionChmod   = "chmod"   // set the mode bits
+	ActionXAttrs  = "xattrs"  // set the extended attributes and remove the other ones
+	ActionTouch   = "touch"   // set the modification time
+)
+
+// Action is one step of the repair of an item.
+type Action struct {
+	// Kind is the kind of the action, e.g. ActionCopy.
+	Kind string
+
+	// Path is the target path the action applies to.
+	Path string
+
+	// Arg describes the argument of the action, e.g. the source of a copy or the mode of a chmod.
+	Arg string
+}
+
+func (a Action) String() string {
+	if a.Arg == "" {
+		return fmt.Sprintf("%s %s", a.Kind, a.Path)
+	}
+	return fmt.Sprintf("%s %s %s", a.Kind, a.Arg, a.Path)
+}
+
+// Item is the repair of the item of one finding.
+type Item struct {
+	// Finding is the finding the item comes from.
+	Finding validator.Finding
+
+	// SourcePath and TargetPath are the paths of the item in the source and in the target directory.
+	SourcePath string
+	TargetPath string
+
+	// Actions are the planned actions, in the order they are applied.
+	Actions []Action
+
+	// Skipped is the reason why the item can not be repaired. Empty if the actions are planned.
+	Skipped string
+
+	// Remaining are the mismatches found by the validation after the repair. Set by Run.
+	Remaining []string
+
+	// Err is the error which stopped the repair of the item. Set by Run.
+	Err error
+}
+
+// Options configures a repair.
+type Options struct {
+	// ManifestSourceDir is the source directory recorded in the header of the metadata file. The paths of the items
+	// are relative to it.
+	ManifestSourceDir string
+
+	// SourceDir is the directory to copy the content from. ManifestSourceDir if empty.
+	SourceDir string
+
+	// TargetDir is the directory to repair.
+	TargetDir string
+
+	// DryRun only plans the actions without applying them.
+	DryRun bool
+}
+
+// Result counts the items of a repair.
+type Result struct {
+	Planned  int // the items with at least one action
+	Repaired int // the items which match their metadata after the repair
+	Failed   int // the items which failed to be repaired or still mismatch after the repair
+	Skipped  int // the items which can not be repaired
+}
+
+// Plan plans the repair of the items of the findings. Only the FileNotFound, Moved and MetaMismatch findings of source
+// items can be repaired, see repairable. The items are sorted in reverse path order, so that the children of a directory are repaired before
+// the modification time of the directory is set.
+func Plan(findings []validator.Finding, opts Options) ([]*Item, error) {
+	opts, err := absOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(findings))
+	for _, finding := range findings {
+		items = append(items, planItem(finding, opts))
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].TargetPath > items[j].TargetPath })
+	return items, nil
+}
+
+// Run plans and applies the repair of the items of the findings, then validates each repaired item again.
+// Input:
+// - findings: the findings of the validation, see validator.ReadFindings
+// - opts: the options of the repair
+// - onItem: called with every item once it is planned, or once it is repaired if it is not a dry run. Optional
+func Run(ctx context.Context, findings []validator.Finding, opts Options, onItem func(item *Item)) (*Result, error) {
+	items, err := Plan(findings, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, item := range items {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+
+		switch {
+		case item.Skipped != "":
+			result.Skipped++
+		case len(item.Actions) == 0: // the item has been fixed since the validation
+			result.Repaired++
+		default:
+			result.Planned++
+			if !opts.DryRun {
+				repairItem(ctx, item)
+				if item.Err != nil || len(item.Remaining) > 0 {
+					result.Failed++
+				} else {
+					result.Repaired++
+				}
+			}
+		}
+
+		if onItem != nil {
+			onItem(item)
+		}
+	}
+	return result, nil
+}
+
+// absOptions returns the options with absolute directories.
+func absOptions(opts Options) (Options, error) {
+	if opts.ManifestSourceDir == "" || opts.TargetDir == "" {
+		return opts, errors.New("manifest source directory and target directory must be specified")
+	}
+	if opts.SourceDir == "" {
+		opts.SourceDir = opts.ManifestSourceDir
+	}
+
+	var err error
+	for _, dir := range []*string{&opts.ManifestSourceDir, &opts.SourceDir, &opts.TargetDir} {
+		if *dir, err = filepath.Abs(*dir); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// repairable reports whether the findings of the reason can be repaired. A moved item is restored at its path like a
+// missing one, the copy it was moved to is left as it is.
+func repairable(reason string) bool {
+	switch reason {
+	case validator.ReasonFileNotFound, validator.ReasonMoved, validator.ReasonMetaMismatch:
+		return true
+	}
+	return false
+}
+
+// missing reports whether the findings of the reason are about an item which is not at its path in the target.
+func missing(reason string) bool {
+	return reason == validator.ReasonFileNotFound || reason == validator.ReasonMoved
+}
+
+// planItem plans the actions to make the target item of a finding match its metadata. The target is compared with
+// the metadata again, so only the attributes which still mismatch are repaired.
+func planItem(finding validator.Finding, opts Options) *Item {
+	item := &Item{Finding: finding}
+	if !repairable(finding.Reason) {
+		item.Skipped = fmt.Sprintf("%s findings are not repairable", finding.Reason)
+		return item
+	}
+	if finding.Side != validator.SideSource || finding.Item == nil || finding.Item.FileSystem == nil {
+		item.Skipped = "the finding has no source file system metadata"
+		return item
+	}
+
+	rel, err := filepath.Rel(opts.ManifestSourceDir, finding.Item.Common.Path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || rel == ".." {
+		item.Skipped = fmt.Sprintf("the item is outside of the source directory %s", opts.ManifestSourceDir)
+		return item
+	}
+	item.SourcePath = filepath.Join(opts.SourceDir, rel)
+	item.TargetPath = filepath.Join(opts.TargetDir, rel)
+	if err = checkParents(opts.TargetDir, rel); err != nil {
+		item.Skipped = err.Error()
+		return item
+	}
+
+	var current *metadata.Meta
+	if fi, _err := os.Lstat(item.TargetPath); _err == nil {
+		current, _err = metadata.RetrieveFileSystemMeta(item.TargetPath, fi, metadata.RetrieveOptionsFor(finding.Item)...)
+		if _err != nil {
+			item.Skipped = fmt.Sprintf("failed to retrieve the target metadata: %s", _err)
+			return item
+		}
+	} else if !errors.Is(_err, fs.ErrNotExist) {
+		item.Skipped = fmt.Sprintf("failed to stat the target: %s", _err)
+		return item
+	}
+
+	expected := finding.Item.FileSystem
+	if current != nil && current.FileSystem.Type != expected.Type &&
+		(current.FileSystem.Type == metadata.FSTypeDir || expected.Type == metadata.FSTypeDir) {
+		item.Skipped = fmt.Sprintf("the target is a %s instead of a %s", current.FileSystem.Type, expected.Type)
+		return item
+	}
+
+	recreated := true
+	switch expected.Type {
+	case metadata.FSTypeDir:
+		if current == nil {
+			item.Actions = append(item.Actions, Action{Kind: ActionMkdir, Path: item.TargetPath})
+		} else {
+			recreated = false
+		}
+	case metadata.FSTypeFile:
+		if current == nil || current.FileSystem.Type != expected.Type ||
+			(finding.Item.Records(metadata.FieldSize) && current.Common.Size != finding.Item.Common.Size) ||
+			(finding.Item.Records(metadata.FieldHash) && current.Common.Hash != finding.Item.Common.Hash) {
+			item.Actions = append(item.Actions, Action{Kind: ActionCopy, Path: item.TargetPath, Arg: item.SourcePath})
+		} else {
+			recreated = false
+		}
+	case metadata.FSTypeSymlink:
+		if current == nil || current.FileSystem.Type != expected.Type ||
+			(finding.Item.Records(metadata.FieldLinkTarget) && current.FileSystem.LinkTarget != expected.LinkTarget) {
+			item.Actions = append(item.Actions, Action{Kind: ActionSymlink, Path: item.TargetPath, Arg: expected.LinkTarget})
+		} else {
+			recreated = false
+		}
+	default:
+		item.Skipped = fmt.Sprintf("%s items are not repairable", expected.Type)
+		return item
+	}
+
+	planAttributes(item, recreated, func(field string) bool {
+		switch field {
+		case metadata.FieldUID:
+			return current.FileSystem.UID != expected.UID
+		case metadata.FieldGID:
+			return current.FileSystem.GID != expected.GID
+		case metadata.FieldMode:
+			return current.FileSystem.Mode != expected.Mode
+		case metadata.FieldXAttrs:
+			return len(finding.Item.ExtendedAttributes.Equals(current.ExtendedAttributes)) > 0
+		case metadata.FieldModTime:
+			return current.FileSystem.ModTime != expected.ModTime
+		}
+		return false
+	})
+	return item
+}
+
+// planAttributes fills the chown, chmod, xattrs and touch actions of an item. Only the attributes recorded for the
+// item are set, see metadata.Meta.Fields: all of them if the entry is recreated, else the ones which mismatch.
+func planAttributes(item *Item, recreated bool, mismatch func(field string) bool) {
+	meta := item.Finding.Item
+	expected := meta.FileSystem
+	changed := func(field string) bool { return meta.Records(field) && (recreated || mismatch(field)) }
+
+	if changed(metadata.FieldUID) || changed(metadata.FieldGID) {
+		item.Actions = append(item.Actions, Action{Kind: ActionChown, Path: item.TargetPath, Arg: ownerArg(meta)})
+	}
+	if expected.Type != metadata.FSTypeSymlink && changed(metadata.FieldMode) {
+		item.Actions = append(item.Actions, Action{Kind: ActionChmod, Path: item.TargetPath,
+			Arg: fmt.Sprintf("%04o", metadata.UnixMode(expected.Mode))})
+	}
+	if changed(metadata.FieldXAttrs) && (!recreated || len(meta.ExtendedAttributes) > 0) {
+		keys := make([]string, 0, len(meta.ExtendedAttributes))
+		for _, xattr := range meta.ExtendedAttributes {
+			keys = append(keys, xattr.Key)
+		}
+		item.Actions = append(item.Actions, Action{Kind: ActionXAttrs, Path: item.TargetPath, Arg: strings.Join(keys, ",")})
+	}
+	if changed(metadata.FieldModTime) {
+		item.Actions = append(item.Actions, Action{Kind: ActionTouch, Path: item.TargetPath,
+			Arg: time.Unix(int64(expected.ModTime), 0).UTC().Format(time.RFC3339)})
+	}
+}
+
+// owner returns the owner and group to set on the item, -1 for the ones it does not record.
+func owner(meta *metadata.Meta) (uid, gid int) {
+	uid, gid = -1, -1
+	if meta.Records(metadata.FieldUID) {
+		uid = int(meta.FileSystem.UID)
+	}
+	if meta.Records(metadata.FieldGID) {
+		gid = int(meta.FileSystem.GID)
+	}
+	return uid, gid
+}
+
+// ownerArg returns the owner argument of a chown command for the item, e.g. "1000:100", or ":100" if it only records
+// the group.
+func ownerArg(meta *metadata.Meta) string {
+	uid, gid := owner(meta)
+	switch {
+	case uid >= 0 && gid >= 0:
+		return fmt.Sprintf("%d:%d", uid, gid)
+	case uid >= 0:
+		return fmt.Sprint(uid)
+	}
+	return fmt.Sprintf(":%d", gid)
+}
+
+// checkParents checks that the existing parents of the item below the target directory are directories, since the
+// actions would follow a symbolic link in a parent out of the target directory. The parents which do not exist are
+// created as directories by the actions.
+// Input:
+// - targetDir: the absolute target directory
+// - rel: the path of the item relative to the target directory
+func checkParents(targetDir, rel string) error {
+	parent := targetDir
+	for _, name := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if name == "." {
+			break
+		}
+		parent = filepath.Join(parent, name)
+
+		fi, err := os.Lstat(parent)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat the target parent: %w", err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("the target parent %s is not a directory", parent)
+		}
+	}
+	return nil
+}
+
+// repairItem applies the actions of an item and validates it again.
+func repairItem(ctx context.Context, item *Item) {
+	for _, action := range item.Actions {
+		if item.Err = applyAction(ctx, item, action); item.Err != nil {
+			slog.Warn("Failed to repair item:",
+				slog.String("TargetPath", item.TargetPath),
+				slog.String("Action", action.Kind),
+				slog.Any("Error", item.Err),
+			)
+			return
+		}
+	}
+
+	fi, err := os.Lstat(item.TargetPath)
+	if err != nil {
+		item.Err = err
+		return
+	}
+	current, err := metadata.RetrieveFileSystemMeta(item.TargetPath, fi, metadata.WithContext(ctx))
+	if err != nil {
+		item.Err = err
+		return
+	}
+	item.Remaining = item.Finding.Item.Equals(current)
+}
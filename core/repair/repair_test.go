@@ -0,0 +1,207 @@
+package repair
+
+import (
+	"context"
+	"file-clone-validator/core/checksum"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/mtree"
+	"file-clone-validator/core/utils"
+	"file-clone-validator/core/validator"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunRepairsTextReport(t *testing.T) {
+	root := t.TempDir()
+	srcDir, dstDir := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("hello\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "g"), []byte("g"), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dstDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "a", "f"), []byte("hello\n"), 0644))
+	for _, dir := range []string{srcDir, dstDir} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "a", "f"), time.Unix(1600000000, 0), time.Unix(1600000000, 0)))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "a"), time.Unix(1600000000, 0), time.Unix(1600000000, 0)))
+	}
+	require.NoError(t, os.Chmod(filepath.Join(dstDir, "a", "f"), 0600))
+
+	// validate the target with a text report
+	metaPath := testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "out"))
+	reportPath := filepath.Join(root, "report.txt")
+	require.Equal(t, map[string]uint64{validator.ReasonFileNotFound: 1, validator.ReasonMetaMismatch: 1},
+		validate(t, dstDir, metaPath, reportPath))
+
+	findings, err := validator.ReadFindings(reportPath)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	opts := Options{ManifestSourceDir: srcDir, TargetDir: dstDir}
+
+	dryRun := opts
+	dryRun.DryRun = true
+	result, err := Run(context.Background(), findings, dryRun, nil)
+	require.NoError(t, err)
+	require.Equal(t, &Result{Planned: 2}, result)
+	_, err = os.Stat(filepath.Join(dstDir, "a", "g"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	result, err = Run(context.Background(), findings, opts, nil)
+	require.NoError(t, err)
+	require.Equal(t, &Result{Planned: 2, Repaired: 2}, result)
+	require.Empty(t, validate(t, dstDir, metaPath, reportPath))
+}
+
+func TestRunRepairsMovedItem(t *testing.T) {
+	root := t.TempDir()
+	srcDir, dstDir := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, os.MkdirAll(dstDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "f"), []byte("hello\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "g"), []byte("hello\n"), 0644))
+	for _, dir := range []string{srcDir, dstDir} {
+		require.NoError(t, os.Chtimes(dir, time.Unix(1600000000, 0), time.Unix(1600000000, 0)))
+	}
+
+	metaPath := testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "out"))
+	reportPath := filepath.Join(root, "report.txt")
+	reporter, err := validator.NewReporter(reportPath)
+	require.NoError(t, err)
+	v, err := validator.NewFileValidator(dstDir, reporter, validator.WithExtraItems())
+	require.NoError(t, err)
+	require.NoError(t, v.Validate(context.Background(), metaPath, 2))
+	reporter.Flush()
+	require.Equal(t, map[string]uint64{validator.ReasonMoved: 1}, reporter.Counts())
+
+	// the moved item is restored at its path, its copy is left as it is
+	findings, err := validator.ReadFindings(reportPath)
+	require.NoError(t, err)
+	result, err := Run(context.Background(), findings, Options{ManifestSourceDir: srcDir, TargetDir: dstDir}, nil)
+	require.NoError(t, err)
+	require.Equal(t, &Result{Planned: 1, Repaired: 1}, result)
+	require.FileExists(t, filepath.Join(dstDir, "g"))
+	require.Empty(t, validate(t, dstDir, metaPath, reportPath))
+}
+
+func TestRunSkipsItemsUnderSymlinkedParents(t *testing.T) {
+	root := t.TempDir()
+	srcDir, dstDir, outsideDir := filepath.Join(root, "src"), filepath.Join(root, "dst"), filepath.Join(root, "outside")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("hello\n"), 0644))
+	require.NoError(t, os.MkdirAll(dstDir, 0755))
+	require.NoError(t, os.MkdirAll(outsideDir, 0755))
+	require.NoError(t, os.Symlink(outsideDir, filepath.Join(dstDir, "a")))
+
+	metaPath := testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "out"))
+	reportPath := filepath.Join(root, "report.txt")
+	require.Equal(t, map[string]uint64{validator.ReasonFileNotFound: 1, validator.ReasonMetaMismatch: 1},
+		validate(t, dstDir, metaPath, reportPath))
+
+	// a is a type mismatch, and a/f must not be written through the symbolic link out of the target
+	findings, err := validator.ReadFindings(reportPath)
+	require.NoError(t, err)
+	var skipped []string
+	result, err := Run(context.Background(), findings, Options{ManifestSourceDir: srcDir, TargetDir: dstDir},
+		func(item *Item) { skipped = append(skipped, item.Skipped) })
+	require.NoError(t, err)
+	require.Equal(t, &Result{Skipped: 2}, result)
+	require.Contains(t, skipped, "the target parent "+filepath.Join(dstDir, "a")+" is not a directory")
+
+	entries, err := os.ReadDir(outsideDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+// validate validates the target directory and returns the findings by reason.
+func validate(t *testing.T, dstDir, metaPath, reportPath string) map[string]uint64 {
+	reporter, err := validator.NewReporter(reportPath)
+	require.NoError(t, err)
+	v, err := validator.NewFileValidator(dstDir, reporter)
+	require.NoError(t, err)
+	require.NoError(t, v.Validate(context.Background(), metaPath, 2))
+	reporter.Flush()
+	return reporter.Counts()
+}
+
+func TestPlanImportedManifest(t *testing.T) {
+	root := t.TempDir()
+	srcDir, dstDir := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	require.NoError(t, os.MkdirAll(dstDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "g"), []byte("hello\n"), 0600))
+	require.NoError(t, os.Chtimes(filepath.Join(dstDir, "g"), time.Unix(1600000000, 0), time.Unix(1600000000, 0)))
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "f"), []byte("hello\n"), 0644))
+
+	// the spec records neither the owner nor the modification time
+	var items []*metadata.Meta
+	spec := "#mtree\n/set type=file mode=0640\nf size=6\ng size=6\n"
+	require.NoError(t, mtree.Read(strings.NewReader(spec), srcDir, func(item *metadata.Meta) error {
+		items = append(items, item)
+		return nil
+	}))
+	require.Len(t, items, 2)
+	fi, err := os.Lstat(filepath.Join(dstDir, "g"))
+	require.NoError(t, err)
+	current, err := metadata.RetrieveFileSystemMeta(filepath.Join(dstDir, "g"), fi)
+	require.NoError(t, err)
+	findings := []validator.Finding{
+		{Reason: validator.ReasonFileNotFound, Side: validator.SideSource, Item: items[0]},
+		{Reason: validator.ReasonMetaMismatch, Side: validator.SideSource, Item: items[1],
+			Error: strings.Join(items[1].Equals(current), ",")},
+	}
+	require.Equal(t, "mode: -rw-r----- != -rw-------", findings[1].Error)
+
+	f, g := filepath.Join(dstDir, "f"), filepath.Join(dstDir, "g")
+	expected := [][]Action{
+		{{Kind: ActionChmod, Path: g, Arg: "0640"}},
+		{{Kind: ActionCopy, Path: f, Arg: filepath.Join(srcDir, "f")}, {Kind: ActionChmod, Path: f, Arg: "0640"}},
+	}
+	opts := Options{ManifestSourceDir: srcDir, TargetDir: dstDir}
+	for _, plan := range []func([]validator.Finding, Options) ([]*Item, error){Plan, PlanFromReasons} {
+		planned, _err := plan(findings, opts)
+		require.NoError(t, _err)
+		require.Len(t, planned, 2)
+		require.Equal(t, expected, [][]Action{planned[0].Actions, planned[1].Actions})
+	}
+
+	result, err := Run(context.Background(), findings, opts, nil)
+	require.NoError(t, err)
+	require.Equal(t, &Result{Planned: 2, Repaired: 2}, result)
+	fi, err = os.Stat(g)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1600000000, 0), fi.ModTime(), "the modification time is not recorded")
+}
+
+func TestPlanChecksumImport(t *testing.T) {
+	root := t.TempDir()
+	srcDir, dstDir := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	require.NoError(t, os.MkdirAll(dstDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "f"), []byte("hullo\n"), 0600))
+
+	// a checksum list only records the names and the hashes, the other attributes of its items are zero
+	f, err := checksum.NewMeta(srcDir, "f", utils.HashMD5, "b1946ac92492d2347c6235b4d2611184")
+	require.NoError(t, err)
+	g, err := checksum.NewMeta(srcDir, "g", utils.HashMD5, "b1946ac92492d2347c6235b4d2611184")
+	require.NoError(t, err)
+	fi, err := os.Lstat(filepath.Join(dstDir, "f"))
+	require.NoError(t, err)
+	current, err := metadata.RetrieveFileSystemMeta(filepath.Join(dstDir, "f"), fi)
+	require.NoError(t, err)
+	findings := []validator.Finding{
+		{Reason: validator.ReasonMetaMismatch, Side: validator.SideSource, Item: f, Error: strings.Join(f.Equals(current), ",")},
+		{Reason: validator.ReasonFileNotFound, Side: validator.SideSource, Item: g},
+	}
+
+	opts := Options{ManifestSourceDir: srcDir, TargetDir: dstDir}
+	for _, plan := range []func([]validator.Finding, Options) ([]*Item, error){Plan, PlanFromReasons} {
+		planned, _err := plan(findings, opts)
+		require.NoError(t, _err)
+		require.Len(t, planned, 2)
+		for _, item := range planned {
+			require.Equal(t, []Action{{Kind: ActionCopy, Path: item.TargetPath, Arg: item.SourcePath}}, item.Actions)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Algorithm is the signature algorithm: Ed25519ph (RFC 8032) over the SHA-512 digest of the file, so that files
+// larger than the memory can be signed.
+const Algorithm = "ed25519ph"
+
+// Suffix is appended to the path of a signed file to get the path of its detached signature.
+const Suffix = ".sig"
+
+var (
+	// ErrUnsigned is returned by VerifyFile when the file has no detached signature.
+	ErrUnsigned = errors.New("file is not signed")
+
+	// ErrInvalidSignature is returned by VerifyFile when the signature does not match the file or the key.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Signature is the content of a detached signature file.
+type Signature struct {
+	// Algorithm is the signature algorithm, see Algorithm.
+	Algorithm string
+
+	// KeyID is the hex-encoded SHA-256 of the public key, to tell which key signed the file.
+	KeyID string
+
+	// Signature is the signature of the SHA-512 digest of the file.
+	Signature []byte
+}
+
+// GenerateKey generates a new key pair and writes it to PEM files. The private key is only readable by the owner.
+// Input:
+// - publicKeyPath: the path to write the PKIX public key to
+// - privateKeyPath: the path to write the PKCS #8 private key to
+func GenerateKey(publicKeyPath, privateKeyPath string) error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	if err = writePEM(privateKeyPath, "PRIVATE KEY", privateDER, 0600); err != nil {
+		return err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	return writePEM(publicKeyPath, "PUBLIC KEY", publicDER, 0644)
+}
+
+// LoadPrivateKey loads an Ed25519 private key from a PKCS #8 PEM file.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an ed25519 key", path)
+	}
+	return privateKey, nil
+}
+
+// LoadPublicKey loads an Ed25519 public key from a PKIX PEM file.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an ed25519 key", path)
+	}
+	return publicKey, nil
+}
+
+// SignFile signs the file and writes the detached signature next to it, at path + Suffix.
+func SignFile(path string, privateKey ed25519.PrivateKey) error {
+	digest, err := digestFile(path, io.Discard)
+	if err != nil {
+		return err
+	}
+
+	sig, err := privateKey.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&Signature{
+		Algorithm: Algorithm,
+		KeyID:     KeyID(privateKey.Public().(ed25519.PublicKey)),
+		Signature: sig,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+Suffix, append(data, '\n'), 0644)
+}
+
+// VerifyFile verifies the detached signature of the file at path + Suffix. It returns ErrUnsigned if there is no
+// signature, and ErrInvalidSignature if the file was modified or signed by another key.
+func VerifyFile(path string, publicKey ed25519.PublicKey) error {
+	return VerifyCopy(path, publicKey, io.Discard)
+}
+
+// VerifyCopy verifies the detached signature of the file like VerifyFile, and copies the content it reads to w. The
+// file is read once, so the copy holds the verified bytes even if the file is replaced during or after the
+// verification.
+// Input:
+// - path: the signed file
+// - publicKey: the key the file must be signed by
+// - w: receives the content of the file. It is only complete and verified if VerifyCopy returns nil
+func VerifyCopy(path string, publicKey ed25519.PublicKey, w io.Writer) error {
+	data, err := os.ReadFile(path + Suffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrUnsigned
+	}
+	if err != nil {
+		return err
+	}
+
+	sig := &Signature{}
+	if err = json.Unmarshal(data, sig); err != nil {
+		return fmt.Errorf("%w: failed to parse %s: %s", ErrInvalidSignature, path+Suffix, err.Error())
+	}
+
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidSignature, sig.Algorithm)
+	}
+
+	if keyID := KeyID(publicKey); sig.KeyID != keyID {
+		return fmt.Errorf("%w: signed by key %s, expect key %s", ErrInvalidSignature, sig.KeyID, keyID)
+	}
+
+	digest, err := digestFile(path, w)
+	if err != nil {
+		return err
+	}
+
+	if err = ed25519.VerifyWithOptions(publicKey, digest, sig.Signature, &ed25519.Options{Hash: crypto.SHA512}); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err.Error())
+	}
+	return nil
+}
+
+// KeyID returns the hex-encoded SHA-256 of the public key.
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:])
+}
+
+// digestFile returns the SHA-512 digest of the file, and copies the content it digests to w.
+func digestFile(path string, w io.Writer) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha512.New()
+	if _, err = io.Copy(io.MultiWriter(hash, w), file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return pem.Encode(file, &pem.Block{Type: blockType, Bytes: der})
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM %s block", path, blockType)
+	}
+	return block.Bytes, nil
+}
@@ -0,0 +1,35 @@
+package signature
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignAndVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	publicKeyPath, privateKeyPath := filepath.Join(dir, "key.pub"), filepath.Join(dir, "key")
+	require.NoError(t, GenerateKey(publicKeyPath, privateKeyPath))
+
+	privateKey, err := LoadPrivateKey(privateKeyPath)
+	require.NoError(t, err)
+	publicKey, err := LoadPublicKey(publicKeyPath)
+	require.NoError(t, err)
+
+	metaPath := filepath.Join(dir, "meta.out")
+	require.NoError(t, os.WriteFile(metaPath, []byte("{\"SourceDir\":\"/src\",\"ItemCount\":0}\n"), 0644))
+	require.ErrorIs(t, VerifyFile(metaPath, publicKey), ErrUnsigned)
+
+	require.NoError(t, SignFile(metaPath, privateKey))
+	require.NoError(t, VerifyFile(metaPath, publicKey))
+
+	// the copy holds the verified bytes
+	var verified bytes.Buffer
+	require.NoError(t, VerifyCopy(metaPath, publicKey, &verified))
+	require.Equal(t, "{\"SourceDir\":\"/src\",\"ItemCount\":0}\n", verified.String())
+
+	require.NoError(t, os.WriteFile(metaPath, []byte("{\"SourceDir\":\"/src\",\"ItemCount\":1}\n"), 0644))
+	require.ErrorIs(t, VerifyFile(metaPath, publicKey), ErrInvalidSignature)
+}
@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+)
+
+// DialOptions configures Dial.
+type DialOptions struct {
+	// Token is the shared secret of the generator.
+	Token string
+
+	// TLS connects with TLS if it is set, see ClientTLSConfig.
+	TLS *tls.Config
+}
+
+// Reader reads the rows of a streamed metadata file, see Accept. It implements validator.RowReader.
+type Reader struct {
+	addr   string
+	sc     *conn
+	header datasource.MetaHeader
+	rows   []json.RawMessage
+	done   bool
+	stop   func() bool
+}
+
+// Dial connects to a generator serving its metadata and reads the header.
+// Input:
+// - addr: the address of the generator, e.g. "10.0.0.1:7071", see ParseAddress
+func Dial(ctx context.Context, addr string, opts DialOptions) (*Reader, error) {
+	var nc net.Conn
+	var err error
+	if opts.TLS != nil {
+		dialer := &tls.Dialer{Config: opts.TLS}
+		nc, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		nc, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to generator: %w", err)
+	}
+	r := &Reader{addr: addr, sc: newConn(nc, maxMessageSize)}
+	r.stop = context.AfterFunc(ctx, func() { r.sc.Close() }) // unblock the reads when the context is done
+
+	if err = r.sc.send(&message{Type: msgHello, Token: opts.Token}); err != nil {
+		r.Close()
+		return nil, err
+	}
+	msg, err := r.sc.receive()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to receive header: %w", err)
+	}
+	if msg.Type == msgError {
+		r.Close()
+		return nil, fmt.Errorf("rejected by generator: %s", msg.Error)
+	}
+	if msg.Type != msgHeader || msg.Header == nil {
+		r.Close()
+		return nil, fmt.Errorf("unexpected message from generator: %s", msg.Type)
+	}
+	r.header = *msg.Header
+
+	slog.Info("Connected to generator:", slog.String("Addr", addr), slog.String("SourceDir", r.header.SourceDir))
+	return r, nil
+}
+
+// Header returns the header of the metadata. Its item count is only known once Next returned io.EOF.
+func (r *Reader) Header() datasource.MetaHeader {
+	return r.header
+}
+
+// Next returns the next row, or io.EOF when the generator has sent every row.
+func (r *Reader) Next() ([]byte, error) {
+	for len(r.rows) == 0 {
+		if r.done {
+			return nil, io.EOF
+		}
+
+		msg, err := r.sc.receive()
+		if errors.Is(err, net.ErrClosed) {
+			return nil, fmt.Errorf("the stream of %s ended before its last row: %w", r.addr, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive rows: %w", err)
+		}
+
+		switch msg.Type {
+		case msgRows:
+			r.rows = msg.Rows
+		case msgDone:
+			r.header.ItemCount = msg.Count
+			r.done = true
+		case msgError:
+			return nil, fmt.Errorf("generator failed: %s", msg.Error)
+		default:
+			return nil, fmt.Errorf("unexpected message from generator: %s", msg.Type)
+		}
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+// Close closes the connection.
+func (r *Reader) Close() error {
+	r.stop()
+	return r.sc.Close()
+}
@@ -0,0 +1,161 @@
+package stream
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// helloTimeout is the time a connection has to present its token.
+const helloTimeout = 10 * time.Second
+
+// BatchSize is the largest number of rows sent in one message. The channel passed to Sender.Send should have this
+// capacity, so that the rows waiting in it are sent together.
+const BatchSize = 256
+
+// Sender streams the metadata of a generate run to one validator.
+type Sender struct {
+	sc    *conn
+	count uint64
+}
+
+// Accept waits for the first validator which connects to the listener with the token and sends it the header, the
+// other connections are rejected. The listener is closed when Accept returns.
+// Input:
+// - ln: the listener to accept the validator on. Wrap it with tls.NewListener for TLS
+// - token: the shared secret the validator must present. Any validator is accepted if it is empty
+// - header: the header of the metadata. Its item count is sent by Finish
+// Note:
+// - The hello of every connection is received by its own goroutine, so that a client which is slow to present its
+// token does not hold back the others
+func Accept(ctx context.Context, ln net.Listener, token string, header datasource.MetaHeader) (*Sender, error) {
+	defer ln.Close()
+	// cancel closes the connections which are still presenting their token when Accept returns
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	context.AfterFunc(ctx, func() { ln.Close() }) // unblock Accept when the context is done
+
+	slog.Info("Start to serve manifest, waiting for a validator:", slog.String("Addr", ln.Addr().String()))
+	acceptedC := make(chan *conn)
+	errC := make(chan error, 1)
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				errC <- err
+				return
+			}
+			go handshake(ctx, newConn(nc, maxHelloSize), token, acceptedC)
+		}
+	}()
+
+	var sc *conn
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err := <-errC:
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to accept validator: %w", err)
+	case sc = <-acceptedC:
+	}
+
+	header.ItemCount = 0
+	if err := sc.send(&message{Type: msgHeader, Header: &header}); err != nil {
+		sc.Close()
+		return nil, fmt.Errorf("failed to send header: %w", err)
+	}
+	slog.Info("Validator connected:", slog.String("Addr", sc.RemoteAddr().String()))
+	return &Sender{sc: sc}, nil
+}
+
+// handshake receives the hello of a connection and hands it to Accept if it presents the token, the connection is
+// closed otherwise, or when Accept returned before.
+func handshake(ctx context.Context, sc *conn, token string, acceptedC chan<- *conn) {
+	stop := context.AfterFunc(ctx, func() { sc.Close() }) // unblock the hello when Accept returns
+	sc.SetReadDeadline(time.Now().Add(helloTimeout))
+	hello, err := sc.receive()
+	if err != nil || hello.Type != msgHello {
+		slog.Warn("Reject validator without hello:", slog.String("Addr", sc.RemoteAddr().String()),
+			slog.Any("Error", err))
+		stop()
+		sc.Close()
+		return
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(hello.Token), []byte(token)) != 1 {
+		slog.Warn("Reject validator with invalid token:", slog.String("Addr", sc.RemoteAddr().String()))
+		stop()
+		sc.send(&message{Type: msgError, Error: "invalid token"})
+		sc.Close()
+		return
+	}
+	sc.SetReadDeadline(time.Time{})
+
+	if !stop() { // Accept returned and the connection is closed
+		return
+	}
+	select {
+	case acceptedC <- sc:
+	case <-ctx.Done(): // another validator was accepted
+		sc.Close()
+	}
+}
+
+// Send sends the metadata to the validator as soon as it is received, in batches when the validator is slower than
+// the generation, until the channel is closed.
+func (s *Sender) Send(ctx context.Context, in <-chan *metadata.Meta) error {
+	stop := context.AfterFunc(ctx, func() { s.sc.Close() }) // unblock the writes when the context is done
+	defer stop()
+
+	rows := make([]json.RawMessage, 0, BatchSize)
+	for {
+		meta, ok := <-in
+		if ok {
+			row, err := metadata.Serialise(meta)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		// send the batch when it is full, or when no other row is ready so that the validator does not wait
+		if len(rows) > 0 && (!ok || len(rows) == BatchSize || len(in) == 0) {
+			if err := s.sc.send(&message{Type: msgRows, Rows: rows}); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("failed to send rows: %w", err)
+			}
+			s.count += uint64(len(rows))
+			rows = rows[:0]
+		}
+		if !ok {
+			return nil
+		}
+	}
+}
+
+// Finish ends the stream and closes the connection. The validator receives the number of rows sent if the generation
+// succeeded, or its error otherwise, so that a partial stream is never taken for a complete one.
+// Input:
+// - err: the error of the generation, nil if it succeeded
+func (s *Sender) Finish(err error) error {
+	defer s.sc.Close()
+	if err != nil {
+		s.sc.send(&message{Type: msgError, Error: err.Error()})
+		return nil
+	}
+
+	if err = s.sc.send(&message{Type: msgDone, Count: s.count}); err != nil {
+		return fmt.Errorf("failed to send done: %w", err)
+	}
+	slog.Info("Finish to serve manifest:", slog.String("Validator", s.sc.RemoteAddr().String()),
+		slog.Uint64("ItemCount", s.count))
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package stream sends the metadata of a generate run over a TCP connection as it is produced, so that a validation
+// on another host can start before the metadata file is written and copied.
+//
+// The messages are json objects, one per line, optionally over TLS:
+// - validator -> generator: hello, with the shared token
+// - generator -> validator: header, then batches of rows, then done with the number of rows
+package stream
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Scheme is the prefix of the address of a streamed metadata file, e.g. tcp://10.0.0.1:7071.
+const Scheme = "tcp://"
+
+// Message types of the protocol.
+const (
+	msgHello  = "hello"
+	msgHeader = "header"
+	msgRows   = "rows"
+	msgDone   = "done"
+	msgError  = "error"
+)
+
+// maxMessageSize is the largest message accepted by a validator.
+const maxMessageSize = 256 << 20
+
+// maxHelloSize is the largest message accepted by a generator, which only receives the hello before it is
+// authenticated.
+const maxHelloSize = 4 << 10
+
+// message is the envelope of all the messages of the protocol. Only the fields of its type are set.
+type message struct {
+	Type string
+
+	// hello
+	Token string `json:",omitempty"`
+
+	// header. Its item count is not known yet, see done
+	Header *datasource.MetaHeader `json:",omitempty"`
+
+	// rows
+	Rows []json.RawMessage `json:",omitempty"`
+
+	// done
+	Count uint64 `json:",omitempty"`
+
+	// error
+	Error string `json:",omitempty"`
+}
+
+// conn reads and writes messages on a connection. Writes are safe for concurrent use, reads are not.
+type conn struct {
+	net.Conn
+	scanner *bufio.Scanner
+	mu      sync.Mutex
+}
+
+// newConn returns the conn of a connection which accepts the messages up to maxSize bytes.
+func newConn(c net.Conn, maxSize int) *conn {
+	scanner := bufio.NewScanner(c)
+	scanner.Buffer(make([]byte, 0, min(64<<10, maxSize)), maxSize)
+	return &conn{Conn: c, scanner: scanner}
+}
+
+func (c *conn) send(msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.Write(append(data, '\n'))
+	return err
+}
+
+func (c *conn) receive() (*message, error) {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, net.ErrClosed
+	}
+
+	msg := &message{}
+	if err := json.Unmarshal(c.scanner.Bytes(), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ParseAddress returns the host:port of the address of a streamed metadata file, and whether it is one.
+func ParseAddress(s string) (addr string, ok bool) {
+	if !strings.HasPrefix(s, Scheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(s, Scheme), true
+}
+
+// ServerTLSConfig loads the certificate of the generator.
+// Input:
+// - certPath: the PEM encoded certificate chain
+// - keyPath: the PEM encoded private key of the certificate
+func ServerTLSConfig(certPath, keyPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// ClientTLSConfig returns the TLS configuration of the validator.
+// Input:
+// - caPath: the PEM encoded certificates which sign the certificate of the generator. The system roots if empty
+func ClientTLSConfig(caPath string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caPath == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS CA: %w", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in TLS CA %s", caPath)
+	}
+	return config, nil
+}
@@ -0,0 +1,162 @@
+package stream_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/stream"
+	"file-clone-validator/core/utils"
+	"file-clone-validator/pkg/clonevalidator"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamGenerateToValidate(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	for i := 0; i < 600; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("f%03d", i)), []byte{byte(i)}, 0644))
+	}
+
+	serverTLS, clientTLS := selfSignedTLS(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := stream.Scheme + ln.Addr().String()
+
+	generated := make(chan error, 1)
+	go func() {
+		_, _err := clonevalidator.Generate(context.Background(), clonevalidator.GenerateOptions{
+			SourceDir:        srcDir,
+			OutputDir:        outDir,
+			ManifestListener: tls.NewListener(ln, serverTLS),
+			StreamToken:      "secret",
+		})
+		generated <- _err
+	}()
+
+	// a validator with a wrong token is rejected, and the generator keeps waiting
+	_, err = clonevalidator.Validate(context.Background(), clonevalidator.ValidateOptions{
+		TargetDir:    srcDir,
+		MetaFilePath: addr,
+		StreamToken:  "wrong",
+		StreamTLS:    clientTLS,
+	})
+	require.ErrorContains(t, err, "invalid token")
+
+	validated, err := clonevalidator.Validate(context.Background(), clonevalidator.ValidateOptions{
+		TargetDir:    srcDir,
+		MetaFilePath: addr,
+		StreamToken:  "secret",
+		StreamTLS:    clientTLS,
+	})
+	require.NoError(t, err)
+	require.True(t, validated.Passed())
+	require.NoError(t, <-generated)
+
+	// the metadata file is written as well
+	header, err := datasource.ReadMetaHeader(filepath.Join(outDir, utils.GetOutputFileName()))
+	require.NoError(t, err)
+	require.Equal(t, uint64(600), header.ItemCount)
+}
+
+func TestStreamReportsFailedGeneration(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	accepted := make(chan *stream.Sender, 1)
+	go func() {
+		sender, _ := stream.Accept(context.Background(), ln, "", datasource.MetaHeader{SourceDir: "/src"})
+		accepted <- sender
+	}()
+
+	r, err := stream.Dial(context.Background(), ln.Addr().String(), stream.DialOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, "/src", r.Header().SourceDir)
+
+	sender := <-accepted
+	require.NotNil(t, sender)
+	in := make(chan *metadata.Meta)
+	close(in)
+	require.NoError(t, sender.Send(context.Background(), in))
+	require.NoError(t, sender.Finish(errors.New("disk failure")))
+
+	_, err = r.Next()
+	require.ErrorContains(t, err, "generator failed: disk failure")
+}
+
+func TestStreamAcceptsDespiteSlowClients(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	accepted := make(chan *stream.Sender, 1)
+	go func() {
+		sender, _ := stream.Accept(context.Background(), ln, "secret", datasource.MetaHeader{SourceDir: "/src"})
+		accepted <- sender
+	}()
+
+	// a client which never sends its hello does not hold back the others
+	silent, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer silent.Close()
+
+	// a hello larger than a few KiB is rejected before it is read
+	large, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer large.Close()
+	_, err = large.Write([]byte(`{"Type":"hello","Token":"` + strings.Repeat("x", 64<<10) + `"}` + "\n"))
+	require.NoError(t, err)
+	large.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = large.Read(make([]byte, 1))
+	require.Error(t, err) // closed by the generator, not timed out
+	require.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := stream.Dial(ctx, ln.Addr().String(), stream.DialOptions{Token: "secret"})
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, "/src", r.Header().SourceDir)
+	sender := <-accepted
+	require.NotNil(t, sender)
+	require.NoError(t, sender.Finish(errors.New("stopped")))
+}
+
+// selfSignedTLS returns the TLS configurations of a generator with a self-signed certificate for 127.0.0.1 and of a
+// validator trusting it.
+func selfSignedTLS(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "generator"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{RootCAs: pool}
+	return server, client
+}
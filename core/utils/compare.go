@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// CompareChunkSize is the size of the chunks CompareReaders reads from both sides at once.
+const CompareChunkSize = 1 << 20
+
+// CompareFiles compares the content of two files byte for byte, see CompareReaders. The files are opened through
+// DefaultLimiter.
+func CompareFiles(ctx context.Context, pathA, pathB string) (offset int64, equal bool, err error) {
+	if err = DefaultLimiter.WaitFile(ctx); err != nil {
+		return 0, false, err
+	}
+	fileA, err := os.Open(pathA)
+	if err != nil {
+		return 0, false, err
+	}
+	defer fileA.Close()
+	fileB, err := os.Open(pathB)
+	if err != nil {
+		return 0, false, err
+	}
+	defer fileB.Close()
+
+	return CompareReaders(ctx, fileA, fileB)
+}
+
+// compareBuffers recycles the chunk buffers of CompareReaders, so that comparing many small files does not allocate two
+// chunks per file.
+var compareBuffers = sync.Pool{New: func() any {
+	buf := make([]byte, CompareChunkSize)
+	return &buf
+}}
+
+// compareChunk is a chunk read from the second reader of CompareReaders.
+type compareChunk struct {
+	n   int
+	err error
+}
+
+// CompareReaders compares the content of two readers byte for byte and stops at the first difference. The next chunk
+// of both readers is read in parallel, through DefaultLimiter, and the bytes are counted like the hashed ones.
+// Input:
+// - a, b: the contents to compare
+// Output:
+// - offset: the offset of the first differing byte. It is the length of the shorter content if it is a prefix of the
+// other one, and the length of the contents if they are equal
+// - equal: whether the contents are equal
+// Note:
+// - The chunks of b are read by one goroutine for the whole comparison, while the chunks of a are read by the caller
+func CompareReaders(ctx context.Context, a, b io.Reader) (offset int64, equal bool, err error) {
+	a = DefaultLimiter.Reader(ctx, &countingReader{r: a})
+	b = DefaultLimiter.Reader(ctx, &countingReader{r: b})
+	ptrA, ptrB := compareBuffers.Get().(*[]byte), compareBuffers.Get().(*[]byte)
+	defer compareBuffers.Put(ptrA)
+	defer compareBuffers.Put(ptrB)
+	bufA, bufB := *ptrA, *ptrB
+
+	readC, chunkC := make(chan struct{}), make(chan compareChunk)
+	defer close(readC) // every read is waited for, so the goroutine is idle and no longer uses bufB
+	go func() {
+		for range readC {
+			n, _err := readChunk(b, bufB)
+			chunkC <- compareChunk{n: n, err: _err}
+		}
+	}()
+
+	for {
+		readC <- struct{}{}
+		nA, errA := readChunk(a, bufA)
+		chunkB := <-chunkC
+		if errA != nil {
+			return offset, false, errA
+		}
+		if chunkB.err != nil {
+			return offset, false, chunkB.err
+		}
+
+		nB := chunkB.n
+		n := min(nA, nB)
+		if !bytes.Equal(bufA[:n], bufB[:n]) {
+			for i := 0; i < n; i++ {
+				if bufA[i] != bufB[i] {
+					return offset + int64(i), false, nil
+				}
+			}
+		}
+		offset += int64(n)
+		if nA != nB {
+			return offset, false, nil
+		}
+		if nA < CompareChunkSize { // both readers are at io.EOF
+			return offset, true, nil
+		}
+	}
+}
+
+// readChunk fills buf from r, or reads until io.EOF if r is shorter.
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, nil
+	}
+	return n, err
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCompareReaders(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), CompareChunkSize/5) // two chunks
+	changed := bytes.Clone(data)
+	changed[CompareChunkSize+3] = 'x'
+
+	for _, c := range []struct {
+		a, b   []byte
+		offset int64
+		equal  bool
+	}{
+		{data, data, int64(len(data)), true},
+		{nil, nil, 0, true},
+		{data, changed, CompareChunkSize + 3, false},
+		{data[:10], data, 10, false},
+		{data, data[:CompareChunkSize], CompareChunkSize, false},
+		{[]byte("abc"), []byte("abd"), 2, false},
+	} {
+		offset, equal, err := CompareReaders(context.Background(), bytes.NewReader(c.a), bytes.NewReader(c.b))
+		require.NoError(t, err)
+		require.Equal(t, c.offset, offset)
+		require.Equal(t, c.equal, equal)
+	}
+}
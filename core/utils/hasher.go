@@ -1,27 +1,128 @@
 package utils
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"file-clone-validator/core/metrics"
+	"fmt"
+	"hash"
 	"io"
 	"os"
+	"sync/atomic"
 )
 
-// MD5Hash returns the MD5 hash of the file at the given path.
+// Hash algorithms of the content of the items. MD5 is the algorithm of the generated metadata files, the others are
+// recorded by the imported manifests which carry no MD5 digest.
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+// hashedBytes is the number of content bytes read by MD5Hash in the process.
+var hashedBytes atomic.Uint64
+
+// HashedBytes returns the number of content bytes read by MD5Hash so far.
+func HashedBytes() uint64 {
+	return hashedBytes.Load()
+}
+
+// MD5Hash returns the MD5 hash of the file at the given path. The file is read through DefaultLimiter.
 // Input:
+// - ctx: cancels the waits for DefaultLimiter
 // - filePath: the absolute path to the file
 // Output:
 // - hash: the MD5 hash of the file
-func MD5Hash(filePath string) (string, error) {
+func MD5Hash(ctx context.Context, filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	hash := md5.New()
-	if _, err = io.Copy(hash, file); err != nil {
+	return MD5HashReader(ctx, file)
+}
+
+// MD5HashReader returns the MD5 hash of the content read from r until io.EOF. It is read through DefaultLimiter and
+// counted like MD5Hash, so it suits the content of items which are not plain files, e.g. the entries of an archive.
+// Input:
+// - ctx: cancels the waits for DefaultLimiter
+// - r: the content to hash
+// Output:
+// - hash: the MD5 hash of the content
+func MD5HashReader(ctx context.Context, r io.Reader) (string, error) {
+	return HashReader(ctx, HashMD5, r)
+}
+
+// HashReader returns the hash of the content read from r until io.EOF with the given algorithm, like MD5HashReader.
+// Input:
+// - ctx: cancels the waits for DefaultLimiter
+// - algorithm: one of the hash algorithms, e.g. HashSHA256. HashMD5 if empty
+// - r: the content to hash
+// Output:
+// - hash: the hex encoded hash of the content
+func HashReader(ctx context.Context, algorithm string, r io.Reader) (string, error) {
+	hashes, err := HashesReader(ctx, r, algorithm)
+	if err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	return hashes[0], nil
+}
+
+// HashesReader returns the hashes of the content read from r until io.EOF with several algorithms at once, so that
+// the content is only read once.
+// Input:
+// - ctx: cancels the waits for DefaultLimiter
+// - r: the content to hash
+// - algorithms: the hash algorithms, e.g. HashSHA256. HashMD5 if empty
+// Output:
+// - hashes: the hex encoded hashes of the content, in the order of the algorithms
+func HashesReader(ctx context.Context, r io.Reader, algorithms ...string) ([]string, error) {
+	hs := make([]hash.Hash, 0, len(algorithms))
+	ws := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		var h hash.Hash
+		switch algorithm {
+		case "", HashMD5:
+			h = md5.New()
+		case HashSHA1:
+			h = sha1.New()
+		case HashSHA256:
+			h = sha256.New()
+		case HashSHA512:
+			h = sha512.New()
+		default:
+			return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+		}
+		hs, ws = append(hs, h), append(ws, h)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(ws...), DefaultLimiter.Reader(ctx, &countingReader{r: r})); err != nil {
+		return nil, err
+	}
+	metrics.ItemsHashed.Inc()
+
+	hashes := make([]string, 0, len(hs))
+	for _, h := range hs {
+		hashes = append(hashes, hex.EncodeToString(h.Sum(nil)))
+	}
+	return hashes, nil
+}
+
+// countingReader adds the bytes read from r to hashedBytes and metrics.BytesRead as they are read, so that the metric moves while
+// large files are being hashed.
+type countingReader struct {
+	r io.Reader
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	hashedBytes.Add(uint64(n))
+	metrics.BytesRead.Add(float64(n))
+	return n, err
 }
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps the size suffixes to their multipliers. All the units are powers of 1024.
+var sizeUnits = map[string]uint64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+	"P": 1 << 50,
+}
+
+// ParseSize parses a human-readable size such as "512", "64K", "100MiB" or "1G" into a number of bytes.
+// Input:
+// - s: the size string. The suffix is case-insensitive, and "i" and "B" after the unit letter are optional
+// Output:
+// - size: the number of bytes
+func ParseSize(s string) (uint64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	str = strings.TrimSuffix(str, "I")
+
+	i := len(str)
+	for i > 0 && (str[i-1] < '0' || str[i-1] > '9') && str[i-1] != '.' {
+		i--
+	}
+	number, unit := str[:i], str[i:]
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return uint64(value * float64(multiplier)), nil
+}
+
+// FormatSize formats a number of bytes with the largest unit it reaches, e.g. 1536 as "1.5K". It is the inverse of
+// ParseSize up to the rounding.
+func FormatSize(size uint64) string {
+	units := "KMGTP"
+	if size < 1<<10 {
+		return strconv.FormatUint(size, 10)
+	}
+
+	value, i := float64(size)/(1<<10), 0
+	for value >= 1<<10 && i < len(units)-1 {
+		value /= 1 << 10
+		i++
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + string(units[i])
+}
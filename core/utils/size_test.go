@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	for input, expected := range map[string]uint64{
+		"0":      0,
+		"512":    512,
+		"64K":    64 << 10,
+		"100MiB": 100 << 20,
+		"1g":     1 << 30,
+		"1.5KB":  1536,
+	} {
+		actual, err := ParseSize(input)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, actual, input)
+	}
+
+	for _, input := range []string{"", "M", "10X", "-1"} {
+		_, err := ParseSize(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for input, expected := range map[uint64]string{
+		0:             "0",
+		1023:          "1023",
+		1536:          "1.5K",
+		64 << 10:      "64K",
+		100 << 20:     "100M",
+		1<<30 + 1<<20: "1G",
+		3 << 50:       "3P",
+		5 << 60:       "5120P",
+	} {
+		require.Equal(t, expected, FormatSize(input), input)
+	}
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// minByteBurst is the smallest burst of the bytes limiter, kept large enough to not split every read of a file into tiny
+// pieces when the limit is high.
+const minByteBurst = 256 << 10
+
+// maxByteWait is the longest a single wait on the bytes limiter should take. The waits are split into chunks of about
+// this much time, so that a waiting worker picks up new limits within roughly this delay.
+const maxByteWait = 100 * time.Millisecond
+
+// Limiter limits the number of bytes and the number of files processed per second. One Limiter is shared by all the
+// workers, so the limits apply to the whole process rather than to each worker. The limits can be changed at any time
+// while the workers are running.
+type Limiter struct {
+	mu          sync.RWMutex
+	bytes       *rate.Limiter
+	files       *rate.Limiter
+	bytesPerSec uint64
+	filesPerSec uint64
+}
+
+// DefaultLimiter is the process-wide limiter used by the hashing and metadata retrieval functions. It is unlimited until
+// SetLimits is called.
+var DefaultLimiter = NewLimiter(0, 0)
+
+// NewLimiter creates a new Limiter.
+// Input:
+// - bytesPerSec: the maximum number of bytes read per second. 0 means unlimited
+// - filesPerSec: the maximum number of files processed per second. 0 means unlimited
+func NewLimiter(bytesPerSec, filesPerSec uint64) *Limiter {
+	l := &Limiter{
+		bytes: rate.NewLimiter(rate.Inf, 0),
+		files: rate.NewLimiter(rate.Inf, 0),
+	}
+	l.setLimits(bytesPerSec, filesPerSec)
+	return l
+}
+
+// SetLimits changes the limits of the Limiter. A worker waiting for bytes picks up the new limits after its current chunk
+// of about maxByteWait, and a worker waiting for a file after the wait of that file under the old limit.
+// Input:
+// - bytesPerSec: the maximum number of bytes read per second. 0 means unlimited
+// - filesPerSec: the maximum number of files processed per second. 0 means unlimited
+func (l *Limiter) SetLimits(bytesPerSec, filesPerSec uint64) {
+	l.setLimits(bytesPerSec, filesPerSec)
+	slog.Info("Set throttle limits:", slog.Uint64("BytesPerSec", bytesPerSec), slog.Uint64("FilesPerSec", filesPerSec))
+}
+
+func (l *Limiter) setLimits(bytesPerSec, filesPerSec uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bytesPerSec, l.filesPerSec = bytesPerSec, filesPerSec
+	if bytesPerSec == 0 {
+		l.bytes.SetLimit(rate.Inf)
+	} else {
+		l.bytes.SetLimit(rate.Limit(bytesPerSec))
+		l.bytes.SetBurst(int(min(max(bytesPerSec, minByteBurst), math.MaxInt32)))
+	}
+
+	if filesPerSec == 0 {
+		l.files.SetLimit(rate.Inf)
+	} else {
+		l.files.SetLimit(rate.Limit(filesPerSec))
+		l.files.SetBurst(int(min(filesPerSec, math.MaxInt32)))
+	}
+}
+
+// Limits returns the current limits of the Limiter. 0 means unlimited.
+func (l *Limiter) Limits() (bytesPerSec, filesPerSec uint64) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.bytesPerSec, l.filesPerSec
+}
+
+// WaitFile blocks until one more file may be processed.
+func (l *Limiter) WaitFile(ctx context.Context) error {
+	return l.files.Wait(ctx)
+}
+
+// WaitBytes blocks until n more bytes may be read. n may be larger than the burst of the Limiter.
+func (l *Limiter) WaitBytes(ctx context.Context, n int) error {
+	for n > 0 {
+		if l.bytes.Limit() == rate.Inf {
+			return nil
+		}
+		waited, err := l.waitChunk(ctx, min(n, l.byteChunk()))
+		if err != nil {
+			return err
+		}
+		n -= waited
+	}
+	return nil
+}
+
+// waitChunk waits for up to chunk bytes and returns how many bytes it waited for. The chunk is clamped to the burst,
+// which SetLimits may have lowered since the chunk was computed, and nothing is waited for if the burst was lowered
+// again during the wait, so that the caller computes a new chunk instead of failing.
+func (l *Limiter) waitChunk(ctx context.Context, chunk int) (int, error) {
+	chunk = min(chunk, l.bytes.Burst())
+	if err := l.bytes.WaitN(ctx, chunk); err != nil {
+		if chunk > l.bytes.Burst() && ctx.Err() == nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return chunk, nil
+}
+
+// byteChunk returns the largest number of bytes waited for at once: about maxByteWait worth of the bytes limit.
+func (l *Limiter) byteChunk() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	chunk := l.bytesPerSec / uint64(time.Second/maxByteWait)
+	return int(min(max(chunk, 1), uint64(l.bytes.Burst())))
+}
+
+// Reader wraps r so that every read waits for the bytes limit of the Limiter.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, r: r, limiter: l}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if chunk := r.limiter.byteChunk(); r.limiter.bytes.Limit() != rate.Inf && len(p) > chunk {
+		p = p[:chunk] // never read more than one chunk at once to keep the rate smooth
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if _err := r.limiter.WaitBytes(r.ctx, n); _err != nil {
+			return n, _err
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LoadThrottleControlFile reads the limits from a control file. The control file contains one `key = value` pair per line,
+// empty lines and lines starting with `#` are ignored. Supported keys:
+// - bytes: the maximum number of bytes read per second, e.g. `100M`. 0 means unlimited
+// - files: the maximum number of files processed per second, e.g. `500`. 0 means unlimited
+// Missing keys are treated as unlimited.
+func LoadThrottleControlFile(path string) (bytesPerSec, filesPerSec uint64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for lineNo := 1; s.Scan(); lineNo++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid line %d of control file %s: %q", lineNo, path, line)
+		}
+
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "bytes":
+			bytesPerSec, err = ParseSize(value)
+		case "files":
+			filesPerSec, err = strconv.ParseUint(value, 10, 64)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid line %d of control file %s: %w", lineNo, path, err)
+		}
+	}
+
+	return bytesPerSec, filesPerSec, s.Err()
+}
+
+// WatchLimiter reloads the limits of the Limiter from the control file whenever the process receives SIGHUP or the
+// modification time of the control file changes. It returns when the context is done. A control file that cannot be
+// parsed is logged and the current limits are kept.
+// Input:
+// - l: the limiter to update
+// - controlFile: the path to the control file, see LoadThrottleControlFile for the format
+// - interval: how often to check the modification time of the control file
+func WatchLimiter(ctx context.Context, l *Limiter, controlFile string, interval time.Duration) {
+	hupC := make(chan os.Signal, 1)
+	signal.Notify(hupC, syscall.SIGHUP)
+	defer signal.Stop(hupC)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastModTime time.Time
+	if fi, err := os.Stat(controlFile); err == nil {
+		lastModTime = fi.ModTime()
+	}
+
+	reload := func() {
+		bytesPerSec, filesPerSec, err := LoadThrottleControlFile(controlFile)
+		if err != nil {
+			slog.Warn("Failed to reload throttle control file:", slog.String("Path", controlFile), slog.Any("Error", err))
+			return
+		}
+		l.SetLimits(bytesPerSec, filesPerSec)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupC:
+			reload()
+		case <-ticker.C:
+			fi, err := os.Stat(controlFile)
+			if err != nil || fi.ModTime().Equal(lastModTime) {
+				continue
+			}
+			lastModTime = fi.ModTime()
+			reload()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(0, 0)
+	require.NoError(t, l.WaitBytes(context.Background(), 1<<30))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.WaitFile(context.Background()))
+	}
+
+	l.SetLimits(1, 1)
+	bytesPerSec, filesPerSec := l.Limits()
+	require.Equal(t, uint64(1), bytesPerSec)
+	require.Equal(t, uint64(1), filesPerSec)
+
+	// the waits beyond the bursts are cancelled with their context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Error(t, l.WaitBytes(ctx, 2*minByteBurst))
+	waited := 0
+	for ; l.WaitFile(ctx) == nil; waited++ {
+	}
+	require.LessOrEqual(t, waited, 1)
+
+	// the limits can be removed at any time
+	l.SetLimits(0, 0)
+	require.NoError(t, l.WaitBytes(context.Background(), 2*minByteBurst))
+	require.NoError(t, l.WaitFile(context.Background()))
+}
+
+func TestLimiterReleasesWaitsOnNewLimits(t *testing.T) {
+	l := NewLimiter(1<<10, 0)
+	done := make(chan error, 1)
+	go func() { done <- l.WaitBytes(context.Background(), 1<<20) }()
+
+	time.Sleep(50 * time.Millisecond)
+	l.SetLimits(0, 0)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the wait kept the old bytes limit")
+	}
+}
+
+func TestLimiterWaitsAfterTheBurstIsLowered(t *testing.T) {
+	l := NewLimiter(1<<30, 0)
+	chunk := l.byteChunk()
+	l.SetLimits(1<<10, 0) // e.g. a reload of the control file between the chunk and its wait
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	waited, err := l.waitChunk(ctx, chunk)
+	if err != nil { // the clamped chunk takes longer than the deadline at the lower limit
+		require.NotContains(t, err.Error(), "burst")
+	}
+	require.LessOrEqual(t, waited, l.bytes.Burst())
+}
+
+func TestHashReaderCancelsLimiterWaits(t *testing.T) {
+	defer DefaultLimiter.setLimits(DefaultLimiter.Limits())
+	DefaultLimiter.setLimits(1, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := HashReader(ctx, HashMD5, bytes.NewReader([]byte("content")))
+	require.ErrorIs(t, err, context.Canceled)
+
+	DefaultLimiter.setLimits(0, 0)
+	hash, err := HashReader(context.Background(), HashMD5, bytes.NewReader([]byte("content")))
+	require.NoError(t, err)
+	require.Equal(t, "9a0364b9e99bb480dd25e1f0284c8555", hash)
+}
+
+func TestWatchLimiterReloadsControlFile(t *testing.T) {
+	controlFile := filepath.Join(t.TempDir(), "throttle.conf")
+	require.NoError(t, os.WriteFile(controlFile, []byte("# limits\nbytes = 10M\nfiles = 50\n"), 0644))
+	bytesPerSec, filesPerSec, err := LoadThrottleControlFile(controlFile)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10<<20), bytesPerSec)
+	require.Equal(t, uint64(50), filesPerSec)
+
+	l := NewLimiter(bytesPerSec, filesPerSec)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		WatchLimiter(ctx, l, controlFile, 10*time.Millisecond)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// an invalid control file keeps the current limits
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.WriteFile(controlFile, []byte("speed = 1\n"), 0644))
+	require.NoError(t, os.Chtimes(controlFile, later, later))
+	time.Sleep(50 * time.Millisecond)
+	bytesPerSec, filesPerSec = l.Limits()
+	require.Equal(t, uint64(10<<20), bytesPerSec)
+	require.Equal(t, uint64(50), filesPerSec)
+
+	later = later.Add(time.Hour)
+	require.NoError(t, os.WriteFile(controlFile, []byte("files = 5\n"), 0644))
+	require.NoError(t, os.Chtimes(controlFile, later, later))
+	require.Eventually(t, func() bool {
+		bytesPerSec, filesPerSec = l.Limits()
+		return bytesPerSec == 0 && filesPerSec == 5
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,270 @@
+package validator
+
+import (
+	"context"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Content comparisons of CompareTrees.
+const (
+	// ContentHash compares the MD5 hashes of the files, which are computed on each side independently.
+	ContentHash = "hash"
+
+	// ContentBytes compares the files byte for byte, reading both of them in parallel chunks, and reports the offset
+	// of the first difference. The files are not hashed.
+	ContentBytes = "bytes"
+)
+
+// CompareOptions configures CompareTrees.
+type CompareOptions struct {
+	// ScannerCount is the number of scanners listing the directories of each tree.
+	ScannerCount int
+
+	// WorkerCount is the number of workers retrieving the metadata of each tree, and comparing the content of the files
+	// in the ContentBytes mode.
+	WorkerCount int
+
+	// Content is ContentHash or ContentBytes. ContentHash if empty.
+	Content string
+}
+
+// CompareResult is the summary of a CompareTrees run.
+type CompareResult struct {
+	// SourceCount is the number of items walked in the source tree.
+	SourceCount uint64
+
+	// TargetCount is the number of items walked in the target tree.
+	TargetCount uint64
+
+	// ComparedBytes is the number of bytes compared on each side in the ContentBytes mode.
+	ComparedBytes uint64
+
+	// Moved is the number of source items found at another path of the target, see ReasonMoved.
+	Moved uint64
+}
+
+// treeItem is an item walked by CompareTrees, tagged with its side.
+type treeItem struct {
+	source bool
+	meta   *metadata.Meta
+}
+
+// treePair is a source item and the target item at the same path, whose content is compared in the ContentBytes mode.
+type treePair struct {
+	source  *metadata.Meta
+	target  *metadata.Meta
+	reasons []string // the metadata mismatches
+}
+
+// CompareTrees walks the source and the target directories concurrently, without writing a metadata file, and records
+// the differences to the reporter like DiffManifests: the items missing from the target, the extra items of the target,
+// the items moved to another path of the target and the items whose metadata differ. Items are matched by their path
+// relative to their own root, and the unmatched items by their hash, see pairMoves.
+// Input:
+// - srcDir: the source directory
+// - dstDir: the target directory
+// - opts: the concurrency and the content comparison
+// - reporter: the reporter to record the differences to
+// Note:
+// - The items are joined as they arrive: an item waits in memory until the same path is walked on the other side,
+// so the memory is bounded by the number of items walked on one side but not yet on the other. The scanners of both
+// trees list the directories in a similar order, which keeps this set small for similar trees
+// - The moves are not detected in the ContentBytes mode, whose items have no hash
+func CompareTrees(ctx context.Context, srcDir, dstDir string, opts CompareOptions,
+	reporter *Reporter) (*CompareResult, error) {
+	var retrieveOpts []metadata.RetrieveOption
+	switch opts.Content {
+	case "", ContentHash:
+	case ContentBytes:
+		retrieveOpts = append(retrieveOpts, metadata.WithoutHash())
+	default:
+		return nil, fmt.Errorf("invalid content comparison: %s. expect [%s|%s]", opts.Content, ContentHash, ContentBytes)
+	}
+
+	srcDir, err := filepath.Abs(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if dstDir, err = filepath.Abs(dstDir); err != nil {
+		return nil, err
+	}
+
+	// the walks filter out the temp directory of a meta writer in their output directory, which is empty here
+	outDir, err := os.MkdirTemp("", "compare-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outDir)
+
+	sides := []struct {
+		dir    string
+		source bool
+		ds     datasource.DataSource
+	}{{dir: srcDir, source: true}, {dir: dstDir}}
+	for i := range sides {
+		if sides[i].ds, err = datasource.NewFileSource(sides[i].dir, opts.ScannerCount, retrieveOpts...); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("Start to compare trees:", slog.String("SourceDir", srcDir), slog.String("TargetDir", dstDir),
+		slog.String("Content", opts.Content))
+	group, groupCtx := errgroup.WithContext(ctx)
+	itemC := make(chan treeItem, opts.WorkerCount)
+	walks, walksCtx := errgroup.WithContext(groupCtx)
+	for _, side := range sides {
+		side := side
+		metaC := make(chan *metadata.Meta, opts.WorkerCount)
+		walks.Go(func() error {
+			if _err := side.ds.Walk(walksCtx, outDir, metaC, opts.WorkerCount); _err != nil {
+				return fmt.Errorf("failed to walk %s: %w", side.dir, _err)
+			}
+			return nil
+		})
+		walks.Go(func() error {
+			for meta := range metaC {
+				select {
+				case <-walksCtx.Done():
+					return walksCtx.Err()
+				case itemC <- treeItem{source: side.source, meta: meta}:
+				}
+			}
+			return nil
+		})
+	}
+	group.Go(func() error {
+		defer close(itemC)
+		return walks.Wait()
+	})
+
+	result := &CompareResult{}
+	var comparedBytes atomic.Uint64
+	pairC := make(chan treePair, opts.WorkerCount)
+	for i := 0; i < opts.WorkerCount; i++ {
+		group.Go(func() error { // comparer goroutines of the ContentBytes mode
+			for pair := range pairC {
+				reason := ReasonMetaMismatch
+				reasons, _err := compareContent(groupCtx, pair, &comparedBytes)
+				if _err != nil {
+					if _err = groupCtx.Err(); _err != nil {
+						return _err
+					}
+					reasons, reason = []string{"failed to compare content: " + _err.Error()}, ReasonRetrieveMetaFail
+				}
+				if len(reasons) > 0 {
+					_err = recordItem(reporter, reason, SideSource, pair.source, strings.Join(reasons, ","))
+					if _err != nil {
+						return _err
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	sources := make(map[string]*metadata.Meta)
+	targets := make(map[string]*metadata.Meta)
+	group.Go(func() error {
+		defer close(pairC)
+		for item := range itemC {
+			root, pending, other := dstDir, targets, sources
+			if item.source {
+				root, pending, other = srcDir, sources, targets
+				result.SourceCount++
+			} else {
+				result.TargetCount++
+			}
+
+			rel, _err := filepath.Rel(root, item.meta.Common.Path)
+			if _err != nil {
+				return _err
+			}
+			rel = filepath.ToSlash(rel)
+
+			match, ok := other[rel]
+			if !ok {
+				pending[rel] = item.meta
+				continue
+			}
+			delete(other, rel)
+
+			source, target := item.meta, match
+			if !item.source {
+				source, target = match, item.meta
+			}
+			reasons := source.Equals(target)
+			if opts.Content == ContentBytes && isFile(source) && isFile(target) &&
+				source.Common.Size == target.Common.Size {
+				select {
+				case <-groupCtx.Done():
+					return groupCtx.Err()
+				case pairC <- treePair{source: source, target: target, reasons: reasons}:
+				}
+				continue
+			}
+			if len(reasons) > 0 {
+				_err = recordItem(reporter, ReasonMetaMismatch, SideSource, source, strings.Join(reasons, ","))
+				if _err != nil {
+					return _err
+				}
+			}
+		}
+		return nil
+	})
+	if err = group.Wait(); err != nil {
+		return nil, err
+	}
+	result.ComparedBytes = comparedBytes.Load()
+
+	if result.Moved, err = recordDifferences(reporter, sources, targets, "not found in target", nil); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Finish to compare trees:",
+		slog.String("SourceDir", srcDir),
+		slog.String("TargetDir", dstDir),
+		slog.Uint64("SourceCount", result.SourceCount),
+		slog.Uint64("TargetCount", result.TargetCount),
+		slog.Uint64("ComparedBytes", result.ComparedBytes),
+		slog.Uint64("Moved", result.Moved),
+	)
+	return result, nil
+}
+
+// compareContent compares the content of the files of a pair byte for byte, and adds the offset of the first
+// difference to the metadata mismatches of the pair.
+func compareContent(ctx context.Context, pair treePair, comparedBytes *atomic.Uint64) ([]string, error) {
+	offset, equal, err := utils.CompareFiles(ctx, pair.source.Common.Path, pair.target.Common.Path)
+	comparedBytes.Add(uint64(offset))
+	if err != nil {
+		return nil, err
+	}
+	if !equal {
+		return append(pair.reasons, fmt.Sprintf("content: first difference at offset %d", offset)), nil
+	}
+	return pair.reasons, nil
+}
+
+// isFile reports whether the item is a regular file.
+func isFile(meta *metadata.Meta) bool {
+	return meta.FileSystem != nil && meta.FileSystem.Type == metadata.FSTypeFile
+}
+
+// recordItem records a finding about an item, in the "<side>: <row>, error: <detail>" form of ParseFinding.
+func recordItem(reporter *Reporter, reason, side string, meta *metadata.Meta, detail string) error {
+	row, err := metadata.Serialise(meta)
+	if err != nil {
+		return err
+	}
+	reporter.Record(reason, fmt.Errorf("%s: %s, error: %s", side, string(row), detail))
+	return nil
+}
@@ -0,0 +1,107 @@
+package validator
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareTrees(t *testing.T) {
+	files := map[string]string{"a/f": "f", "a/g": "g", "h": "h", "gone": "gone"}
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	for _, dir := range []string{srcDir, dstDir} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "a"), 0755))
+		for name, data := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+		}
+	}
+	require.NoError(t, os.Remove(filepath.Join(dstDir, "gone")))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "a", "g"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "extra"), []byte("extra"), 0644))
+
+	mtime := time.Unix(1700000000, 0)
+	for _, dir := range []string{srcDir, dstDir} {
+		require.NoError(t, filepath.Walk(dir, func(path string, _ os.FileInfo, err error) error {
+			require.NoError(t, err)
+			return os.Chtimes(path, mtime, mtime)
+		}))
+	}
+
+	for _, content := range []string{ContentHash, ContentBytes} {
+		reporter, err := NewReporter("")
+		require.NoError(t, err)
+		var mismatch string
+		reporter.SetHook(func(entry LogEntry) {
+			if entry.Reason == ReasonMetaMismatch {
+				mismatch = entry.ErrorDetail.Error()
+			}
+		})
+
+		opts := CompareOptions{ScannerCount: 2, WorkerCount: 2, Content: content}
+		result, err := CompareTrees(context.Background(), srcDir, dstDir, opts, reporter)
+		require.NoError(t, err, content)
+		require.Equal(t, uint64(5), result.SourceCount, content)
+		require.Equal(t, uint64(5), result.TargetCount, content)
+		require.Equal(t, map[string]uint64{
+			ReasonFileNotFound: 1, // gone
+			ReasonExtraFile:    1, // extra
+			ReasonMetaMismatch: 1, // a/g
+		}, reporter.Counts(), content)
+
+		if content == ContentBytes {
+			require.Contains(t, mismatch, "content: first difference at offset 0")
+			require.Equal(t, uint64(2), result.ComparedBytes) // a/f and h, a/g differs at its first byte
+		} else {
+			require.Contains(t, mismatch, "hash: ")
+		}
+	}
+}
+
+func TestCompareTreesDetectsMoves(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dstDir, "a"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dstDir, "b"), 0755))
+	for dir, files := range map[string]map[string]string{
+		srcDir: {"a/report.pdf": "report", "a/photo.jpg": "photo", "a/copy.jpg": "photo", "empty": ""},
+		dstDir: {"b/report.pdf": "report", "a/picture.jpg": "photo", "a/copy.jpg": "photo", "other-empty": ""},
+	} {
+		for name, data := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+		}
+	}
+
+	mtime := time.Unix(1700000000, 0)
+	for _, dir := range []string{srcDir, dstDir} {
+		require.NoError(t, filepath.Walk(dir, func(path string, _ os.FileInfo, err error) error {
+			require.NoError(t, err)
+			return os.Chtimes(path, mtime, mtime)
+		}))
+	}
+
+	reporter, err := NewReporter("")
+	require.NoError(t, err)
+	moved := make(map[string]string)
+	reporter.SetHook(func(entry LogEntry) {
+		if finding := ParseFinding(entry.Reason, entry.ErrorDetail.Error()); finding.Reason == ReasonMoved {
+			moved[finding.Item.Common.Name] = finding.Error
+		}
+	})
+
+	opts := CompareOptions{ScannerCount: 2, WorkerCount: 2}
+	result, err := CompareTrees(context.Background(), srcDir, dstDir, opts, reporter)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), result.Moved)
+	require.Equal(t, map[string]uint64{
+		ReasonMoved:        2, // a/report.pdf and a/photo.jpg
+		ReasonFileNotFound: 1, // empty, the empty files are only paired by name
+		ReasonExtraFile:    2, // b and other-empty
+	}, reporter.Counts())
+	require.Equal(t, map[string]string{
+		"report.pdf": "moved to b/report.pdf",
+		"photo.jpg":  "moved to a/picture.jpg",
+	}, moved)
+}
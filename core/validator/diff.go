@@ -0,0 +1,144 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// DiffResult is the summary of a DiffManifests run.
+type DiffResult struct {
+	// SourceCount is the number of items in the source metadata file.
+	SourceCount uint64
+
+	// TargetCount is the number of items in the target metadata file.
+	TargetCount uint64
+
+	// Skipped is the number of source and target items skipped because they are in identical subtrees.
+	Skipped uint64
+
+	// Moved is the number of source items found at another path of the target, see ReasonMoved.
+	Moved uint64
+}
+
+// DiffManifests compares two metadata files, typically generated from the source and from the target of a copy, and
+// records the differences to the reporter: the items missing from the target, the extra items of the target, the items
+// moved to another path of the target and the items whose metadata differ. Items are matched by their path relative to
+// the source directory of their own file, and the unmatched items by their hash, see pairMoves.
+// Input:
+// - srcMetaPath: the metadata file of the source
+// - dstMetaPath: the metadata file of the target
+// - skip: the items to skip on both sides, e.g. the identical subtrees of a Merkle tree. It may be nil. It receives
+// the relative path of the item with slash separators
+// - reporter: the reporter to record the differences to
+func DiffManifests(ctx context.Context, srcMetaPath, dstMetaPath string, skip func(rel string) bool,
+	reporter *Reporter) (*DiffResult, error) {
+	result := &DiffResult{}
+
+	// load the target items which are not skipped, they are matched and removed while the source is read
+	targets := make(map[string]*metadata.Meta)
+	err := scanManifest(ctx, dstMetaPath, func(rel string, row []byte, meta *metadata.Meta) error {
+		result.TargetCount++
+		if skip != nil && skip(rel) {
+			result.Skipped++
+			return nil
+		}
+		targets[rel] = meta
+		return nil
+	}, reporter)
+	if err != nil {
+		return nil, err
+	}
+
+	// the source items not found in the target, they are paired with the extra items of the target which were moved
+	sources := make(map[string]*metadata.Meta)
+	err = scanManifest(ctx, srcMetaPath, func(rel string, row []byte, meta *metadata.Meta) error {
+		result.SourceCount++
+		if skip != nil && skip(rel) {
+			result.Skipped++
+			return nil
+		}
+
+		target, ok := targets[rel]
+		if !ok {
+			sources[rel] = meta
+			return nil
+		}
+		delete(targets, rel)
+
+		if reasons := meta.Equals(target); len(reasons) > 0 {
+			reporter.Record(ReasonMetaMismatch, fmt.Errorf("source: %s, error: %s", string(row), strings.Join(reasons, ",")))
+		}
+		return nil
+	}, reporter)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Moved, err = recordDifferences(reporter, sources, targets, "not found in target", nil); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Finish to diff metadata files:",
+		slog.String("SourceMetaPath", srcMetaPath),
+		slog.String("TargetMetaPath", dstMetaPath),
+		slog.Uint64("SourceCount", result.SourceCount),
+		slog.Uint64("TargetCount", result.TargetCount),
+		slog.Uint64("Skipped", result.Skipped),
+		slog.Uint64("Moved", result.Moved),
+	)
+	return result, nil
+}
+
+// scanManifest calls fn with the path relative to the source directory of every item of the metadata file. Invalid
+// rows are recorded to the reporter and skipped. The number of rows is checked against the header at the end.
+func scanManifest(ctx context.Context, metaPath string, fn func(rel string, row []byte, meta *metadata.Meta) error,
+	reporter *Reporter) error {
+	r, err := datasource.OpenMetaFile(metaPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var count uint64
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		row, _err := r.Next()
+		if errors.Is(_err, io.EOF) {
+			break
+		}
+		if _err != nil {
+			return _err
+		}
+
+		meta, _err := metadata.Deserialise(row)
+		if _err != nil {
+			reporter.Record(ReasonInvalidJSON, fmt.Errorf("source: %s, error: %s", string(row), _err.Error()))
+			continue
+		}
+		count++
+
+		rel, _err := filepath.Rel(r.Header.SourceDir, meta.Common.Path)
+		if _err != nil {
+			return _err
+		}
+
+		if _err = fn(filepath.ToSlash(rel), row, meta); _err != nil {
+			return _err
+		}
+	}
+
+	if count != r.Header.ItemCount {
+		return fmt.Errorf("item count mismatch in %s. expect %d, got %d", metaPath, r.Header.ItemCount, count)
+	}
+	return nil
+}
@@ -4,24 +4,30 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"file-clone-validator/core/datasource"
 	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/metrics"
+	"file-clone-validator/core/progress"
+	"file-clone-validator/core/utils"
 	"fmt"
 	"github.com/cheggaaa/pb/v3"
 	"golang.org/x/sync/errgroup"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 )
 
+// FileValidator validates a metadata file against a directory of the OS file system. It is an FSValidator over the
+// metadata.DirFS of the target directory, so the symbolic links of the target are compared as links and never followed,
+// the same way the source is walked.
 type FileValidator struct {
-	targetDir string
-	reporter  *Reporter
+	*FSValidator
 }
 
-func NewFileValidator(targetDir string, reporter *Reporter) (Validator, error) {
+func NewFileValidator(targetDir string, reporter *Reporter, opts ...FileValidatorOption) (Validator, error) {
 	targetDir, err := filepath.Abs(targetDir)
 	if err != nil {
 		return nil, err
@@ -30,10 +36,17 @@ func NewFileValidator(targetDir string, reporter *Reporter) (Validator, error) {
 	if _, err = os.Stat(targetDir); err != nil {
 		return nil, fmt.Errorf("failed to stat target directory: %w", err)
 	}
-	return &FileValidator{targetDir: targetDir, reporter: reporter}, nil
+
+	return &FileValidator{FSValidator: newFSValidator(metadata.DirFS(targetDir), targetDir, reporter, opts...)}, nil
 }
 
-func (fv *FileValidator) Validate(ctx context.Context, filePath string, workerCount int) error {
+// validateRows reads the metadata file and validates its rows with workerCount goroutines. It is the pipeline shared
+// by the validators, which only differ in how they validate a row.
+// Input:
+// - filePath: the path to the metadata file
+// - workerCount: the number of goroutines calling rv
+// - rv: validates the rows and records the findings
+func validateRows(ctx context.Context, filePath string, workerCount int, rv RowValidator) error {
 	filePath, err := filepath.Abs(filePath)
 	if err != nil {
 		return err
@@ -47,40 +60,93 @@ func (fv *FileValidator) Validate(ctx context.Context, filePath string, workerCo
 	s := bufio.NewScanner(metaFile)
 
 	// unmarshal the first line of the metadata file to srcHeader
-	srcHeader := datasource.MetaHeader{}
+	rows := &scannerRows{scanner: s}
 	for s.Scan() {
-		err = json.Unmarshal([]byte(s.Text()), &srcHeader)
+		err = json.Unmarshal([]byte(s.Text()), &rows.header)
 		if err != nil {
 			return err
 		}
 		break
 	}
 
+	return ValidateRows(ctx, filePath, rows, workerCount, rv)
+}
+
+// RowReader reads the rows of a metadata file which is not read from a local file, e.g. streamed over the network.
+type RowReader interface {
+	// Header returns the header of the metadata file. Its item count is only read once Next returned io.EOF, so that
+	// a stream can send it after its rows.
+	Header() datasource.MetaHeader
+
+	// Next returns the next row, or io.EOF after the last one.
+	Next() ([]byte, error)
+}
+
+// scannerRows is the RowReader of a local metadata file whose header has been read.
+type scannerRows struct {
+	scanner *bufio.Scanner
+	header  datasource.MetaHeader
+}
+
+func (r *scannerRows) Header() datasource.MetaHeader {
+	return r.header
+}
+
+func (r *scannerRows) Next() ([]byte, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return []byte(r.scanner.Text()), nil
+}
+
+// ValidateRows validates the rows of a RowReader with workerCount goroutines, like the Validate method of the
+// validators does for a metadata file, and checks the number of validated items against the item count of the header.
+// Input:
+// - name: the name of the metadata file in the logs, e.g. its path or its address
+// - rows: the rows to validate
+// - workerCount: the number of goroutines calling rv
+// - rv: validates the rows and records the findings
+func ValidateRows(ctx context.Context, name string, rows RowReader, workerCount int, rv RowValidator) error {
+	srcHeader := rows.Header()
 	itemCounts := make([]uint64, workerCount)
 
-	slog.Info("Start to validate metadata file:", slog.String("MetaFilePath", filePath))
+	slog.Info("Start to validate metadata file:", slog.String("MetaFilePath", name))
 
 	// validate the metadata file
 	rowC := make(chan []byte, 1)
+	defer metrics.TrackQueue("validate_rows", func() int { return len(rowC) })()
 	group, groupCtx := errgroup.WithContext(ctx)
 
-	go ValidateProgressWatch(groupCtx, int64(srcHeader.ItemCount), itemCounts)
+	watchDone := make(chan struct{})
+	go func() { ValidateProgressWatch(groupCtx, int64(srcHeader.ItemCount), itemCounts); close(watchDone) }()
 
 	group.Go(func() error {
 		defer close(rowC)
-		for s.Scan() {
+		for {
+			row, err := rows.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
 			select {
 			case <-groupCtx.Done():
 				return groupCtx.Err()
-			case rowC <- []byte(s.Text()):
+			case rowC <- row:
 			}
 		}
-		return s.Err()
 	})
 
+	metrics.StartWorkers(metrics.PoolValidate, workerCount)
 	for i := 0; i < workerCount; i++ {
 		_i := i
 		group.Go(func() error {
+			defer metrics.StopWorker(metrics.PoolValidate)
 			for {
 				select {
 				case <-groupCtx.Done():
@@ -90,63 +156,55 @@ func (fv *FileValidator) Validate(ctx context.Context, filePath string, workerCo
 						return nil
 					}
 
-					item := metadata.Meta{}
-					err = json.Unmarshal(row, &item)
-					if err != nil {
-						fv.reporter.Record("InvalidJSON", fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
-						continue
-					}
-
-					itemCounts[_i]++
-
-					targetPath := strings.Replace(item.Common.Path, srcHeader.SourceDir, fv.targetDir, 1)
-					file, _err := os.Open(targetPath)
-					if _err != nil {
-						fv.reporter.Record("FileNotFound", fmt.Errorf("source: %s, error: %s", string(row), _err.Error()))
-						continue
-					}
-
-					fileStat, err := file.Stat()
-					if err != nil {
-						fv.reporter.Record("FileStatError", fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
-						continue
-					}
-					file.Close()
-
-					targetItem, err := metadata.RetrieveFileSystemMeta(targetPath, fileStat)
-					if err != nil {
-						fv.reporter.Record("RetrieveMetaFail", fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
-						continue
-					}
-
-					reasons := item.Equals(targetItem)
-					if len(reasons) > 0 {
-						fv.reporter.Record("MetaMismatch", fmt.Errorf("source: %s, error: %s", string(row), strings.Join(reasons, ",")))
-						continue
+					done := metrics.Busy(metrics.PoolValidate)
+					if rv.ValidateRow(groupCtx, row, &srcHeader) {
+						itemCounts[_i]++
+						metrics.ItemsValidated.Inc()
 					}
+					done()
 				}
 			}
 		})
 	}
-	err = group.Wait()
+	err := group.Wait()
+	<-watchDone
 	if err != nil {
 		return err
 	}
 
-	slog.Info("Finish to validate metadata file:", slog.String("MetaFilePath", filePath))
+	slog.Info("Finish to validate metadata file:", slog.String("MetaFilePath", name))
 
 	var totalCount uint64
 	for _, itemCount := range itemCounts {
 		totalCount += itemCount
 	}
-	if totalCount != srcHeader.ItemCount {
-		return fmt.Errorf("item count mismatch. expect %d, got %d", srcHeader.ItemCount, totalCount)
+	if expected := rows.Header().ItemCount; totalCount != expected {
+		return fmt.Errorf("item count mismatch. expect %d, got %d", expected, totalCount)
 	}
 
 	return nil
 }
 
+// ValidateProgressWatch generates a progress bar to watch the progress of the validation. In the json progress mode,
+// it emits the events of the validate phase instead.
+// Input:
+// - total: the number of items in the metadata file
+// - itemCounts: the number of items validated by each worker. This function will only read the values
 func ValidateProgressWatch(ctx context.Context, total int64, itemCounts []uint64) {
+	switch progress.CurrentMode() {
+	case progress.ModeJSON:
+		progress.Watch(ctx, progress.PhaseValidate, uint64(total), func() uint64 {
+			var totalCount uint64
+			for _, itemCount := range itemCounts {
+				totalCount += itemCount
+			}
+			return totalCount
+		}, utils.HashedBytes)
+		return
+	case progress.ModeNone:
+		return
+	}
+
 	bar := pb.New64(total)
 	bar.Start()
 	defer bar.Finish()
@@ -0,0 +1,112 @@
+package validator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Formats of the error report written by a Reporter.
+const (
+	ReportFormatText = "text" // one "[Reason] detail" line per finding
+	ReportFormatJSON = "json" // one Finding per line
+)
+
+// Sides of the item a finding refers to.
+const (
+	SideSource = "source" // the item is described by a row of the metadata file of the source
+	SideTarget = "target" // the item only exists in the target
+)
+
+// Finding is the structured form of a recorded entry.
+type Finding struct {
+	// Reason is the category of the finding, e.g. FileNotFound.
+	Reason string
+
+	// Side tells whether Item comes from the source or from the target. Empty if the detail has no item.
+	Side string
+
+	// Item is the metadata of the item the finding refers to. Nil if the detail does not carry a valid row.
+	Item *metadata.Meta
+
+	// Error describes the problem, e.g. the mismatching attributes.
+	Error string
+}
+
+// textReportLine matches a line of the text report.
+var textReportLine = regexp.MustCompile(`^\[([A-Za-z0-9]+)] (.*)$`)
+
+// ParseFinding converts a recorded entry to a Finding. The validators format the details as
+// "<side>: <row>, error: <message>", any other detail is kept as the error of the finding.
+// Input:
+// - reason: the reason of the entry
+// - detail: the detail of the entry
+func ParseFinding(reason, detail string) Finding {
+	finding := Finding{Reason: reason, Error: detail}
+	for _, side := range []string{SideSource, SideTarget} {
+		rest, ok := strings.CutPrefix(detail, side+": ")
+		if !ok {
+			continue
+		}
+
+		item := &metadata.Meta{}
+		decoder := json.NewDecoder(strings.NewReader(rest))
+		if err := decoder.Decode(item); err != nil {
+			return finding
+		}
+		message, ok := strings.CutPrefix(rest[decoder.InputOffset():], ", error: ")
+		if !ok {
+			return finding
+		}
+
+		finding.Side, finding.Item, finding.Error = side, item, message
+		return finding
+	}
+	return finding
+}
+
+// ReadFindings reads the findings of an error report written in any ReportFormat. The text lines which can not be
+// parsed are returned as findings without item.
+func ReadFindings(reportPath string) ([]Finding, error) {
+	file, err := os.Open(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	findings := make([]Finding, 0)
+	r := bufio.NewReader(file)
+	for {
+		line, _err := r.ReadString('\n')
+		if _err != nil && !errors.Is(_err, io.EOF) {
+			return nil, _err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "{"):
+			finding := Finding{}
+			if err = json.Unmarshal([]byte(line), &finding); err != nil {
+				return nil, fmt.Errorf("failed to parse finding %q: %w", line, err)
+			}
+			findings = append(findings, finding)
+		default:
+			match := textReportLine.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("failed to parse finding %q: not a report line", line)
+			}
+			findings = append(findings, ParseFinding(match[1], match[2]))
+		}
+
+		if errors.Is(_err, io.EOF) {
+			return findings, nil
+		}
+	}
+}
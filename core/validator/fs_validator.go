@@ -0,0 +1,204 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FSValidator validates a metadata file against any fs.FS. The items are described with metadata.Lstat and
+// metadata.RetrieveFSMeta, so the optional interfaces of the file system are used the same way as by
+// datasource.FSSource.
+type FSValidator struct {
+	fsys     fs.FS
+	root     string
+	reporter *Reporter
+	skip     func(rel string) bool
+	extras   bool
+
+	mu      sync.Mutex
+	seen    map[string]struct{} // the names of the rows, when the extra items are walked
+	missing missingItems        // the source items not in the target, when the extra items are walked
+}
+
+// FileValidatorOption configures optional behaviours of an FSValidator or a FileValidator.
+type FileValidatorOption func(fv *FSValidator)
+
+// WithSkip makes the validator skip the items for which skip returns true. Skipped items still count towards the item
+// count of the metadata file, but the target is not checked for them.
+// Input:
+// - skip: receives the path of the item relative to the source directory, with slash separators
+func WithSkip(skip func(rel string) bool) FileValidatorOption {
+	return func(fv *FSValidator) { fv.skip = skip }
+}
+
+// WithExtraItems makes Validate walk the target once the rows are validated, to report the items which are not in the
+// metadata file as extra files, or as the moved source items they are paired with, see pairMoves. Only the extra
+// regular files of the size of a missing item are hashed.
+// Note:
+// - The names of all the rows are kept in memory until the walk
+// - ValidateRow does not report the missing items itself then, so the option has no effect on the validations which
+// only call ValidateRow, e.g. the distributed and the streamed ones
+func WithExtraItems() FileValidatorOption {
+	return func(fv *FSValidator) { fv.extras = true }
+}
+
+// NewFSValidator creates a new FSValidator.
+// Input:
+// - fsys: the target file system
+// - root: the path the metadata records for the root of fsys, see datasource.NewFSSource
+// - reporter: records the findings
+func NewFSValidator(fsys fs.FS, root string, reporter *Reporter, opts ...FileValidatorOption) (Validator, error) {
+	if _, err := metadata.Lstat(fsys, "."); err != nil {
+		return nil, fmt.Errorf("failed to stat target root: %w", err)
+	}
+	return newFSValidator(fsys, root, reporter, opts...), nil
+}
+
+func newFSValidator(fsys fs.FS, root string, reporter *Reporter, opts ...FileValidatorOption) *FSValidator {
+	fv := &FSValidator{fsys: fsys, root: root, reporter: reporter}
+	for _, opt := range opts {
+		opt(fv)
+	}
+	return fv
+}
+
+func (fv *FSValidator) Validate(ctx context.Context, filePath string, workerCount int) error {
+	if fv.extras {
+		fv.seen, fv.missing = make(map[string]struct{}), missingItems{}
+	}
+	if err := validateRows(ctx, filePath, workerCount, fv); err != nil {
+		return err
+	}
+	if !fv.extras {
+		return nil
+	}
+	return fv.recordExtraItems(ctx)
+}
+
+// ValidateRow validates one row of the metadata file against the target file system and records the findings. It is
+// safe for concurrent use.
+// Input:
+// - ctx: cancels the waits for utils.DefaultLimiter
+// - row: the serialised metadata of the source item
+// - srcHeader: the header of the metadata file
+// Output:
+// - counted: whether the row is a valid item which counts towards the item count of the header
+func (fv *FSValidator) ValidateRow(ctx context.Context, row []byte, srcHeader *datasource.MetaHeader) (counted bool) {
+	item := metadata.Meta{}
+	err := json.Unmarshal(row, &item)
+	if err != nil {
+		fv.reporter.Record(ReasonInvalidJSON, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return false
+	}
+
+	rel, err := filepath.Rel(srcHeader.SourceDir, item.Common.Path)
+	if err != nil {
+		fv.reporter.Record(ReasonFileNotFound, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return true
+	}
+	name := filepath.ToSlash(rel)
+
+	if fv.skip != nil && fv.skip(name) {
+		return true
+	}
+	if fv.seen != nil {
+		fv.mu.Lock()
+		fv.seen[name] = struct{}{}
+		fv.mu.Unlock()
+	}
+
+	fileStat, err := metadata.Lstat(fv.fsys, name)
+	if fv.seen != nil && errors.Is(err, fs.ErrNotExist) {
+		fv.missing.add(name, &item)
+		return true
+	}
+	if err != nil {
+		fv.reporter.Record(ReasonFileNotFound, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return true
+	}
+
+	targetItem, err := metadata.RetrieveFSMeta(fv.fsys, name, filepath.Join(fv.root, rel), fileStat,
+		append(metadata.RetrieveOptionsFor(&item), metadata.WithContext(ctx))...)
+	if err != nil {
+		fv.reporter.Record(ReasonRetrieveMetaFail, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return true
+	}
+
+	reasons := item.Equals(targetItem)
+	if len(reasons) > 0 {
+		fv.reporter.Record(ReasonMetaMismatch, fmt.Errorf("source: %s, error: %s", string(row), strings.Join(reasons, ",")))
+	}
+	return true
+}
+
+// recordExtraItems walks the target for the items which no row refers to, and records them with the missing source
+// items after pairing them by their hash, see recordDifferences. The subtrees skipped by the skip function are not
+// walked.
+func (fv *FSValidator) recordExtraItems(ctx context.Context) error {
+	slog.Info("Start to walk target for extra items:", slog.String("Root", fv.root))
+	algorithms := fv.missing.algorithms() // only the extra files of these sizes can be paired, so they are hashed
+	targets := make(map[string]*metadata.Meta)
+	err := fs.WalkDir(fv.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			fv.reporter.Record(ReasonRetrieveMetaFail, fmt.Errorf("target: %s, error: %s",
+				filepath.Join(fv.root, filepath.FromSlash(name)), err.Error()))
+			return nil
+		}
+		if name == "." {
+			return nil
+		}
+		if fv.skip != nil && fv.skip(name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if _, ok := fv.seen[name]; ok {
+			return nil
+		}
+
+		path := filepath.Join(fv.root, filepath.FromSlash(name))
+		fi, err := d.Info()
+		if err != nil {
+			fv.reporter.Record(ReasonRetrieveMetaFail, fmt.Errorf("target: %s, error: %s", path, err.Error()))
+			return nil
+		}
+		opts := []metadata.RetrieveOption{metadata.WithoutHash(), metadata.WithContext(ctx)}
+		if algorithm, ok := algorithms[uint64(fi.Size())]; ok && fi.Mode().IsRegular() {
+			opts = []metadata.RetrieveOption{metadata.WithHashAlgorithm(algorithm), metadata.WithContext(ctx)}
+		}
+		meta, err := metadata.RetrieveFSMeta(fv.fsys, name, path, fi, opts...)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			fv.reporter.Record(ReasonRetrieveMetaFail, fmt.Errorf("target: %s, error: %s", path, err.Error()))
+			return nil
+		}
+		targets[name] = meta
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk target: %w", err)
+	}
+
+	moved, err := recordDifferences(fv.reporter, fv.missing.items, targets, "not found in target", nil)
+	if err != nil {
+		return err
+	}
+	slog.Info("Finish to walk target for extra items:", slog.String("Root", fv.root),
+		slog.Int("ExtraCount", len(targets)), slog.Uint64("Moved", moved))
+	return nil
+}
@@ -0,0 +1,82 @@
+package validator
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFSValidatorMapFS(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	source := fstest.MapFS{
+		"a":     {Mode: fs.ModeDir | 0755, ModTime: mtime},
+		"a/f":   {Data: []byte("hello\n"), Mode: 0644, ModTime: mtime},
+		"a/g":   {Data: []byte("g"), Mode: 0644, ModTime: mtime},
+		"h":     {Data: []byte("h"), Mode: 0640, ModTime: mtime},
+		"gone":  {Data: []byte("gone"), Mode: 0644, ModTime: mtime},
+		"a/ok":  {Data: []byte("ok"), Mode: 0600, ModTime: mtime},
+		"a/old": {Data: []byte("old"), Mode: 0600, ModTime: mtime},
+	}
+
+	metaPath := writeMapFSMeta(t, source)
+
+	target := fstest.MapFS{}
+	for name, file := range source {
+		clone := *file
+		target[name] = &clone
+	}
+	delete(target, "gone")
+	target["a/f"].Data = []byte("jello\n") // same size, different content
+	target["h"].Mode = 0600
+	target["a/old"].ModTime = mtime.Add(time.Hour)
+
+	reporter, err := NewReporter("")
+	require.NoError(t, err)
+	v, err := NewFSValidator(target, "/dst", reporter, WithSkip(func(rel string) bool { return rel == "a/old" }))
+	require.NoError(t, err)
+	require.NoError(t, v.Validate(context.Background(), metaPath, 4))
+
+	require.Equal(t, map[string]uint64{ReasonFileNotFound: 1, ReasonMetaMismatch: 2}, reporter.Counts())
+}
+
+func TestFSValidatorExtraItems(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	source := fstest.MapFS{
+		"a":    {Mode: fs.ModeDir | 0755, ModTime: mtime},
+		"a/f":  {Data: []byte("hello\n"), Mode: 0644, ModTime: mtime},
+		"gone": {Data: []byte("gone"), Mode: 0644, ModTime: mtime},
+	}
+	metaPath := writeMapFSMeta(t, source)
+
+	target := fstest.MapFS{
+		"a":         {Mode: fs.ModeDir | 0755, ModTime: mtime},
+		"b":         {Mode: fs.ModeDir | 0755, ModTime: mtime},
+		"b/f":       {Data: []byte("hello\n"), Mode: 0644, ModTime: mtime},
+		"new":       {Data: []byte("new"), Mode: 0644, ModTime: mtime},
+		"skipped":   {Mode: fs.ModeDir | 0755, ModTime: mtime},
+		"skipped/x": {Data: []byte("x"), Mode: 0644, ModTime: mtime},
+	}
+
+	reporter, err := NewReporter("")
+	require.NoError(t, err)
+	var moved []string
+	reporter.SetHook(func(entry LogEntry) {
+		if finding := ParseFinding(entry.Reason, entry.ErrorDetail.Error()); finding.Reason == ReasonMoved {
+			moved = append(moved, finding.Item.Common.Path+" "+finding.Error)
+		}
+	})
+	v, err := NewFSValidator(target, "/dst", reporter, WithExtraItems(),
+		WithSkip(func(rel string) bool { return rel == "skipped" }))
+	require.NoError(t, err)
+	require.NoError(t, v.Validate(context.Background(), metaPath, 2))
+
+	require.Equal(t, map[string]uint64{
+		ReasonMoved:        1, // a/f
+		ReasonFileNotFound: 1, // gone
+		ReasonExtraFile:    2, // b and new, not the skipped subtree
+	}, reporter.Counts())
+	require.Equal(t, []string{"/src/a/f moved to b/f"}, moved)
+}
@@ -0,0 +1,178 @@
+package validator
+
+import (
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// move is an item missing from its path in the target which is found at another path of the target.
+type move struct {
+	sourceRel string
+	targetRel string
+	source    *metadata.Meta
+	target    *metadata.Meta
+}
+
+// moveKey groups the items which may be the same file at different paths.
+type moveKey struct {
+	hash string
+	size uint64
+}
+
+// pairMoves pairs the source items missing from the target with the extra items of the target which have the same
+// hash and size, and removes the paired items from both maps. An item is paired with one of the same name first, so
+// that a moved file is not taken for a renamed copy of another one.
+// Input:
+// - sources: the source items not found in the target, by their relative path
+// - targets: the target items not found in the source, by their relative path
+// Note:
+// - Only the regular files with a hash are paired, e.g. not the files compared byte for byte without hash
+// - The empty files all have the same hash, so they are only paired with an item of the same name
+func pairMoves(sources, targets map[string]*metadata.Meta) []move {
+	candidates := make(map[moveKey][]string)
+	for _, rel := range sortedRels(targets) {
+		if key, ok := movable(targets[rel]); ok {
+			candidates[key] = append(candidates[key], rel)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var moves []move
+	for _, sourceRel := range sortedRels(sources) {
+		source := sources[sourceRel]
+		key, ok := movable(source)
+		if !ok {
+			continue
+		}
+
+		rels, picked := candidates[key], -1
+		for i, rel := range rels {
+			if path.Base(rel) == path.Base(sourceRel) {
+				picked = i
+				break
+			}
+		}
+		if picked < 0 && len(rels) > 0 && key.size > 0 {
+			picked = 0
+		}
+		if picked < 0 {
+			continue
+		}
+
+		targetRel := rels[picked]
+		candidates[key] = append(rels[:picked], rels[picked+1:]...)
+		moves = append(moves, move{sourceRel: sourceRel, targetRel: targetRel, source: source,
+			target: targets[targetRel]})
+		delete(sources, sourceRel)
+		delete(targets, targetRel)
+	}
+	return moves
+}
+
+// missingItems collects the source items which are not found at their path in the target, so that they can be paired
+// with the extra items of the target once all the rows are validated, see recordDifferences. It is safe for concurrent
+// use.
+type missingItems struct {
+	mu    sync.Mutex
+	items map[string]*metadata.Meta
+}
+
+// add adds the item missing from its path in the target.
+// Input:
+// - rel: the path of the item relative to the source directory, with slash separators
+func (m *missingItems) add(rel string, item *metadata.Meta) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.items == nil {
+		m.items = make(map[string]*metadata.Meta)
+	}
+	m.items[rel] = item
+}
+
+// algorithms returns the hash algorithm of the items which can be paired by their size, so that only the extra items
+// of these sizes are hashed to be paired with them.
+func (m *missingItems) algorithms() map[uint64]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	algorithms := make(map[uint64]string)
+	for _, item := range m.items {
+		if key, ok := movable(item); ok && key.size > 0 {
+			algorithms[key.size] = item.Common.HashAlgorithm
+		}
+	}
+	return algorithms
+}
+
+// recordDifferences pairs the missing and the extra items, see pairMoves, and records the moves, then the items
+// which are still missing and the extra ones, in path order.
+// Input:
+// - sources: the source items not found in the target, by their relative path
+// - targets: the target items not found in the source, by their relative path
+// - notFound: the detail of the missing items, e.g. "not found in target"
+// - compare: compares a source item with the target item it is moved to. Meta.Equals if nil
+// Output:
+// - moved: the number of moved items
+func recordDifferences(reporter *Reporter, sources, targets map[string]*metadata.Meta, notFound string,
+	compare func(source, target *metadata.Meta) []string) (moved uint64, err error) {
+	moves := pairMoves(sources, targets)
+	if err = recordMoves(reporter, moves, compare); err != nil {
+		return 0, err
+	}
+	for _, rel := range sortedRels(sources) {
+		if err = recordItem(reporter, ReasonFileNotFound, SideSource, sources[rel], notFound); err != nil {
+			return 0, err
+		}
+	}
+	for _, rel := range sortedRels(targets) {
+		if err = recordItem(reporter, ReasonExtraFile, SideTarget, targets[rel], "not found in source"); err != nil {
+			return 0, err
+		}
+	}
+	return uint64(len(moves)), nil
+}
+
+// recordMoves records the moved items to the reporter with their path in the target, and the mismatches of their
+// other metadata.
+// Input:
+// - compare: compares a source item with the target item it is moved to. Meta.Equals if nil
+func recordMoves(reporter *Reporter, moves []move, compare func(source, target *metadata.Meta) []string) error {
+	if compare == nil {
+		compare = (*metadata.Meta).Equals
+	}
+	for _, m := range moves {
+		detail := "moved to " + m.targetRel
+		for _, reason := range compare(m.source, m.target) {
+			if !strings.HasPrefix(reason, metadata.FieldName+":") {
+				detail += "," + reason
+			}
+		}
+		if err := recordItem(reporter, ReasonMoved, SideSource, m.source, detail); err != nil {
+			return fmt.Errorf("failed to record move of %s: %w", m.sourceRel, err)
+		}
+	}
+	return nil
+}
+
+// movable returns the key to pair the item with, and whether the item can be paired.
+func movable(meta *metadata.Meta) (moveKey, bool) {
+	if !isFile(meta) || meta.Common.Hash == "" || !meta.Records(metadata.FieldHash) {
+		return moveKey{}, false
+	}
+	return moveKey{hash: meta.Common.Hash, size: meta.Common.Size}, true
+}
+
+// sortedRels returns the relative paths of the items in order, so that the pairs do not depend on the walk order.
+func sortedRels(items map[string]*metadata.Meta) []string {
+	rels := make([]string, 0, len(items))
+	for rel := range items {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	return rels
+}
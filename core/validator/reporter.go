@@ -1,13 +1,33 @@
 package validator
 
 import (
+	"encoding/json"
+	"file-clone-validator/core/metrics"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
+// Reasons of the entries recorded by the validators.
+const (
+	ReasonInvalidJSON      = "InvalidJSON"
+	ReasonFileNotFound     = "FileNotFound"
+	ReasonFileStatError    = "FileStatError"
+	ReasonRetrieveMetaFail = "RetrieveMetaFail"
+	ReasonMetaMismatch     = "MetaMismatch"
+	ReasonExtraFile        = "ExtraFile"           // the item exists in the target but not in the source
+	ReasonZipChecksum      = "ZipChecksumMismatch" // the content of a zip entry does not match its stored CRC32
+	ReasonZipCorrupt       = "ZipEntryCorrupt"     // a zip entry can not be read, e.g. bad header or compression
+	ReasonInvalidBag       = "InvalidBag"          // a BagIt bag is invalid, e.g. a wrong Payload-Oxum
+	ReasonMoved            = "Moved"               // the item is found at another path of the target, see pairMoves
+)
+
+// reportLineBreaks replaces the line breaks of the details written to the text report, one line per entry.
+var reportLineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
 type LogEntry struct {
 	Reason      string
 	ErrorDetail error
@@ -16,30 +36,83 @@ type LogEntry struct {
 type Reporter struct {
 	mu         sync.Mutex
 	entries    []LogEntry
+	counts     map[string]uint64
 	outputPath string
+	format     string
+	hook       func(entry LogEntry)
 }
 
+// NewReporter creates a new Reporter which collects the validation findings and writes them to the output file on
+// Flush.
+// Input:
+// - outputPath: the path to the error report. The findings are only collected in memory if it is empty
 func NewReporter(outputPath string) (*Reporter, error) {
-	outputPath, err := filepath.Abs(outputPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute path of output path: %w", err)
+	if outputPath != "" {
+		var err error
+		outputPath, err = filepath.Abs(outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path of output path: %w", err)
+		}
 	}
 	return &Reporter{
+		counts:     make(map[string]uint64),
 		outputPath: outputPath,
+		format:     ReportFormatText,
 	}, nil
 }
 
-func (r *Reporter) Record(reason string, err error) {
+// SetHook sets a function called with every recorded entry. The hook is called by the validator workers concurrently
+// and must be safe for concurrent use.
+func (r *Reporter) SetHook(hook func(entry LogEntry)) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.entries = append(r.entries, LogEntry{
+	r.hook = hook
+}
+
+// SetFormat sets the format the error report is written in, ReportFormatText by default.
+func (r *Reporter) SetFormat(format string) error {
+	if format != ReportFormatText && format != ReportFormatJSON {
+		return fmt.Errorf("invalid report format: %s. expect [%s|%s]", format, ReportFormatText, ReportFormatJSON)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.format = format
+	return nil
+}
+
+// Counts returns the number of recorded entries by reason.
+func (r *Reporter) Counts() map[string]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]uint64, len(r.counts))
+	for reason, count := range r.counts {
+		counts[reason] = count
+	}
+	return counts
+}
+
+func (r *Reporter) Record(reason string, err error) {
+	metrics.Findings.WithLabelValues(reason).Inc()
+
+	entry := LogEntry{
 		Reason:      reason,
 		ErrorDetail: err,
-	})
+	}
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.counts[reason]++
+	hook := r.hook
+	r.mu.Unlock()
+
+	if hook != nil {
+		hook(entry)
+	}
 }
 
 func (r *Reporter) Flush() {
-	if len(r.entries) <= 0 {
+	if len(r.entries) <= 0 || r.outputPath == "" {
 		return
 	}
 
@@ -55,7 +128,17 @@ func (r *Reporter) Flush() {
 	defer file.Close()
 
 	for _, entry := range r.entries {
-		file.WriteString(fmt.Sprintf("[%s] %s\n", entry.Reason, entry.ErrorDetail.Error()))
+		if r.format == ReportFormatJSON {
+			line, _err := json.Marshal(ParseFinding(entry.Reason, entry.ErrorDetail.Error()))
+			if _err != nil {
+				slog.Error("Failed to marshal finding:", slog.String("Reason", entry.Reason), slog.Any("Error", _err))
+				continue
+			}
+			file.Write(append(line, '\n'))
+			continue
+		}
+		// the messages of the OS errors quote the names as they are, so their line breaks would split the line
+		file.WriteString(fmt.Sprintf("[%s] %s\n", entry.Reason, reportLineBreaks.Replace(entry.ErrorDetail.Error())))
 	}
 
 	slog.Info("Finish writing error report to file:", slog.String("OutputPath", r.outputPath))
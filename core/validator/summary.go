@@ -0,0 +1,178 @@
+package validator
+
+import (
+	"bufio"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Summary is the machine-readable outcome of one validation run. It is written next to the error report, so that the
+// outcomes of the validation of several shards can be merged into one verdict.
+type Summary struct {
+	// MetaFilePath is the absolute path to the validated metadata file.
+	MetaFilePath string
+
+	// SourceDir is the root directory of the source, from the header of the metadata file.
+	SourceDir string
+
+	// TargetDir is the absolute path to the validated target directory.
+	TargetDir string
+
+	// ItemCount is the number of items validated, which is the item count of the header of the metadata file.
+	ItemCount uint64
+
+	// Findings is the number of findings by reason.
+	Findings map[string]uint64
+
+	// ReportPath is the absolute path to the error report. Empty if no report was written.
+	ReportPath string
+
+	// Passed reports whether the validation found nothing.
+	Passed bool
+}
+
+// WriteSummary writes the summary as json.
+func WriteSummary(path string, summary *Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadSummary reads a summary written by WriteSummary.
+func ReadSummary(path string) (*Summary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{}
+	if err = json.Unmarshal(data, summary); err != nil {
+		return nil, fmt.Errorf("failed to parse summary %s: %w", path, err)
+	}
+	return summary, nil
+}
+
+// MergedSummary is the verdict over the summaries of several validation runs, typically one per shard.
+type MergedSummary struct {
+	// Summaries is the number of merged summaries.
+	Summaries int
+
+	// ItemCount is the total number of items validated.
+	ItemCount uint64
+
+	// Findings is the total number of findings by reason.
+	Findings map[string]uint64
+
+	// Problems lists why the runs do not cover the whole metadata file, e.g. a missing or duplicated shard.
+	Problems []string
+
+	// Passed reports whether every shard was validated and nothing was found.
+	Passed bool
+}
+
+// MergeSummaries merges the summaries of several validation runs into one verdict, and concatenates their error
+// reports into one.
+// Input:
+// - summaryPaths: the summary files to merge
+// - index: the index of the shards. If it is set, every shard must have exactly one summary with the item count of
+// the shard. It may be nil
+// - reportPath: the path to write the merged error report to. Not written if empty
+func MergeSummaries(summaryPaths []string, index *datasource.ShardIndex, reportPath string) (*MergedSummary, error) {
+	merged := &MergedSummary{Findings: make(map[string]uint64)}
+
+	var reportFile *os.File
+	var report *bufio.Writer
+	if reportPath != "" {
+		var err error
+		if reportFile, err = os.Create(reportPath); err != nil {
+			return nil, err
+		}
+		defer reportFile.Close()
+		report = bufio.NewWriter(reportFile)
+	}
+
+	shardCounts := make(map[string]uint64) // file name of the shard -> item count
+	for _, summaryPath := range summaryPaths {
+		summary, err := ReadSummary(summaryPath)
+		if err != nil {
+			return nil, err
+		}
+		if summary.MetaFilePath == "" {
+			return nil, fmt.Errorf("%s is not the summary of a validation", summaryPath)
+		}
+
+		merged.Summaries++
+		merged.ItemCount += summary.ItemCount
+		for reason, count := range summary.Findings {
+			merged.Findings[reason] += count
+		}
+
+		shard := filepath.Base(summary.MetaFilePath)
+		if _, ok := shardCounts[shard]; ok {
+			merged.Problems = append(merged.Problems, fmt.Sprintf("shard %s is validated more than once", shard))
+		}
+		shardCounts[shard] = summary.ItemCount
+
+		if report != nil && summary.ReportPath != "" && len(summary.Findings) > 0 {
+			file, _err := openReport(summary.ReportPath, filepath.Dir(summaryPath))
+			if _err != nil { // the merged report would miss the findings of the run
+				merged.Problems = append(merged.Problems, fmt.Sprintf("the error report of %s can not be read: %s",
+					summaryPath, _err))
+				continue
+			}
+			_, err = io.Copy(report, file)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if report != nil {
+		if err := report.Flush(); err != nil {
+			return nil, err
+		}
+		if err := reportFile.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if index != nil {
+		for _, shard := range index.Shards {
+			count, ok := shardCounts[shard.Path]
+			switch {
+			case !ok:
+				merged.Problems = append(merged.Problems, fmt.Sprintf("shard %s is not validated", shard.Path))
+			case count != shard.ItemCount:
+				merged.Problems = append(merged.Problems, fmt.Sprintf("item count mismatch in shard %s. expect %d, got %d",
+					shard.Path, shard.ItemCount, count))
+			}
+		}
+
+		if merged.ItemCount != index.ItemCount {
+			merged.Problems = append(merged.Problems, fmt.Sprintf("item count mismatch. expect %d, got %d",
+				index.ItemCount, merged.ItemCount))
+		}
+	}
+	sort.Strings(merged.Problems)
+
+	merged.Passed = len(merged.Findings) == 0 && len(merged.Problems) == 0
+	return merged, nil
+}
+
+// openReport opens the error report of a run. Reports are often copied from other hosts, so a report which is not
+// found at its recorded path is looked up next to its summary.
+func openReport(reportPath, summaryDir string) (*os.File, error) {
+	file, err := os.Open(reportPath)
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(summaryDir, filepath.Base(reportPath)))
+	}
+	return file, err
+}
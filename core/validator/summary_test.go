@@ -0,0 +1,38 @@
+package validator
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeSummariesReportsUnreadableReports(t *testing.T) {
+	dir := t.TempDir()
+	reportPath := filepath.Join(dir, "report-0.txt")
+	require.NoError(t, os.WriteFile(reportPath, []byte("finding of shard 0\n"), 0644))
+
+	var summaryPaths []string
+	for i, shardReportPath := range []string{reportPath, filepath.Join(dir, "lost", "report-1.txt")} {
+		summaryPath := filepath.Join(dir, filepath.Base(shardReportPath)+".json")
+		require.NoError(t, WriteSummary(summaryPath, &Summary{
+			MetaFilePath: filepath.Join(dir, fmt.Sprintf("meta-%05d-of-00002.out", i)),
+			ItemCount:    1,
+			Findings:     map[string]uint64{ReasonFileNotFound: 1},
+			ReportPath:   shardReportPath,
+		}))
+		summaryPaths = append(summaryPaths, summaryPath)
+	}
+
+	mergedPath := filepath.Join(dir, "merged.txt")
+	merged, err := MergeSummaries(summaryPaths, nil, mergedPath)
+	require.NoError(t, err)
+	require.False(t, merged.Passed)
+	require.Len(t, merged.Problems, 1)
+	require.Contains(t, merged.Problems[0], "the error report of "+summaryPaths[1]+" can not be read")
+
+	data, err := os.ReadFile(mergedPath)
+	require.NoError(t, err)
+	require.Equal(t, "finding of shard 0\n", string(data))
+}
@@ -0,0 +1,180 @@
+package validator
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// TarValidator validates a metadata file against a tar archive without extracting it. The archive is read once to
+// index the metadata of its entries, then the rows of the metadata file are looked up in the index.
+type TarValidator struct {
+	archivePath string
+	reporter    *Reporter
+	entries     map[string]*archiveEntry // indexed by Validate, keyed by the slash separated relative path
+	missing     missingItems             // the source items not in the archive, paired with the extra entries
+}
+
+// archiveEntry is an entry of an archive and whether a row of the metadata file refers to it.
+type archiveEntry struct {
+	path string         // the absolute path of the entry, made by joining the archive path and the entry name
+	meta *metadata.Meta // the metadata of the entry, nil if it is only retrieved when a row refers to it
+	file *zip.File      // the zip entry to retrieve the metadata from, nil for the other archives
+	seen atomic.Bool
+}
+
+// NewTarValidator creates a new TarValidator.
+// Input:
+// - archivePath: the path to the tar archive, which may be compressed with gzip or zstd
+// - reporter: records the findings
+func NewTarValidator(archivePath string, reporter *Reporter) (Validator, error) {
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(archivePath); err != nil {
+		return nil, fmt.Errorf("failed to stat tar archive: %w", err)
+	}
+	return &TarValidator{archivePath: archivePath, reporter: reporter}, nil
+}
+
+// Validate indexes the archive and validates the metadata file against it. The entries of the archive which are not
+// in the metadata file are reported as extra files, or as the moved source items they are paired with, see pairMoves.
+func (tv *TarValidator) Validate(ctx context.Context, filePath string, workerCount int) error {
+	slog.Info("Start to index tar archive:", slog.String("ArchivePath", tv.archivePath))
+	tv.missing = missingItems{}
+	tv.entries = make(map[string]*archiveEntry)
+	err := datasource.WalkTar(ctx, tv.archivePath, func(rel string, meta *metadata.Meta) error {
+		// a later entry of the same name replaces the earlier one
+		tv.entries[rel] = &archiveEntry{path: meta.Common.Path, meta: meta}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Finish to index tar archive:", slog.Int("EntryCount", len(tv.entries)))
+
+	if err = validateRows(ctx, filePath, workerCount, tv); err != nil {
+		return err
+	}
+
+	return recordArchiveDifferences(ctx, tv.entries, &tv.missing, tv.reporter, nil,
+		func(source, target *metadata.Meta) []string { return normaliseForArchive(source).Equals(target) })
+}
+
+// ValidateRow validates one row of the metadata file against the index built by Validate. It is safe for concurrent
+// use.
+func (tv *TarValidator) ValidateRow(_ context.Context, row []byte, srcHeader *datasource.MetaHeader) (counted bool) {
+	item, entry, counted := lookupArchiveEntry(row, srcHeader, tv.entries, &tv.missing, tv.reporter)
+	if entry == nil {
+		return counted
+	}
+
+	reasons := normaliseForArchive(item).Equals(entry.meta)
+	if len(reasons) > 0 {
+		tv.reporter.Record(ReasonMetaMismatch, fmt.Errorf("source: %s, error: %s", string(row), strings.Join(reasons, ",")))
+	}
+	return true
+}
+
+// lookupArchiveEntry deserialises a row and looks up its item in the index of an archive. The entry is marked as seen.
+// Input:
+// - missing: collects the item if it is not in the archive, see recordArchiveDifferences
+// Output:
+// - item: the source metadata of the row
+// - entry: the entry of the item, nil if the row is invalid, which is recorded, or the item is not in the archive
+// - counted: whether the row counts towards the item count of the header
+func lookupArchiveEntry(row []byte, srcHeader *datasource.MetaHeader, entries map[string]*archiveEntry,
+	missing *missingItems, reporter *Reporter) (item *metadata.Meta, entry *archiveEntry, counted bool) {
+	item = &metadata.Meta{}
+	err := json.Unmarshal(row, item)
+	if err != nil {
+		reporter.Record(ReasonInvalidJSON, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return nil, nil, false
+	}
+
+	rel, err := filepath.Rel(srcHeader.SourceDir, item.Common.Path)
+	if err != nil {
+		reporter.Record(ReasonFileNotFound, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return item, nil, true
+	}
+
+	entry, ok := entries[filepath.ToSlash(rel)]
+	if !ok {
+		missing.add(filepath.ToSlash(rel), item)
+		return item, nil, true
+	}
+	entry.seen.Store(true)
+	return item, entry, true
+}
+
+// normaliseForArchive returns a copy of the source metadata without the attributes an archive can not represent: the
+// number of hard links is dropped and the extended attributes are sorted by key.
+func normaliseForArchive(item *metadata.Meta) *metadata.Meta {
+	normalised := *item
+	if item.FileSystem != nil {
+		fsAttrs := *item.FileSystem
+		fsAttrs.Links = 0
+		normalised.FileSystem = &fsAttrs
+	}
+	normalised.ExtendedAttributes = append(metadata.ExtendedAttributes{}, item.ExtendedAttributes...)
+	normalised.ExtendedAttributes.Sort()
+	return &normalised
+}
+
+// recordArchiveDifferences records the source items missing from an archive and the entries which no row of the
+// metadata file refers to, after pairing them by their hash, see recordDifferences.
+// Input:
+// - missing: the source items missing from the archive, see lookupArchiveEntry
+// - retrieve: retrieves the metadata of an entry which is not indexed with it. Only called for the entries of the size
+// of a missing item, the other ones are recorded with their path only. Nil if all the entries are indexed with their
+// metadata
+// - compare: compares a source item with the entry it is moved to
+func recordArchiveDifferences(ctx context.Context, entries map[string]*archiveEntry, missing *missingItems,
+	reporter *Reporter, retrieve func(ctx context.Context, entry *archiveEntry) (*metadata.Meta, error),
+	compare func(source, target *metadata.Meta) []string) error {
+	sizes := missing.algorithms() // the entries of the other sizes can not be paired
+	targets := make(map[string]*metadata.Meta)
+	var unindexed []string
+	for rel, entry := range entries {
+		if entry.seen.Load() {
+			continue
+		}
+		meta := entry.meta
+		if meta == nil && retrieve != nil && entry.file != nil {
+			if _, ok := sizes[entry.file.UncompressedSize64]; ok {
+				var err error
+				if meta, err = retrieve(ctx, entry); err != nil {
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return ctxErr
+					}
+					meta = nil // recorded with its path like the other entries which are not retrieved
+				}
+			}
+		}
+		if meta == nil {
+			unindexed = append(unindexed, rel)
+			continue
+		}
+		targets[rel] = meta
+	}
+
+	if _, err := recordDifferences(reporter, missing.items, targets, "not found in archive", compare); err != nil {
+		return err
+	}
+	sort.Strings(unindexed)
+	for _, rel := range unindexed {
+		reporter.Record(ReasonExtraFile, fmt.Errorf("target: %s, error: not found in source", entries[rel].path))
+	}
+	return nil
+}
@@ -2,8 +2,17 @@ package validator
 
 import (
 	"context"
+	"file-clone-validator/core/datasource"
 )
 
 type Validator interface {
 	Validate(ctx context.Context, filePath string, workerCount int) error
 }
+
+// RowValidator validates the rows of a metadata file one by one. It lets other pipelines, such as the distributed
+// validation, reuse the logic of a Validator without its file reading.
+type RowValidator interface {
+	// ValidateRow validates one serialised metadata.Meta and records the findings. It returns whether the row counts
+	// towards the item count of the header. The context cancels the waits for utils.DefaultLimiter.
+	ValidateRow(ctx context.Context, row []byte, srcHeader *datasource.MetaHeader) (counted bool)
+}
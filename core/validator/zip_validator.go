@@ -0,0 +1,122 @@
+package validator
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// ZipValidator validates a metadata file against a zip archive without extracting it. The entries are looked up in the
+// central directory, and their content is read concurrently by the validator goroutines. Reading an entry also checks
+// its content against the CRC32 stored in the archive.
+type ZipValidator struct {
+	archivePath string
+	reporter    *Reporter
+	entries     map[string]*archiveEntry // indexed by Validate, keyed by the slash separated relative path
+	missing     missingItems             // the source items not in the archive, paired with the extra entries
+}
+
+// NewZipValidator creates a new ZipValidator.
+// Input:
+// - archivePath: the path to the zip archive
+// - reporter: records the findings
+func NewZipValidator(archivePath string, reporter *Reporter) (Validator, error) {
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	r.Close()
+	return &ZipValidator{archivePath: archivePath, reporter: reporter}, nil
+}
+
+// Validate indexes the central directory of the archive and validates the metadata file against it. The entries of
+// the archive which are not in the metadata file are reported as extra files, or as the moved source items they are
+// paired with, see pairMoves.
+func (zv *ZipValidator) Validate(ctx context.Context, filePath string, workerCount int) error {
+	r, err := zip.OpenReader(zv.archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	defer r.Close()
+
+	zv.missing = missingItems{}
+	zv.entries = make(map[string]*archiveEntry, len(r.File))
+	for _, f := range r.File {
+		rel := datasource.ArchiveEntryRelPath(f.Name)
+		if rel == "." {
+			continue
+		}
+		// a later entry of the same name replaces the earlier one
+		zv.entries[rel] = &archiveEntry{path: datasource.ZipEntryPath(zv.archivePath, f.Name), file: f}
+	}
+	slog.Info("Finish to index zip archive:",
+		slog.String("ArchivePath", zv.archivePath),
+		slog.Int("EntryCount", len(zv.entries)),
+	)
+
+	if err = validateRows(ctx, filePath, workerCount, zv); err != nil {
+		return err
+	}
+
+	retrieve := func(ctx context.Context, entry *archiveEntry) (*metadata.Meta, error) {
+		return metadata.RetrieveZipMeta(ctx, entry.path, entry.file)
+	}
+	return recordArchiveDifferences(ctx, zv.entries, &zv.missing, zv.reporter, retrieve,
+		func(source, target *metadata.Meta) []string { return zipExpected(source, target).Equals(target) })
+}
+
+// ValidateRow reads the entry of one row of the metadata file and validates it. The entries which fail their CRC32
+// check are recorded as ReasonZipChecksum, the ones which can not be read at all as ReasonZipCorrupt. It is safe for
+// concurrent use.
+func (zv *ZipValidator) ValidateRow(ctx context.Context, row []byte, srcHeader *datasource.MetaHeader) (counted bool) {
+	item, entry, counted := lookupArchiveEntry(row, srcHeader, zv.entries, &zv.missing, zv.reporter)
+	if entry == nil {
+		return counted
+	}
+
+	targetItem, err := metadata.RetrieveZipMeta(ctx, entry.path, entry.file)
+	switch {
+	case errors.Is(err, zip.ErrChecksum):
+		zv.reporter.Record(ReasonZipChecksum, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return true
+	case err != nil:
+		zv.reporter.Record(ReasonZipCorrupt, fmt.Errorf("source: %s, error: %s", string(row), err.Error()))
+		return true
+	}
+
+	reasons := zipExpected(item, targetItem).Equals(targetItem)
+	if len(reasons) > 0 {
+		zv.reporter.Record(ReasonMetaMismatch, fmt.Errorf("source: %s, error: %s", string(row), strings.Join(reasons, ",")))
+	}
+	return true
+}
+
+// zipExpected returns a copy of the source metadata without the attributes the zip entry does not record, to be
+// compared with the metadata of the entry.
+func zipExpected(item, targetItem *metadata.Meta) *metadata.Meta {
+	expected := normaliseForArchive(item)
+	expected.ExtendedAttributes = nil // zip does not record the extended attributes
+
+	// the attributes the entry does not record are not compared, see metadata.RetrieveZipMeta
+	if len(targetItem.Fields) > 0 {
+		fields := make([]string, 0, len(targetItem.Fields))
+		for _, field := range targetItem.Fields {
+			if expected.Records(field) {
+				fields = append(fields, field)
+			}
+		}
+		expected.Fields = fields
+	}
+	return expected
+}
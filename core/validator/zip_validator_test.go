@@ -0,0 +1,142 @@
+package validator
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/metadata"
+	"github.com/stretchr/testify/require"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestZipValidator(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	source := fstest.MapFS{
+		"ok":    {Data: []byte("ok"), Mode: 0644, ModTime: mtime},
+		"crc":   {Data: []byte("crc"), Mode: 0644, ModTime: mtime},
+		"trunc": {Data: bytes.Repeat([]byte("truncated "), 1000), Mode: 0644, ModTime: mtime},
+		"fat":   {Data: []byte("fat"), Mode: 0640, ModTime: mtime},
+	}
+	metaPath := writeMapFSMeta(t, source)
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	hdr := &zip.FileHeader{Name: "ok", Method: zip.Store, Modified: mtime}
+	hdr.SetMode(0644)
+	w, err := zw.CreateHeader(hdr)
+	require.NoError(t, err)
+	_, err = w.Write(source["ok"].Data)
+	require.NoError(t, err)
+
+	// an MS-DOS entry records neither a Unix mode nor an accurate mtime, they are not compared
+	w, err = zw.CreateHeader(&zip.FileHeader{Name: "fat", Method: zip.Store, ModifiedDate: 0x5821, ModifiedTime: 0x6000})
+	require.NoError(t, err)
+	_, err = w.Write(source["fat"].Data)
+	require.NoError(t, err)
+
+	// the content does not match its CRC32
+	data := source["crc"].Data
+	hdr = &zip.FileHeader{Name: "crc", Method: zip.Store, Modified: mtime, CRC32: crc32.ChecksumIEEE(data) + 1,
+		CompressedSize64: uint64(len(data)), UncompressedSize64: uint64(len(data))}
+	hdr.SetMode(0644)
+	w, err = zw.CreateRaw(hdr)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+
+	// the compressed content ends before the end of the entry
+	data = source["trunc"].Data
+	compressed := &bytes.Buffer{}
+	fw, err := flate.NewWriter(compressed, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = fw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+	truncated := compressed.Bytes()[:compressed.Len()/2]
+	hdr = &zip.FileHeader{Name: "trunc", Method: zip.Deflate, Modified: mtime, CRC32: crc32.ChecksumIEEE(data),
+		CompressedSize64: uint64(len(truncated)), UncompressedSize64: uint64(len(data))}
+	hdr.SetMode(0644)
+	w, err = zw.CreateRaw(hdr)
+	require.NoError(t, err)
+	_, err = w.Write(truncated)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	archivePath := filepath.Join(t.TempDir(), "a.zip")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0644))
+
+	reporter, err := NewReporter("")
+	require.NoError(t, err)
+	v, err := NewZipValidator(archivePath, reporter)
+	require.NoError(t, err)
+	require.NoError(t, v.Validate(context.Background(), metaPath, 2))
+
+	require.Equal(t, map[string]uint64{ReasonZipChecksum: 1, ReasonZipCorrupt: 1}, reporter.Counts())
+}
+
+func TestZipValidatorMoves(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	source := fstest.MapFS{
+		"f":    {Data: []byte("hello\n"), Mode: 0644, ModTime: mtime},
+		"gone": {Data: []byte("gone"), Mode: 0644, ModTime: mtime},
+	}
+	metaPath := writeMapFSMeta(t, source)
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, data := range map[string]string{"renamed": "hello\n", "other": "other content"} {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime}
+		hdr.SetMode(0644)
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	archivePath := filepath.Join(t.TempDir(), "a.zip")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0644))
+
+	reporter, err := NewReporter("")
+	require.NoError(t, err)
+	var moved []string
+	reporter.SetHook(func(entry LogEntry) {
+		if finding := ParseFinding(entry.Reason, entry.ErrorDetail.Error()); finding.Reason == ReasonMoved {
+			moved = append(moved, finding.Item.Common.Path+" "+finding.Error)
+		}
+	})
+	v, err := NewZipValidator(archivePath, reporter)
+	require.NoError(t, err)
+	require.NoError(t, v.Validate(context.Background(), metaPath, 2))
+
+	require.Equal(t, map[string]uint64{ReasonMoved: 1, ReasonFileNotFound: 1, ReasonExtraFile: 1}, reporter.Counts())
+	require.Equal(t, []string{"/src/f moved to renamed"}, moved)
+}
+
+// writeMapFSMeta writes the metadata file of a MapFS whose items are recorded under /src.
+func writeMapFSMeta(t *testing.T, source fstest.MapFS) string {
+	header, err := json.Marshal(datasource.MetaHeader{SourceDir: "/src", ItemCount: uint64(len(source))})
+	require.NoError(t, err)
+	rows := []string{string(header)}
+	for name := range source {
+		info, _err := fs.Stat(source, name)
+		require.NoError(t, _err)
+		meta, _err := metadata.RetrieveFSMeta(source, name, "/src/"+name, info)
+		require.NoError(t, _err)
+		row, _err := metadata.Serialise(meta)
+		require.NoError(t, _err)
+		rows = append(rows, string(row))
+	}
+	metaPath := filepath.Join(t.TempDir(), "meta.out")
+	require.NoError(t, os.WriteFile(metaPath, []byte(strings.Join(rows, "\n")+"\n"), 0644))
+	return metaPath
+}
@@ -0,0 +1,466 @@
+// Package watch keeps the metadata file of a source directory up to date while the source keeps changing. It
+// subscribes to the file system events under the source root (inotify on Linux) and only retrieves the metadata of the
+// touched paths again, so the changes made during the copy window are known without walking the whole source again.
+package watch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/merkle"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/signature"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations of a Change.
+const (
+	OpCreate = "create" // the item is not in the metadata file yet
+	OpUpdate = "update" // the metadata of the item changed
+	OpDelete = "delete" // the item has been removed from the source
+)
+
+// Change is one entry of the delta list.
+type Change struct {
+	// Op is the operation, e.g. OpUpdate.
+	Op string
+
+	// Path is the source path of the item.
+	Path string
+
+	// Time is when the change has been recorded.
+	Time time.Time
+
+	// Item is the new metadata of the item. Nil for OpDelete.
+	Item *metadata.Meta `json:",omitempty"`
+
+	// Reasons are the mismatches between the previous and the new metadata of an updated item.
+	Reasons []string `json:",omitempty"`
+}
+
+// Options configures a Watcher.
+type Options struct {
+	// Settle is how long the touched paths are collected before their metadata is retrieved again, so that a file
+	// being written is only hashed once per interval. 1s if zero.
+	Settle time.Duration
+
+	// Exclude are the paths under the source root which are not watched, e.g. the output directory of the metadata
+	// file. The paths under them are excluded too.
+	Exclude []string
+}
+
+// Watcher keeps the metadata of the items of a source directory in memory and updates it from the file system events.
+type Watcher struct {
+	root    string
+	opts    Options
+	fsw     *fsnotify.Watcher
+	pending map[string]struct{}
+	writeMu sync.Mutex // serialises the writes of the metadata file
+
+	mu      sync.Mutex
+	items   map[string]*metadata.Meta
+	changes uint64
+	dirty   bool
+}
+
+// New creates a Watcher from a metadata file generated from the source directory to watch.
+// Input:
+// - metaPath: the metadata file. The watched directory is the source directory of its header
+// - opts: the options of the watcher
+func New(metaPath string, opts Options) (*Watcher, error) {
+	r, err := datasource.OpenMetaFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if opts.Settle <= 0 {
+		opts.Settle = time.Second
+	}
+	for i, exclude := range opts.Exclude {
+		if opts.Exclude[i], err = filepath.Abs(exclude); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &Watcher{
+		root:    r.Header.SourceDir,
+		opts:    opts,
+		pending: make(map[string]struct{}),
+		items:   make(map[string]*metadata.Meta, r.Header.ItemCount),
+	}
+	for {
+		row, _err := r.Next()
+		if errors.Is(_err, io.EOF) {
+			break
+		}
+		if _err != nil {
+			return nil, fmt.Errorf("failed to read metadata file: %w", _err)
+		}
+
+		item, _err := metadata.Deserialise(row)
+		if _err != nil {
+			return nil, fmt.Errorf("failed to parse metadata row %q: %w", row, _err)
+		}
+		w.items[item.Common.Path] = item
+	}
+	return w, nil
+}
+
+// Root returns the watched source directory.
+func (w *Watcher) Root() string {
+	return w.root
+}
+
+// Changes returns the number of changes recorded since the watcher has been created.
+func (w *Watcher) Changes() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changes
+}
+
+// Watches returns the number of watched directories. 0 if the watcher is not running.
+func (w *Watcher) Watches() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fsw == nil {
+		return 0
+	}
+	return len(w.fsw.WatchList())
+}
+
+// Run watches the source directory until the context is done. The touched paths are collected for Options.Settle,
+// then their metadata is retrieved again and compared with the known one. Every difference is applied to the items
+// in memory and passed to onChange.
+// Note:
+// - The items are not checked against the source when Run starts, the metadata file is expected to be fresh
+// - When the kernel drops events, the whole source is walked again to catch up
+// - The pending paths are processed once more before Run returns
+func (w *Watcher) Run(ctx context.Context, onChange func(change Change)) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file system watcher: %w", err)
+	}
+	defer fsw.Close()
+	w.mu.Lock()
+	w.fsw = fsw
+	w.mu.Unlock()
+
+	slog.Info("Start to watch source directory:", slog.String("SourceDir", w.root), slog.Int("ItemCount", len(w.items)))
+	if err = w.addTree(w.root, false); err != nil {
+		return err
+	}
+	slog.Info("Finish to add watches:", slog.Int("WatchCount", w.Watches()))
+
+	ticker := time.NewTicker(w.opts.Settle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.flush(onChange)
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return errors.New("file system watcher closed")
+			}
+			w.touch(event.Name)
+			if event.Has(fsnotify.Create) {
+				if fi, _err := os.Lstat(event.Name); _err == nil && fi.IsDir() {
+					if _err = w.addTree(event.Name, true); _err != nil {
+						slog.Warn("Failed to watch new directory:", slog.String("Path", event.Name), slog.Any("Error", _err))
+					}
+				}
+			}
+		case _err, ok := <-fsw.Errors:
+			if !ok {
+				return errors.New("file system watcher closed")
+			}
+			if !errors.Is(_err, fsnotify.ErrEventOverflow) {
+				slog.Warn("File system watcher error:", slog.Any("Error", _err))
+				continue
+			}
+
+			slog.Warn("File system events dropped, walk the source directory again:", slog.String("SourceDir", w.root))
+			w.mu.Lock()
+			for path := range w.items {
+				w.pending[path] = struct{}{}
+			}
+			w.mu.Unlock()
+			if _err = w.addTree(w.root, true); _err != nil {
+				return _err
+			}
+		case <-ticker.C:
+			w.flush(onChange)
+		}
+	}
+}
+
+// addTree watches the directory and its sub directories.
+// Input:
+// - dir: the directory to watch
+// - touch: whether the entries under dir are touched too, for the directories created after the watch started
+func (w *Watcher) addTree(dir string, touch bool) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) { // removed in the meantime
+				return nil
+			}
+			return err
+		}
+		if w.excluded(path) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if touch && path != w.root {
+			w.touch(path)
+		}
+		if entry.IsDir() {
+			if err = w.fsw.Add(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to watch directory %s: %w", path, err)
+			}
+		}
+		return nil
+	})
+}
+
+// touch adds the path and its parent directory, whose modification time changes with its entries, to the pending
+// paths.
+func (w *Watcher) touch(path string) {
+	if w.excluded(path) {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[path] = struct{}{}
+	if parent := filepath.Dir(path); parent != w.root && strings.HasPrefix(parent, w.root) {
+		w.pending[parent] = struct{}{}
+	}
+}
+
+// excluded reports whether the path is outside of the source root or under an excluded path.
+func (w *Watcher) excluded(path string) bool {
+	if path != w.root && !strings.HasPrefix(path, w.root+string(filepath.Separator)) {
+		return true
+	}
+	for _, exclude := range w.opts.Exclude {
+		if path == exclude || strings.HasPrefix(path, exclude+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush retrieves the metadata of the pending paths again and applies the changes.
+func (w *Watcher) flush(onChange func(change Change)) {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.pending))
+	for path := range w.pending {
+		paths = append(paths, path)
+	}
+	w.pending = make(map[string]struct{})
+	w.mu.Unlock()
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		for _, change := range w.refresh(path) {
+			if onChange != nil {
+				onChange(change)
+			}
+		}
+	}
+}
+
+// refresh retrieves the metadata of a path again and returns the changes. A removed directory removes all the items
+// under it, the items under any other removed path are removed by their own events.
+func (w *Watcher) refresh(path string) []Change {
+	now := time.Now()
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to stat touched path:", slog.String("Path", path), slog.Any("Error", err))
+			return nil
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		previous, ok := w.items[path]
+		if !ok {
+			return nil
+		}
+		delete(w.items, path)
+		changes := []Change{{Op: OpDelete, Path: path, Time: now}}
+
+		// only a directory has items under it, so that removing a tree does not scan all the items for every file
+		if previous.FileSystem != nil && previous.FileSystem.Type == metadata.FSTypeDir {
+			for itemPath := range w.items {
+				if strings.HasPrefix(itemPath, path+string(filepath.Separator)) {
+					delete(w.items, itemPath)
+					changes = append(changes, Change{Op: OpDelete, Path: itemPath, Time: now})
+				}
+			}
+			sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+		}
+		w.record(len(changes))
+		return changes
+	}
+
+	item, err := metadata.RetrieveFileSystemMeta(path, fi)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) { // removed while it was read, the removal is handled by its own event
+			slog.Warn("Failed to retrieve metadata of touched path:", slog.String("Path", path), slog.Any("Error", err))
+		}
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	change := Change{Op: OpCreate, Path: path, Time: now, Item: item}
+	if previous, ok := w.items[path]; ok {
+		if change.Reasons = previous.Equals(item); len(change.Reasons) == 0 {
+			return nil
+		}
+		change.Op = OpUpdate
+	}
+	w.items[path] = item
+	w.record(1)
+	return []Change{change}
+}
+
+// record counts the changes. The caller must hold the lock.
+func (w *Watcher) record(count int) {
+	if count > 0 {
+		w.changes += uint64(count)
+		w.dirty = true
+	}
+}
+
+// WriteMetaFile writes the current items to a metadata file, sorted by path. The file is written next to filePath and
+// renamed over it once complete, so readers never see a partial file. Nothing is written if the items did not change
+// since the last call, unless force is set.
+// Note:
+// - The items are copied under the lock and written without it, so the events are still handled during the write
+// - The sidecars of the previous file would not match the new one: its detached signature is removed, as it can not
+// be signed again without the private key, and the Merkle tree next to it is built again from the items, without its
+// signature either
+func (w *Watcher) WriteMetaFile(filePath string, force bool) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.mu.Lock()
+	if !w.dirty && !force {
+		w.mu.Unlock()
+		return nil
+	}
+	items := make([]*metadata.Meta, 0, len(w.items))
+	for _, item := range w.items { // the items are replaced on change, never modified, so they can be shared
+		items = append(items, item)
+	}
+	w.dirty = false
+	w.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Common.Path < items[j].Common.Path })
+	if err := w.writeMetaFile(filePath, items); err != nil {
+		w.mu.Lock()
+		w.dirty = true // to write it again on the next call
+		w.mu.Unlock()
+		return err
+	}
+
+	slog.Info("Finish to write metadata file:", slog.String("MetaFilePath", filePath), slog.Int("ItemCount", len(items)))
+	return nil
+}
+
+// writeMetaFile writes the sorted items to the metadata file and updates its sidecars, see WriteMetaFile.
+func (w *Watcher) writeMetaFile(filePath string, items []*metadata.Meta) error {
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	bw := bufio.NewWriter(file)
+	header, err := json.Marshal(&datasource.MetaHeader{SourceDir: w.root, ItemCount: uint64(len(items))})
+	if err != nil {
+		return err
+	}
+	bw.Write(append(header, '\n'))
+	for _, item := range items {
+		row, _err := metadata.Serialise(item)
+		if _err != nil {
+			return _err
+		}
+		bw.Write(append(row, '\n'))
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	// the signature is removed first, so that a signature never covers another content than the one it was made for
+	sigPath := filePath + signature.Suffix
+	if err = os.Remove(sigPath); err == nil {
+		slog.Warn("Remove the signature of the rewritten metadata file:", slog.String("SignaturePath", sigPath))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove the signature of the metadata file: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	return w.writeMerkleFile(filepath.Join(filepath.Dir(filePath), merkle.FileName), items)
+}
+
+// writeMerkleFile builds the Merkle tree of the items again and replaces the Merkle tree file with it. Nothing is
+// written if there is no Merkle tree file.
+func (w *Watcher) writeMerkleFile(merklePath string, items []*metadata.Meta) error {
+	if _, err := os.Lstat(merklePath); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	builder := merkle.NewBuilder(w.root)
+	for _, item := range items {
+		if err := builder.Add(item); err != nil {
+			return fmt.Errorf("failed to add %s to the merkle tree: %w", item.Common.Path, err)
+		}
+	}
+
+	tmpPath := merklePath + ".tmp"
+	defer os.Remove(tmpPath)
+	if err := builder.Build().WriteFile(tmpPath); err != nil {
+		return fmt.Errorf("failed to write the merkle tree: %w", err)
+	}
+	sigPath := merklePath + signature.Suffix
+	if err := os.Remove(sigPath); err == nil {
+		slog.Warn("Remove the signature of the rewritten merkle tree file:", slog.String("SignaturePath", sigPath))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove the signature of the merkle tree file: %w", err)
+	}
+	if err := os.Rename(tmpPath, merklePath); err != nil {
+		return err
+	}
+	slog.Info("Finish to write merkle tree file:", slog.String("MerkleFilePath", merklePath))
+	return nil
+}
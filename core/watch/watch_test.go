@@ -0,0 +1,144 @@
+package watch
+
+import (
+	"context"
+	"file-clone-validator/core/datasource/testutil"
+	"file-clone-validator/core/merkle"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/signature"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatcherRecordsChanges(t *testing.T) {
+	root := t.TempDir()
+	srcDir, outDir := filepath.Join(root, "src"), filepath.Join(root, "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("f"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "g"), []byte("g"), 0644))
+	past := time.Unix(1600000000, 0) // the modification time of the directory changes within the second of the test
+	require.NoError(t, os.Chtimes(filepath.Join(srcDir, "a"), past, past))
+	metaPath := testutil.WriteMetaFile(t, srcDir, outDir)
+
+	w, err := New(metaPath, Options{Settle: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	ops := make(map[string]string)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx, func(change Change) {
+			mu.Lock()
+			defer mu.Unlock()
+			ops[change.Path] = change.Op
+		})
+	}()
+	require.Eventually(t, func() bool { return w.Watches() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("changed"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "a", "g")))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "b", "c"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b", "c", "h"), []byte("h"), 0644))
+
+	expected := map[string]string{
+		filepath.Join(srcDir, "a"):           OpUpdate,
+		filepath.Join(srcDir, "a", "f"):      OpUpdate,
+		filepath.Join(srcDir, "a", "g"):      OpDelete,
+		filepath.Join(srcDir, "b"):           OpCreate,
+		filepath.Join(srcDir, "b", "c"):      OpCreate,
+		filepath.Join(srcDir, "b", "c", "h"): OpCreate,
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for path, op := range expected {
+			if ops[path] != op {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond, "%v", ops)
+	cancel()
+	require.NoError(t, <-done)
+
+	// the updated metadata file matches the source
+	updatedPath := filepath.Join(root, "updated.out")
+	require.NoError(t, w.WriteMetaFile(updatedPath, false))
+	fresh := readItems(t, testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "fresh")))
+	updated := readItems(t, updatedPath)
+	require.Len(t, updated, len(fresh))
+	for path, item := range fresh {
+		require.Contains(t, updated, path)
+		require.Empty(t, item.Equals(updated[path]), path)
+	}
+}
+
+func TestRefreshRemovedPaths(t *testing.T) {
+	root := t.TempDir()
+	srcDir := filepath.Join(root, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "d", "f"), []byte("f"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "d", "g"), []byte("g"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "dg"), []byte("dg"), 0644))
+	w, err := New(testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "out")), Options{})
+	require.NoError(t, err)
+	require.NoError(t, os.RemoveAll(filepath.Join(srcDir, "d")))
+
+	// a removed file only removes itself, a removed directory the items left under it
+	changes := w.refresh(filepath.Join(srcDir, "d", "f"))
+	require.Len(t, changes, 1)
+	require.Equal(t, Change{Op: OpDelete, Path: filepath.Join(srcDir, "d", "f"), Time: changes[0].Time}, changes[0])
+	require.Nil(t, w.refresh(filepath.Join(srcDir, "d", "f")))
+
+	changes = w.refresh(filepath.Join(srcDir, "d"))
+	require.Len(t, changes, 2)
+	require.Equal(t, filepath.Join(srcDir, "d"), changes[0].Path)
+	require.Equal(t, filepath.Join(srcDir, "d", "g"), changes[1].Path)
+	require.Contains(t, w.items, filepath.Join(srcDir, "dg"))
+}
+
+// readItems reads the items of a metadata file by path.
+func readItems(t *testing.T, metaPath string) map[string]*metadata.Meta {
+	w, err := New(metaPath, Options{})
+	require.NoError(t, err)
+	return w.items
+}
+
+func TestWriteMetaFileSidecars(t *testing.T) {
+	root := t.TempDir()
+	srcDir, outDir := filepath.Join(root, "src"), filepath.Join(root, "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("f"), 0644))
+	metaPath := testutil.WriteMetaFile(t, srcDir, outDir)
+	merklePath := filepath.Join(outDir, merkle.FileName)
+	require.NoError(t, os.WriteFile(metaPath+signature.Suffix, []byte("{}\n"), 0644))
+	require.NoError(t, os.WriteFile(merklePath, []byte("{}\n"), 0644))
+	require.NoError(t, os.WriteFile(merklePath+signature.Suffix, []byte("{}\n"), 0644))
+
+	w, err := New(metaPath, Options{})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "f"), []byte("changed"), 0644))
+	require.Len(t, w.refresh(filepath.Join(srcDir, "a", "f")), 1)
+	require.NoError(t, w.WriteMetaFile(metaPath, false))
+
+	// the signature of the previous content is removed and the merkle tree matches the new content
+	require.NoFileExists(t, metaPath+signature.Suffix)
+	require.NoFileExists(t, merklePath+signature.Suffix)
+	tree, err := merkle.ReadFile(merklePath)
+	require.NoError(t, err)
+	builder := merkle.NewBuilder(srcDir)
+	for _, item := range readItems(t, testutil.WriteMetaFile(t, srcDir, filepath.Join(root, "fresh"))) {
+		require.NoError(t, builder.Add(item))
+	}
+	require.Equal(t, builder.Build().RootHash, tree.RootHash)
+
+	// no merkle tree is written next to a metadata file which had none
+	otherPath := filepath.Join(root, "other.out")
+	require.NoError(t, w.WriteMetaFile(otherPath, true))
+	require.NoFileExists(t, filepath.Join(root, merkle.FileName))
+}
@@ -11,6 +11,23 @@ func main() {
 	rootCmd := &cobra.Command{Use: "validator"}
 	rootCmd.AddCommand(cmd.GenerateCmd)
 	rootCmd.AddCommand(cmd.ValidateCmd)
+	rootCmd.AddCommand(cmd.DiffCmd)
+	rootCmd.AddCommand(cmd.CompareCmd)
+	rootCmd.AddCommand(cmd.ShardCmd)
+	rootCmd.AddCommand(cmd.MergeReportsCmd)
+	rootCmd.AddCommand(cmd.CoordinatorCmd)
+	rootCmd.AddCommand(cmd.WorkerCmd)
+	rootCmd.AddCommand(cmd.RepairCmd)
+	rootCmd.AddCommand(cmd.ReportCmd)
+	rootCmd.AddCommand(cmd.WatchCmd)
+	rootCmd.AddCommand(cmd.InspectCmd)
+	rootCmd.AddCommand(cmd.ExportCmd)
+	rootCmd.AddCommand(cmd.MtreeCmd)
+	rootCmd.AddCommand(cmd.ChecksumCmd)
+	rootCmd.AddCommand(cmd.BagitCmd)
+	rootCmd.AddCommand(cmd.KeygenCmd)
+	rootCmd.AddCommand(cmd.SignCmd)
+	rootCmd.AddCommand(cmd.VerifyCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to execute command: %v\n", err)
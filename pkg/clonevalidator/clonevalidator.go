@@ -0,0 +1,38 @@
+// Package clonevalidator is the public API to embed the generate and validate pipelines in other Go programs. It wires
+// the DataSource, MetaWriter, Validator and Reporter of the core packages the same way the command line does, without
+// relying on any command line flag.
+//
+// The process-wide settings such as the I/O throttling (utils.DefaultLimiter), the progress reporting
+// (progress.Configure) and the metrics (metrics.Registry) are shared by all the pipelines of the process and are
+// configured through their own packages.
+package clonevalidator
+
+// Default concurrency used when an option is left to 0.
+const (
+	DefaultScannerCount   = 4
+	DefaultReaderCount    = 1
+	DefaultWriterCount    = 1
+	DefaultValidatorCount = 16
+)
+
+// orDefault returns value, or def if value is not set.
+func orDefault(value, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
+
+// Kind is the kind of the storage a source or a target is read from.
+type Kind string
+
+const (
+	// KindFileSystem is a directory of the local file system. It is the default.
+	KindFileSystem Kind = "fs"
+
+	// KindTar is a tar archive, optionally compressed with gzip or zstd.
+	KindTar Kind = "tar"
+
+	// KindZip is a zip archive.
+	KindZip Kind = "zip"
+)
@@ -0,0 +1,140 @@
+package clonevalidator
+
+import (
+	"context"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/signature"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestGenerateAndValidate(t *testing.T) {
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("b"), 0644))
+
+	var items int
+	generated, err := Generate(context.Background(), GenerateOptions{
+		SourceDir: srcDir,
+		OutputDir: outDir,
+		OnItem:    func(meta *metadata.Meta) { items++ },
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), generated.Header.ItemCount)
+	require.Equal(t, 3, items)
+
+	validated, err := Validate(context.Background(), ValidateOptions{
+		TargetDir:    srcDir,
+		MetaFilePath: generated.MetaFilePath,
+	})
+	require.NoError(t, err)
+	require.True(t, validated.Passed())
+
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "sub", "b.txt")))
+
+	var mu sync.Mutex
+	var findings []Finding
+	validated, err = Validate(context.Background(), ValidateOptions{
+		TargetDir:    srcDir,
+		MetaFilePath: generated.MetaFilePath,
+		OnFinding: func(finding Finding) {
+			mu.Lock()
+			defer mu.Unlock()
+			findings = append(findings, finding)
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, validated.Passed())
+	require.Equal(t, uint64(1), validated.Findings["FileNotFound"])
+
+	var total uint64
+	for _, count := range validated.Findings {
+		total += count
+	}
+	require.Len(t, findings, int(total))
+}
+
+func TestValidateSignedMetadataFile(t *testing.T) {
+	srcDir, outDir, keyDir := t.TempDir(), t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644))
+	publicKeyPath, privateKeyPath := filepath.Join(keyDir, "key.pub"), filepath.Join(keyDir, "key")
+	require.NoError(t, signature.GenerateKey(publicKeyPath, privateKeyPath))
+	privateKey, err := signature.LoadPrivateKey(privateKeyPath)
+	require.NoError(t, err)
+	publicKey, err := signature.LoadPublicKey(publicKeyPath)
+	require.NoError(t, err)
+
+	generated, err := Generate(context.Background(), GenerateOptions{
+		SourceDir:  srcDir,
+		OutputDir:  outDir,
+		SigningKey: privateKey,
+	})
+	require.NoError(t, err)
+
+	opts := ValidateOptions{
+		TargetDir:        srcDir,
+		MetaFilePath:     generated.MetaFilePath,
+		PublicKey:        publicKey,
+		RequireSignature: true,
+	}
+	validated, err := Validate(context.Background(), opts)
+	require.NoError(t, err)
+	require.True(t, validated.SignatureVerified)
+	require.True(t, validated.Passed())
+
+	// a metadata file which no longer matches its signature is not validated
+	data, err := os.ReadFile(generated.MetaFilePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(generated.MetaFilePath, append(data, data[len(data)/2:]...), 0644))
+	_, err = Validate(context.Background(), opts)
+	require.ErrorIs(t, err, signature.ErrInvalidSignature)
+}
+
+func TestValidateSignedMerkleTrees(t *testing.T) {
+	srcDir, outDir, keyDir := t.TempDir(), t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("a"), 0644))
+	publicKeyPath, privateKeyPath := filepath.Join(keyDir, "key.pub"), filepath.Join(keyDir, "key")
+	require.NoError(t, signature.GenerateKey(publicKeyPath, privateKeyPath))
+	privateKey, err := signature.LoadPrivateKey(privateKeyPath)
+	require.NoError(t, err)
+	publicKey, err := signature.LoadPublicKey(publicKeyPath)
+	require.NoError(t, err)
+
+	generated, err := Generate(context.Background(), GenerateOptions{
+		SourceDir:  srcDir,
+		OutputDir:  outDir,
+		SigningKey: privateKey,
+		Merkle:     true,
+	})
+	require.NoError(t, err)
+
+	opts := ValidateOptions{
+		TargetDir:        srcDir,
+		MetaFilePath:     generated.MetaFilePath,
+		PublicKey:        publicKey,
+		RequireSignature: true,
+		SourceMerklePath: generated.MerkleFilePath,
+		TargetMerklePath: generated.MerkleFilePath,
+	}
+	validated, err := Validate(context.Background(), opts)
+	require.NoError(t, err)
+	require.True(t, validated.Passed())
+
+	// a merkle tree file which no longer matches its signature could skip any subtree, so it is not used
+	tamperedPath := filepath.Join(t.TempDir(), "merkle.out")
+	data, err := os.ReadFile(generated.MerkleFilePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(tamperedPath, append(data, '\n'), 0644))
+	sig, err := os.ReadFile(generated.MerkleFilePath + signature.Suffix)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(tamperedPath+signature.Suffix, sig, 0644))
+
+	opts.TargetMerklePath = tamperedPath
+	_, err = Validate(context.Background(), opts)
+	require.ErrorIs(t, err, signature.ErrInvalidSignature)
+}
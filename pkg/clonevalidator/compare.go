@@ -0,0 +1,95 @@
+package clonevalidator
+
+import (
+	"context"
+	"errors"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"time"
+)
+
+// CompareOptions configures a Compare run.
+type CompareOptions struct {
+	// SourceDir is the source directory. Required.
+	SourceDir string
+
+	// TargetDir is the target directory. Required.
+	TargetDir string
+
+	// ScannerCount is the number of scanners listing the directories of each tree. DefaultScannerCount if 0.
+	ScannerCount int
+
+	// ReaderCount is the number of workers retrieving the metadata of each tree, and comparing the content of the files
+	// in the validator.ContentBytes mode. DefaultReaderCount if 0.
+	ReaderCount int
+
+	// Content is validator.ContentHash or validator.ContentBytes. The files are compared by their MD5 hash if empty.
+	Content string
+
+	// ReportPath is the path to write the difference report to. No report is written if empty.
+	ReportPath string
+
+	// ReportFormat is validator.ReportFormatText or validator.ReportFormatJSON. Text if empty.
+	ReportFormat string
+
+	// OnFinding is called with every difference as soon as it is found. Optional.
+	OnFinding func(finding Finding)
+}
+
+// CompareResult is the result of a Compare run.
+type CompareResult struct {
+	validator.CompareResult
+
+	// Findings is the number of differences by reason.
+	Findings map[string]uint64
+
+	// Duration is the time the run took.
+	Duration time.Duration
+}
+
+// Identical reports whether no difference was found.
+func (r *CompareResult) Identical() bool {
+	return len(r.Findings) == 0
+}
+
+// Compare walks the source and the target directories concurrently and compares them directly, without the metadata
+// file a generate and validate run would write and read back. Both trees must be reachable from this host.
+func Compare(ctx context.Context, opts CompareOptions) (*CompareResult, error) {
+	if opts.SourceDir == "" || opts.TargetDir == "" {
+		return nil, errors.New("source and target directory must be specified")
+	}
+	start := time.Now()
+
+	reporter, err := validator.NewReporter(opts.ReportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reporter: %w", err)
+	}
+	defer reporter.Flush()
+
+	if opts.ReportFormat != "" {
+		if err = reporter.SetFormat(opts.ReportFormat); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.OnFinding != nil {
+		reporter.SetHook(func(entry validator.LogEntry) {
+			opts.OnFinding(Finding{Reason: entry.Reason, Detail: entry.ErrorDetail.Error()})
+		})
+	}
+
+	result, err := validator.CompareTrees(ctx, opts.SourceDir, opts.TargetDir, validator.CompareOptions{
+		ScannerCount: orDefault(opts.ScannerCount, DefaultScannerCount),
+		WorkerCount:  orDefault(opts.ReaderCount, DefaultReaderCount),
+		Content:      opts.Content,
+	}, reporter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompareResult{
+		CompareResult: *result,
+		Findings:      reporter.Counts(),
+		Duration:      time.Since(start),
+	}, nil
+}
@@ -0,0 +1,86 @@
+package clonevalidator
+
+import (
+	"context"
+	"errors"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"time"
+)
+
+// DiffOptions configures a Diff run.
+type DiffOptions struct {
+	// SourceMetaPath is the metadata file generated from the source. Required.
+	SourceMetaPath string
+
+	// TargetMetaPath is the metadata file generated from the target. Required.
+	TargetMetaPath string
+
+	// SourceMerklePath and TargetMerklePath are the Merkle tree files generated with the metadata files. If both are
+	// set, the items inside the subtrees which are identical on both sides are not compared. Like the metadata files,
+	// their signatures are not verified. Optional.
+	SourceMerklePath string
+	TargetMerklePath string
+
+	// ReportPath is the path to write the difference report to. No report is written if empty.
+	ReportPath string
+
+	// OnFinding is called with every difference as soon as it is found. Optional.
+	OnFinding func(finding Finding)
+}
+
+// DiffResult is the result of a Diff run.
+type DiffResult struct {
+	validator.DiffResult
+
+	// Findings is the number of differences by reason.
+	Findings map[string]uint64
+
+	// Duration is the time the run took.
+	Duration time.Duration
+}
+
+// Identical reports whether no difference was found.
+func (r *DiffResult) Identical() bool {
+	return len(r.Findings) == 0
+}
+
+// Diff compares the metadata files generated from the source and from the target, without accessing either tree.
+func Diff(ctx context.Context, opts DiffOptions) (*DiffResult, error) {
+	if opts.SourceMetaPath == "" || opts.TargetMetaPath == "" {
+		return nil, errors.New("source and target metadata file path must be specified")
+	}
+	start := time.Now()
+
+	reporter, err := validator.NewReporter(opts.ReportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reporter: %w", err)
+	}
+	defer reporter.Flush()
+
+	if opts.OnFinding != nil {
+		reporter.SetHook(func(entry validator.LogEntry) {
+			opts.OnFinding(Finding{Reason: entry.Reason, Detail: entry.ErrorDetail.Error()})
+		})
+	}
+
+	var skip func(rel string) bool
+	if opts.SourceMerklePath != "" && opts.TargetMerklePath != "" {
+		identical, _err := loadIdenticalSubtrees(opts.SourceMerklePath, opts.TargetMerklePath)
+		if _err != nil {
+			return nil, _err
+		}
+		skip = identical.Contains
+	}
+
+	result, err := validator.DiffManifests(ctx, opts.SourceMetaPath, opts.TargetMetaPath, skip, reporter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiffResult{
+		DiffResult: *result,
+		Findings:   reporter.Counts(),
+		Duration:   time.Since(start),
+	}, nil
+}
@@ -0,0 +1,236 @@
+package clonevalidator
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/merkle"
+	"file-clone-validator/core/metadata"
+	"file-clone-validator/core/signature"
+	"file-clone-validator/core/stream"
+	"file-clone-validator/core/utils"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+// GenerateOptions configures a Generate run.
+type GenerateOptions struct {
+	// SourceDir is the root directory to generate the metadata of, or the archive if SourceKind is an archive kind.
+	// Required.
+	SourceDir string
+
+	// SourceKind is the kind of the source. KindFileSystem if empty.
+	SourceKind Kind
+
+	// OutputDir is the directory to write the metadata file to. Required.
+	OutputDir string
+
+	// ScannerCount is the number of goroutines listing the directories. DefaultScannerCount if 0.
+	ScannerCount int
+
+	// ReaderCount is the number of goroutines retrieving the metadata of the items. DefaultReaderCount if 0.
+	ReaderCount int
+
+	// WriterCount is the number of goroutines writing the metadata. DefaultWriterCount if 0.
+	WriterCount int
+
+	// SigningKey signs the metadata file with a detached signature if it is set. Optional.
+	SigningKey ed25519.PrivateKey
+
+	// Merkle writes the Merkle tree of the source directory next to the metadata file, see merkle.Tree.
+	Merkle bool
+
+	// ManifestListener streams the metadata to the first validator connecting to it with StreamToken as it is
+	// generated, see stream.Accept. Generate waits for the validator before walking the source, and closes the
+	// listener. Optional.
+	ManifestListener net.Listener
+
+	// StreamToken is the shared secret the validator of ManifestListener must present. Any validator is accepted if
+	// it is empty.
+	StreamToken string
+
+	// OnItem is called with the metadata of every item before it is written. It is called from a single goroutine
+	// and must not modify the metadata. Optional.
+	OnItem func(meta *metadata.Meta)
+}
+
+// GenerateResult is the result of a successful Generate run.
+type GenerateResult struct {
+	// MetaFilePath is the absolute path to the generated metadata file.
+	MetaFilePath string
+
+	// Header is the header written to the metadata file.
+	Header datasource.MetaHeader
+
+	// MerkleFilePath is the absolute path to the Merkle tree file. Empty if the Merkle tree is not generated.
+	MerkleFilePath string
+
+	// RootHash is the digest of the source directory. Empty if the Merkle tree is not generated.
+	RootHash string
+
+	// Duration is the time the run took.
+	Duration time.Duration
+}
+
+// Generate walks the source directory and writes the metadata of every item to the metadata file in the output
+// directory.
+func Generate(ctx context.Context, opts GenerateOptions) (*GenerateResult, error) {
+	if opts.SourceDir == "" || opts.OutputDir == "" {
+		return nil, errors.New("source and output directory must be specified")
+	}
+	start := time.Now()
+	if opts.ManifestListener != nil {
+		defer opts.ManifestListener.Close()
+	}
+
+	ds, err := newDataSource(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var writer datasource.MetaWriter
+	if opts.SigningKey != nil {
+		writer, err = datasource.NewSignedMetaWriter(opts.SourceDir, opts.OutputDir, opts.SigningKey)
+	} else {
+		writer, err = datasource.NewMetaWriter(opts.SourceDir, opts.OutputDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create meta writer: %w", err)
+	}
+
+	srcDir, err := filepath.Abs(opts.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	outDir, err := filepath.Abs(opts.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var builder *merkle.Builder
+	if opts.Merkle {
+		builder = merkle.NewBuilder(srcDir)
+	}
+
+	var sender *stream.Sender
+	if opts.ManifestListener != nil {
+		header := datasource.MetaHeader{SourceDir: srcDir}
+		if sender, err = stream.Accept(ctx, opts.ManifestListener, opts.StreamToken, header); err != nil {
+			return nil, fmt.Errorf("failed to serve manifest: %w", err)
+		}
+	}
+
+	metaItemC := make(chan *metadata.Meta, 1)
+	writeItemC := metaItemC
+	g, gCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return ds.Walk(gCtx, opts.OutputDir, metaItemC, orDefault(opts.ReaderCount, DefaultReaderCount))
+	})
+	var streamC chan *metadata.Meta
+	if sender != nil {
+		streamC = make(chan *metadata.Meta, stream.BatchSize)
+		g.Go(func() error { return sender.Send(gCtx, streamC) })
+	}
+	if opts.OnItem != nil || builder != nil || sender != nil {
+		writeItemC = make(chan *metadata.Meta, 1)
+		g.Go(func() error {
+			defer close(writeItemC)
+			if streamC != nil {
+				defer close(streamC)
+			}
+			for meta := range metaItemC {
+				if builder != nil {
+					if _err := builder.Add(meta); _err != nil {
+						return _err
+					}
+				}
+				if opts.OnItem != nil {
+					opts.OnItem(meta)
+				}
+				if streamC != nil {
+					select {
+					case <-gCtx.Done():
+						return gCtx.Err()
+					case streamC <- meta:
+					}
+				}
+
+				select {
+				case <-gCtx.Done():
+					return gCtx.Err()
+				case writeItemC <- meta:
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error { return writer.Write(gCtx, writeItemC, orDefault(opts.WriterCount, DefaultWriterCount)) })
+	err = g.Wait()
+	if sender != nil {
+		if _err := sender.Finish(err); _err != nil && err == nil {
+			return nil, _err
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate metadata: %w", err)
+	}
+
+	metaFilePath := filepath.Join(outDir, utils.GetOutputFileName())
+	header, err := datasource.ReadMetaHeader(metaFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GenerateResult{
+		MetaFilePath: metaFilePath,
+		Header:       *header,
+	}
+
+	if builder != nil {
+		tree := builder.Build()
+		result.MerkleFilePath = filepath.Join(outDir, merkle.FileName)
+		result.RootHash = tree.RootHash
+		if err = tree.WriteFile(result.MerkleFilePath); err != nil {
+			return nil, fmt.Errorf("failed to write merkle tree: %w", err)
+		}
+
+		if opts.SigningKey != nil {
+			if err = signature.SignFile(result.MerkleFilePath, opts.SigningKey); err != nil {
+				return nil, fmt.Errorf("failed to sign merkle tree: %w", err)
+			}
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// newDataSource creates the DataSource of the source kind.
+func newDataSource(opts GenerateOptions) (datasource.DataSource, error) {
+	switch opts.SourceKind {
+	case "", KindFileSystem:
+		ds, err := datasource.NewFileSource(opts.SourceDir, orDefault(opts.ScannerCount, DefaultScannerCount))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file source: %w", err)
+		}
+		return ds, nil
+	case KindTar:
+		ds, err := datasource.NewTarSource(opts.SourceDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tar source: %w", err)
+		}
+		return ds, nil
+	case KindZip:
+		ds, err := datasource.NewZipSource(opts.SourceDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zip source: %w", err)
+		}
+		return ds, nil
+	default:
+		return nil, fmt.Errorf("invalid source kind: %s", opts.SourceKind)
+	}
+}
@@ -0,0 +1,447 @@
+package clonevalidator
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
+	"file-clone-validator/core/checksum"
+	"file-clone-validator/core/datasource"
+	"file-clone-validator/core/merkle"
+	"file-clone-validator/core/mtree"
+	"file-clone-validator/core/signature"
+	"file-clone-validator/core/stream"
+	"file-clone-validator/core/validator"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Finding is one problem found by Validate, e.g. a missing file or a metadata mismatch.
+type Finding struct {
+	// Reason is the category of the finding, e.g. FileNotFound or MetaMismatch.
+	Reason string
+
+	// Detail describes the finding, including the source metadata of the item.
+	Detail string
+}
+
+// Formats of the source of truth of a Validate run.
+const (
+	// MetaFormatJSON is the metadata file written by Generate. It is the default.
+	MetaFormatJSON = "json"
+
+	// MetaFormatMtree is a BSD mtree specification. Only the keywords it records are validated, see mtree.Read.
+	MetaFormatMtree = "mtree"
+
+	// MetaFormatMD5Sum, MetaFormatSHA256Sum and MetaFormatHashdeep are checksum lists. Only the content of the files
+	// they list is validated, see checksum.Read.
+	MetaFormatMD5Sum    = checksum.FormatMD5Sum
+	MetaFormatSHA256Sum = checksum.FormatSHA256Sum
+	MetaFormatHashdeep  = checksum.FormatHashdeep
+)
+
+// ValidateOptions configures a Validate run.
+type ValidateOptions struct {
+	// TargetDir is the root directory to validate, or the archive if TargetKind is an archive kind. Required.
+	TargetDir string
+
+	// TargetKind is the kind of the target. KindFileSystem if empty.
+	TargetKind Kind
+
+	// MetaFilePath is the path to the metadata file generated from the source, or the address of a generate run
+	// streaming it, e.g. tcp://10.0.0.1:7071, see stream.ParseAddress. Required.
+	MetaFilePath string
+
+	// StreamToken is the shared secret of the generate run streaming the metadata file.
+	StreamToken string
+
+	// StreamTLS connects to the generate run streaming the metadata file with TLS if it is set, see
+	// stream.ClientTLSConfig. Optional.
+	StreamTLS *tls.Config
+
+	// MetaFormat is the format of MetaFilePath. MetaFormatJSON if empty.
+	MetaFormat string
+
+	// MetaRoot is the directory the absolute paths of a source of truth in another format than MetaFormatJSON are
+	// under, e.g. the directory hashdeep was run on. The paths of the source of truth are relative to it, and their
+	// relative path is looked up in the target. TargetDir if empty.
+	MetaRoot string
+
+	// ValidatorCount is the number of goroutines validating the items. DefaultValidatorCount if 0.
+	ValidatorCount int
+
+	// ReportPath is the path to write the error report to. No report is written if empty.
+	ReportPath string
+
+	// ReportFormat is the format of the error report, validator.ReportFormatText if empty. The json format can be read
+	// back with validator.ReadFindings, e.g. by the repair.
+	ReportFormat string
+
+	// SummaryPath is the path to write the summary of the run to, see validator.Summary. Not written if empty.
+	SummaryPath string
+
+	// PublicKey verifies the detached signature of the metadata file before the validation if it is set. Optional.
+	PublicKey ed25519.PublicKey
+
+	// RequireSignature makes Validate fail if the metadata file is unsigned or its signature is invalid. Otherwise,
+	// the verification failure is only logged. It has no effect if PublicKey is not set.
+	RequireSignature bool
+
+	// SourceMerklePath and TargetMerklePath are the Merkle tree files generated from the source and from the target.
+	// If both are set, the items inside the subtrees which are identical on both sides are not checked. Their
+	// signatures are verified like the metadata file's if PublicKey is set. Only supported by the file system targets.
+	// Optional.
+	SourceMerklePath string
+	TargetMerklePath string
+
+	// ExtraItems walks a file system target for the items which are not in the metadata file, reported as extra
+	// files or as the moved source items they are paired with, see validator.WithExtraItems. The archive targets
+	// always report them. Not supported with a streamed metadata file.
+	ExtraItems bool
+
+	// OnFinding is called with every finding as soon as it is found. It is called by the validator goroutines
+	// concurrently and must be safe for concurrent use. Optional.
+	OnFinding func(finding Finding)
+}
+
+// ValidateResult is the result of a Validate run.
+type ValidateResult struct {
+	// ItemCount is the number of items in the metadata file.
+	ItemCount uint64
+
+	// SignatureVerified reports whether the signature of the metadata file has been verified.
+	SignatureVerified bool
+
+	// Findings is the number of findings by reason.
+	Findings map[string]uint64
+
+	// Duration is the time the run took.
+	Duration time.Duration
+}
+
+// Passed reports whether the target matches the metadata file.
+func (r *ValidateResult) Passed() bool {
+	return len(r.Findings) == 0
+}
+
+// Validate validates the target directory against the metadata file. The findings do not make Validate fail, they
+// are reported through the result and the OnFinding hook. An error is returned if the validation could not run to the
+// end, e.g. the metadata file is unreadable or truncated.
+func Validate(ctx context.Context, opts ValidateOptions) (*ValidateResult, error) {
+	if opts.TargetDir == "" || opts.MetaFilePath == "" {
+		return nil, errors.New("target directory and metadata file path must be specified")
+	}
+	start := time.Now()
+
+	streamAddr, streamed := stream.ParseAddress(opts.MetaFilePath)
+	if streamed && (opts.PublicKey != nil || (opts.MetaFormat != "" && opts.MetaFormat != MetaFormatJSON)) {
+		return nil, errors.New("a streamed metadata file is in the json format and has no signature")
+	}
+
+	verified, metaPath, cleanup, err := verifySignature(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	reporter, err := validator.NewReporter(opts.ReportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reporter: %w", err)
+	}
+	defer reporter.Flush()
+
+	if opts.ReportFormat != "" {
+		if err = reporter.SetFormat(opts.ReportFormat); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.OnFinding != nil {
+		reporter.SetHook(func(entry validator.LogEntry) {
+			opts.OnFinding(Finding{Reason: entry.Reason, Detail: entry.ErrorDetail.Error()})
+		})
+	}
+
+	v, err := newValidator(opts, reporter)
+	if err != nil {
+		return nil, err
+	}
+
+	var header *datasource.MetaHeader
+	if streamed {
+		header, err = validateStream(ctx, opts, streamAddr, v)
+	} else {
+		header, err = validateFile(ctx, opts, metaPath, v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ValidateResult{
+		ItemCount:         header.ItemCount,
+		SignatureVerified: verified,
+		Findings:          reporter.Counts(),
+		Duration:          time.Since(start),
+	}
+
+	if opts.SummaryPath != "" {
+		if err = writeSummary(opts, header, result); err != nil {
+			return nil, fmt.Errorf("failed to write summary: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// validateFile validates the target against a metadata file.
+// Input:
+// - metaPath: the metadata file, in the format of the options. It is the verified copy of MetaFilePath if it is signed
+func validateFile(ctx context.Context, opts ValidateOptions, metaPath string,
+	v validator.Validator) (*datasource.MetaHeader, error) {
+	metaPath, cleanup, err := metaFile(ctx, opts, metaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	header, err := datasource.ReadMetaHeader(metaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = v.Validate(ctx, metaPath, orDefault(opts.ValidatorCount, DefaultValidatorCount)); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// validateStream validates the target against the metadata streamed by a generate run while it is generated.
+func validateStream(ctx context.Context, opts ValidateOptions, addr string,
+	v validator.Validator) (*datasource.MetaHeader, error) {
+	// the archives are indexed, and the extra items walked, by Validate which a stream does not call
+	rv, ok := v.(validator.RowValidator)
+	if !ok || opts.TargetKind == KindTar || opts.TargetKind == KindZip {
+		return nil, fmt.Errorf("the %s targets can not be validated against a streamed metadata file", opts.TargetKind)
+	}
+	if opts.ExtraItems {
+		return nil, errors.New("the extra items can not be walked with a streamed metadata file")
+	}
+
+	r, err := stream.Dial(ctx, addr, stream.DialOptions{Token: opts.StreamToken, TLS: opts.StreamTLS})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	err = validator.ValidateRows(ctx, opts.MetaFilePath, r, orDefault(opts.ValidatorCount, DefaultValidatorCount), rv)
+	if err != nil {
+		return nil, err
+	}
+	header := r.Header()
+	return &header, nil
+}
+
+// metaFile returns the metadata file to validate against. The sources of truth in other formats are imported to a
+// temporary directory, which cleanup removes, under MetaRoot.
+// Input:
+// - path: the metadata file in the format of the options
+func metaFile(ctx context.Context, opts ValidateOptions, path string) (metaPath string, cleanup func(), err error) {
+	switch opts.MetaFormat {
+	case "", MetaFormatJSON:
+		return path, func() {}, nil
+	case MetaFormatMtree, MetaFormatMD5Sum, MetaFormatSHA256Sum, MetaFormatHashdeep:
+	default:
+		return "", nil, fmt.Errorf("invalid metadata format: %s", opts.MetaFormat)
+	}
+
+	root := opts.MetaRoot
+	if root == "" {
+		root = opts.TargetDir
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", nil, err
+	}
+	tmpDir, err := os.MkdirTemp("", "validate-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+
+	if opts.MetaFormat == MetaFormatMtree {
+		metaPath, err = mtree.Import(ctx, path, root, tmpDir)
+	} else {
+		metaPath, err = checksum.Import(ctx, path, opts.MetaFormat, root, tmpDir)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return metaPath, cleanup, nil
+}
+
+// writeSummary writes the summary of a successful run.
+func writeSummary(opts ValidateOptions, header *datasource.MetaHeader, result *ValidateResult) error {
+	summary := &validator.Summary{
+		SourceDir: header.SourceDir,
+		ItemCount: result.ItemCount,
+		Findings:  result.Findings,
+		Passed:    result.Passed(),
+	}
+
+	var err error
+	summary.MetaFilePath = opts.MetaFilePath
+	if _, streamed := stream.ParseAddress(opts.MetaFilePath); !streamed {
+		if summary.MetaFilePath, err = filepath.Abs(opts.MetaFilePath); err != nil {
+			return err
+		}
+	}
+	if summary.TargetDir, err = filepath.Abs(opts.TargetDir); err != nil {
+		return err
+	}
+	if opts.ReportPath != "" {
+		if summary.ReportPath, err = filepath.Abs(opts.ReportPath); err != nil {
+			return err
+		}
+	}
+	return validator.WriteSummary(opts.SummaryPath, summary)
+}
+
+// verifySignature verifies the signature of the metadata file according to the options. The file is copied to a
+// temporary directory, which cleanup removes, while it is verified, so that the validation reads the verified bytes
+// even if the file is replaced in the meantime.
+// Output:
+// - verified: whether the signature is valid
+// - metaPath: the metadata file to validate, the verified copy if verified is set and MetaFilePath otherwise
+func verifySignature(opts ValidateOptions) (verified bool, metaPath string, cleanup func(), err error) {
+	return verifyFile(opts, opts.MetaFilePath, "metadata file")
+}
+
+// verifyFile verifies the signature of a file generated from the source or the target, e.g. the metadata file or a
+// Merkle tree file, according to the signature policy of the options. See verifySignature.
+// Input:
+// - path: the signed file
+// - what: the kind of the file, for the logs and errors
+func verifyFile(opts ValidateOptions, path, what string) (verified bool, verifiedPath string, cleanup func(),
+	err error) {
+	if opts.PublicKey == nil {
+		return false, path, func() {}, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "verified-*")
+	if err != nil {
+		return false, "", nil, err
+	}
+	verifiedPath = filepath.Join(tmpDir, filepath.Base(path))
+	err = copyVerified(path, verifiedPath, opts)
+	if err == nil {
+		slog.Info(fmt.Sprintf("Success to verify %s signature:", what), slog.String("Path", path))
+		return true, verifiedPath, func() { os.RemoveAll(tmpDir) }, nil
+	}
+	os.RemoveAll(tmpDir)
+
+	if opts.RequireSignature {
+		return false, "", nil, fmt.Errorf("failed to verify %s signature: %w", what, err)
+	}
+
+	slog.Warn(fmt.Sprintf("Failed to verify %s signature, continue anyway:", what),
+		slog.String("Path", path), slog.Any("Error", err))
+	return false, path, func() {}, nil
+}
+
+// copyVerified copies the signed file to dst while its signature is verified, see signature.VerifyCopy.
+func copyVerified(src, dst string, opts ValidateOptions) error {
+	file, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err = signature.VerifyCopy(src, opts.PublicKey, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadVerifiedIdenticalSubtrees verifies the signatures of the Merkle tree files of the options like the metadata
+// file's, since a tampered tree could make the validation skip any subtree, and returns the identical subtrees.
+func loadVerifiedIdenticalSubtrees(opts ValidateOptions) (*merkle.Subtrees, error) {
+	_, srcMerklePath, srcCleanup, err := verifyFile(opts, opts.SourceMerklePath, "source merkle tree")
+	if err != nil {
+		return nil, err
+	}
+	defer srcCleanup()
+
+	_, dstMerklePath, dstCleanup, err := verifyFile(opts, opts.TargetMerklePath, "target merkle tree")
+	if err != nil {
+		return nil, err
+	}
+	defer dstCleanup()
+
+	return loadIdenticalSubtrees(srcMerklePath, dstMerklePath)
+}
+
+// loadIdenticalSubtrees reads two Merkle tree files and returns the subtrees which are identical in both.
+func loadIdenticalSubtrees(srcMerklePath, dstMerklePath string) (*merkle.Subtrees, error) {
+	src, err := merkle.ReadFile(srcMerklePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := merkle.ReadFile(dstMerklePath)
+	if err != nil {
+		return nil, err
+	}
+
+	identical := merkle.IdenticalSubtrees(src, dst)
+	slog.Info("Finish to compare merkle trees:",
+		slog.String("SourceRootHash", src.RootHash),
+		slog.String("TargetRootHash", dst.RootHash),
+		slog.Int("IdenticalSubtrees", identical.Len()),
+	)
+	return identical, nil
+}
+
+// newValidator creates the Validator of the target kind.
+func newValidator(opts ValidateOptions, reporter *validator.Reporter) (validator.Validator, error) {
+	switch opts.TargetKind {
+	case "", KindFileSystem:
+		var validatorOpts []validator.FileValidatorOption
+		if opts.SourceMerklePath != "" && opts.TargetMerklePath != "" {
+			identical, err := loadVerifiedIdenticalSubtrees(opts)
+			if err != nil {
+				return nil, err
+			}
+			validatorOpts = append(validatorOpts, validator.WithSkip(identical.Contains))
+		}
+		if opts.ExtraItems {
+			validatorOpts = append(validatorOpts, validator.WithExtraItems())
+		}
+
+		v, err := validator.NewFileValidator(opts.TargetDir, reporter, validatorOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file validator: %w", err)
+		}
+		return v, nil
+	case KindTar, KindZip:
+		if opts.SourceMerklePath != "" || opts.TargetMerklePath != "" {
+			return nil, fmt.Errorf("merkle trees are not supported by the %s targets", opts.TargetKind)
+		}
+
+		if opts.TargetKind == KindZip {
+			v, err := validator.NewZipValidator(opts.TargetDir, reporter)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create zip validator: %w", err)
+			}
+			return v, nil
+		}
+
+		v, err := validator.NewTarValidator(opts.TargetDir, reporter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tar validator: %w", err)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("invalid target kind: %s", opts.TargetKind)
+	}
+}